@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"github.com/saasuke-labs/nagare/pkg/layout"
+)
+
+var errUnsupportedMediaType = errors.New("request body must be application/json")
+
+// warningsHeader carries the number of fallbacks a successful non-strict render took.
+const warningsHeader = "X-Nagare-Warnings"
+
+// renderRequest is the body accepted by POST /v1/render.
+type renderRequest struct {
+	Source string  `json:"source"`
+	Format string  `json:"format"`
+	Theme  string  `json:"theme"`
+	Scale  float64 `json:"scale"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Step   int     `json:"step"`
+	Steps  bool    `json:"steps"` // One page per step, in formats with pages
+	Strict bool    `json:"strict"`
+	// Roughness applies to the excalidraw format.
+	Roughness int `json:"roughness"`
+}
+
+// options converts the request into pipeline options layered over the server limits.
+func (r renderRequest) options(base diagram.Options) diagram.Options {
+	base.Theme = r.Theme
+	base.Scale = r.Scale
+	base.Width = r.Width
+	base.Height = r.Height
+	base.Step = r.Step
+	base.Steps = r.Steps
+	base.Strict = r.Strict
+	base.Roughness = r.Roughness
+	return base
+}
+
+func (r renderRequest) format() (diagram.OutputFormat, error) {
+	if r.Format == "" {
+		return diagram.FormatSVG, nil
+	}
+	return diagram.ParseFormat(r.Format)
+}
+
+// problem is an RFC 9457 problem document extended with source diagnostics.
+type problem struct {
+	Type        string               `json:"type"`
+	Title       string               `json:"title"`
+	Status      int                  `json:"status"`
+	Detail      string               `json:"detail,omitempty"`
+	Instance    string               `json:"instance,omitempty"`
+	RequestID   string               `json:"requestId,omitempty"`
+	Diagnostics []diagram.Diagnostic `json:"diagnostics"`
+}
+
+func (s *server) handleRenderV1(w http.ResponseWriter, r *http.Request) {
+	var req renderRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeProblem(w, r, "", err)
+		return
+	}
+
+	format, err := req.format()
+	if err != nil {
+		writeProblem(w, r, req.Source, err)
+		return
+	}
+
+	out, err := s.render(r.Context(), req.Source, format, req.options(s.cfg.diagramOptions()))
+	if err != nil {
+		writeProblem(w, r, req.Source, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", out.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(out.Data)))
+	w.Header().Set(warningsHeader, strconv.Itoa(len(out.Warnings)))
+	w.Write(out.Data)
+}
+
+// decodeJSON decodes a size-limited JSON request body into v, rejecting unknown fields.
+func (s *server) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/json" {
+			return errUnsupportedMediaType
+		}
+	}
+
+	body, err := s.readBody(w, r)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", diagram.ErrInvalidOptions, err)
+	}
+	return nil
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, source string, err error) {
+	status := renderErrorStatus(err)
+	doc := problem{
+		Type:        "about:blank",
+		Title:       http.StatusText(status),
+		Status:      status,
+		Detail:      err.Error(),
+		Instance:    r.URL.Path,
+		RequestID:   requestIDFrom(r.Context()),
+		Diagnostics: diagram.Diagnostics(source, err),
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(doc)
+}
+
+// handleSchema serves the JSON Schema describing every component's props.
+func (s *server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(layout.Schema())
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+)
+
+// postRender sends body to POST /v1/render with the given Content-Type.
+func postRender(s *server, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/v1/render", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return serveRequest(s, r)
+}
+
+// decodeProblem checks w holds a problem document with status and returns it.
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder, status int) problem {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("expected %d, got %d: %s", status, w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Fatalf("expected application/problem+json, got %q", got)
+	}
+	var doc problem
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	if doc.Status != status || doc.Title != http.StatusText(status) || doc.Instance != "/v1/render" {
+		t.Fatalf("unexpected problem %+v", doc)
+	}
+	if doc.RequestID == "" || doc.RequestID != w.Header().Get(requestIDHeader) {
+		t.Fatalf("expected the request ID %q in the problem, got %q", w.Header().Get(requestIDHeader), doc.RequestID)
+	}
+	return doc
+}
+
+func TestRenderV1ProblemLocatesErrors(t *testing.T) {
+	s := testServer(nil)
+	for _, tt := range []struct {
+		body    string
+		message string
+		start   diagram.Position
+	}{
+		{
+			body:    `{"source": "api:Server\nvm:VM {"}`,
+			message: "unexpected end of input: missing closing brace",
+			start:   diagram.Position{Offset: 17, Line: 2, Column: 7},
+		},
+		{
+			body:    `{"source": "api:Server@api\n@api(x: 10, w: nope)", "strict": true}`,
+			message: `w of api is ignored: invalid expression "nope": unknown function "nope": use min or max`,
+			start:   diagram.Position{Offset: 27, Line: 2, Column: 13},
+		},
+	} {
+		doc := decodeProblem(t, postRender(s, "application/json", tt.body), http.StatusBadRequest)
+		if len(doc.Diagnostics) != 1 {
+			t.Fatalf("%s: expected one diagnostic, got %+v", tt.body, doc.Diagnostics)
+		}
+		d := doc.Diagnostics[0]
+		if d.Severity != diagram.SeverityError || d.Message != tt.message || d.Span == nil || d.Span.Start != tt.start {
+			t.Errorf("%s: expected %q at %+v, got %+v", tt.body, tt.message, tt.start, d)
+		}
+	}
+}
+
+func TestRenderV1RejectsUnknownFields(t *testing.T) {
+	doc := decodeProblem(t, postRender(testServer(nil), "application/json", `{"source": "api:Server", "colour": "red"}`), http.StatusBadRequest)
+	if !strings.Contains(doc.Detail, `unknown field "colour"`) {
+		t.Fatalf("expected the unknown field named, got %q", doc.Detail)
+	}
+	if len(doc.Diagnostics) != 1 || doc.Diagnostics[0].Span != nil {
+		t.Fatalf("expected one diagnostic without a span, got %+v", doc.Diagnostics)
+	}
+}
+
+func TestRenderV1ChecksMediaType(t *testing.T) {
+	s := testServer(nil)
+	for _, contentType := range []string{"text/plain", "application/x-www-form-urlencoded", "not a media type"} {
+		doc := decodeProblem(t, postRender(s, contentType, `{"source": "api:Server"}`), http.StatusUnsupportedMediaType)
+		if doc.Detail != errUnsupportedMediaType.Error() {
+			t.Errorf("%s: unexpected detail %q", contentType, doc.Detail)
+		}
+	}
+
+	for _, contentType := range []string{"", "application/json; charset=utf-8"} {
+		w := postRender(s, contentType, `{"source": "api:Server"}`)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != diagram.FormatSVG.ContentType() || w.Header().Get(warningsHeader) != "0" {
+			t.Errorf("%q: expected an svg without warnings, got %d %v", contentType, w.Code, w.Header())
+		}
+	}
+}
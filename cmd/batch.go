@@ -0,0 +1,188 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+)
+
+// batchRequest is the body accepted by POST /v1/render/batch. The render options apply
+// to every item.
+type batchRequest struct {
+	Items  []batchRequestItem `json:"items"`
+	Format string             `json:"format"`
+	Theme  string             `json:"theme"`
+	Scale  float64            `json:"scale"`
+	Width  int                `json:"width"`
+	Height int                `json:"height"`
+	Step   int                `json:"step"`
+	Steps  bool               `json:"steps"`
+	Strict bool               `json:"strict"`
+	// Roughness applies to the excalidraw format.
+	Roughness int `json:"roughness"`
+}
+
+type batchRequestItem struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// batchReport lists the outcome of every item in a batch. It is returned by the HTTP
+// endpoint and written by `nagare render -batch -report`.
+type batchReport struct {
+	Format    diagram.OutputFormat `json:"format"`
+	Succeeded int                  `json:"succeeded"`
+	Failed    int                  `json:"failed"`
+	Items     []batchReportItem    `json:"items"`
+}
+
+type batchReportItem struct {
+	Name        string               `json:"name"`
+	OK          bool                 `json:"ok"`
+	Output      string               `json:"output,omitempty"`
+	ContentType string               `json:"contentType,omitempty"`
+	Data        []byte               `json:"data,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Diagnostics []diagram.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+func newBatchReport(format diagram.OutputFormat, results []diagram.BatchResult) batchReport {
+	report := batchReport{Format: format, Items: make([]batchReportItem, 0, len(results))}
+	for _, result := range results {
+		item := batchReportItem{Name: result.Name, OK: result.Err == nil}
+		if result.Err != nil {
+			report.Failed++
+			item.Error = result.Err.Error()
+			item.Diagnostics = diagram.Diagnostics(result.Source, result.Err)
+		} else {
+			report.Succeeded++
+			item.ContentType = result.Output.ContentType
+			item.Diagnostics = result.Output.Warnings
+		}
+		report.Items = append(report.Items, item)
+	}
+	return report
+}
+
+func (s *server) handleRenderBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := s.decodeJSON(w, r, &req); err != nil {
+		writeProblem(w, r, "", err)
+		return
+	}
+
+	single := renderRequest{Format: req.Format, Theme: req.Theme, Scale: req.Scale, Width: req.Width, Height: req.Height, Step: req.Step, Steps: req.Steps, Strict: req.Strict, Roughness: req.Roughness}
+	format, err := single.format()
+	if err != nil {
+		writeProblem(w, r, "", err)
+		return
+	}
+	if len(req.Items) == 0 {
+		writeProblem(w, r, "", fmt.Errorf("%w: batch has no items", diagram.ErrInvalidOptions))
+		return
+	}
+	if s.cfg.MaxBatchItems > 0 && len(req.Items) > s.cfg.MaxBatchItems {
+		writeProblem(w, r, "", fmt.Errorf("%w: %d items exceeds maximum of %d", diagram.ErrLimitExceeded, len(req.Items), s.cfg.MaxBatchItems))
+		return
+	}
+
+	items := make([]diagram.BatchItem, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = diagram.BatchItem{Name: batchItemName(item.Name, i), Source: item.Source}
+	}
+
+	results := diagram.RenderBatch(r.Context(), items, diagram.BatchOptions{
+		Format:  format,
+		Options: single.options(s.cfg.diagramOptions()),
+		Workers: s.cfg.BatchWorkers,
+		Render:  s.render,
+	})
+	report := newBatchReport(format, results)
+
+	if acceptsZip(r) {
+		writeBatchZip(w, format, report, results)
+		return
+	}
+
+	for i, result := range results {
+		if result.Err == nil {
+			report.Items[i].Data = result.Output.Data
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// batchItemName returns a name that is safe to use as a file name inside an archive.
+func batchItemName(name string, index int) string {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "." || name == "/" || name == ".." || name == "" {
+		return fmt.Sprintf("item-%d", index+1)
+	}
+	return strings.TrimSuffix(name, ".nagare")
+}
+
+func acceptsZip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == "application/zip" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBatchZip writes every successful render plus a report.json describing all items.
+func writeBatchZip(w http.ResponseWriter, format diagram.OutputFormat, report batchReport, results []diagram.BatchResult) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	// Items may share a name, or take one a suffix gave another; report.json is the
+	// archive's own.
+	used := map[string]bool{"report.json": true}
+	for i, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		name := result.Name + format.Extension()
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s-%d%s", result.Name, n, format.Extension())
+		}
+		used[name] = true
+		report.Items[i].Output = name
+
+		file, err := archive.Create(name)
+		if err == nil {
+			_, err = file.Write(result.Output.Data)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("write archive: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	file, err := archive.Create("report.json")
+	if err == nil {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("write archive: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="diagrams.zip"`)
+	w.Write(buf.Bytes())
+}
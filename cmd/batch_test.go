@@ -0,0 +1,39 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+)
+
+func TestWriteBatchZipNamesAreUnique(t *testing.T) {
+	var results []diagram.BatchResult
+	for _, name := range []string{"a", "a", "a-2", "report", "a"} {
+		results = append(results, diagram.BatchResult{Name: name, Output: diagram.Output{Data: []byte(name)}})
+	}
+	report := newBatchReport(diagram.FormatJSON, results)
+
+	w := httptest.NewRecorder()
+	writeBatchZip(w, diagram.FormatJSON, report, results)
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"a.json", "a-2.json", "a-2-2.json", "report-2.json", "a-3.json", "report.json"}
+	if len(names) != len(want) {
+		t.Fatalf("expected entries %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("expected entries %v, got %v", want, names)
+		}
+	}
+}
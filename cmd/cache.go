@@ -0,0 +1,72 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"strings"
+	"sync"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+)
+
+// renderCache is a fixed size LRU of rendered outputs keyed by format and source.
+type renderCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type cacheEntry struct {
+	key [sha256.Size]byte
+	out diagram.Output
+}
+
+func newRenderCache(maxEntries int) *renderCache {
+	return &renderCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// renderCacheKey hashes every input that affects the rendered bytes.
+func renderCacheKey(parts ...string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+}
+
+// Get returns the cached output for key. A nil or disabled cache always misses.
+func (c *renderCache) Get(key [sha256.Size]byte) (diagram.Output, bool) {
+	if c == nil || c.maxEntries <= 0 {
+		return diagram.Output{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return diagram.Output{}, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).out, true
+}
+
+// Add stores out under key, evicting the least recently used entry when full.
+func (c *renderCache) Add(key [sha256.Size]byte, out diagram.Output) {
+	if c == nil || c.maxEntries <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).out = out
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, out: out})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"github.com/saasuke-labs/nagare/pkg/docs"
+	"github.com/saasuke-labs/nagare/pkg/layout"
+)
+
+func runDocs(ctx context.Context, args []string) error {
+	var format, out, theme string
+
+	fs := flag.NewFlagSet("docs", flag.ContinueOnError)
+	fs.StringVar(&format, "format", "markdown", "output format: markdown, html or schema")
+	fs.StringVar(&out, "o", "", "output directory for markdown, or file for html and schema (default stdout)")
+	fs.StringVar(&theme, "theme", "", "renderer theme for the samples")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: nagare docs [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	stdout, restore := divertStdout()
+	defer restore()
+
+	switch format {
+	case "schema":
+		return writeOutput(out, stdout, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(layout.Schema())
+		})
+	case "html":
+		entries, err := docs.Reference(ctx, diagram.Options{Theme: theme})
+		if err != nil {
+			return err
+		}
+		return writeOutput(out, stdout, func(w io.Writer) error { return docs.WriteHTML(w, entries) })
+	case "markdown":
+		if out == "" {
+			return fmt.Errorf("markdown needs an output directory for the samples; pass -o")
+		}
+		entries, err := docs.Reference(ctx, diagram.Options{Theme: theme})
+		if err != nil {
+			return err
+		}
+		return writeMarkdownDocs(out, entries)
+	default:
+		return fmt.Errorf("unknown format %q: use markdown, html or schema", format)
+	}
+}
+
+// writeMarkdownDocs writes components.md to dir, with the samples under dir/images.
+func writeMarkdownDocs(dir string, entries []docs.Entry) error {
+	images := filepath.Join(dir, "images")
+	if err := os.MkdirAll(images, 0o755); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.WriteFile(filepath.Join(images, e.SampleFile()), e.Sample, 0o644); err != nil {
+			return err
+		}
+	}
+	return writeOutput(filepath.Join(dir, "components.md"), nil, func(w io.Writer) error {
+		return docs.WriteMarkdown(w, entries, "images")
+	})
+}
+
+// writeOutput writes to path, or to stdout when path is empty.
+func writeOutput(path string, stdout io.Writer, write func(io.Writer) error) error {
+	if path == "" {
+		return write(stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
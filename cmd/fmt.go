@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+)
+
+func runFmt(ctx context.Context, args []string) error {
+	var check, write bool
+
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	fs.BoolVar(&check, "check", false, "list files that are not formatted and exit 1 if there are any")
+	fs.BoolVar(&write, "w", false, "write the result back to each file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: nagare fmt [flags] <file.nagare|dir|->...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one file or directory")
+	}
+
+	stdout, restore := divertStdout()
+	defer restore()
+
+	files, err := diagramFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	var unformatted, failed int
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		changed, ok := formatFile(stdout, file, check, write)
+		if !ok {
+			failed++
+			continue
+		}
+		if changed && check {
+			fmt.Fprintln(stdout, file)
+			unformatted++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be formatted", failed, len(files))
+	}
+	if unformatted > 0 {
+		return fmt.Errorf("%d of %d files are not formatted", unformatted, len(files))
+	}
+	return nil
+}
+
+// diagramFiles expands directories into the .nagare files below them; "-" stands for stdin.
+func diagramFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if arg == "-" || (err == nil && !info.IsDir()) {
+			files = append(files, arg)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(path) == ".nagare" {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// formatFile formats one file and reports whether its content changed. Without -check or
+// -w the result goes to stdout. Errors are printed to stderr and reported as !ok.
+func formatFile(stdout io.Writer, path string, check, write bool) (changed, ok bool) {
+	source, err := readSource(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return false, false
+	}
+	formatted, err := diagram.Format(string(source))
+	if err != nil {
+		for _, d := range diagram.Diagnostics(string(source), err) {
+			fmt.Fprintln(os.Stderr, formatDiagnostic(path, d))
+		}
+		return false, false
+	}
+
+	changed = formatted != string(source)
+	switch {
+	case check:
+	case write && path != "-":
+		if changed {
+			err = os.WriteFile(path, []byte(formatted), 0o644)
+		}
+	default:
+		_, err = io.WriteString(stdout, formatted)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return changed, false
+	}
+	return changed, true
+}
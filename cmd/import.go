@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"github.com/saasuke-labs/nagare/pkg/importer"
+)
+
+// sourceFormat is the -format of nagare import that writes .nagare source.
+const sourceFormat = "nagare"
+
+// importKind is a description nagare import reads.
+type importKind struct {
+	summary string
+	files   string                 // Describes the files a directory argument contributes
+	match   func(name string) bool // Reports whether a file below a directory is read
+	read    func(sources ...importer.Source) (importer.Diagram, error)
+}
+
+var importKinds = map[string]importKind{
+	"k8s":     {summary: "Kubernetes manifests", files: ".yaml or .yml", match: isYAML, read: importer.Kubernetes},
+	"compose": {summary: "Compose files", files: "compose.yaml or docker-compose.yml", match: isComposeFile, read: importer.Compose},
+	"dot":     {summary: "Graphviz DOT graphs", files: ".dot or .gv", match: isDOT, read: importer.DOT},
+}
+
+func isYAML(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func isDOT(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".dot" || ext == ".gv"
+}
+
+// isComposeFile reports whether name is a file Compose reads by default, such as
+// compose.yaml, docker-compose.yml or docker-compose.override.yml.
+func isComposeFile(name string) bool {
+	return isYAML(name) && (strings.HasPrefix(name, "compose.") || strings.HasPrefix(name, "docker-compose."))
+}
+
+func runImport(ctx context.Context, args []string) error {
+	var format, output string
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.StringVar(&format, "format", sourceFormat, fmt.Sprintf("output format: %s, or a render format %v", sourceFormat, diagram.Formats()))
+	fs.StringVar(&output, "o", "", "output file (default stdout)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: nagare import <kind> [flags] <file|dir>...")
+		fmt.Fprintln(fs.Output(), "\nKinds:")
+		for _, name := range importKindNames() {
+			fmt.Fprintf(fs.Output(), "  %-8s %s\n", name, importKinds[name].summary)
+		}
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		fs.Usage()
+		return fmt.Errorf("expected the kind of input to import")
+	}
+	kind, ok := importKinds[args[0]]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown kind %q", args[0])
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one input file or directory")
+	}
+
+	var renderFormat diagram.OutputFormat
+	if format != sourceFormat {
+		f, err := diagram.ParseFormat(format)
+		if err != nil {
+			return err
+		}
+		renderFormat = f
+	}
+
+	stdout, restore := divertStdout()
+	defer restore()
+
+	paths, err := importFiles(fs.Args(), kind)
+	if err != nil {
+		return err
+	}
+	sources := make([]importer.Source, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sources = append(sources, importer.Source{Name: path, Reader: f})
+	}
+
+	d, err := kind.read(sources...)
+	if err != nil {
+		return err
+	}
+	for _, w := range d.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	if renderFormat == "" {
+		return writeOutput(output, stdout, func(w io.Writer) error {
+			_, err := io.WriteString(w, d.Source())
+			return err
+		})
+	}
+	out, err := diagram.Render(ctx, d.Source(), renderFormat, diagram.Options{})
+	if err != nil {
+		return err
+	}
+	return writeOutput(output, stdout, func(w io.Writer) error {
+		_, err := w.Write(out.Data)
+		return err
+	})
+}
+
+// importFiles expands directories in args to the files below them that kind reads, in
+// lexical order. Files named directly are read whatever their name.
+func importFiles(args []string, kind importKind) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		var found []string
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if kind.match(d.Name()) {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no %s files found in %s", kind.files, arg)
+		}
+		paths = append(paths, found...)
+	}
+	return paths, nil
+}
+
+func importKindNames() []string {
+	names := make([]string, 0, len(importKinds))
+	for name := range importKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
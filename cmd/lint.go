@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"github.com/saasuke-labs/nagare/pkg/lint"
+)
+
+// lintResult is one finding in `nagare lint -json` output.
+type lintResult struct {
+	File     string        `json:"file"`
+	Rule     string        `json:"rule"`
+	Severity lint.Severity `json:"severity"`
+	Message  string        `json:"message"`
+	Span     *diagram.Span `json:"span,omitempty"`
+	Fix      *lint.Fix     `json:"fix,omitempty"`
+}
+
+func runLint(ctx context.Context, args []string) error {
+	var (
+		cfg        lint.Config
+		configPath string
+		fix        bool
+		asJSON     bool
+		listRules  bool
+		failOn     = string(lint.SeverityError)
+	)
+
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.StringVar(&configPath, "config", "", "JSON file with rule severities, e.g. {\"rules\": {\"unused-state\": \"error\"}}")
+	fs.Func("rule", "override a rule severity as id=off|info|warning|error (repeatable)", func(value string) error {
+		id, severity, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("expected id=severity, got %q", value)
+		}
+		return cfg.Set(id, lint.Severity(severity))
+	})
+	fs.BoolVar(&fix, "fix", false, "apply autofixes and write the files back")
+	fs.BoolVar(&asJSON, "json", false, "print findings as JSON")
+	fs.BoolVar(&listRules, "rules", false, "list the rules and their default severities")
+	fs.StringVar(&failOn, "fail-on", failOn, "exit 1 when a finding is at least this severe")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: nagare lint [flags] <file.nagare|dir|->...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if listRules {
+		for _, rule := range lint.Rules() {
+			fixable := ""
+			if rule.Fixable {
+				fixable = " (fixable)"
+			}
+			fmt.Printf("%-22s %-8s %s%s\n", rule.ID, rule.Severity, rule.Summary, fixable)
+		}
+		return nil
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one file or directory")
+	}
+
+	threshold, err := lint.ParseSeverity(failOn)
+	if err != nil {
+		return err
+	}
+	if configPath != "" {
+		fileCfg, err := lint.LoadConfig(configPath)
+		if err != nil {
+			return err
+		}
+		// Flags take precedence over the config file; both are already validated.
+		for id, severity := range cfg.Rules {
+			fileCfg.Set(id, severity)
+		}
+		cfg = fileCfg
+	}
+
+	stdout, restore := divertStdout()
+	defer restore()
+
+	files, err := diagramFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if fix && file == "-" {
+			return fmt.Errorf("-fix cannot rewrite stdin; use nagare lint -fix with files")
+		}
+	}
+
+	results := []lintResult{}
+	failed, failing := 0, 0
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		found, err := lintFile(file, cfg, fix)
+		if err != nil {
+			failed++
+			continue
+		}
+		for _, result := range found {
+			if result.Severity.AtLeast(threshold) {
+				failing++
+			}
+			if !asJSON {
+				d := diagram.Diagnostic{Severity: diagram.Severity(result.Severity), Message: fmt.Sprintf("%s (%s)", result.Message, result.Rule), Span: result.Span}
+				fmt.Fprintln(stdout, formatDiagnostic(result.File, d))
+			}
+		}
+		results = append(results, found...)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be linted", failed, len(files))
+	}
+	if failing > 0 {
+		return fmt.Errorf("%d findings at %s or above", failing, threshold)
+	}
+	return nil
+}
+
+// lintFile lints one file, applying fixes first when fix is set. Files that do not parse
+// are reported on stderr and returned as an error.
+func lintFile(path string, cfg lint.Config, fix bool) ([]lintResult, error) {
+	data, err := readSource(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return nil, err
+	}
+	source := string(data)
+
+	if fix {
+		// A source that does not parse has nothing to fix; Lint reports why below.
+		if fixed, applied, err := lint.Autofix(source, cfg); err == nil && applied > 0 {
+			if err := os.WriteFile(path, []byte(fixed), 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+				return nil, err
+			}
+			fmt.Fprintf(os.Stderr, "%s: applied %d fixes\n", path, applied)
+			source = fixed
+		}
+	}
+
+	findings, err := lint.Lint(source, cfg)
+	if err != nil {
+		for _, d := range diagram.Diagnostics(source, err) {
+			fmt.Fprintln(os.Stderr, formatDiagnostic(path, d))
+		}
+		return nil, err
+	}
+
+	results := make([]lintResult, 0, len(findings))
+	for _, finding := range findings {
+		results = append(results, lintResult{
+			File:     path,
+			Rule:     finding.Rule,
+			Severity: finding.Severity,
+			Message:  finding.Message,
+			Span:     diagram.NewSpan(source, finding.Span),
+			Fix:      finding.Fix,
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/saasuke-labs/nagare/pkg/lsp"
+)
+
+func runLSP(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Stdout carries the protocol.
+	stdout, restore := divertStdout()
+	defer restore()
+
+	return lsp.NewServer(stdout).Serve(ctx, os.Stdin)
+}
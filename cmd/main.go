@@ -1,87 +1,99 @@
 package main
 
 import (
-	"io"
-	"log"
-	"net/http"
-
-	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
 )
 
-func main() {
-	http.HandleFunc("POST /render", handleRender)
-	http.HandleFunc("POST /render-webp", handleRenderWebP)
-	http.HandleFunc("GET /test", handleTest)
-	log.Printf("Server starting on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// command is a nagare subcommand. run receives the arguments after the command name.
+type command struct {
+	summary string
+	run     func(ctx context.Context, args []string) error
 }
 
-func handleTest(w http.ResponseWriter, r *http.Request) {
-
-	code := `
-@layout(w:950,h:400)
-
-browser:Browser@home
-vps:VM@ubuntu {
-nginx:Server@nginx
-app:Server@app
+var commands = map[string]command{
+	"serve":  {summary: "run the HTTP render server (default)", run: runServe},
+	"render": {summary: "render diagrams to files", run: runRender},
+	"fmt":    {summary: "format diagrams in canonical form", run: runFmt},
+	"lint":   {summary: "check diagrams for common mistakes", run: runLint},
+	"lsp":    {summary: "run the language server on stdio", run: runLSP},
+	"docs":   {summary: "generate the component reference", run: runDocs},
+	"import": {summary: "build a diagram from other descriptions of a system", run: runImport},
 }
 
-browser.e --> nginx.w
-nginx.e --> app.w
-
-@browser(x:50,y:100,w:200,h:150)
-@home(url: "https://www.nagare.com", bg: "#e6f3ff", fg: "#333", text: "Home Page")
-
-@vps(x:300,y:&browser.c,w:600,h:300)
-@ubuntu(title: "home@ubuntu", bg: "#333", fg: "#ccc", text: "Ubuntu")
+func main() {
+	// Without a subcommand nagare runs the server, so `nagare -addr :9000` keeps working.
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-@nginx(x:50,y:&browser.c,w:200,h:50, title: "nginx", icon: "nginx", port: 80, bg: "#e6f3ff", fg: "#333")
-@app(x:350,y:&browser.c,w:200,h:50, title: "App", icon: "golang", port: 8080, bg: "#f0f8ff", fg: "#333")
-`
-	html, err := diagram.CreateDiagram(code)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if name == "help" {
+		usage()
 		return
 	}
 
-	// Send response
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
-}
-
-func handleRender(w http.ResponseWriter, r *http.Request) {
-	// Read the input
-	code, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "nagare: unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
 	}
 
-	html, err := diagram.CreateDiagram(string(code))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	if err := cmd.run(context.Background(), args); err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "nagare %s: %v\n", name, err)
+		os.Exit(1)
 	}
+}
 
-	// Send response
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
+// divertStdout points os.Stdout at stderr until restore is called, so the debug traces
+// the pipeline still prints stay off a command's output. It returns the real stdout for
+// the output itself.
+func divertStdout() (stdout *os.File, restore func()) {
+	stdout = os.Stdout
+	os.Stdout = os.Stderr
+	return stdout, func() { os.Stdout = stdout }
 }
 
-func handleRenderWebP(w http.ResponseWriter, r *http.Request) {
-	code, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	data, err := diagram.CreateDiagramWebP(string(code))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	fmt.Fprintln(os.Stderr, "Usage: nagare <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'nagare <command> -h' for command flags.")
+}
+
+func runServe(ctx context.Context, args []string) error {
+	cfg := defaultServerConfig()
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	cfg.registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
 	}
 
-	w.Header().Set("Content-Type", "image/webp")
-	w.Write(data)
+	// Drain in-flight renders on SIGINT/SIGTERM. Other commands keep the default handling,
+	// so a signal stops them at once. A second signal stops the server the same way.
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return serve(ctx, cfg)
 }
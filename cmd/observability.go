@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"github.com/saasuke-labs/nagare/pkg/metrics"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// serverMetrics groups the Prometheus series exported on /metrics.
+type serverMetrics struct {
+	registry      *metrics.Registry
+	renders       *metrics.CounterVec
+	stageLatency  *metrics.HistogramVec
+	cacheRequests *metrics.CounterVec
+	rasterJobs    *metrics.Gauge
+	httpRequests  *metrics.CounterVec
+}
+
+func newServerMetrics() *serverMetrics {
+	registry := metrics.NewRegistry()
+	return &serverMetrics{
+		registry:      registry,
+		renders:       registry.NewCounterVec("nagare_renders_total", "Diagram renders by output format and outcome.", "format", "outcome"),
+		stageLatency:  registry.NewHistogramVec("nagare_render_stage_duration_seconds", "Latency of each render pipeline stage.", nil, "stage"),
+		cacheRequests: registry.NewCounterVec("nagare_render_cache_requests_total", "Render cache lookups by result (hit or miss).", "result"),
+		rasterJobs:    registry.NewGauge("nagare_raster_jobs_in_flight", "Raster renders currently holding a slot."),
+		httpRequests:  registry.NewCounterVec("nagare_http_requests_total", "HTTP requests by route and status code.", "route", "code"),
+	}
+}
+
+func (m *serverMetrics) observeStage(stage diagram.Stage, elapsed time.Duration) {
+	m.stageLatency.WithLabelValues(string(stage)).Observe(elapsed.Seconds())
+}
+
+func (m *serverMetrics) recordRender(format string, err error) {
+	m.renders.WithLabelValues(format, renderOutcome(err)).Inc()
+}
+
+func (m *serverMetrics) recordCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheRequests.WithLabelValues(result).Inc()
+}
+
+// renderOutcome buckets errors into a small, fixed set of label values.
+func renderOutcome(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	switch renderErrorStatus(err) {
+	case http.StatusRequestEntityTooLarge:
+		return "limit"
+	case http.StatusGatewayTimeout:
+		return "timeout"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	default:
+		return "error"
+	}
+}
+
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports ready until shutdown begins so load balancers stop routing to us
+// while in-flight requests drain.
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !s.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("shutting down\n"))
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+type requestIDKey struct{}
+
+// requestIDFrom returns the request ID stored in ctx by the access log middleware.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// withAccessLog assigns every request an ID (reusing an incoming X-Request-ID), echoes
+// it in the response and writes one structured log line per request.
+func (s *server) withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		s.metrics.httpRequests.WithLabelValues(route, strconv.Itoa(rec.status)).Inc()
+
+		s.logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
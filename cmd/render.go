@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+)
+
+// renderFlags holds the flags shared by single and batch CLI renders.
+type renderFlags struct {
+	format string
+	theme  string
+	scale  float64
+	width  int
+	height int
+	step   int
+	steps  bool
+	strict bool
+	rough  int
+	// imports is the directory @import reads from; empty uses the directory of the
+	// diagram, or the batch directory.
+	imports string
+}
+
+func (f *renderFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.format, "format", string(diagram.FormatSVG), fmt.Sprintf("output format %v", diagram.Formats()))
+	fs.StringVar(&f.theme, "theme", "", "renderer theme (light, dark)")
+	fs.Float64Var(&f.scale, "scale", 0, "output size multiplier")
+	fs.IntVar(&f.width, "width", 0, "canvas width override")
+	fs.IntVar(&f.height, "height", 0, "canvas height override")
+	fs.IntVar(&f.step, "step", 0, "render the diagram as of step N (0 renders everything)")
+	fs.BoolVar(&f.steps, "steps", false, "render each step up to -step as a page of its own (pdf)")
+	fs.BoolVar(&f.strict, "strict", false, "fail on anything the pipeline would otherwise ignore or draw as a fallback")
+	fs.IntVar(&f.rough, "roughness", 0, "how hand-drawn the excalidraw format looks, 0 (clean) to 2")
+	fs.StringVar(&f.imports, "imports", "", "directory @import may read files from (default the diagram's directory, or the batch directory)")
+}
+
+func (f renderFlags) options() diagram.Options {
+	return diagram.Options{Theme: f.theme, Scale: f.scale, Width: f.width, Height: f.height, Step: f.step, Steps: f.steps, Strict: f.strict, Roughness: f.rough}
+}
+
+// importRoot returns the directory @import reads from when the diagrams live in dir.
+func (f renderFlags) importRoot(dir string) string {
+	if f.imports != "" {
+		return f.imports
+	}
+	return dir
+}
+
+// importPath returns the location of file below root as @import resolves it.
+func importPath(root, file string) string {
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func runRender(ctx context.Context, args []string) error {
+	var (
+		flags      renderFlags
+		output     string
+		batchDir   string
+		outDir     string
+		jobs       int
+		reportPath string
+	)
+
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	flags.register(fs)
+	fs.StringVar(&output, "o", "", "output file for a single render (default stdout)")
+	fs.StringVar(&batchDir, "batch", "", "render every .nagare file below this directory")
+	fs.StringVar(&outDir, "out-dir", "", "batch output directory (default next to each source)")
+	fs.IntVar(&jobs, "jobs", 0, "concurrent batch renders (default GOMAXPROCS)")
+	fs.StringVar(&reportPath, "report", "", "write a JSON batch report to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: nagare render [flags] <file.nagare|->")
+		fmt.Fprintln(fs.Output(), "       nagare render -batch <dir> [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := diagram.ParseFormat(flags.format)
+	if err != nil {
+		return err
+	}
+
+	stdout, restore := divertStdout()
+	defer restore()
+
+	opts := flags.options()
+	if batchDir != "" {
+		root := flags.importRoot(batchDir)
+		opts.Imports = os.DirFS(root)
+		return renderBatchDir(ctx, stdout, batchDir, outDir, reportPath, jobs, format, opts, root)
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one input file")
+	}
+	input := fs.Arg(0)
+	if input == "-" {
+		opts.Imports = os.DirFS(flags.importRoot("."))
+	} else {
+		root := flags.importRoot(filepath.Dir(input))
+		opts.Imports = os.DirFS(root)
+		opts.Path = importPath(root, input)
+	}
+	return renderFile(ctx, stdout, input, output, format, opts)
+}
+
+func renderFile(ctx context.Context, stdout io.Writer, input, output string, format diagram.OutputFormat, opts diagram.Options) error {
+	source, err := readSource(input)
+	if err != nil {
+		return err
+	}
+
+	out, err := diagram.Render(ctx, string(source), format, opts)
+	if err != nil {
+		for _, d := range diagram.Diagnostics(string(source), err) {
+			fmt.Fprintln(os.Stderr, formatDiagnostic(input, d))
+		}
+		return fmt.Errorf("render %s failed", input)
+	}
+	for _, d := range out.Warnings {
+		fmt.Fprintln(os.Stderr, formatDiagnostic(input, d))
+	}
+
+	if output == "" || output == "-" {
+		_, err = stdout.Write(out.Data)
+		return err
+	}
+	return os.WriteFile(output, out.Data, 0o644)
+}
+
+// readSource reads a diagram from a file, or from stdin when path is "-".
+func readSource(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// formatDiagnostic renders a diagnostic in the conventional file:line:col: form.
+func formatDiagnostic(file string, d diagram.Diagnostic) string {
+	if d.Span == nil {
+		return fmt.Sprintf("%s: %s: %s", file, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", file, d.Span.Start.Line, d.Span.Start.Column, d.Severity, d.Message)
+}
+
+// renderBatchDir renders every .nagare file below dir. Failures are reported per file and
+// do not stop the rest of the batch; the command exits non-zero if any file failed.
+func renderBatchDir(ctx context.Context, stdout io.Writer, dir, outDir, reportPath string, jobs int, format diagram.OutputFormat, opts diagram.Options, importRoot string) error {
+	var items []diagram.BatchItem
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".nagare" {
+			return nil
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		items = append(items, diagram.BatchItem{Name: path, Source: string(source), Path: importPath(importRoot, path)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("no .nagare files found in %s", dir)
+	}
+
+	results := diagram.RenderBatch(ctx, items, diagram.BatchOptions{Format: format, Options: opts, Workers: jobs})
+	report := newBatchReport(format, results)
+
+	for i, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL %s\n", result.Name)
+			for _, d := range report.Items[i].Diagnostics {
+				fmt.Fprintf(os.Stderr, "     %s\n", formatDiagnostic(result.Name, d))
+			}
+			continue
+		}
+
+		target := batchOutputPath(dir, outDir, result.Name, format)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err == nil {
+			err = os.WriteFile(target, result.Output.Data, 0o644)
+		}
+		if err != nil {
+			report.Items[i].OK = false
+			report.Items[i].Error = err.Error()
+			report.Succeeded--
+			report.Failed++
+			fmt.Fprintf(os.Stderr, "FAIL %s: %v\n", result.Name, err)
+			continue
+		}
+		report.Items[i].Output = target
+		fmt.Fprintf(stdout, "ok   %s -> %s\n", result.Name, target)
+		for _, d := range report.Items[i].Diagnostics {
+			fmt.Fprintf(os.Stderr, "     %s\n", formatDiagnostic(result.Name, d))
+		}
+	}
+
+	fmt.Fprintf(stdout, "%d rendered, %d failed\n", report.Succeeded, report.Failed)
+
+	if reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(reportPath, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d diagrams failed", report.Failed, len(results))
+	}
+	return nil
+}
+
+// batchOutputPath mirrors source's position below dir into outDir, swapping the extension.
+func batchOutputPath(dir, outDir, source string, format diagram.OutputFormat) string {
+	target := strings.TrimSuffix(source, filepath.Ext(source)) + format.Extension()
+	if outDir == "" {
+		return target
+	}
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		rel = filepath.Base(target)
+	}
+	return filepath.Join(outDir, rel)
+}
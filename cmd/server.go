@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/playground"
+)
+
+// serverConfig holds the tunables for the HTTP render server. Every field can be set
+// with a command line flag or the matching NAGARE_* environment variable.
+type serverConfig struct {
+	Addr               string
+	MaxBodyBytes       int64
+	MaxCanvasPixels    int
+	MaxNodes           int
+	MaxRasterJobs      int
+	CacheEntries       int
+	MaxBatchItems      int
+	BatchWorkers       int
+	PlaygroundSessions int
+	ImportDir          string
+	RenderTimeout      time.Duration
+	ReadTimeout        time.Duration
+	WriteTimeout       time.Duration
+	IdleTimeout        time.Duration
+	ShutdownTimeout    time.Duration
+}
+
+func defaultServerConfig() serverConfig {
+	return serverConfig{
+		Addr:               envString("NAGARE_ADDR", ":8080"),
+		MaxBodyBytes:       int64(envInt("NAGARE_MAX_BODY_BYTES", 1<<20)),
+		MaxCanvasPixels:    envInt("NAGARE_MAX_CANVAS_PIXELS", 4096*4096),
+		MaxNodes:           envInt("NAGARE_MAX_NODES", 500),
+		MaxRasterJobs:      envInt("NAGARE_MAX_RASTER_JOBS", 4),
+		CacheEntries:       envInt("NAGARE_CACHE_ENTRIES", 256),
+		MaxBatchItems:      envInt("NAGARE_MAX_BATCH_ITEMS", 500),
+		BatchWorkers:       envInt("NAGARE_BATCH_WORKERS", 0),
+		PlaygroundSessions: envInt("NAGARE_PLAYGROUND_SESSIONS", 64),
+		ImportDir:          envString("NAGARE_IMPORT_DIR", ""),
+		RenderTimeout:      envDuration("NAGARE_RENDER_TIMEOUT", 10*time.Second),
+		ReadTimeout:        envDuration("NAGARE_READ_TIMEOUT", 10*time.Second),
+		WriteTimeout:       envDuration("NAGARE_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:        envDuration("NAGARE_IDLE_TIMEOUT", 60*time.Second),
+		ShutdownTimeout:    envDuration("NAGARE_SHUTDOWN_TIMEOUT", 15*time.Second),
+	}
+}
+
+func (c *serverConfig) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "address to listen on")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body-bytes", c.MaxBodyBytes, "maximum request body size in bytes")
+	fs.IntVar(&c.MaxCanvasPixels, "max-canvas-pixels", c.MaxCanvasPixels, "maximum canvas width*height (0 disables the check)")
+	fs.IntVar(&c.MaxNodes, "max-nodes", c.MaxNodes, "maximum number of nodes per diagram (0 disables the check)")
+	fs.IntVar(&c.MaxRasterJobs, "max-raster-jobs", c.MaxRasterJobs, "maximum number of concurrent raster renders")
+	fs.IntVar(&c.CacheEntries, "cache-entries", c.CacheEntries, "number of rendered outputs kept in memory (0 disables the cache)")
+	fs.IntVar(&c.MaxBatchItems, "max-batch-items", c.MaxBatchItems, "maximum number of diagrams per batch request (0 disables the check)")
+	fs.IntVar(&c.BatchWorkers, "batch-workers", c.BatchWorkers, "concurrent renders per batch request (0 uses GOMAXPROCS)")
+	fs.IntVar(&c.PlaygroundSessions, "playground-sessions", c.PlaygroundSessions, "maximum concurrent playground previews (0 disables the playground)")
+	fs.StringVar(&c.ImportDir, "import-dir", c.ImportDir, "directory diagrams may @import files from (empty disables imports)")
+	fs.DurationVar(&c.RenderTimeout, "render-timeout", c.RenderTimeout, "maximum time spent rendering a single request")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "maximum duration for reading a request")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "maximum duration before timing out writes of a response")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "maximum keep-alive idle time")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "grace period for in-flight requests on shutdown")
+}
+
+func (c serverConfig) diagramOptions() diagram.Options {
+	opts := diagram.Options{
+		Limits: diagram.Limits{
+			MaxCanvasPixels: c.MaxCanvasPixels,
+			MaxNodes:        c.MaxNodes,
+		},
+	}
+	if c.ImportDir != "" {
+		// os.DirFS keeps imports inside the directory.
+		opts.Imports = os.DirFS(c.ImportDir)
+	}
+	return opts
+}
+
+type server struct {
+	cfg         serverConfig
+	rasterSlots chan struct{}
+	cache       *renderCache
+	metrics     *serverMetrics
+	playground  *playground.Playground
+	logger      *slog.Logger
+	ready       atomic.Bool
+}
+
+func newServer(cfg serverConfig, logger *slog.Logger) *server {
+	slots := cfg.MaxRasterJobs
+	if slots <= 0 {
+		slots = 1
+	}
+	s := &server{
+		cfg:         cfg,
+		rasterSlots: make(chan struct{}, slots),
+		cache:       newRenderCache(cfg.CacheEntries),
+		metrics:     newServerMetrics(),
+		logger:      logger,
+	}
+	if cfg.PlaygroundSessions > 0 {
+		s.playground = playground.New(playground.Config{
+			Render:       s.render,
+			Options:      cfg.diagramOptions(),
+			MaxBodyBytes: cfg.MaxBodyBytes,
+			MaxSessions:  cfg.PlaygroundSessions,
+		})
+	}
+	s.ready.Store(true)
+	return s
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /render", s.handleRender)
+	mux.HandleFunc("POST /render-webp", s.handleRenderWebP)
+	mux.HandleFunc("POST /v1/render", s.handleRenderV1)
+	mux.HandleFunc("POST /v1/render/batch", s.handleRenderBatch)
+	mux.HandleFunc("GET /v1/schema", s.handleSchema)
+	mux.HandleFunc("GET /test", s.handleTest)
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	mux.Handle("GET /metrics", s.metrics.registry.Handler())
+	if s.playground != nil {
+		mux.Handle(playground.Prefix, s.playground)
+		mux.Handle("GET /{$}", http.RedirectHandler(playground.Prefix, http.StatusFound))
+	}
+	return s.withAccessLog(mux)
+}
+
+// serve runs the HTTP server until ctx is cancelled, then drains in-flight requests.
+func serve(ctx context.Context, cfg serverConfig) error {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	logger.Info("server starting", slog.String("addr", listener.Addr().String()))
+	return newServer(cfg, logger).run(ctx, listener)
+}
+
+// run serves requests on listener until ctx is cancelled. It then reports not ready, ends
+// the playground's preview streams and waits up to ShutdownTimeout for in-flight
+// requests to finish.
+func (s *server) run(ctx context.Context, listener net.Listener) error {
+	cfg := s.cfg
+	srv := &http.Server{
+		Handler:           s.routes(),
+		ErrorLog:          slog.NewLogLogger(s.logger.Handler(), slog.LevelError),
+		ReadHeaderTimeout: cfg.ReadTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if s.playground != nil {
+		srv.RegisterOnShutdown(s.playground.Close)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.ready.Store(false)
+	s.logger.Info("shutting down", slog.Duration("grace_period", cfg.ShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *server) handleTest(w http.ResponseWriter, r *http.Request) {
+
+	code := `
+@layout(w:950,h:400)
+
+browser:Browser@home
+vps:VM@ubuntu {
+nginx:Server@nginx
+app:Server@app
+}
+
+browser.e --> nginx.w
+nginx.e --> app.w
+
+@browser(x:50,y:100,w:200,h:150)
+@home(url: "https://www.nagare.com", bg: "#e6f3ff", fg: "#333", text: "Home Page")
+
+@vps(x:300,y:&browser.c,w:600,h:300)
+@ubuntu(title: "home@ubuntu", bg: "#333", fg: "#ccc", text: "Ubuntu")
+
+@nginx(x:50,y:&browser.c,w:200,h:50, title: "nginx", icon: "nginx", port: 80, bg: "#e6f3ff", fg: "#333")
+@app(x:350,y:&browser.c,w:200,h:50, title: "App", icon: "golang", port: 8080, bg: "#f0f8ff", fg: "#333")
+`
+	html, err := s.renderSVG(r.Context(), code, false)
+	if err != nil {
+		writeRenderError(w, err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(html)
+}
+
+func (s *server) handleRender(w http.ResponseWriter, r *http.Request) {
+	strict, err := strictParam(r)
+	if err != nil {
+		writeRenderError(w, err)
+		return
+	}
+
+	// Read the input
+	code, err := s.readBody(w, r)
+	if err != nil {
+		writeRenderError(w, err)
+		return
+	}
+
+	html, err := s.renderSVG(r.Context(), string(code), strict)
+	if err != nil {
+		writeRenderError(w, err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(html)
+}
+
+func (s *server) handleRenderWebP(w http.ResponseWriter, r *http.Request) {
+	strict, err := strictParam(r)
+	if err != nil {
+		writeRenderError(w, err)
+		return
+	}
+
+	code, err := s.readBody(w, r)
+	if err != nil {
+		writeRenderError(w, err)
+		return
+	}
+
+	data, err := s.renderWebP(r.Context(), string(code), strict)
+	if err != nil {
+		writeRenderError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/webp")
+	w.Write(data)
+}
+
+// strictParam reads the ?strict= query parameter of the plain-body endpoints.
+func strictParam(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("strict")
+	if value == "" {
+		return false, nil
+	}
+	strict, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: strict must be a boolean, got %q", diagram.ErrInvalidOptions, value)
+	}
+	return strict, nil
+}
+
+// readBody reads the request body, refusing anything larger than MaxBodyBytes.
+func (s *server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body := r.Body
+	if s.cfg.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+	}
+	return io.ReadAll(body)
+}
+
+func (s *server) renderSVG(ctx context.Context, code string, strict bool) ([]byte, error) {
+	opts := s.cfg.diagramOptions()
+	opts.Strict = strict
+	out, err := s.render(ctx, code, diagram.FormatSVG, opts)
+	return out.Data, err
+}
+
+func (s *server) renderWebP(ctx context.Context, code string, strict bool) ([]byte, error) {
+	opts := s.cfg.diagramOptions()
+	opts.Strict = strict
+	out, err := s.render(ctx, code, diagram.FormatWebP, opts)
+	return out.Data, err
+}
+
+// render serves code from the cache or runs the pipeline under the render timeout,
+// recording metrics either way. Raster formats wait for a free raster slot first.
+func (s *server) render(ctx context.Context, code string, format diagram.OutputFormat, opts diagram.Options) (diagram.Output, error) {
+	key := renderCacheKey(string(format), renderVariant(opts), code)
+	// The cache only sees the diagram itself, so it would miss edits to imported files.
+	cacheable := opts.Imports == nil || !strings.Contains(code, "@"+parser.ImportKeyword)
+	if out, ok := s.cache.Get(key); ok && cacheable {
+		s.metrics.recordCache(true)
+		s.metrics.recordRender(string(format), nil)
+		return out, nil
+	}
+	s.metrics.recordCache(false)
+
+	ctx, cancel := s.withRenderTimeout(ctx)
+	defer cancel()
+
+	opts.Observer = s.metrics.observeStage
+
+	var err error
+	if format.Rasterized() {
+		// Rasterising allocates a full canvas, so only a bounded number may run at once.
+		// The slot is released when the job ends, which may be after a timeout.
+		select {
+		case s.rasterSlots <- struct{}{}:
+		case <-ctx.Done():
+			err = errRasterBusy
+		}
+	}
+	var out diagram.Output
+	if err == nil {
+		out, err = runWithContext(ctx, func() (diagram.Output, error) {
+			if format.Rasterized() {
+				s.metrics.rasterJobs.Inc()
+				defer func() {
+					s.metrics.rasterJobs.Dec()
+					<-s.rasterSlots
+				}()
+			}
+			return diagram.Render(ctx, code, format, opts)
+		})
+	}
+	s.metrics.recordRender(string(format), err)
+	if err != nil {
+		s.logger.Warn("render failed",
+			slog.String("request_id", requestIDFrom(ctx)),
+			slog.String("format", string(format)),
+			slog.String("error", err.Error()))
+		return diagram.Output{}, err
+	}
+	if cacheable {
+		s.cache.Add(key, out)
+	}
+	return out, nil
+}
+
+// renderVariant encodes the output-affecting options for use in cache keys.
+func renderVariant(opts diagram.Options) string {
+	return fmt.Sprintf("%s|%g|%d|%d|%d|%t|%t|%d", opts.Theme, opts.Scale, opts.Width, opts.Height, opts.Step, opts.Steps, opts.Strict, opts.Roughness)
+}
+
+func (s *server) withRenderTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.cfg.RenderTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.cfg.RenderTimeout)
+}
+
+var errRasterBusy = errors.New("too many concurrent raster jobs")
+
+// runWithContext runs fn in its own goroutine and returns as soon as either fn finishes
+// or ctx is done. The pipeline is not fully interruptible, so a timed out job keeps
+// running in the background until it reaches its next cancellation check.
+func runWithContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func writeRenderError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), renderErrorStatus(err))
+}
+
+func renderErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, diagram.ErrLimitExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, errRasterBusy):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		// The client went away; the status is only visible in logs.
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func envString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("ignoring %s=%q: %v", key, value, err)
+		return fallback
+	}
+	return parsed
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("ignoring %s=%q: %v", key, value, err)
+		return fallback
+	}
+	return parsed
+}
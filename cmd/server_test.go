@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer returns a server with the default configuration, changed by configure,
+// that logs nowhere.
+func testServer(configure func(cfg *serverConfig)) *server {
+	cfg := defaultServerConfig()
+	cfg.PlaygroundSessions = 0
+	if configure != nil {
+		configure(&cfg)
+	}
+	return newServer(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// serveRequest sends r through the server's routes and returns the response.
+func serveRequest(s *server, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, r)
+	return w
+}
+
+func TestRenderRejectsLargeBody(t *testing.T) {
+	s := testServer(func(cfg *serverConfig) { cfg.MaxBodyBytes = 16 })
+
+	w := serveRequest(s, httptest.NewRequest(http.MethodPost, "/render", strings.NewReader("app:Server\nweb:Server\ndb:Database")))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", w.Code, w.Body)
+	}
+
+	w = serveRequest(s, httptest.NewRequest(http.MethodPost, "/render", strings.NewReader("app:Server")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected a body under the limit to render, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestRenderTimesOut(t *testing.T) {
+	s := testServer(func(cfg *serverConfig) { cfg.RenderTimeout = time.Nanosecond })
+
+	w := serveRequest(s, httptest.NewRequest(http.MethodPost, "/render", strings.NewReader("app:Server")))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestRasterRenderWithoutFreeSlot(t *testing.T) {
+	s := testServer(func(cfg *serverConfig) {
+		cfg.MaxRasterJobs = 1
+		cfg.RenderTimeout = 50 * time.Millisecond
+	})
+	s.rasterSlots <- struct{}{} // A raster render that does not finish
+	defer func() { <-s.rasterSlots }()
+
+	w := serveRequest(s, httptest.NewRequest(http.MethodPost, "/render-webp", strings.NewReader("app:Server")))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), errRasterBusy.Error()) {
+		t.Fatalf("expected %q, got %q", errRasterBusy, w.Body)
+	}
+
+	// SVG renders do not need a slot.
+	w = serveRequest(s, httptest.NewRequest(http.MethodPost, "/render", strings.NewReader("app:Server")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected an svg render to go ahead, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestReadyzFailsWhileShuttingDown(t *testing.T) {
+	s := testServer(func(cfg *serverConfig) {
+		cfg.MaxRasterJobs = 1
+		cfg.ReadTimeout, cfg.WriteTimeout, cfg.ShutdownTimeout = 0, 0, 10*time.Second
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.run(ctx, listener) }()
+	url := "http://" + listener.Addr().String()
+
+	ready := func() int {
+		w := serveRequest(s, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return w.Code
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("expected ready before shutdown, got %d", code)
+	}
+
+	// A raster render waiting for a slot keeps the server draining. It is in flight once
+	// its cache miss is counted.
+	s.rasterSlots <- struct{}{}
+	responses := make(chan int, 1)
+	go func() {
+		resp, err := http.Post(url+"/render-webp", "text/plain", strings.NewReader("app:Server"))
+		if err != nil {
+			responses <- 0
+			return
+		}
+		resp.Body.Close()
+		responses <- resp.StatusCode
+	}()
+	waitFor(t, "the render to start", func() bool {
+		w := serveRequest(s, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return strings.Contains(w.Body.String(), `nagare_render_cache_requests_total{result="miss"} 1`)
+	})
+
+	cancel()
+	waitFor(t, "/readyz to fail once shutdown began", func() bool { return ready() == http.StatusServiceUnavailable })
+	select {
+	case err := <-stopped:
+		t.Fatalf("expected the server to wait for the render, it stopped with %v", err)
+	default:
+	}
+
+	<-s.rasterSlots
+	if code := <-responses; code != http.StatusOK {
+		t.Fatalf("expected the in-flight render to finish, got %d", code)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
+
+func TestShutdownEndsPlaygroundStreams(t *testing.T) {
+	s := testServer(func(cfg *serverConfig) {
+		cfg.PlaygroundSessions = 1
+		cfg.ReadTimeout, cfg.WriteTimeout, cfg.ShutdownTimeout = 0, 0, 10*time.Second
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.run(ctx, listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/playground/events")
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if line, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil || line != "event: session\n" {
+		t.Fatalf("expected the session event, got %q, %v", line, err)
+	}
+
+	start := time.Now()
+	cancel()
+	if err := <-stopped; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the open stream to end with the shutdown, it took %s", elapsed)
+	}
+}
+
+// waitFor polls done until it reports true, failing the test after five seconds.
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !done(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestRequestIDIsEchoed(t *testing.T) {
+	s := testServer(nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	r.Header.Set(requestIDHeader, "trace-42")
+	if got := serveRequest(s, r).Header().Get(requestIDHeader); got != "trace-42" {
+		t.Fatalf("expected the incoming request ID echoed, got %q", got)
+	}
+
+	generated := regexp.MustCompile(`^[0-9a-f]{16}$`)
+	r = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	if got := serveRequest(s, r).Header().Get(requestIDHeader); !generated.MatchString(got) {
+		t.Fatalf("expected a generated request ID, got %q", got)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	r.Header.Set(requestIDHeader, strings.Repeat("x", 129))
+	if got := serveRequest(s, r).Header().Get(requestIDHeader); !generated.MatchString(got) {
+		t.Fatalf("expected an overlong request ID replaced, got %q", got)
+	}
+}
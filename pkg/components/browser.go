@@ -8,11 +8,11 @@ import (
 
 // BrowserProps defines the configurable properties for a Browser component
 type BrowserProps struct {
-	URL                    string `prop:"url"`
-	BackgroundColor        string `prop:"bg"`
-	ForegroundColor        string `prop:"fg"`
-	ContentBackgroundColor string `prop:"contentBg"`
-	Text                   string `prop:"text"`
+	URL                    string      `prop:"url" doc:"Address shown in the URL bar"`
+	BackgroundColor        props.Color `prop:"bg" default:"#e6f3ff" doc:"Background colour"`
+	ForegroundColor        props.Color `prop:"fg" default:"#333333" doc:"Text colour"`
+	ContentBackgroundColor props.Color `prop:"contentBg" default:"#ffffff" doc:"Background colour of the content area"`
+	Text                   string      `prop:"text" doc:"Text shown in the page area"`
 }
 
 // Parse implements the Props interface
@@ -22,13 +22,9 @@ func (b *BrowserProps) Parse(input string) error {
 
 // DefaultBrowserProps returns a BrowserProps with default values
 func DefaultBrowserProps() BrowserProps {
-	return BrowserProps{
-		URL:                    "",
-		BackgroundColor:        "#e6f3ff",
-		ForegroundColor:        "#333333",
-		ContentBackgroundColor: "#ffffff", // White content area by default
-		Text:                   "",
-	}
+	var p BrowserProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type Browser struct {
@@ -107,9 +103,9 @@ func (r *Browser) Draw() string {
 		ContentAreaX:           contentAreaX,
 		ContentAreaY:           contentAreaY,
 		FontSize:               fontSize,
-		BackgroundColor:        r.Props.BackgroundColor,
-		ForegroundColor:        r.Props.ForegroundColor,
-		ContentBackgroundColor: r.Props.ContentBackgroundColor,
+		BackgroundColor:        string(r.Props.BackgroundColor),
+		ForegroundColor:        string(r.Props.ForegroundColor),
+		ContentBackgroundColor: string(r.Props.ContentBackgroundColor),
 		URL:                    r.Props.URL,
 		Text:                   r.Props.Text,
 		HeaderControlProps:     headerControlProps,
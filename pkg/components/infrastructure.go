@@ -8,11 +8,11 @@ import (
 
 // DatabaseProps defines configurable values for a database component.
 type DatabaseProps struct {
-	Title           string `prop:"title"`
-	Engine          string `prop:"engine"`
-	BackgroundColor string `prop:"bg"`
-	ForegroundColor string `prop:"fg"`
-	AccentColor     string `prop:"accent"`
+	Title           string      `prop:"title" default:"Database" doc:"Label shown on the database"`
+	Engine          string      `prop:"engine" default:"PostgreSQL" doc:"Database engine, e.g. PostgreSQL"`
+	BackgroundColor props.Color `prop:"bg" default:"#0f766e" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#ecfdf5" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#14b8a6" doc:"Accent colour for icons and highlights"`
 }
 
 func (d *DatabaseProps) Parse(input string) error {
@@ -20,13 +20,9 @@ func (d *DatabaseProps) Parse(input string) error {
 }
 
 func DefaultDatabaseProps() DatabaseProps {
-	return DatabaseProps{
-		Title:           "Database",
-		Engine:          "PostgreSQL",
-		BackgroundColor: "#0f766e",
-		ForegroundColor: "#ecfdf5",
-		AccentColor:     "#14b8a6",
-	}
+	var p DatabaseProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type Database struct {
@@ -73,11 +69,11 @@ func (d *Database) Draw() string {
 
 // MessageQueueProps defines configurable values for a message queue component.
 type MessageQueueProps struct {
-	Title           string `prop:"title"`
-	Kind            string `prop:"kind"`
-	BackgroundColor string `prop:"bg"`
-	ForegroundColor string `prop:"fg"`
-	AccentColor     string `prop:"accent"`
+	Title           string      `prop:"title" default:"Queue" doc:"Label shown on the queue"`
+	Kind            string      `prop:"kind" default:"RabbitMQ" doc:"Broker kind, e.g. RabbitMQ"`
+	BackgroundColor props.Color `prop:"bg" default:"#4c1d95" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#ede9fe" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#a855f7" doc:"Accent colour for icons and highlights"`
 }
 
 func (m *MessageQueueProps) Parse(input string) error {
@@ -85,13 +81,9 @@ func (m *MessageQueueProps) Parse(input string) error {
 }
 
 func DefaultMessageQueueProps() MessageQueueProps {
-	return MessageQueueProps{
-		Title:           "Queue",
-		Kind:            "RabbitMQ",
-		BackgroundColor: "#4c1d95",
-		ForegroundColor: "#ede9fe",
-		AccentColor:     "#a855f7",
-	}
+	var p MessageQueueProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type MessageQueue struct {
@@ -138,12 +130,12 @@ func (m *MessageQueue) Draw() string {
 
 // CDNProps defines configurable values for an edge or CDN component.
 type CDNProps struct {
-	Title           string `prop:"title"`
-	Provider        string `prop:"provider"`
-	Region          string `prop:"region"`
-	BackgroundColor string `prop:"bg"`
-	ForegroundColor string `prop:"fg"`
-	AccentColor     string `prop:"accent"`
+	Title           string      `prop:"title" default:"Edge" doc:"Label shown on the edge node"`
+	Provider        string      `prop:"provider" default:"Cloudflare" doc:"CDN provider, e.g. Cloudflare"`
+	Region          string      `prop:"region" default:"Global" doc:"Region served by the edge node"`
+	BackgroundColor props.Color `prop:"bg" default:"#1d4ed8" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#eff6ff" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#60a5fa" doc:"Accent colour for icons and highlights"`
 }
 
 func (c *CDNProps) Parse(input string) error {
@@ -151,14 +143,9 @@ func (c *CDNProps) Parse(input string) error {
 }
 
 func DefaultCDNProps() CDNProps {
-	return CDNProps{
-		Title:           "Edge",
-		Provider:        "Cloudflare",
-		Region:          "Global",
-		BackgroundColor: "#1d4ed8",
-		ForegroundColor: "#eff6ff",
-		AccentColor:     "#60a5fa",
-	}
+	var p CDNProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type CDN struct {
@@ -205,12 +192,12 @@ func (c *CDN) Draw() string {
 
 // APIGatewayProps defines configurable values for an API Gateway component.
 type APIGatewayProps struct {
-	Title           string `prop:"title"`
-	Route           string `prop:"route"`
-	Method          string `prop:"method"`
-	BackgroundColor string `prop:"bg"`
-	ForegroundColor string `prop:"fg"`
-	AccentColor     string `prop:"accent"`
+	Title           string      `prop:"title" default:"API Gateway" doc:"Label shown on the gateway"`
+	Route           string      `prop:"route" default:"/api" doc:"Route prefix handled by the gateway"`
+	Method          string      `prop:"method" default:"ANY" doc:"HTTP method handled by the gateway"`
+	BackgroundColor props.Color `prop:"bg" default:"#312e81" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#eef2ff" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#6366f1" doc:"Accent colour for icons and highlights"`
 }
 
 func (a *APIGatewayProps) Parse(input string) error {
@@ -218,14 +205,9 @@ func (a *APIGatewayProps) Parse(input string) error {
 }
 
 func DefaultAPIGatewayProps() APIGatewayProps {
-	return APIGatewayProps{
-		Title:           "API Gateway",
-		Route:           "/api",
-		Method:          "ANY",
-		BackgroundColor: "#312e81",
-		ForegroundColor: "#eef2ff",
-		AccentColor:     "#6366f1",
-	}
+	var p APIGatewayProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type APIGateway struct {
@@ -272,12 +254,12 @@ func (a *APIGateway) Draw() string {
 
 // BackgroundWorkerProps defines configurable values for a worker component.
 type BackgroundWorkerProps struct {
-	Title           string `prop:"title"`
-	Job             string `prop:"job"`
-	Schedule        string `prop:"schedule"`
-	BackgroundColor string `prop:"bg"`
-	ForegroundColor string `prop:"fg"`
-	AccentColor     string `prop:"accent"`
+	Title           string      `prop:"title" default:"Worker" doc:"Label shown on the worker"`
+	Job             string      `prop:"job" default:"process-emails" doc:"Name of the job the worker runs"`
+	Schedule        string      `prop:"schedule" default:"@every 1m" doc:"Schedule the job runs on, e.g. @every 1m"`
+	BackgroundColor props.Color `prop:"bg" default:"#166534" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#dcfce7" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#22c55e" doc:"Accent colour for icons and highlights"`
 }
 
 func (b *BackgroundWorkerProps) Parse(input string) error {
@@ -285,14 +267,9 @@ func (b *BackgroundWorkerProps) Parse(input string) error {
 }
 
 func DefaultBackgroundWorkerProps() BackgroundWorkerProps {
-	return BackgroundWorkerProps{
-		Title:           "Worker",
-		Job:             "process-emails",
-		Schedule:        "@every 1m",
-		BackgroundColor: "#166534",
-		ForegroundColor: "#dcfce7",
-		AccentColor:     "#22c55e",
-	}
+	var p BackgroundWorkerProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type BackgroundWorker struct {
@@ -339,12 +316,12 @@ func (b *BackgroundWorker) Draw() string {
 
 // PackageProps defines configurable values for a package artifact component.
 type PackageProps struct {
-	Title           string `prop:"title"`
-	Version         string `prop:"version"`
-	Language        string `prop:"lang"`
-	BackgroundColor string `prop:"bg"`
-	ForegroundColor string `prop:"fg"`
-	AccentColor     string `prop:"accent"`
+	Title           string      `prop:"title" default:"Package" doc:"Label shown on the package"`
+	Version         string      `prop:"version" default:"1.0.0" doc:"Package version"`
+	Language        string      `prop:"lang" default:"Go" doc:"Implementation language"`
+	BackgroundColor props.Color `prop:"bg" default:"#92400e" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#fef3c7" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#f97316" doc:"Accent colour for icons and highlights"`
 }
 
 func (p *PackageProps) Parse(input string) error {
@@ -352,14 +329,9 @@ func (p *PackageProps) Parse(input string) error {
 }
 
 func DefaultPackageProps() PackageProps {
-	return PackageProps{
-		Title:           "Package",
-		Version:         "1.0.0",
-		Language:        "Go",
-		BackgroundColor: "#92400e",
-		ForegroundColor: "#fef3c7",
-		AccentColor:     "#f97316",
-	}
+	var p PackageProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type Package struct {
@@ -406,12 +378,12 @@ func (p *Package) Draw() string {
 
 // ArtifactProps defines configurable values for a file or artifact component.
 type ArtifactProps struct {
-	Title           string `prop:"title"`
-	Filename        string `prop:"filename"`
-	Size            string `prop:"size"`
-	BackgroundColor string `prop:"bg"`
-	ForegroundColor string `prop:"fg"`
-	AccentColor     string `prop:"accent"`
+	Title           string      `prop:"title" default:"Artifact" doc:"Label shown on the artifact"`
+	Filename        string      `prop:"filename" default:"build.tar.gz" doc:"File name of the artifact"`
+	Size            string      `prop:"size" default:"24 MB" doc:"Human readable file size"`
+	BackgroundColor props.Color `prop:"bg" default:"#1f2937" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#f9fafb" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#9ca3af" doc:"Accent colour for icons and highlights"`
 }
 
 func (a *ArtifactProps) Parse(input string) error {
@@ -419,14 +391,9 @@ func (a *ArtifactProps) Parse(input string) error {
 }
 
 func DefaultArtifactProps() ArtifactProps {
-	return ArtifactProps{
-		Title:           "Artifact",
-		Filename:        "build.tar.gz",
-		Size:            "24 MB",
-		BackgroundColor: "#1f2937",
-		ForegroundColor: "#f9fafb",
-		AccentColor:     "#9ca3af",
-	}
+	var p ArtifactProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type Artifact struct {
@@ -0,0 +1,676 @@
+package components
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/props"
+)
+
+// Cluster and Namespace place their children in the area below their header, like VM.
+const (
+	KubernetesContentAreaXRatio      = 0.025
+	KubernetesContentAreaYRatio      = 0.12
+	KubernetesContentAreaWidthRatio  = 0.95
+	KubernetesContentAreaHeightRatio = 0.855
+)
+
+// maxPodStack is the most cards a Pod draws, however many replicas it has.
+const maxPodStack = 3
+
+// ClusterProps defines configurable values for a Kubernetes cluster.
+type ClusterProps struct {
+	Title           string      `prop:"title" doc:"Label shown in the header; defaults to the node id"`
+	Provider        string      `prop:"provider" doc:"Where the cluster runs, e.g. GKE or EKS"`
+	BackgroundColor props.Color `prop:"bg" default:"#eef2ff" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#1e3a8a" doc:"Text and border colour"`
+	AccentColor     props.Color `prop:"accent" default:"#326ce5" doc:"Colour of the header and its icon"`
+}
+
+func (c *ClusterProps) Parse(input string) error {
+	return props.ParseProps(input, c)
+}
+
+func DefaultClusterProps() ClusterProps {
+	var p ClusterProps
+	props.SetDefaults(&p)
+	return p
+}
+
+// Cluster is a Kubernetes cluster that can contain namespaces and resources.
+type Cluster struct {
+	Shape
+	Text     string
+	Props    ClusterProps
+	State    string
+	Children []Component
+}
+
+func NewCluster(id string) *Cluster {
+	return &Cluster{
+		Text:  id,
+		Props: DefaultClusterProps(),
+	}
+}
+
+// AddChild adds a child component to the cluster
+func (c *Cluster) AddChild(child Component) {
+	c.Children = append(c.Children, child)
+}
+
+// KubernetesContainerTemplateData is the template data of Cluster and Namespace.
+type KubernetesContainerTemplateData struct {
+	X               float64
+	Y               float64
+	Width           float64
+	Height          float64
+	HeaderHeight    float64
+	FontSize        float64
+	Title           string
+	Subtitle        string
+	BackgroundColor string
+	ForegroundColor string
+	AccentColor     string
+	ChildrenContent template.HTML
+}
+
+func kubernetesContainerData(shape Shape, title, subtitle string, bg, fg, accent props.Color, children []Component) KubernetesContainerTemplateData {
+	headerHeight := shape.Height * KubernetesContentAreaYRatio * 0.75
+
+	var content strings.Builder
+	if len(children) > 0 {
+		content.WriteString(fmt.Sprintf(`<g transform="translate(%f,%f)" class="k8s-content">`,
+			shape.Width*KubernetesContentAreaXRatio,
+			shape.Height*KubernetesContentAreaYRatio))
+		for _, child := range children {
+			content.WriteString(child.Draw())
+		}
+		content.WriteString("</g>")
+	}
+
+	return KubernetesContainerTemplateData{
+		X:               shape.X,
+		Y:               shape.Y,
+		Width:           shape.Width,
+		Height:          shape.Height,
+		HeaderHeight:    headerHeight,
+		FontSize:        math.Min(headerHeight*0.5, shape.Width*0.05),
+		Title:           title,
+		Subtitle:        subtitle,
+		BackgroundColor: string(bg),
+		ForegroundColor: string(fg),
+		AccentColor:     string(accent),
+		ChildrenContent: template.HTML(content.String()),
+	}
+}
+
+func (c *Cluster) templateData() KubernetesContainerTemplateData {
+	title := c.Props.Title
+	if title == "" {
+		title = c.Text
+	}
+	return kubernetesContainerData(c.Shape, title, c.Props.Provider,
+		c.Props.BackgroundColor, c.Props.ForegroundColor, c.Props.AccentColor, c.Children)
+}
+
+func (c *Cluster) Draw() string {
+	result, err := RenderTemplate("cluster", c.templateData())
+	if err != nil {
+		return fmt.Sprintf("<!-- Error rendering cluster template: %v -->", err)
+	}
+	return result
+}
+
+// NamespaceProps defines configurable values for a Kubernetes namespace.
+type NamespaceProps struct {
+	Title           string      `prop:"title" doc:"Namespace name shown in the header; defaults to the node id"`
+	BackgroundColor props.Color `prop:"bg" default:"#f8fafc" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#334155" doc:"Text and border colour"`
+	AccentColor     props.Color `prop:"accent" default:"#64748b" doc:"Colour of the header"`
+}
+
+func (n *NamespaceProps) Parse(input string) error {
+	return props.ParseProps(input, n)
+}
+
+func DefaultNamespaceProps() NamespaceProps {
+	var p NamespaceProps
+	props.SetDefaults(&p)
+	return p
+}
+
+// Namespace is a Kubernetes namespace that can contain resources. It can be drawn on its
+// own or inside a Cluster.
+type Namespace struct {
+	Shape
+	Text     string
+	Props    NamespaceProps
+	State    string
+	Children []Component
+}
+
+func NewNamespace(id string) *Namespace {
+	return &Namespace{
+		Text:  id,
+		Props: DefaultNamespaceProps(),
+	}
+}
+
+// AddChild adds a child component to the namespace
+func (n *Namespace) AddChild(child Component) {
+	n.Children = append(n.Children, child)
+}
+
+func (n *Namespace) templateData() KubernetesContainerTemplateData {
+	title := n.Props.Title
+	if title == "" {
+		title = n.Text
+	}
+	return kubernetesContainerData(n.Shape, title, "namespace",
+		n.Props.BackgroundColor, n.Props.ForegroundColor, n.Props.AccentColor, n.Children)
+}
+
+func (n *Namespace) Draw() string {
+	result, err := RenderTemplate("namespace", n.templateData())
+	if err != nil {
+		return fmt.Sprintf("<!-- Error rendering namespace template: %v -->", err)
+	}
+	return result
+}
+
+// DeploymentProps defines configurable values for a Kubernetes deployment.
+type DeploymentProps struct {
+	Title           string      `prop:"title" default:"Deployment" doc:"Label shown on the deployment"`
+	Namespace       string      `prop:"namespace" doc:"Namespace the deployment belongs to"`
+	Replicas        int         `prop:"replicas" default:"1" doc:"Number of pod replicas"`
+	Image           string      `prop:"image" doc:"Container image, e.g. nginx:1.27"`
+	BackgroundColor props.Color `prop:"bg" default:"#326ce5" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#ffffff" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#1d4ed8" doc:"Accent colour for icons and highlights"`
+}
+
+func (d *DeploymentProps) Parse(input string) error {
+	return props.ParseProps(input, d)
+}
+
+func DefaultDeploymentProps() DeploymentProps {
+	var p DeploymentProps
+	props.SetDefaults(&p)
+	return p
+}
+
+type Deployment struct {
+	Shape
+	Text  string
+	Props DeploymentProps
+	State string
+}
+
+func NewDeployment(id string) *Deployment {
+	return &Deployment{
+		Text:  id,
+		Props: DefaultDeploymentProps(),
+	}
+}
+
+type DeploymentTemplateData struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	Props  DeploymentProps
+	Text   string
+}
+
+func (d *Deployment) templateData() DeploymentTemplateData {
+	return DeploymentTemplateData{
+		X:      d.X,
+		Y:      d.Y,
+		Width:  d.Width,
+		Height: d.Height,
+		Props:  d.Props,
+		Text:   d.Text,
+	}
+}
+
+func (d *Deployment) Draw() string {
+	result, err := RenderTemplate("deployment", d.templateData())
+	if err != nil {
+		return fmt.Sprintf("<!-- Error rendering deployment template: %v -->", err)
+	}
+	return result
+}
+
+// PodProps defines configurable values for a Kubernetes pod.
+type PodProps struct {
+	Title           string      `prop:"title" default:"Pod" doc:"Label shown on the pod"`
+	Namespace       string      `prop:"namespace" doc:"Namespace the pod belongs to"`
+	Replicas        int         `prop:"replicas" default:"1" doc:"Number of replicas, drawn as a stack of pods"`
+	Image           string      `prop:"image" doc:"Container image, e.g. nginx:1.27"`
+	BackgroundColor props.Color `prop:"bg" default:"#ffffff" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#1e3a8a" doc:"Text and border colour"`
+	AccentColor     props.Color `prop:"accent" default:"#326ce5" doc:"Accent colour for icons and highlights"`
+}
+
+func (p *PodProps) Parse(input string) error {
+	return props.ParseProps(input, p)
+}
+
+func DefaultPodProps() PodProps {
+	var p PodProps
+	props.SetDefaults(&p)
+	return p
+}
+
+type Pod struct {
+	Shape
+	Text  string
+	Props PodProps
+	State string
+}
+
+func NewPod(id string) *Pod {
+	return &Pod{
+		Text:  id,
+		Props: DefaultPodProps(),
+	}
+}
+
+// PodTemplateData describes a pod drawn as a stack of cards, one per replica up to
+// maxPodStack. The front card is CardWidth by CardHeight; Stack holds the offset of each
+// card behind it, furthest first.
+type PodTemplateData struct {
+	X          float64
+	Y          float64
+	Width      float64
+	Height     float64
+	CardWidth  float64
+	CardHeight float64
+	Front      float64 // Offset of the front card
+	Stack      []float64
+	Props      PodProps
+	Text       string
+}
+
+func (p *Pod) templateData() PodTemplateData {
+	cards := p.Props.Replicas
+	if cards < 1 {
+		cards = 1
+	}
+	if cards > maxPodStack {
+		cards = maxPodStack
+	}
+
+	step := math.Min(p.Width, p.Height) * 0.06
+	data := PodTemplateData{
+		X:          p.X,
+		Y:          p.Y,
+		Width:      p.Width,
+		Height:     p.Height,
+		CardWidth:  p.Width - step*float64(cards-1),
+		CardHeight: p.Height - step*float64(cards-1),
+		Front:      step * float64(cards-1),
+		Props:      p.Props,
+		Text:       p.Text,
+	}
+	for i := 0; i < cards-1; i++ {
+		data.Stack = append(data.Stack, step*float64(i))
+	}
+	return data
+}
+
+func (p *Pod) Draw() string {
+	result, err := RenderTemplate("pod", p.templateData())
+	if err != nil {
+		return fmt.Sprintf("<!-- Error rendering pod template: %v -->", err)
+	}
+	return result
+}
+
+// ServiceProps defines configurable values for a Kubernetes service.
+type ServiceProps struct {
+	Title           string      `prop:"title" default:"Service" doc:"Label shown on the service"`
+	Namespace       string      `prop:"namespace" doc:"Namespace the service belongs to"`
+	Kind            string      `prop:"kind" enum:"ClusterIP,NodePort,LoadBalancer,ExternalName" default:"ClusterIP" doc:"Service type"`
+	Port            int         `prop:"port" default:"80" doc:"Port the service listens on"`
+	Selector        []string    `prop:"selector" doc:"Pod selectors, e.g. [\"app=web\"]; each is an anchor on the bottom edge named after its value"`
+	BackgroundColor props.Color `prop:"bg" default:"#0e7490" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#ecfeff" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#22d3ee" doc:"Colour of the selector anchors"`
+}
+
+func (s *ServiceProps) Parse(input string) error {
+	return props.ParseProps(input, s)
+}
+
+func DefaultServiceProps() ServiceProps {
+	var p ServiceProps
+	props.SetDefaults(&p)
+	return p
+}
+
+// SelectorAnchors returns the name of the anchor each selector adds to a Service, in
+// order: the value of a key=value selector, or the selector itself.
+func (s ServiceProps) SelectorAnchors() []string {
+	names := make([]string, 0, len(s.Selector))
+	for _, selector := range s.Selector {
+		name := strings.TrimSpace(selector)
+		if i := strings.LastIndexByte(name, '='); i >= 0 {
+			name = strings.TrimSpace(name[i+1:])
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// SelectorAnchorFraction returns where along the bottom edge of a Service the i-th of n
+// selector anchors sits, from 0 at the left to 1 at the right.
+func SelectorAnchorFraction(i, n int) float64 {
+	return float64(i+1) / float64(n+1)
+}
+
+type Service struct {
+	Shape
+	Text  string
+	Props ServiceProps
+	State string
+}
+
+func NewService(id string) *Service {
+	return &Service{
+		Text:  id,
+		Props: DefaultServiceProps(),
+	}
+}
+
+// ServiceAnchor is a selector anchor drawn on the bottom edge of a Service.
+type ServiceAnchor struct {
+	Name string
+	X    float64
+}
+
+type ServiceTemplateData struct {
+	X       float64
+	Y       float64
+	Width   float64
+	Height  float64
+	Anchors []ServiceAnchor
+	Props   ServiceProps
+	Text    string
+}
+
+func (s *Service) templateData() ServiceTemplateData {
+	data := ServiceTemplateData{
+		X:      s.X,
+		Y:      s.Y,
+		Width:  s.Width,
+		Height: s.Height,
+		Props:  s.Props,
+		Text:   s.Text,
+	}
+	names := s.Props.SelectorAnchors()
+	for i, name := range names {
+		data.Anchors = append(data.Anchors, ServiceAnchor{Name: name, X: s.Width * SelectorAnchorFraction(i, len(names))})
+	}
+	return data
+}
+
+func (s *Service) Draw() string {
+	result, err := RenderTemplate("service", s.templateData())
+	if err != nil {
+		return fmt.Sprintf("<!-- Error rendering service template: %v -->", err)
+	}
+	return result
+}
+
+// IngressProps defines configurable values for a Kubernetes ingress.
+type IngressProps struct {
+	Title           string      `prop:"title" default:"Ingress" doc:"Label shown on the ingress"`
+	Namespace       string      `prop:"namespace" doc:"Namespace the ingress belongs to"`
+	Host            string      `prop:"host" doc:"Host the ingress routes, e.g. shop.example.com"`
+	Path            string      `prop:"path" default:"/" doc:"Path prefix the ingress routes"`
+	BackgroundColor props.Color `prop:"bg" default:"#7c3aed" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#f5f3ff" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#c4b5fd" doc:"Accent colour for icons and highlights"`
+}
+
+func (i *IngressProps) Parse(input string) error {
+	return props.ParseProps(input, i)
+}
+
+func DefaultIngressProps() IngressProps {
+	var p IngressProps
+	props.SetDefaults(&p)
+	return p
+}
+
+type Ingress struct {
+	Shape
+	Text  string
+	Props IngressProps
+	State string
+}
+
+func NewIngress(id string) *Ingress {
+	return &Ingress{
+		Text:  id,
+		Props: DefaultIngressProps(),
+	}
+}
+
+type IngressTemplateData struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	Props  IngressProps
+	Text   string
+}
+
+func (i *Ingress) templateData() IngressTemplateData {
+	return IngressTemplateData{
+		X:      i.X,
+		Y:      i.Y,
+		Width:  i.Width,
+		Height: i.Height,
+		Props:  i.Props,
+		Text:   i.Text,
+	}
+}
+
+func (i *Ingress) Draw() string {
+	result, err := RenderTemplate("ingress", i.templateData())
+	if err != nil {
+		return fmt.Sprintf("<!-- Error rendering ingress template: %v -->", err)
+	}
+	return result
+}
+
+// ConfigMapProps defines configurable values for a Kubernetes config map.
+type ConfigMapProps struct {
+	Title           string      `prop:"title" default:"ConfigMap" doc:"Label shown on the config map"`
+	Namespace       string      `prop:"namespace" doc:"Namespace the config map belongs to"`
+	BackgroundColor props.Color `prop:"bg" default:"#fef3c7" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#78350f" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#f59e0b" doc:"Accent colour for icons and highlights"`
+}
+
+func (c *ConfigMapProps) Parse(input string) error {
+	return props.ParseProps(input, c)
+}
+
+func DefaultConfigMapProps() ConfigMapProps {
+	var p ConfigMapProps
+	props.SetDefaults(&p)
+	return p
+}
+
+type ConfigMap struct {
+	Shape
+	Text  string
+	Props ConfigMapProps
+	State string
+}
+
+func NewConfigMap(id string) *ConfigMap {
+	return &ConfigMap{
+		Text:  id,
+		Props: DefaultConfigMapProps(),
+	}
+}
+
+type ConfigMapTemplateData struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	Props  ConfigMapProps
+	Text   string
+}
+
+func (c *ConfigMap) templateData() ConfigMapTemplateData {
+	return ConfigMapTemplateData{
+		X:      c.X,
+		Y:      c.Y,
+		Width:  c.Width,
+		Height: c.Height,
+		Props:  c.Props,
+		Text:   c.Text,
+	}
+}
+
+func (c *ConfigMap) Draw() string {
+	result, err := RenderTemplate("configmap", c.templateData())
+	if err != nil {
+		return fmt.Sprintf("<!-- Error rendering configmap template: %v -->", err)
+	}
+	return result
+}
+
+// SecretProps defines configurable values for a Kubernetes secret.
+type SecretProps struct {
+	Title           string      `prop:"title" default:"Secret" doc:"Label shown on the secret"`
+	Namespace       string      `prop:"namespace" doc:"Namespace the secret belongs to"`
+	BackgroundColor props.Color `prop:"bg" default:"#1f2937" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#f9fafb" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#fbbf24" doc:"Colour of the lock icon"`
+}
+
+func (s *SecretProps) Parse(input string) error {
+	return props.ParseProps(input, s)
+}
+
+func DefaultSecretProps() SecretProps {
+	var p SecretProps
+	props.SetDefaults(&p)
+	return p
+}
+
+type Secret struct {
+	Shape
+	Text  string
+	Props SecretProps
+	State string
+}
+
+func NewSecret(id string) *Secret {
+	return &Secret{
+		Text:  id,
+		Props: DefaultSecretProps(),
+	}
+}
+
+type SecretTemplateData struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	Props  SecretProps
+	Text   string
+}
+
+func (s *Secret) templateData() SecretTemplateData {
+	return SecretTemplateData{
+		X:      s.X,
+		Y:      s.Y,
+		Width:  s.Width,
+		Height: s.Height,
+		Props:  s.Props,
+		Text:   s.Text,
+	}
+}
+
+func (s *Secret) Draw() string {
+	result, err := RenderTemplate("secret", s.templateData())
+	if err != nil {
+		return fmt.Sprintf("<!-- Error rendering secret template: %v -->", err)
+	}
+	return result
+}
+
+// PersistentVolumeProps defines configurable values for a Kubernetes persistent volume.
+type PersistentVolumeProps struct {
+	Title           string      `prop:"title" default:"PersistentVolume" doc:"Label shown on the volume"`
+	Namespace       string      `prop:"namespace" doc:"Namespace of the claim bound to the volume"`
+	Capacity        string      `prop:"capacity" default:"10Gi" doc:"Storage capacity, e.g. 10Gi"`
+	StorageClass    string      `prop:"storageClass" doc:"Storage class, e.g. standard"`
+	BackgroundColor props.Color `prop:"bg" default:"#166534" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#f0fdf4" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#4ade80" doc:"Accent colour for icons and highlights"`
+}
+
+func (v *PersistentVolumeProps) Parse(input string) error {
+	return props.ParseProps(input, v)
+}
+
+func DefaultPersistentVolumeProps() PersistentVolumeProps {
+	var p PersistentVolumeProps
+	props.SetDefaults(&p)
+	return p
+}
+
+type PersistentVolume struct {
+	Shape
+	Text  string
+	Props PersistentVolumeProps
+	State string
+}
+
+func NewPersistentVolume(id string) *PersistentVolume {
+	return &PersistentVolume{
+		Text:  id,
+		Props: DefaultPersistentVolumeProps(),
+	}
+}
+
+type PersistentVolumeTemplateData struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	Props  PersistentVolumeProps
+	Text   string
+}
+
+func (v *PersistentVolume) templateData() PersistentVolumeTemplateData {
+	return PersistentVolumeTemplateData{
+		X:      v.X,
+		Y:      v.Y,
+		Width:  v.Width,
+		Height: v.Height,
+		Props:  v.Props,
+		Text:   v.Text,
+	}
+}
+
+func (v *PersistentVolume) Draw() string {
+	result, err := RenderTemplate("persistent-volume", v.templateData())
+	if err != nil {
+		return fmt.Sprintf("<!-- Error rendering persistent volume template: %v -->", err)
+	}
+	return result
+}
@@ -15,13 +15,13 @@ type Shape struct {
 	Height        float64
 	X             float64
 	Y             float64
-	AlignmentRefs map[string]string // Store alignment references for later resolution
+	AlignmentRefs map[string]string // Geometry expressions by prop (x, y, w, h), resolved after layout
 }
 
 type RectangleProps struct {
-	Title           string `prop:"title"`
-	BackgroundColor string `prop:"bg"`
-	ForegroundColor string `prop:"fg"`
+	Title           string      `prop:"title" doc:"Label drawn inside the rectangle"`
+	BackgroundColor props.Color `prop:"bg" default:"#e6f3ff" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#333333" doc:"Text colour"`
 }
 
 func (r *RectangleProps) Parse(input string) error {
@@ -29,11 +29,9 @@ func (r *RectangleProps) Parse(input string) error {
 }
 
 func DefaultRectangleProps() RectangleProps {
-	return RectangleProps{
-		Title:           "",
-		BackgroundColor: "#e6f3ff",
-		ForegroundColor: "#333333",
-	}
+	var p RectangleProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type Rectangle struct {
@@ -72,8 +70,8 @@ func (r *Rectangle) Draw() string {
 		Width:         r.Width,
 		Height:        r.Height,
 		DisplayText:   displayText,
-		Background:    r.Props.BackgroundColor,
-		Foreground:    r.Props.ForegroundColor,
+		Background:    string(r.Props.BackgroundColor),
+		Foreground:    string(r.Props.ForegroundColor),
 		BorderRadiusX: r.Height * 0.1,
 		BorderRadiusY: r.Height * 0.1,
 	}
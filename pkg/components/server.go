@@ -8,11 +8,11 @@ import (
 
 // ServerProps defines the configurable properties for a Server component
 type ServerProps struct {
-	Title           string `prop:"title"`
-	Icon            string `prop:"icon"` // nginx, golang, etc.
-	Port            int    `prop:"port"`
-	BackgroundColor string `prop:"bg"`
-	ForegroundColor string `prop:"fg"`
+	Title           string      `prop:"title" doc:"Label shown next to the icon"`
+	Icon            string      `prop:"icon" enum:"nginx,golang,default" default:"default" doc:"Icon to draw: nginx, golang or default"`
+	Port            int         `prop:"port" default:"80" doc:"Port number shown on the server"`
+	BackgroundColor props.Color `prop:"bg" default:"#e6f3ff" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#333333" doc:"Text colour"`
 }
 
 // Parse implements the Props interface
@@ -22,13 +22,9 @@ func (s *ServerProps) Parse(input string) error {
 
 // DefaultServerProps returns a ServerProps with default values
 func DefaultServerProps() ServerProps {
-	return ServerProps{
-		Title:           "",
-		Icon:            "default",
-		Port:            80,
-		BackgroundColor: "#e6f3ff",
-		ForegroundColor: "#333333",
-	}
+	var p ServerProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type Server struct {
@@ -8,13 +8,13 @@ import (
 
 // TerminalProps defines configurable properties for a Terminal component.
 type TerminalProps struct {
-	Title           string `prop:"title"`
-	WorkingDir      string `prop:"cwd"`
-	Command         string `prop:"command"`
-	PromptSymbol    string `prop:"prompt"`
-	BackgroundColor string `prop:"bg"`
-	ForegroundColor string `prop:"fg"`
-	AccentColor     string `prop:"accent"`
+	Title           string      `prop:"title" default:"Terminal" doc:"Title shown in the window header"`
+	WorkingDir      string      `prop:"cwd" default:"~/project" doc:"Working directory shown in the prompt"`
+	Command         string      `prop:"command" default:"go run main.go" doc:"Command shown after the prompt"`
+	PromptSymbol    string      `prop:"prompt" default:"$" doc:"Prompt symbol"`
+	BackgroundColor props.Color `prop:"bg" default:"#0f172a" doc:"Background colour"`
+	ForegroundColor props.Color `prop:"fg" default:"#f8fafc" doc:"Text colour"`
+	AccentColor     props.Color `prop:"accent" default:"#38bdf8" doc:"Accent colour for icons and highlights"`
 }
 
 // Parse implements the propertyParser interface.
@@ -24,15 +24,9 @@ func (t *TerminalProps) Parse(input string) error {
 
 // DefaultTerminalProps provides sensible defaults for a terminal window.
 func DefaultTerminalProps() TerminalProps {
-	return TerminalProps{
-		Title:           "Terminal",
-		WorkingDir:      "~/project",
-		Command:         "go run main.go",
-		PromptSymbol:    "$",
-		BackgroundColor: "#0f172a",
-		ForegroundColor: "#f8fafc",
-		AccentColor:     "#38bdf8",
-	}
+	var p TerminalProps
+	props.SetDefaults(&p)
+	return p
 }
 
 // Terminal renders a faux terminal window with a command prompt.
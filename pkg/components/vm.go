@@ -18,10 +18,10 @@ const (
 
 // VMProps defines the configurable properties for a VM component
 type VMProps struct {
-	Title                  string `prop:"title"`
-	BackgroundColor        string `prop:"bg"`
-	ForegroundColor        string `prop:"fg"`
-	ContentBackgroundColor string `prop:"contentBg"`
+	Title                  string      `prop:"title" doc:"Title shown in the window header"`
+	BackgroundColor        props.Color `prop:"bg" default:"#e6f3ff" doc:"Background colour"`
+	ForegroundColor        props.Color `prop:"fg" default:"#333333" doc:"Text colour"`
+	ContentBackgroundColor props.Color `prop:"contentBg" default:"#ccc" doc:"Background colour of the content area"`
 }
 
 // Parse implements the Props interface
@@ -31,12 +31,9 @@ func (b *VMProps) Parse(input string) error {
 
 // DefaultVMProps returns a VMProps with default values
 func DefaultVMProps() VMProps {
-	return VMProps{
-		Title:                  "",
-		BackgroundColor:        "#e6f3ff",
-		ForegroundColor:        "#333333",
-		ContentBackgroundColor: "#ccc", // Light content area to keep connections visible
-	}
+	var p VMProps
+	props.SetDefaults(&p)
+	return p
 }
 
 type VM struct {
@@ -130,9 +127,9 @@ func (r *VM) Draw() string {
 		TitleBarX:              titleBarX,
 		TitleBarY:              titleBarY,
 		FontSize:               fontSize,
-		BackgroundColor:        r.Props.BackgroundColor,
-		ForegroundColor:        r.Props.ForegroundColor,
-		ContentBackgroundColor: r.Props.ContentBackgroundColor,
+		BackgroundColor:        string(r.Props.BackgroundColor),
+		ForegroundColor:        string(r.Props.ForegroundColor),
+		ContentBackgroundColor: string(r.Props.ContentBackgroundColor),
 		Title:                  r.Props.Title,
 		HeaderControlProps:     NewHeaderControlProps(actualWidth, actualHeight),
 		ChildrenContent:        template.HTML(childrenContent.String()),
@@ -0,0 +1,84 @@
+package diagram
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// BatchItem is one diagram source in a batch.
+type BatchItem struct {
+	Name   string
+	Source string
+	Path   string // Location of the diagram in Options.Imports, if it differs per item
+}
+
+// BatchResult is the outcome of rendering one BatchItem. Results are independent: one
+// item failing never affects another.
+type BatchResult struct {
+	Name   string
+	Source string
+	Output Output
+	Err    error
+}
+
+// RenderFunc has the signature of Render, so callers can wrap it with caching or limits.
+type RenderFunc func(ctx context.Context, code string, format OutputFormat, opts Options) (Output, error)
+
+// BatchOptions configures RenderBatch.
+type BatchOptions struct {
+	Format  OutputFormat
+	Options Options
+	Workers int        // Maximum concurrent renders; 0 uses GOMAXPROCS
+	Render  RenderFunc // Nil uses Render
+}
+
+// RenderBatch renders items concurrently on a bounded worker pool. The returned slice has
+// one result per item, in input order. Items not started before ctx is done fail with
+// ctx.Err().
+func RenderBatch(ctx context.Context, items []BatchItem, opts BatchOptions) []BatchResult {
+	render := opts.Render
+	if render == nil {
+		render = Render
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	results := make([]BatchResult, len(items))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				item := items[i]
+				result := BatchResult{Name: item.Name, Source: item.Source}
+				if err := ctx.Err(); err != nil {
+					result.Err = err
+				} else {
+					itemOpts := opts.Options
+					if item.Path != "" {
+						itemOpts.Path = item.Path
+					}
+					result.Output, result.Err = render(ctx, item.Source, opts.Format, itemOpts)
+				}
+				results[i] = result
+			}
+		}()
+	}
+
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,73 @@
+package diagram
+
+import (
+	"errors"
+
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+// Severity classifies a Diagnostic.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Position is a location in diagram source. Line and Column are 1-based; Column counts bytes.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Span is the half-open source range [Start, End) a diagnostic refers to.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Diagnostic is a problem found in diagram source, suitable for editor integrations.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Span     *Span    `json:"span,omitempty"`
+}
+
+// NewSpan resolves a tokenizer span against source.
+func NewSpan(source string, span tokenizer.Span) *Span {
+	return &Span{
+		Start: newPosition(source, span.Start),
+		End:   newPosition(source, span.End),
+	}
+}
+
+func newPosition(source string, offset int) Position {
+	line, column := tokenizer.Position(source, offset)
+	return Position{Offset: offset, Line: line, Column: column}
+}
+
+// Diagnostics converts an error returned by this package into diagnostics for source.
+// A *StrictError yields one diagnostic per problem; other errors without location
+// information produce a single span-less diagnostic.
+func Diagnostics(source string, err error) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+	if diagnostics, ok := strictDiagnostics(err); ok {
+		return diagnostics
+	}
+
+	diagnostic := Diagnostic{Severity: SeverityError, Message: err.Error()}
+
+	var parseErr *parser.Error
+	if errors.As(err, &parseErr) {
+		diagnostic.Message = parseErr.Msg
+		if parseErr.HasSpan {
+			diagnostic.Span = NewSpan(source, parseErr.Span)
+		}
+	}
+
+	return []Diagnostic{diagnostic}
+}
@@ -1,14 +1,119 @@
 package diagram
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"math"
+	"time"
 
+	"github.com/saasuke-labs/nagare/pkg/exporter"
 	"github.com/saasuke-labs/nagare/pkg/layout"
 	"github.com/saasuke-labs/nagare/pkg/parser"
 	"github.com/saasuke-labs/nagare/pkg/renderer"
 	"github.com/saasuke-labs/nagare/pkg/tokenizer"
 )
 
+// ErrLimitExceeded is returned when a diagram exceeds one of the configured Limits.
+var ErrLimitExceeded = errors.New("diagram limit exceeded")
+
+// ErrInvalidOptions is returned when Options hold values the pipeline cannot honour.
+var ErrInvalidOptions = errors.New("invalid render options")
+
+// Limits bounds the resources a single diagram may consume. Zero values disable the
+// corresponding check.
+type Limits struct {
+	MaxCanvasPixels int // Maximum width*height of the rendered canvas
+	MaxNodes        int // Maximum number of declared nodes, including container children
+}
+
+// Stage identifies a step of the render pipeline.
+type Stage string
+
+const (
+	StageTokenize  Stage = "tokenize"
+	StageParse     Stage = "parse"
+	StageLayout    Stage = "layout"
+	StageRender    Stage = "render"
+	StageRasterize Stage = "rasterize"
+)
+
+// StageObserver is notified after each pipeline stage completes, successfully or not.
+type StageObserver func(stage Stage, elapsed time.Duration)
+
+// Options configures a diagram render. The zero value renders exactly like CreateDiagram.
+type Options struct {
+	Limits   Limits
+	Observer StageObserver
+
+	Theme  string  // Name of a renderer theme; empty uses the light theme
+	Scale  float64 // Output size multiplier; 0 means 1
+	Width  int     // Canvas width override, takes precedence over @layout
+	Height int     // Canvas height override, takes precedence over @layout
+	Step   int     // Render the diagram as of step N (the first N connections); 0 renders everything
+	Steps  bool    // Render each step up to Step as a page of its own, in formats with pages
+	Strict bool    // Fail with a *StrictError instead of falling back silently
+	// Roughness sets how hand-drawn sketch formats such as Excalidraw look, from 0 (clean
+	// lines) to exporter.MaxRoughness.
+	Roughness int
+
+	// Imports holds the files @import can read, and Path the location of the diagram in
+	// it. A nil Imports rejects every @import, which keeps servers sandboxed.
+	Imports fs.FS
+	Path    string
+}
+
+// observe starts timing a stage and returns a function that reports it to the observer.
+func (o Options) observe(stage Stage) func() {
+	if o.Observer == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { o.Observer(stage, time.Since(start)) }
+}
+
+func (o Options) scale() float64 {
+	if o.Scale == 0 {
+		return 1
+	}
+	return o.Scale
+}
+
+func (o Options) validate() error {
+	if o.Scale < 0 || o.Scale > 16 || math.IsNaN(o.Scale) {
+		return fmt.Errorf("%w: scale must be between 0 and 16, got %v", ErrInvalidOptions, o.Scale)
+	}
+	if o.Width < 0 || o.Height < 0 {
+		return fmt.Errorf("%w: width and height must not be negative", ErrInvalidOptions)
+	}
+	if o.Roughness < 0 || o.Roughness > exporter.MaxRoughness {
+		return fmt.Errorf("%w: roughness must be between 0 and %d, got %d", ErrInvalidOptions, exporter.MaxRoughness, o.Roughness)
+	}
+	if o.Step < 0 {
+		return fmt.Errorf("%w: step must not be negative, got %d", ErrInvalidOptions, o.Step)
+	}
+	if o.Theme != "" {
+		if _, ok := renderer.LookupTheme(o.Theme); !ok {
+			return fmt.Errorf("%w: unknown theme %q", ErrInvalidOptions, o.Theme)
+		}
+	}
+	return nil
+}
+
+// defaultCanvasWidth and defaultCanvasHeight are the canvas layouts are calculated
+// in, and its size when the layout leaves it empty.
+const defaultCanvasWidth, defaultCanvasHeight = 800.0, 400.0
+
+// model is the result of running the pipeline up to, but excluding, rendering.
+type model struct {
+	AST      parser.Node
+	Layout   layout.Layout
+	Width    int
+	Height   int
+	Warnings []Diagnostic // Silent fallbacks taken while building; empty in strict mode
+}
+
 // CreateDiagram generates an SVG diagram from the provided code and returns it as a string.
 func CreateDiagram(code string) (string, error) {
 	svg, _, _, err := CreateDiagramWithSize(code)
@@ -17,27 +122,77 @@ func CreateDiagram(code string) (string, error) {
 
 // CreateDiagramWithSize generates an SVG diagram and returns the SVG along with the computed canvas size.
 func CreateDiagramWithSize(code string) (string, int, int, error) {
+	return CreateDiagramWithOptions(context.Background(), code, Options{})
+}
+
+// CreateDiagramWithOptions generates an SVG diagram honouring the provided options. The context is
+// checked between pipeline stages so callers can abandon long renders.
+func CreateDiagramWithOptions(ctx context.Context, code string, opts Options) (string, int, int, error) {
+	m, err := build(ctx, code, opts)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	html := renderSVG(m, opts)
+	fmt.Println(html)
+	return html, m.Width, m.Height, nil
+}
+
+// build tokenizes, parses and lays out code, enforcing limits along the way.
+func build(ctx context.Context, code string, opts Options) (*model, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
 	fmt.Printf("Input code:\n%s\n", string(code))
 
 	// Pipeline:
 	// 1. Tokenize
-	tokens := tokenizer.Tokenize(string(code))
+	done := opts.observe(StageTokenize)
+	tokens, spans := tokenizer.TokenizeWithSpans(string(code))
+	done()
 	fmt.Printf("Tokens: %+v\n", tokens)
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// 2. Parse
-	ast, err := parser.Parse(tokens)
+	done = opts.observe(StageParse)
+	ast, err := parser.ParseWithImports(tokens, spans, parser.Imports{FS: opts.Imports, Path: opts.Path})
+	done()
 	if err != nil {
-		return "", 0, 0, fmt.Errorf("parse error: %w", err)
+		return nil, fmt.Errorf("parse error: %w", err)
+	}
+
+	if opts.Limits.MaxNodes > 0 {
+		if count := countNodes(ast); count > opts.Limits.MaxNodes {
+			return nil, fmt.Errorf("%w: %d nodes exceeds maximum of %d", ErrLimitExceeded, count, opts.Limits.MaxNodes)
+		}
 	}
 
 	fmt.Printf("AST: \n%+v\n", ast)
 
+	if opts.Step > 0 && opts.Step < len(ast.Connections) {
+		ast.Connections = ast.Connections[:opts.Step]
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// 3. Layout
-	const defaultCanvasWidth, defaultCanvasHeight = 800.0, 400.0
+	done = opts.observe(StageLayout)
 	l := layout.Calculate(ast, defaultCanvasWidth, defaultCanvasHeight)
+	done()
 
 	fmt.Printf("Layout: \n%+v\n", l)
 
+	warnings := collectWarnings(code, l)
+	if err := checkStrict(warnings, opts); err != nil {
+		return nil, err
+	}
+
 	// 4. Render using the computed layout dimensions
 	canvasWidth := int(l.Bounds.Width)
 	canvasHeight := int(l.Bounds.Height)
@@ -47,8 +202,54 @@ func CreateDiagramWithSize(code string) (string, int, int, error) {
 	if canvasHeight == 0 {
 		canvasHeight = int(defaultCanvasHeight)
 	}
+	if opts.Width > 0 {
+		canvasWidth = opts.Width
+	}
+	if opts.Height > 0 {
+		canvasHeight = opts.Height
+	}
 
-	html := renderer.Render(l, canvasWidth, canvasHeight)
-	fmt.Println(html)
-	return html, canvasWidth, canvasHeight, nil
+	if err := opts.Limits.checkCanvas(canvasWidth, canvasHeight, opts.scale()); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return &model{AST: ast, Layout: l, Width: canvasWidth, Height: canvasHeight, Warnings: warnings}, nil
+}
+
+func renderSVG(m *model, opts Options) string {
+	theme := renderer.DefaultTheme
+	if opts.Theme != "" {
+		theme, _ = renderer.LookupTheme(opts.Theme)
+	}
+
+	done := opts.observe(StageRender)
+	defer done()
+	return renderer.RenderWithOptions(m.Layout, m.Width, m.Height, renderer.Options{Theme: theme, Scale: opts.Scale})
+}
+
+func (l Limits) checkCanvas(width, height int, scale float64) error {
+	if width < 0 || height < 0 {
+		return fmt.Errorf("%w: invalid canvas size %dx%d", ErrLimitExceeded, width, height)
+	}
+	if l.MaxCanvasPixels <= 0 {
+		return nil
+	}
+	// Compare in float64 so huge @layout values cannot overflow.
+	if float64(width)*float64(height)*scale*scale > float64(l.MaxCanvasPixels) {
+		return fmt.Errorf("%w: canvas %dx%d at scale %v exceeds maximum of %d pixels", ErrLimitExceeded, width, height, scale, l.MaxCanvasPixels)
+	}
+	return nil
+}
+
+// countNodes returns the number of declared nodes below root.
+func countNodes(root parser.Node) int {
+	count := 0
+	for _, child := range root.Children {
+		count += 1 + countNodes(child)
+	}
+	return count
 }
@@ -1,8 +1,16 @@
 package diagram
 
 import (
+	"bytes"
+	"context"
 	_ "embed"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
 )
 
 //go:embed fixtures/code_block_1.txt
@@ -48,3 +56,278 @@ func TestCreateDiagramFromActualCodeBlocks(t *testing.T) {
 	}
 
 }
+
+func TestCreateDiagramWithOptionsEnforcesLimits(t *testing.T) {
+	testData := []struct {
+		name   string
+		code   string
+		limits Limits
+	}{
+		{
+			name:   "canvas too large",
+			code:   "@layout(w:100000,h:100000)\nserver:Server",
+			limits: Limits{MaxCanvasPixels: 4096 * 4096},
+		},
+		{
+			name:   "too many nodes",
+			code:   "vm:VM {\na:Server\nb:Server\n}",
+			limits: Limits{MaxNodes: 2},
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.name, func(t *testing.T) {
+			_, _, _, err := CreateDiagramWithOptions(context.Background(), td.code, Options{Limits: td.limits})
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("expected ErrLimitExceeded, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateDiagramWithOptionsHonoursCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, _, err := CreateDiagramWithOptions(ctx, "server:Server", Options{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRenderReturnsFormatContentType(t *testing.T) {
+	out, err := Render(context.Background(), "server:Server", FormatSVG, Options{Scale: 2, Theme: "dark"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.ContentType != "image/svg+xml" {
+		t.Fatalf("expected image/svg+xml, got %s", out.ContentType)
+	}
+	if !strings.Contains(string(out.Data), `width="1600" height="800" viewBox="0 0 800 400"`) {
+		t.Fatalf("expected scaled svg header, got: %s", out.Data)
+	}
+}
+
+func TestDiagnosticsLocateParseErrors(t *testing.T) {
+	code := "vm:VM {\n  app:Server\n  db:Database"
+	_, err := Render(context.Background(), code, FormatSVG, Options{})
+	if err == nil {
+		t.Fatal("expected parse error")
+	}
+
+	diagnostics := Diagnostics(code, err)
+	if len(diagnostics) != 1 || diagnostics[0].Span == nil {
+		t.Fatalf("expected one located diagnostic, got %+v", diagnostics)
+	}
+	if diagnostics[0].Message != "unexpected end of input: missing closing brace" {
+		t.Fatalf("unexpected message %q", diagnostics[0].Message)
+	}
+	if start := diagnostics[0].Span.Start; start.Line != 3 || start.Column != 6 {
+		t.Fatalf("expected diagnostic at 3:6, got %d:%d", start.Line, start.Column)
+	}
+}
+
+func TestStrictModeReportsFallbacksAsErrors(t *testing.T) {
+	code := "a:Servr\nb:Server@b\na.e --> c.w\n@b(x: 10, prot: 80)"
+
+	out, err := Render(context.Background(), code, FormatSVG, Options{})
+	if err != nil {
+		t.Fatalf("non-strict render: %v", err)
+	}
+	if len(out.Warnings) != 3 {
+		t.Fatalf("expected 3 warnings, got %+v", out.Warnings)
+	}
+	for _, w := range out.Warnings {
+		if w.Severity != SeverityWarning || w.Span == nil {
+			t.Fatalf("expected located warnings, got %+v", w)
+		}
+	}
+
+	_, err = Render(context.Background(), code, FormatSVG, Options{Strict: true})
+	var strictErr *StrictError
+	if !errors.As(err, &strictErr) {
+		t.Fatalf("expected a StrictError, got %v", err)
+	}
+	diagnostics := Diagnostics(code, err)
+	if len(diagnostics) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %+v", diagnostics)
+	}
+	want := []string{"a:Servr", "a.e --> c.w", "prot"}
+	for i, d := range diagnostics {
+		if d.Severity != SeverityError || d.Span == nil {
+			t.Fatalf("expected located errors, got %+v", d)
+		}
+		if got := code[d.Span.Start.Offset:d.Span.End.Offset]; got != want[i] {
+			t.Errorf("diagnostic %d: expected span %q, got %q", i, want[i], got)
+		}
+	}
+
+	if _, err := Render(context.Background(), "a:Server@a\n@a(x: 10)", FormatSVG, Options{Strict: true}); err != nil {
+		t.Fatalf("expected a clean diagram to pass strict mode, got %v", err)
+	}
+}
+
+func TestStrictModeLocatesPropsThatDoNotParse(t *testing.T) {
+	code := "a:Server@a\n@a(x: 10, port: eighty, title: \"A\")\n@layout(w: 400, cols: many)"
+
+	_, err := Render(context.Background(), code, FormatSVG, Options{Strict: true})
+	diagnostics := Diagnostics(code, err)
+	want := []string{"port", "cols"}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("expected %d diagnostics, got %+v", len(want), diagnostics)
+	}
+	for i, d := range diagnostics {
+		if d.Span == nil {
+			t.Fatalf("expected located errors, got %+v", d)
+		}
+		if got := code[d.Span.Start.Offset:d.Span.End.Offset]; got != want[i] {
+			t.Errorf("diagnostic %d: expected span %q, got %q (%s)", i, want[i], got, d.Message)
+		}
+	}
+}
+
+func TestRenderReportsWhatExportsDrop(t *testing.T) {
+	code := "a:Server@a\nb:Database@b\na.e --> b.w\n@a(x: 10)\n@b(x: 300, engine: \"Redis\")"
+
+	out, err := Render(context.Background(), code, FormatMermaid, Options{Strict: true})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(string(out.Data), "a --> b") {
+		t.Fatalf("expected the connection as an edge, got:\n%s", out.Data)
+	}
+	if len(out.Warnings) != 2 || out.Warnings[0].Severity != SeverityWarning {
+		t.Fatalf("expected warnings for the engine and the anchors, got %+v", out.Warnings)
+	}
+}
+
+func TestRenderJSONIsTheResolvedLayout(t *testing.T) {
+	out, err := Render(context.Background(), "a:Server@a\nb:Server@b\na.e --> b.w\n@a(x: 10)\n@b(x: 300)", FormatJSON, Options{})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	var doc layout.Document
+	if err := json.Unmarshal(out.Data, &doc); err != nil {
+		t.Fatalf("decode: %v\n%s", err, out.Data)
+	}
+	if out.ContentType != "application/json" || doc.Version != layout.DocumentVersion || len(doc.Nodes) != 2 || len(doc.Arrows) != 1 {
+		t.Fatalf("unexpected document %s", out.Data)
+	}
+	if doc.Nodes[1].Bounds.X != 300 || doc.Arrows[0].To.Node != "b" {
+		t.Fatalf("expected resolved geometry, got %s", out.Data)
+	}
+}
+
+func TestRenderPDFPutsEachStepOnAPage(t *testing.T) {
+	code := "a:Server@a\nb:Server@b\nc:Server@c\na.e --> b.w\nb.e --> c.w\n@a(x: 10)\n@b(x: 300)\n@c(x: 600)"
+	pages := regexp.MustCompile(`/Count (\d+)`)
+	for _, tc := range []struct {
+		opts  Options
+		pages string
+	}{
+		{Options{}, "1"},
+		{Options{Steps: true}, "2"},
+		{Options{Steps: true, Step: 1}, "1"},
+	} {
+		out, err := Render(context.Background(), code, FormatPDF, tc.opts)
+		if err != nil {
+			t.Fatalf("render %+v: %v", tc.opts, err)
+		}
+		if !bytes.HasPrefix(out.Data, []byte("%PDF-")) || out.ContentType != "application/pdf" {
+			t.Fatalf("expected a pdf, got %q", out.Data[:min(len(out.Data), 16)])
+		}
+		if m := pages.FindSubmatch(out.Data); m == nil || string(m[1]) != tc.pages {
+			t.Fatalf("render %+v: expected %s pages, got %q", tc.opts, tc.pages, m)
+		}
+	}
+
+	if _, err := Render(context.Background(), code, FormatSVG, Options{Steps: true}); !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("expected steps to need a paged format, got %v", err)
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	out, err := Render(context.Background(), "a:Server@a\nb:Server@b\na.e --> b.w\n@a(x: 0, y: 0, w: 80, h: 48, title: \"A\")\n@b(x: 160, y: 0, w: 80, h: 48, title: \"B\")", FormatText, Options{})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	want := "┌─────────┐         ┌─────────┐\n│    A    │         │    B    │\n│         ├────────►│         │\n└─────────┘         └─────────┘\n"
+	if string(out.Data) != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, out.Data)
+	}
+}
+
+func TestRenderBatchKeepsInputOrderAndIsolatesFailures(t *testing.T) {
+	items := []BatchItem{
+		{Name: "one", Source: "server:Server"},
+		{Name: "broken", Source: "vm:VM {"},
+		{Name: "three", Source: "db:Database"},
+	}
+
+	results := RenderBatch(context.Background(), items, BatchOptions{Format: FormatSVG, Workers: 2})
+	if len(results) != len(items) {
+		t.Fatalf("expected %d results, got %d", len(items), len(results))
+	}
+	for i, result := range results {
+		if result.Name != items[i].Name {
+			t.Fatalf("result %d: expected %s, got %s", i, items[i].Name, result.Name)
+		}
+		failed := result.Err != nil
+		if failed != (result.Name == "broken") {
+			t.Fatalf("result %s: unexpected error state %v", result.Name, result.Err)
+		}
+		if !failed && len(result.Output.Data) == 0 {
+			t.Fatalf("result %s: expected output", result.Name)
+		}
+	}
+}
+
+func TestFormatIsCanonicalAndIdempotent(t *testing.T) {
+	source := "@layout(w:400,h:200)\na:Server@api\n\n\n@api(title : 'API',port:80 ,x:&b.c)\nb:Database\na.e-->b.w\n"
+	want := "a:Server@api\nb:Database\n\na.e --> b.w\n\n@layout(w: 400, h: 200)\n\n@api(title: \"API\", port: 80, x: &b.c)\n"
+
+	got, err := Format(source)
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+	again, err := Format(got)
+	if err != nil || again != got {
+		t.Fatalf("expected formatting to be idempotent, got %q (%v)", again, err)
+	}
+}
+
+func TestFormatKeepsDefinitionsOffTheLastDeclaration(t *testing.T) {
+	// Printed right after b, a definition would be read as a state of b.
+	tests := []struct{ source, want string }{
+		{
+			"@layout(w:800,h:300)\n@var(gap:20)\na:Server\nb:Server\n",
+			"@layout(w: 800, h: 300)\n@var(gap: 20)\n\na:Server\nb:Server\n",
+		},
+		{
+			"@var(gap:20)\n@layout(w:800,h:300)\na:Server@a\n@a(x:$gap)\nb:Server\n",
+			"@var(gap: 20)\n@layout(w: 800, h: 300)\n\na:Server@a\n\n@a(x: $gap)\n\nb:Server\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := Format(tt.source)
+		if err != nil {
+			t.Fatalf("format %q: %v", tt.source, err)
+		}
+		if got != tt.want {
+			t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, tt.want)
+		}
+		again, err := Format(got)
+		if err != nil || again != got {
+			t.Fatalf("expected formatting to be idempotent, got %q (%v)", again, err)
+		}
+	}
+}
+
+func TestFormatRefusesToChangeMeaning(t *testing.T) {
+	// The state is defined before a is declared, so it does not apply to a yet.
+	if _, err := Format("@a(x:1)\na:Server"); !errors.Is(err, ErrFormatChangesMeaning) {
+		t.Fatalf("expected ErrFormatChangesMeaning, got %v", err)
+	}
+}
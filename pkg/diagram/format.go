@@ -0,0 +1,81 @@
+package diagram
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+// ErrFormatChangesMeaning is returned by Format when the canonical layout would be read
+// differently from the original source. The source is left as it is.
+var ErrFormatChangesMeaning = errors.New("formatting would change the meaning of the diagram")
+
+// Format returns source in canonical form: declarations, then connections, then state
+// definitions, with normalised prop spacing and quoting. The result is parsed again and
+// compared with the original, so formatting never changes the nodes, connections or
+// state definitions of a diagram. Moving states after the declarations does make every
+// state apply to every node it names, which is how layout already reads them.
+func Format(source string) (string, error) {
+	file, err := parser.ParseFile(source)
+	if err != nil {
+		return "", err
+	}
+	formatted := parser.Print(file)
+
+	before, err := parser.Parse(tokenizer.Tokenize(source))
+	if err != nil {
+		return "", err
+	}
+	after, err := parser.Parse(tokenizer.Tokenize(formatted))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrFormatChangesMeaning, err)
+	}
+	if want, got := signature(before), signature(after); want != got {
+		return "", fmt.Errorf("%w:\n%s", ErrFormatChangesMeaning, firstDifference(want, got))
+	}
+	return formatted, nil
+}
+
+// signature describes what a parsed diagram means, independent of statement order.
+func signature(root parser.Node) string {
+	var b strings.Builder
+	for _, imp := range root.Imports {
+		fmt.Fprintf(&b, "import %q as %s\n", imp.Path, imp.Namespace)
+	}
+	var walk func(nodes []parser.Node, depth int)
+	walk = func(nodes []parser.Node, depth int) {
+		for _, node := range nodes {
+			fmt.Fprintf(&b, "%snode %s:%s@%s\n", strings.Repeat("  ", depth), node.Text, node.Type, node.State)
+			walk(node.Children, depth+1)
+		}
+	}
+	walk(root.Children, 0)
+
+	for _, conn := range root.Connections {
+		fmt.Fprintf(&b, "connection %s.%s --> %s.%s\n", conn.FromID, conn.FromAnchor.Raw, conn.ToID, conn.ToAnchor.Raw)
+	}
+
+	names := make([]string, 0, len(root.Globals))
+	for name := range root.Globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "state %s(%s)\n", name, root.Globals[name].PropsDef)
+	}
+	return b.String()
+}
+
+func firstDifference(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) && i < len(gotLines); i++ {
+		if wantLines[i] != gotLines[i] {
+			return fmt.Sprintf("  was:   %s\n  would: %s", wantLines[i], gotLines[i])
+		}
+	}
+	return fmt.Sprintf("  was %d lines, would be %d", len(wantLines), len(gotLines))
+}
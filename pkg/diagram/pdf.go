@@ -0,0 +1,601 @@
+package diagram
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/pdf"
+	"golang.org/x/image/colornames"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// renderPDF draws the diagram as a vector PDF. With opts.Steps each step is a page of
+// its own, every page the size of the whole diagram, and the last page shows it all.
+func renderPDF(ctx context.Context, m *model, opts Options) ([]byte, error) {
+	doc := pdf.New()
+	fonts := &pdfFonts{doc: doc}
+
+	layouts := []layout.Layout{m.Layout}
+	if opts.Steps && len(m.AST.Connections) > 1 {
+		layouts = layouts[:0]
+		for step := 1; step <= len(m.AST.Connections); step++ {
+			ast := m.AST
+			ast.Connections = m.AST.Connections[:step]
+			layouts = append(layouts, layout.Calculate(ast, defaultCanvasWidth, defaultCanvasHeight))
+		}
+	}
+
+	for _, l := range layouts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page := &model{AST: m.AST, Layout: l, Width: m.Width, Height: m.Height}
+		if err := drawSVGPage(doc, fonts, renderSVG(page, opts)); err != nil {
+			return nil, fmt.Errorf("convert to pdf: %w", err)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := doc.Write(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// svgNode is an element of a parsed SVG document. Character data is kept as children
+// named "#text", so the runs of a text element stay in order.
+type svgNode struct {
+	Name     string
+	Attrs    map[string]string
+	Text     string
+	Children []*svgNode
+}
+
+func parseSVGTree(svg string) (*svgNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader(svg))
+	root := &svgNode{Name: "#document"}
+	stack := []*svgNode{root}
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &svgNode{Name: t.Name.Local, Attrs: make(map[string]string, len(t.Attr))}
+			for _, attr := range t.Attr {
+				node.Attrs[attr.Name.Local] = attr.Value
+			}
+			// Declarations in style take precedence over attributes.
+			for _, decl := range strings.Split(node.Attrs["style"], ";") {
+				if key, value, ok := strings.Cut(decl, ":"); ok {
+					node.Attrs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+				}
+			}
+			parent.Children = append(parent.Children, node)
+			stack = append(stack, node)
+		case xml.CharData:
+			parent.Children = append(parent.Children, &svgNode{Name: "#text", Text: string(t)})
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	for _, child := range root.Children {
+		if child.Name == "svg" {
+			return child, nil
+		}
+	}
+	return nil, fmt.Errorf("no svg element")
+}
+
+// svgStyle is the presentation of an SVG element, inherited from its ancestors.
+type svgStyle struct {
+	Fill, Stroke               string // Paint, or "none"
+	StrokeWidth                float64
+	Opacity                    float64 // Of the element and its ancestors, multiplied
+	FillOpacity, StrokeOpacity float64
+	Dash                       []float64
+	LineCap, LineJoin          string
+	FontFamily, FontWeight     string
+	FontSize                   float64
+	TextAnchor, Baseline       string
+}
+
+func defaultSVGStyle() svgStyle {
+	return svgStyle{Fill: "black", Stroke: "none", StrokeWidth: 1, Opacity: 1, FillOpacity: 1, StrokeOpacity: 1, FontSize: 16}
+}
+
+// inherit returns the style of n, a child of an element styled s.
+func (s svgStyle) inherit(n *svgNode) svgStyle {
+	a := n.Attrs
+	if v, ok := a["fill"]; ok {
+		s.Fill = v
+	}
+	if v, ok := a["stroke"]; ok {
+		s.Stroke = v
+	}
+	if v, ok := a["stroke-width"]; ok {
+		s.StrokeWidth = parseSVGFloat(v, s.StrokeWidth)
+	}
+	if v, ok := a["opacity"]; ok {
+		s.Opacity *= parseSVGFloat(v, 1)
+	}
+	if v, ok := a["fill-opacity"]; ok {
+		s.FillOpacity = parseSVGFloat(v, 1)
+	}
+	if v, ok := a["stroke-opacity"]; ok {
+		s.StrokeOpacity = parseSVGFloat(v, 1)
+	}
+	if v, ok := a["stroke-dasharray"]; ok {
+		s.Dash = nil
+		if v != "none" {
+			s.Dash = parseNumberList(v)
+		}
+	}
+	if v, ok := a["stroke-linecap"]; ok {
+		s.LineCap = v
+	}
+	if v, ok := a["stroke-linejoin"]; ok {
+		s.LineJoin = v
+	}
+	if v, ok := a["font-family"]; ok {
+		s.FontFamily = v
+	}
+	if v, ok := a["font-weight"]; ok {
+		s.FontWeight = v
+	}
+	if v, ok := a["font-size"]; ok {
+		s.FontSize = parseSVGFloat(v, s.FontSize)
+	}
+	if v, ok := a["text-anchor"]; ok {
+		s.TextAnchor = v
+	}
+	if v, ok := a["dominant-baseline"]; ok {
+		s.Baseline = v
+	}
+	return s
+}
+
+// pdfFonts loads the Go fonts into a document as text first needs each of them.
+type pdfFonts struct {
+	doc    *pdf.Document
+	loaded map[string]*pdf.Font
+}
+
+// pick returns the font closest to family and weight: Go Mono for monospaced families,
+// Go Regular otherwise, in bold for bold weights.
+func (f *pdfFonts) pick(family, weight string) (*pdf.Font, error) {
+	family = strings.ToLower(family)
+	mono := strings.Contains(family, "mono") || strings.Contains(family, "menlo") || strings.Contains(family, "courier") || strings.Contains(family, "consolas")
+	bold := weight == "bold" || weight == "bolder" || parseSVGFloat(weight, 400) >= 600
+
+	key, ttf := "regular", goregular.TTF
+	switch {
+	case mono && bold:
+		key, ttf = "mono-bold", gomonobold.TTF
+	case mono:
+		key, ttf = "mono", gomono.TTF
+	case bold:
+		key, ttf = "bold", gobold.TTF
+	}
+	if font, ok := f.loaded[key]; ok {
+		return font, nil
+	}
+	font, err := f.doc.LoadFont(ttf)
+	if err != nil {
+		return nil, err
+	}
+	if f.loaded == nil {
+		f.loaded = make(map[string]*pdf.Font)
+	}
+	f.loaded[key] = font
+	return font, nil
+}
+
+// svgPainter draws the elements of one SVG document on a page.
+type svgPainter struct {
+	page    *pdf.Page
+	fonts   *pdfFonts
+	markers map[string]*svgNode
+}
+
+// drawSVGPage adds a page the size of svg to doc and draws svg on it.
+func drawSVGPage(doc *pdf.Document, fonts *pdfFonts, svg string) error {
+	root, err := parseSVGTree(svg)
+	if err != nil {
+		return fmt.Errorf("parse svg: %w", err)
+	}
+
+	width := parseSVGFloat(root.Attrs["width"], 0)
+	height := parseSVGFloat(root.Attrs["height"], 0)
+	box := parseNumberList(root.Attrs["viewBox"])
+	if len(box) == 4 && width == 0 && height == 0 {
+		width, height = box[2], box[3]
+	}
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid canvas size: %vx%v", width, height)
+	}
+
+	p := &svgPainter{page: doc.AddPage(width, height), fonts: fonts, markers: make(map[string]*svgNode)}
+	var collect func(n *svgNode)
+	collect = func(n *svgNode) {
+		if n.Name == "marker" && n.Attrs["id"] != "" {
+			p.markers[n.Attrs["id"]] = n
+		}
+		for _, child := range n.Children {
+			collect(child)
+		}
+	}
+	collect(root)
+
+	if len(box) == 4 && box[2] > 0 && box[3] > 0 {
+		p.page.Transform(width/box[2], 0, 0, height/box[3], -box[0]*width/box[2], -box[1]*height/box[3])
+	}
+	return p.drawChildren(root, defaultSVGStyle())
+}
+
+func (p *svgPainter) drawChildren(n *svgNode, style svgStyle) error {
+	for _, child := range n.Children {
+		if err := p.draw(child, style); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// draw draws n and its children. Filters are left out.
+func (p *svgPainter) draw(n *svgNode, parent svgStyle) error {
+	switch n.Name {
+	case "#text", "defs", "marker", "title", "desc", "filter", "style":
+		return nil
+	}
+	if n.Attrs["display"] == "none" || n.Attrs["visibility"] == "hidden" {
+		return nil
+	}
+	style := parent.inherit(n)
+
+	transform := n.Attrs["transform"]
+	if transform != "" {
+		t := parseTransformAttribute(transform)
+		p.page.Save()
+		p.page.Transform(t.a, t.b, t.c, t.d, t.e, t.f)
+		defer p.page.Restore()
+	}
+
+	a := func(key string) float64 { return parseSVGFloat(n.Attrs[key], 0) }
+	switch n.Name {
+	case "g", "svg", "a":
+		return p.drawChildren(n, style)
+	case "rect":
+		w, h := a("width"), a("height")
+		if w <= 0 || h <= 0 {
+			return nil
+		}
+		rx, ry := roundedCorners(n, w, h)
+		p.paint(style, svgRoundedRect(a("x"), a("y"), w, h, rx, ry), nil)
+	case "circle":
+		r := a("r")
+		p.paint(style, svgEllipse(a("cx"), a("cy"), r, r), nil)
+	case "ellipse":
+		p.paint(style, svgEllipse(a("cx"), a("cy"), a("rx"), a("ry")), nil)
+	case "line":
+		path := svgPathData{{op: 'M', pts: []layout.Point{{X: a("x1"), Y: a("y1")}}}, {op: 'L', pts: []layout.Point{{X: a("x2"), Y: a("y2")}}}}
+		p.paint(style, path, n)
+	case "polyline", "polygon":
+		nums := parseNumberList(n.Attrs["points"])
+		var path svgPathData
+		for i := 0; i+1 < len(nums); i += 2 {
+			op := byte('L')
+			if i == 0 {
+				op = 'M'
+			}
+			path = append(path, svgSegment{op: op, pts: []layout.Point{{X: nums[i], Y: nums[i+1]}}})
+		}
+		if n.Name == "polygon" && len(path) > 0 {
+			path = append(path, svgSegment{op: 'Z'})
+		}
+		p.paint(style, path, n)
+	case "path":
+		p.paint(style, parseSVGPath(n.Attrs["d"]), n)
+	case "text":
+		return p.text(n, style)
+	}
+	return nil
+}
+
+// roundedCorners returns the corner radii of a rect, each defaulting to the other and
+// at most half the side it rounds.
+func roundedCorners(n *svgNode, w, h float64) (rx, ry float64) {
+	rx, hasX := parseSVGFloat(n.Attrs["rx"], 0), n.Attrs["rx"] != ""
+	ry, hasY := parseSVGFloat(n.Attrs["ry"], 0), n.Attrs["ry"] != ""
+	if !hasX {
+		rx = ry
+	}
+	if !hasY {
+		ry = rx
+	}
+	return math.Min(math.Max(rx, 0), w/2), math.Min(math.Max(ry, 0), h/2)
+}
+
+// paint fills and strokes path as style says, then draws the markers n refers to.
+func (p *svgPainter) paint(style svgStyle, path svgPathData, n *svgNode) {
+	if len(path) == 0 {
+		return
+	}
+	fill, hasFill := svgPaint(style.Fill, style.FillOpacity*style.Opacity)
+	stroke, hasStroke := svgPaint(style.Stroke, style.StrokeOpacity*style.Opacity)
+	hasStroke = hasStroke && style.StrokeWidth > 0
+	if hasFill || hasStroke {
+		if hasFill {
+			p.page.SetFillColor(fill)
+		}
+		if hasStroke {
+			p.setStroke(style, stroke)
+		}
+		path.trace(p.page)
+		switch {
+		case hasFill && hasStroke:
+			p.page.FillStroke()
+		case hasFill:
+			p.page.Fill()
+		default:
+			p.page.Stroke()
+		}
+	}
+	if n != nil {
+		p.markersOf(n, style, path)
+	}
+}
+
+func (p *svgPainter) setStroke(style svgStyle, c color.Color) {
+	p.page.SetStrokeColor(c)
+	p.page.SetLineWidth(style.StrokeWidth)
+	switch style.LineCap {
+	case "round":
+		p.page.SetLineCap(pdf.RoundCap)
+	case "square":
+		p.page.SetLineCap(pdf.SquareCap)
+	default:
+		p.page.SetLineCap(pdf.ButtCap)
+	}
+	switch style.LineJoin {
+	case "round":
+		p.page.SetLineJoin(pdf.RoundJoin)
+	case "bevel":
+		p.page.SetLineJoin(pdf.BevelJoin)
+	default:
+		p.page.SetLineJoin(pdf.MiterJoin)
+	}
+	dash := style.Dash
+	if len(dash)%2 == 1 {
+		dash = append(dash, dash...) // SVG repeats an odd list to make it even
+	}
+	p.page.SetDash(dash, 0)
+}
+
+// markersOf draws the start and end markers n refers to at the ends of path, turned to
+// follow it.
+func (p *svgPainter) markersOf(n *svgNode, style svgStyle, path svgPathData) {
+	for _, end := range []struct {
+		attr  string
+		start bool
+	}{{"marker-start", true}, {"marker-end", false}} {
+		ref := strings.TrimSpace(n.Attrs[end.attr])
+		if !strings.HasPrefix(ref, "url(#") {
+			continue
+		}
+		marker, ok := p.markers[strings.TrimSuffix(strings.TrimPrefix(ref, "url(#"), ")")]
+		if !ok {
+			continue
+		}
+		at, angle, ok := path.end(end.start)
+		if !ok {
+			continue
+		}
+		switch orient := marker.Attrs["orient"]; orient {
+		case "auto":
+		case "auto-start-reverse":
+			if end.start {
+				angle += math.Pi
+			}
+		default:
+			angle = parseSVGFloat(orient, 0) * math.Pi / 180
+		}
+		p.marker(marker, style, at, angle)
+	}
+}
+
+// marker draws marker at the point at, turned by angle, scaled to the stroke width of
+// the line it ends as SVG's default markerUnits asks.
+func (p *svgPainter) marker(marker *svgNode, line svgStyle, at layout.Point, angle float64) {
+	mw := parseSVGFloat(marker.Attrs["markerWidth"], 3)
+	mh := parseSVGFloat(marker.Attrs["markerHeight"], 3)
+	sx, sy := 1.0, 1.0
+	if box := parseNumberList(marker.Attrs["viewBox"]); len(box) == 4 && box[2] > 0 && box[3] > 0 {
+		// preserveAspectRatio's default keeps the aspect ratio and fits the box.
+		sx = math.Min(mw/box[2], mh/box[3])
+		sy = sx
+	}
+	units := line.StrokeWidth
+	if marker.Attrs["markerUnits"] == "userSpaceOnUse" {
+		units = 1
+	}
+
+	p.page.Save()
+	defer p.page.Restore()
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	p.page.Transform(cos, sin, -sin, cos, at.X, at.Y)
+	p.page.Transform(units*sx, 0, 0, units*sy, 0, 0)
+	p.page.Transform(1, 0, 0, 1, -parseSVGFloat(marker.Attrs["refX"], 0), -parseSVGFloat(marker.Attrs["refY"], 0))
+	// Marker content inherits from the marker, not from the line it ends.
+	style := defaultSVGStyle().inherit(marker)
+	style.Opacity *= line.Opacity
+	p.drawChildren(marker, style)
+}
+
+// text sets a text element and the spans in it as one line, anchored and aligned to its
+// baseline as it says.
+func (p *svgPainter) text(n *svgNode, style svgStyle) error {
+	type run struct {
+		text  string
+		style svgStyle
+	}
+	var runs []run
+	var collect func(n *svgNode, style svgStyle)
+	collect = func(n *svgNode, style svgStyle) {
+		for _, child := range n.Children {
+			switch child.Name {
+			case "#text":
+				runs = append(runs, run{child.Text, style})
+			case "tspan":
+				collect(child, style.inherit(child))
+			}
+		}
+	}
+	collect(n, style)
+
+	// Collapse white space as SVG does, across the runs.
+	space := true
+	for i := range runs {
+		var b strings.Builder
+		for _, r := range runs[i].text {
+			if r == ' ' || r == '\n' || r == '\t' || r == '\r' {
+				if !space {
+					b.WriteRune(' ')
+				}
+				space = true
+				continue
+			}
+			b.WriteRune(r)
+			space = false
+		}
+		runs[i].text = b.String()
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		trimmed := strings.TrimRight(runs[i].text, " ")
+		runs[i].text = trimmed
+		if trimmed != "" {
+			break
+		}
+	}
+
+	width := 0.0
+	for _, r := range runs {
+		f, err := p.fonts.pick(r.style.FontFamily, r.style.FontWeight)
+		if err != nil {
+			return err
+		}
+		width += f.Width(r.text, r.style.FontSize)
+	}
+	if width == 0 {
+		return nil
+	}
+
+	x := parseSVGFloat(splitFirstValue(n.Attrs["x"]), 0)
+	y := parseSVGFloat(splitFirstValue(n.Attrs["y"]), 0)
+	switch style.TextAnchor {
+	case "middle":
+		x -= width / 2
+	case "end":
+		x -= width
+	}
+	first, err := p.fonts.pick(style.FontFamily, style.FontWeight)
+	if err != nil {
+		return err
+	}
+	ascent, descent := first.Metrics(style.FontSize)
+	switch style.Baseline {
+	case "middle", "central":
+		y += (ascent - descent) / 2
+	case "hanging", "text-before-edge":
+		y += ascent
+	case "text-after-edge":
+		y -= descent
+	}
+
+	for _, r := range runs {
+		f, _ := p.fonts.pick(r.style.FontFamily, r.style.FontWeight)
+		if c, ok := svgPaint(r.style.Fill, r.style.FillOpacity*r.style.Opacity); ok && r.text != "" {
+			p.page.SetFillColor(c)
+			p.page.Text(f, r.style.FontSize, x, y, r.text)
+		}
+		x += f.Width(r.text, r.style.FontSize)
+	}
+	return nil
+}
+
+// svgPaint returns the colour value paints with at opacity, and false for none and
+// paints it cannot read, such as gradients.
+func svgPaint(value string, opacity float64) (color.NRGBA, bool) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	var c color.NRGBA
+	switch {
+	case v == "" || v == "none" || strings.HasPrefix(v, "url("):
+		return c, false
+	case v == "transparent":
+		return c, false
+	case strings.HasPrefix(v, "#"):
+		digits := v[1:]
+		if len(digits) == 3 || len(digits) == 4 {
+			var expanded strings.Builder
+			for _, d := range digits {
+				expanded.WriteString(strings.Repeat(string(d), 2))
+			}
+			digits = expanded.String()
+		}
+		if len(digits) == 6 {
+			digits += "ff"
+		}
+		n, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || len(digits) != 8 {
+			return c, false
+		}
+		c = color.NRGBA{R: uint8(n >> 24), G: uint8(n >> 16), B: uint8(n >> 8), A: uint8(n)}
+	case strings.HasPrefix(v, "rgb"):
+		_, args, _ := strings.Cut(strings.TrimSuffix(v, ")"), "(")
+		parts := strings.Split(args, ",")
+		if len(parts) < 3 {
+			return c, false
+		}
+		channels := [4]float64{0, 0, 0, 1}
+		for i := 0; i < len(parts) && i < 4; i++ {
+			part := strings.TrimSpace(parts[i])
+			limit := 255.0
+			if i == 3 {
+				limit = 1
+			}
+			if strings.HasSuffix(part, "%") {
+				part, limit = strings.TrimSuffix(part, "%"), 100
+			}
+			f, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return c, false
+			}
+			channels[i] = math.Max(0, math.Min(f/limit, 1))
+		}
+		c = color.NRGBA{R: uint8(math.Round(channels[0] * 255)), G: uint8(math.Round(channels[1] * 255)), B: uint8(math.Round(channels[2] * 255)), A: uint8(math.Round(channels[3] * 255))}
+	default:
+		named, ok := colornames.Map[v]
+		if !ok {
+			return c, false
+		}
+		c = color.NRGBA{R: named.R, G: named.G, B: named.B, A: 255}
+	}
+	c.A = uint8(math.Round(float64(c.A) * math.Max(0, math.Min(opacity, 1))))
+	return c, c.A > 0
+}
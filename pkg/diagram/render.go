@@ -0,0 +1,208 @@
+package diagram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/saasuke-labs/nagare/pkg/dot"
+	"github.com/saasuke-labs/nagare/pkg/exporter"
+	"github.com/saasuke-labs/nagare/pkg/textgrid"
+)
+
+// OutputFormat names an output format supported by Render.
+type OutputFormat string
+
+const (
+	FormatSVG        OutputFormat = "svg"
+	FormatWebP       OutputFormat = "webp"
+	FormatDOT        OutputFormat = "dot"
+	FormatDrawIO     OutputFormat = "drawio"
+	FormatExcalidraw OutputFormat = "excalidraw"
+	FormatMermaid    OutputFormat = "mermaid"
+	FormatPlantUML   OutputFormat = "plantuml"
+	FormatJSON       OutputFormat = "json"
+	FormatPDF        OutputFormat = "pdf"
+	FormatText       OutputFormat = "txt"
+)
+
+// formatInfo describes how to produce one output format from a built model.
+type formatInfo struct {
+	ContentType string
+	Extension   string
+	Rasterized  bool // Allocates a full pixel canvas; callers may want to bound concurrency
+	Paged       bool // Holds pages, so Options.Steps can put each step on its own
+	render      func(ctx context.Context, m *model, opts Options) ([]byte, error)
+}
+
+var formats = map[OutputFormat]formatInfo{
+	FormatSVG: {
+		ContentType: "image/svg+xml",
+		Extension:   ".svg",
+		render: func(_ context.Context, m *model, opts Options) ([]byte, error) {
+			return []byte(renderSVG(m, opts)), nil
+		},
+	},
+	FormatWebP: {
+		ContentType: "image/webp",
+		Extension:   ".webp",
+		Rasterized:  true,
+		render:      rasterizeModel,
+	},
+	FormatPDF: {
+		ContentType: "application/pdf",
+		Extension:   ".pdf",
+		Paged:       true,
+		render:      renderPDF,
+	},
+	FormatText: {
+		ContentType: "text/plain; charset=utf-8",
+		Extension:   ".txt",
+		render: func(_ context.Context, m *model, opts Options) ([]byte, error) {
+			return []byte(textgrid.Render(m.Layout, m.Width, m.Height, textgrid.Options{Scale: opts.Scale})), nil
+		},
+	},
+	FormatJSON: {
+		ContentType: "application/json",
+		Extension:   ".json",
+		render: func(_ context.Context, m *model, _ Options) ([]byte, error) {
+			data, err := json.MarshalIndent(m.Layout.Document(), "", "  ")
+			return append(data, '\n'), err
+		},
+	},
+	FormatDOT: {
+		ContentType: "text/vnd.graphviz",
+		Extension:   ".dot",
+		render: func(_ context.Context, m *model, _ Options) ([]byte, error) {
+			var b bytes.Buffer
+			err := dot.Write(&b, exporter.DOT(m.AST, m.Layout))
+			return b.Bytes(), err
+		},
+	},
+	FormatDrawIO: {
+		ContentType: "application/vnd.jgraph.mxfile",
+		Extension:   ".drawio",
+		render: func(_ context.Context, m *model, _ Options) ([]byte, error) {
+			var b bytes.Buffer
+			err := exporter.DrawIO(&b, m.Layout)
+			return b.Bytes(), err
+		},
+	},
+	FormatExcalidraw: {
+		ContentType: "application/vnd.excalidraw+json",
+		Extension:   ".excalidraw",
+		render: func(_ context.Context, m *model, opts Options) ([]byte, error) {
+			var b bytes.Buffer
+			err := exporter.Excalidraw(&b, m.Layout, opts.Roughness)
+			return b.Bytes(), err
+		},
+	},
+	FormatMermaid: {
+		ContentType: "text/vnd.mermaid",
+		Extension:   ".mmd",
+		render: func(_ context.Context, m *model, _ Options) ([]byte, error) {
+			var b bytes.Buffer
+			warnings, err := exporter.Mermaid(&b, m.AST, m.Layout)
+			m.warn(warnings)
+			return b.Bytes(), err
+		},
+	},
+	FormatPlantUML: {
+		ContentType: "text/vnd.plantuml",
+		Extension:   ".puml",
+		render: func(_ context.Context, m *model, _ Options) ([]byte, error) {
+			var b bytes.Buffer
+			warnings, err := exporter.PlantUML(&b, m.Layout)
+			m.warn(warnings)
+			return b.Bytes(), err
+		},
+	},
+}
+
+// Output is a rendered diagram.
+type Output struct {
+	Format      OutputFormat
+	ContentType string
+	Data        []byte
+	Width       int // Canvas width in diagram units, before scaling
+	Height      int // Canvas height in diagram units, before scaling
+	Warnings    []Diagnostic
+}
+
+// ParseFormat validates a format name.
+func ParseFormat(name string) (OutputFormat, error) {
+	format := OutputFormat(name)
+	if _, ok := formats[format]; !ok {
+		return "", fmt.Errorf("%w: unknown format %q (supported: %v)", ErrInvalidOptions, name, Formats())
+	}
+	return format, nil
+}
+
+// Formats lists the supported output formats in a stable order.
+func Formats() []OutputFormat {
+	list := make([]OutputFormat, 0, len(formats))
+	for format := range formats {
+		list = append(list, format)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// ContentType returns the MIME type for format.
+func (f OutputFormat) ContentType() string {
+	return formats[f].ContentType
+}
+
+// Extension returns the conventional file extension for format, including the dot.
+func (f OutputFormat) Extension() string {
+	return formats[f].Extension
+}
+
+// Paged reports whether format holds pages, and so can render each step on its own.
+func (f OutputFormat) Paged() bool {
+	return formats[f].Paged
+}
+
+// Rasterized reports whether producing format allocates a pixel canvas.
+func (f OutputFormat) Rasterized() bool {
+	return formats[f].Rasterized
+}
+
+// Render runs the full pipeline for code and encodes the result in the requested format.
+func Render(ctx context.Context, code string, format OutputFormat, opts Options) (Output, error) {
+	info, ok := formats[format]
+	if !ok {
+		return Output{}, fmt.Errorf("%w: unknown format %q", ErrInvalidOptions, format)
+	}
+	if opts.Steps && !info.Paged {
+		return Output{}, fmt.Errorf("%w: format %q has no pages to render steps on", ErrInvalidOptions, format)
+	}
+
+	m, err := build(ctx, code, opts)
+	if err != nil {
+		return Output{}, err
+	}
+
+	data, err := info.render(ctx, m, opts)
+	if err != nil {
+		return Output{}, err
+	}
+
+	return Output{
+		Format:      format,
+		ContentType: info.ContentType,
+		Data:        data,
+		Width:       m.Width,
+		Height:      m.Height,
+		Warnings:    m.Warnings,
+	}, nil
+}
+
+// warn adds what an exporter could not keep of the diagram to the warnings of m.
+func (m *model) warn(messages []string) {
+	for _, message := range messages {
+		m.Warnings = append(m.Warnings, Diagnostic{Severity: SeverityWarning, Message: message})
+	}
+}
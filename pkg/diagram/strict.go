@@ -0,0 +1,148 @@
+package diagram
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+// StrictError is returned in strict mode when the pipeline would otherwise fall back
+// silently, such as drawing an unknown type as a rectangle or ignoring a prop. It holds
+// every such problem, located in the source.
+type StrictError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *StrictError) Error() string {
+	first := e.Diagnostics[0]
+	msg := first.Message
+	if first.Span != nil {
+		msg = fmt.Sprintf("%d:%d: %s", first.Span.Start.Line, first.Span.Start.Column, msg)
+	}
+	if len(e.Diagnostics) > 1 {
+		msg = fmt.Sprintf("%s (and %d more)", msg, len(e.Diagnostics)-1)
+	}
+	return "strict mode: " + msg
+}
+
+// checkStrict turns warnings into a *StrictError when opts.Strict is set.
+func checkStrict(warnings []Diagnostic, opts Options) error {
+	if !opts.Strict || len(warnings) == 0 {
+		return nil
+	}
+	diagnostics := make([]Diagnostic, len(warnings))
+	for i, warning := range warnings {
+		warning.Severity = SeverityError
+		diagnostics[i] = warning
+	}
+	return &StrictError{Diagnostics: diagnostics}
+}
+
+// collectWarnings locates the layout's warnings in source. Source the formatter could not
+// print faithfully, such as a state that may belong to the declaration before it, is
+// reported too.
+func collectWarnings(source string, l layout.Layout) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	file, err := parser.ParseFile(source)
+	if err != nil {
+		// Parse accepted source already, so this is an ambiguity rather than a syntax error.
+		for _, d := range Diagnostics(source, err) {
+			d.Severity = SeverityWarning
+			diagnostics = append(diagnostics, d)
+		}
+		file = nil
+	}
+
+	for _, warning := range l.Warnings {
+		d := Diagnostic{Severity: SeverityWarning, Message: warning.Message}
+		if span, ok := locateWarning(file, warning); ok {
+			d.Span = NewSpan(source, span)
+		}
+		diagnostics = append(diagnostics, d)
+	}
+
+	// Report in source order; warnings that could not be located go last.
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Span, diagnostics[j].Span
+		return a != nil && (b == nil || a.Start.Offset < b.Start.Offset)
+	})
+	return diagnostics
+}
+
+// locateWarning finds the most specific span a warning refers to: a prop key, then its
+// state definition, then the declaration or connection.
+func locateWarning(file *parser.File, warning layout.Warning) (tokenizer.Span, bool) {
+	if file == nil {
+		return tokenizer.Span{}, false
+	}
+
+	stateName := warning.State
+	if stateName == "" && warning.Prop != "" {
+		// Props of a node live in the state named after it.
+		stateName = warning.Node
+	}
+	if stateName != "" {
+		if state, ok := findState(file.Statements, stateName); ok {
+			for _, prop := range state.Props {
+				if warning.Prop != "" && prop.Key == warning.Prop {
+					return prop.KeySpan, true
+				}
+			}
+			if warning.State != "" {
+				return state.Span, true
+			}
+		}
+	}
+
+	if warning.Node != "" {
+		if decl, ok := findDeclaration(file.Statements, warning.Node); ok {
+			return decl.Span, true
+		}
+	}
+	if warning.From != "" || warning.To != "" {
+		for _, stmt := range file.Statements {
+			if stmt.Kind == parser.StatementConnection && stmt.From == warning.From && stmt.To == warning.To {
+				return stmt.Span, true
+			}
+		}
+	}
+	return tokenizer.Span{}, false
+}
+
+func findState(statements []parser.Statement, name string) (parser.Statement, bool) {
+	for _, stmt := range statements {
+		if stmt.Kind == parser.StatementState && stmt.Name == name {
+			return stmt, true
+		}
+	}
+	return parser.Statement{}, false
+}
+
+func findDeclaration(statements []parser.Statement, id string) (parser.Statement, bool) {
+	for _, stmt := range statements {
+		if stmt.Kind != parser.StatementDeclaration {
+			continue
+		}
+		if stmt.ID == id {
+			return stmt, true
+		}
+		if child, ok := findDeclaration(stmt.Children, id); ok {
+			return child, true
+		}
+	}
+	return parser.Statement{}, false
+}
+
+// strictDiagnostics unwraps a *StrictError, if err is one.
+func strictDiagnostics(err error) ([]Diagnostic, bool) {
+	var strictErr *StrictError
+	if errors.As(err, &strictErr) {
+		return strictErr.Diagnostics, true
+	}
+	return nil, false
+}
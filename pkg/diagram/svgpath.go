@@ -0,0 +1,425 @@
+package diagram
+
+import (
+	"math"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/pdf"
+)
+
+// svgSegment is a step of a path in absolute coordinates: a move to or line to its one
+// point ('M', 'L'), a cubic curve through its two control points to its third ('C'), or
+// a line back to the start of the subpath ('Z').
+type svgSegment struct {
+	op  byte
+	pts []layout.Point
+}
+
+// svgPathData is an SVG path reduced to moves, lines and cubic curves, which is all a
+// PDF page draws.
+type svgPathData []svgSegment
+
+// kappa is how far along the tangent the control points of a cubic curve lie for it to
+// draw a quarter circle of radius 1.
+const kappa = 0.5522847498
+
+func svgRoundedRect(x, y, w, h, rx, ry float64) svgPathData {
+	pt := func(x, y float64) layout.Point { return layout.Point{X: x, Y: y} }
+	if rx <= 0 || ry <= 0 {
+		return svgPathData{
+			{'M', []layout.Point{pt(x, y)}},
+			{'L', []layout.Point{pt(x+w, y)}},
+			{'L', []layout.Point{pt(x+w, y+h)}},
+			{'L', []layout.Point{pt(x, y+h)}},
+			{'Z', nil},
+		}
+	}
+	kx, ky := rx*kappa, ry*kappa
+	return svgPathData{
+		{'M', []layout.Point{pt(x+rx, y)}},
+		{'L', []layout.Point{pt(x+w-rx, y)}},
+		{'C', []layout.Point{pt(x+w-rx+kx, y), pt(x+w, y+ry-ky), pt(x+w, y+ry)}},
+		{'L', []layout.Point{pt(x+w, y+h-ry)}},
+		{'C', []layout.Point{pt(x+w, y+h-ry+ky), pt(x+w-rx+kx, y+h), pt(x+w-rx, y+h)}},
+		{'L', []layout.Point{pt(x+rx, y+h)}},
+		{'C', []layout.Point{pt(x+rx-kx, y+h), pt(x, y+h-ry+ky), pt(x, y+h-ry)}},
+		{'L', []layout.Point{pt(x, y+ry)}},
+		{'C', []layout.Point{pt(x, y+ry-ky), pt(x+rx-kx, y), pt(x+rx, y)}},
+		{'Z', nil},
+	}
+}
+
+func svgEllipse(cx, cy, rx, ry float64) svgPathData {
+	if rx <= 0 || ry <= 0 {
+		return nil
+	}
+	pt := func(x, y float64) layout.Point { return layout.Point{X: x, Y: y} }
+	kx, ky := rx*kappa, ry*kappa
+	return svgPathData{
+		{'M', []layout.Point{pt(cx+rx, cy)}},
+		{'C', []layout.Point{pt(cx+rx, cy+ky), pt(cx+kx, cy+ry), pt(cx, cy+ry)}},
+		{'C', []layout.Point{pt(cx-kx, cy+ry), pt(cx-rx, cy+ky), pt(cx-rx, cy)}},
+		{'C', []layout.Point{pt(cx-rx, cy-ky), pt(cx-kx, cy-ry), pt(cx, cy-ry)}},
+		{'C', []layout.Point{pt(cx+kx, cy-ry), pt(cx+rx, cy-ky), pt(cx+rx, cy)}},
+		{'Z', nil},
+	}
+}
+
+// trace adds the path to the current path of page.
+func (d svgPathData) trace(page *pdf.Page) {
+	for _, s := range d {
+		switch s.op {
+		case 'M':
+			page.MoveTo(s.pts[0].X, s.pts[0].Y)
+		case 'L':
+			page.LineTo(s.pts[0].X, s.pts[0].Y)
+		case 'C':
+			page.CurveTo(s.pts[0].X, s.pts[0].Y, s.pts[1].X, s.pts[1].Y, s.pts[2].X, s.pts[2].Y)
+		case 'Z':
+			page.ClosePath()
+		}
+	}
+}
+
+// end returns the first point of the path if start is set, or its last point otherwise,
+// with the direction the path runs in there, as markers are oriented.
+func (d svgPathData) end(start bool) (layout.Point, float64, bool) {
+	// Flatten the path to the points it passes through, control points included, as
+	// the direction at an end is towards the nearest distinct one.
+	var pts []layout.Point
+	for _, s := range d {
+		pts = append(pts, s.pts...)
+	}
+	if len(pts) == 0 {
+		return layout.Point{}, 0, false
+	}
+	if start {
+		at := pts[0]
+		for _, p := range pts[1:] {
+			if p != at {
+				return at, math.Atan2(p.Y-at.Y, p.X-at.X), true
+			}
+		}
+		return at, 0, true
+	}
+	at := pts[len(pts)-1]
+	for i := len(pts) - 2; i >= 0; i-- {
+		if p := pts[i]; p != at {
+			return at, math.Atan2(at.Y-p.Y, at.X-p.X), true
+		}
+	}
+	return at, 0, true
+}
+
+// parseSVGPath reads the d attribute of a path. Reading stops at the first error, and
+// what was read so far is drawn, as SVG does.
+func parseSVGPath(d string) svgPathData {
+	s := &pathScanner{s: d}
+	var out svgPathData
+	var cur, start, lastControl layout.Point
+	var prev byte
+	cmd := byte(0)
+	for {
+		s.skipSpace()
+		if s.done() {
+			return out
+		}
+		if c := s.s[s.i]; isPathCommand(c) {
+			cmd = c
+			s.i++
+		} else if cmd == 0 || cmd == 'Z' || cmd == 'z' {
+			return out
+		}
+
+		rel := cmd >= 'a' && cmd <= 'z'
+		abs := func(x, y float64) layout.Point {
+			if rel {
+				return layout.Point{X: cur.X + x, Y: cur.Y + y}
+			}
+			return layout.Point{X: x, Y: y}
+		}
+		upper := cmd &^ 0x20
+		switch upper {
+		case 'M':
+			v, ok := s.numbers(2)
+			if !ok {
+				return out
+			}
+			cur = abs(v[0], v[1])
+			start = cur
+			out = append(out, svgSegment{'M', []layout.Point{cur}})
+			// Pairs after the first of a move are lines.
+			if rel {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		case 'L', 'H', 'V':
+			var p layout.Point
+			switch upper {
+			case 'L':
+				v, ok := s.numbers(2)
+				if !ok {
+					return out
+				}
+				p = abs(v[0], v[1])
+			case 'H':
+				v, ok := s.numbers(1)
+				if !ok {
+					return out
+				}
+				p = layout.Point{X: v[0], Y: cur.Y}
+				if rel {
+					p.X += cur.X
+				}
+			case 'V':
+				v, ok := s.numbers(1)
+				if !ok {
+					return out
+				}
+				p = layout.Point{X: cur.X, Y: v[0]}
+				if rel {
+					p.Y += cur.Y
+				}
+			}
+			cur = p
+			out = append(out, svgSegment{'L', []layout.Point{cur}})
+		case 'C', 'S':
+			var c1 layout.Point
+			if upper == 'C' {
+				v, ok := s.numbers(6)
+				if !ok {
+					return out
+				}
+				c1 = abs(v[0], v[1])
+				c2, end := abs(v[2], v[3]), abs(v[4], v[5])
+				out = append(out, svgSegment{'C', []layout.Point{c1, c2, end}})
+				lastControl, cur = c2, end
+			} else {
+				v, ok := s.numbers(4)
+				if !ok {
+					return out
+				}
+				c1 = cur
+				if prev == 'C' || prev == 'S' {
+					c1 = layout.Point{X: 2*cur.X - lastControl.X, Y: 2*cur.Y - lastControl.Y}
+				}
+				c2, end := abs(v[0], v[1]), abs(v[2], v[3])
+				out = append(out, svgSegment{'C', []layout.Point{c1, c2, end}})
+				lastControl, cur = c2, end
+			}
+		case 'Q', 'T':
+			var q layout.Point
+			var end layout.Point
+			if upper == 'Q' {
+				v, ok := s.numbers(4)
+				if !ok {
+					return out
+				}
+				q, end = abs(v[0], v[1]), abs(v[2], v[3])
+			} else {
+				v, ok := s.numbers(2)
+				if !ok {
+					return out
+				}
+				q = cur
+				if prev == 'Q' || prev == 'T' {
+					q = layout.Point{X: 2*cur.X - lastControl.X, Y: 2*cur.Y - lastControl.Y}
+				}
+				end = abs(v[0], v[1])
+			}
+			// Raise the quadratic curve to a cubic one.
+			c1 := layout.Point{X: cur.X + 2.0/3*(q.X-cur.X), Y: cur.Y + 2.0/3*(q.Y-cur.Y)}
+			c2 := layout.Point{X: end.X + 2.0/3*(q.X-end.X), Y: end.Y + 2.0/3*(q.Y-end.Y)}
+			out = append(out, svgSegment{'C', []layout.Point{c1, c2, end}})
+			lastControl, cur = q, end
+		case 'A':
+			v, ok := s.arc()
+			if !ok {
+				return out
+			}
+			end := abs(v[5], v[6])
+			out = append(out, arcToCurves(cur, end, v[0], v[1], v[2], v[3] != 0, v[4] != 0)...)
+			cur = end
+		case 'Z':
+			out = append(out, svgSegment{'Z', nil})
+			cur = start
+		default:
+			return out
+		}
+		prev = upper
+	}
+}
+
+func isPathCommand(c byte) bool {
+	switch c &^ 0x20 {
+	case 'M', 'L', 'H', 'V', 'C', 'S', 'Q', 'T', 'A', 'Z':
+		return true
+	}
+	return false
+}
+
+// pathScanner reads the numbers of SVG path data, which may run together as in
+// "1-2.5.5".
+type pathScanner struct {
+	s string
+	i int
+}
+
+func (p *pathScanner) done() bool { return p.i >= len(p.s) }
+
+func (p *pathScanner) skipSpace() {
+	for !p.done() {
+		switch p.s[p.i] {
+		case ' ', '\t', '\n', '\r', ',':
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+func (p *pathScanner) number() (float64, bool) {
+	p.skipSpace()
+	start := p.i
+	if !p.done() && (p.s[p.i] == '+' || p.s[p.i] == '-') {
+		p.i++
+	}
+	digits, dot := false, false
+	for !p.done() {
+		c := p.s[p.i]
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c == '.' && !dot:
+			dot = true
+		default:
+			goto exponent
+		}
+		p.i++
+	}
+exponent:
+	if digits && !p.done() && (p.s[p.i] == 'e' || p.s[p.i] == 'E') {
+		j := p.i + 1
+		if j < len(p.s) && (p.s[j] == '+' || p.s[j] == '-') {
+			j++
+		}
+		if j < len(p.s) && p.s[j] >= '0' && p.s[j] <= '9' {
+			for j < len(p.s) && p.s[j] >= '0' && p.s[j] <= '9' {
+				j++
+			}
+			p.i = j
+		}
+	}
+	if !digits {
+		p.i = start
+		return 0, false
+	}
+	return parseSVGFloat(p.s[start:p.i], 0), true
+}
+
+func (p *pathScanner) numbers(n int) ([]float64, bool) {
+	v := make([]float64, n)
+	for i := range v {
+		var ok bool
+		if v[i], ok = p.number(); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// arc reads the arguments of an arc, whose flags are single digits that need not be
+// separated from what follows them.
+func (p *pathScanner) arc() ([]float64, bool) {
+	v := make([]float64, 7)
+	for i := range v {
+		if i == 3 || i == 4 {
+			p.skipSpace()
+			if p.done() || (p.s[p.i] != '0' && p.s[p.i] != '1') {
+				return nil, false
+			}
+			v[i] = float64(p.s[p.i] - '0')
+			p.i++
+			continue
+		}
+		var ok bool
+		if v[i], ok = p.number(); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// arcToCurves approximates the elliptical arc from p0 to p1 with cubic curves of at
+// most a quarter turn each, following the endpoint parameterization of the SVG spec.
+func arcToCurves(p0, p1 layout.Point, rx, ry, rotation float64, large, sweep bool) svgPathData {
+	if p0 == p1 {
+		return nil
+	}
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		return svgPathData{{'L', []layout.Point{p1}}}
+	}
+	phi := rotation * math.Pi / 180
+	cos, sin := math.Cos(phi), math.Sin(phi)
+
+	dx, dy := (p0.X-p1.X)/2, (p0.Y-p1.Y)/2
+	x1 := cos*dx + sin*dy
+	y1 := -sin*dx + cos*dy
+	if scale := x1*x1/(rx*rx) + y1*y1/(ry*ry); scale > 1 {
+		rx, ry = rx*math.Sqrt(scale), ry*math.Sqrt(scale)
+	}
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	coef := 0.0
+	if den != 0 && num > 0 {
+		coef = math.Sqrt(num / den)
+	}
+	if large == sweep {
+		coef = -coef
+	}
+	cx1, cy1 := coef*rx*y1/ry, -coef*ry*x1/rx
+	cx := cos*cx1 - sin*cy1 + (p0.X+p1.X)/2
+	cy := sin*cx1 + cos*cy1 + (p0.Y+p1.Y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta := angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	delta := angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	point := func(t float64) layout.Point {
+		x, y := rx*math.Cos(t), ry*math.Sin(t)
+		return layout.Point{X: cos*x - sin*y + cx, Y: sin*x + cos*y + cy}
+	}
+	derivative := func(t float64) layout.Point {
+		x, y := -rx*math.Sin(t), ry*math.Cos(t)
+		return layout.Point{X: cos*x - sin*y, Y: sin*x + cos*y}
+	}
+
+	n := int(math.Ceil(math.Abs(delta) / (math.Pi / 2)))
+	step := delta / float64(n)
+	k := 4.0 / 3 * math.Tan(step/4)
+	var out svgPathData
+	for i := 0; i < n; i++ {
+		t0, t1 := theta+float64(i)*step, theta+float64(i+1)*step
+		a, b := point(t0), point(t1)
+		da, db := derivative(t0), derivative(t1)
+		end := b
+		if i == n-1 {
+			end = p1
+		}
+		out = append(out, svgSegment{'C', []layout.Point{
+			{X: a.X + k*da.X, Y: a.Y + k*da.Y},
+			{X: b.X - k*db.X, Y: b.Y - k*db.Y},
+			end,
+		}})
+	}
+	return out
+}
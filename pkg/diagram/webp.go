@@ -2,6 +2,7 @@ package diagram
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"html"
@@ -25,12 +26,28 @@ import (
 
 // CreateDiagramWebP generates a diagram identical to CreateDiagram but returns it encoded as a WebP image.
 func CreateDiagramWebP(code string) ([]byte, error) {
-	svg, width, height, err := CreateDiagramWithSize(code)
+	return CreateDiagramWebPWithOptions(context.Background(), code, Options{})
+}
+
+// CreateDiagramWebPWithOptions generates a WebP diagram honouring the provided options.
+func CreateDiagramWebPWithOptions(ctx context.Context, code string, opts Options) ([]byte, error) {
+	m, err := build(ctx, code, opts)
 	if err != nil {
 		return nil, err
 	}
+	return rasterizeModel(ctx, m, opts)
+}
+
+func rasterizeModel(ctx context.Context, m *model, opts Options) ([]byte, error) {
+	svg := renderSVG(m, opts)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	data, err := rasterizeSVGToWebP(svg, width, height)
+	done := opts.observe(StageRasterize)
+	data, err := rasterizeSVGToWebP(svg, m.Width, m.Height, opts.scale())
+	done()
 	if err != nil {
 		return nil, fmt.Errorf("convert to webp: %w", err)
 	}
@@ -38,7 +55,9 @@ func CreateDiagramWebP(code string) ([]byte, error) {
 	return data, nil
 }
 
-func rasterizeSVGToWebP(svg string, width, height int) ([]byte, error) {
+// rasterizeSVGToWebP draws svg onto a width*scale by height*scale canvas. width and height
+// are the SVG's own coordinate space.
+func rasterizeSVGToWebP(svg string, width, height int, scale float64) ([]byte, error) {
 	icon, err := oksvg.ReadIconStream(strings.NewReader(svg))
 	if err != nil {
 		return nil, fmt.Errorf("parse svg: %w", err)
@@ -52,6 +71,8 @@ func rasterizeSVGToWebP(svg string, width, height int) ([]byte, error) {
 	if height <= 0 {
 		height = int(math.Ceil(box.H))
 	}
+	width = int(math.Ceil(float64(width) * scale))
+	height = int(math.Ceil(float64(height) * scale))
 	if width <= 0 || height <= 0 {
 		return nil, fmt.Errorf("invalid canvas size: %dx%d", width, height)
 	}
@@ -65,7 +86,7 @@ func rasterizeSVGToWebP(svg string, width, height int) ([]byte, error) {
 	raster := rasterx.NewDasher(width, height, scanner)
 	icon.Draw(raster, 1.0)
 
-	texts, err := extractTextElements(svg)
+	texts, err := extractTextElements(svg, scale)
 	if err != nil {
 		return nil, fmt.Errorf("extract text: %w", err)
 	}
@@ -129,11 +150,11 @@ func (t affineTransform) ScaleFactor() float64 {
 	return (sx + sy) / 2
 }
 
-func extractTextElements(svg string) ([]textElement, error) {
+func extractTextElements(svg string, scale float64) ([]textElement, error) {
 	decoder := xml.NewDecoder(strings.NewReader(svg))
 	var elements []textElement
 
-	transformStack := []affineTransform{identityTransform()}
+	transformStack := []affineTransform{{a: scale, d: scale}}
 	var current *textElement
 	var content strings.Builder
 	textDepth := 0
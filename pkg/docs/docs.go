@@ -0,0 +1,206 @@
+// Package docs generates the component reference: every component type with its props,
+// their types and defaults, and a sample rendered at the type's default size.
+package docs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/props"
+)
+
+// sampleMargin is the space left around each sample.
+const sampleMargin = 20
+
+// Entry documents one component type.
+type Entry struct {
+	Type    string
+	Summary string
+	Aliases []string
+	Width   float64
+	Height  float64
+	Props   []Prop
+	Sample  []byte // SVG
+}
+
+// SampleFile is the file name the entry's sample is written to.
+func (e Entry) SampleFile() string {
+	return strings.ToLower(e.Type) + ".svg"
+}
+
+// Prop documents one prop of a component.
+type Prop struct {
+	Key     string
+	Type    string
+	Default string
+	Values  []string // Allowed values, if the prop is an enum
+	Doc     string
+}
+
+// Reference builds an entry for every component type that is not an alias, sorted by
+// type, and renders its sample with opts.
+func Reference(ctx context.Context, opts diagram.Options) ([]Entry, error) {
+	schema := layout.Schema()
+	aliases := make(map[string][]string)
+	for _, c := range layout.Components() {
+		if c.AliasOf != "" {
+			aliases[c.AliasOf] = append(aliases[c.AliasOf], c.Type)
+		}
+	}
+
+	var entries []Entry
+	for _, c := range layout.Components() {
+		if c.AliasOf != "" {
+			continue
+		}
+		entry := Entry{
+			Type:    c.Type,
+			Summary: c.Summary,
+			Aliases: aliases[c.Type],
+			Width:   c.Width,
+			Height:  c.Height,
+		}
+
+		fields, _ := layout.ComponentFields(c.Type)
+		properties := schema.Defs[c.Type].Properties
+		for _, field := range fields {
+			entry.Props = append(entry.Props, Prop{
+				Key:     field.Key,
+				Type:    field.Type,
+				Default: defaultText(properties[field.Key]),
+				Values:  field.Enum,
+				Doc:     field.Doc,
+			})
+		}
+
+		sample, err := renderSample(ctx, c, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s sample: %w", c.Type, err)
+		}
+		entry.Sample = sample
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// renderSample draws a single component of type c at its default size.
+func renderSample(ctx context.Context, c layout.Component, opts diagram.Options) ([]byte, error) {
+	// Name the state in the declaration; a bare @sample( on the next line would be read
+	// as the declaration's state rather than a definition.
+	source := fmt.Sprintf("@layout(w:%g,h:%g)\n\nsample:%s@sample\n\n@sample(x:%d,y:%d)\n",
+		c.Width+2*sampleMargin, c.Height+2*sampleMargin, c.Type, sampleMargin, sampleMargin)
+	opts.Strict = true
+	out, err := diagram.Render(ctx, source, diagram.FormatSVG, opts)
+	if err != nil {
+		return nil, err
+	}
+	return out.Data, nil
+}
+
+// defaultText formats a schema default the way it would be written in a diagram.
+func defaultText(property *props.Schema) string {
+	if property == nil || property.Default == nil {
+		return ""
+	}
+	switch v := property.Default.(type) {
+	case string:
+		return v
+	case props.Color:
+		return string(v)
+	case float64:
+		return fmt.Sprintf("%g", v)
+	}
+	data, err := json.Marshal(property.Default)
+	if err != nil {
+		return fmt.Sprint(property.Default)
+	}
+	return string(data)
+}
+
+// WriteMarkdown writes the reference as Markdown. Samples are linked as image files
+// under imageDir, named by Entry.SampleFile; the caller writes them.
+func WriteMarkdown(w io.Writer, entries []Entry, imageDir string) error {
+	var b strings.Builder
+	b.WriteString("# Component reference\n\n")
+	b.WriteString("Every component accepts the geometry props `x`, `y`, `w` and `h`; `w` and `h` default to the size shown for each type.\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\n## %s\n\n%s", e.Type, e.Summary)
+		if len(e.Aliases) > 0 {
+			fmt.Fprintf(&b, " Also available as `%s`.", strings.Join(e.Aliases, "`, `"))
+		}
+		fmt.Fprintf(&b, "\n\nDefault size: %g×%g\n\n", e.Width, e.Height)
+		fmt.Fprintf(&b, "![%s sample](%s)\n\n", e.Type, strings.TrimSuffix(imageDir, "/")+"/"+e.SampleFile())
+		b.WriteString("| Prop | Type | Default | Description |\n|------|------|---------|-------------|\n")
+		for _, p := range e.Props {
+			doc := p.Doc
+			if len(p.Values) > 0 {
+				doc = strings.TrimSpace(doc + " One of `" + strings.Join(p.Values, "`, `") + "`.")
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", p.Key, p.Type, markdownCode(p.Default), markdownCell(doc))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + markdownCell(s) + "`"
+}
+
+// markdownCell keeps s from ending a table cell.
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// WriteHTML writes the reference as a single HTML page with the samples inlined.
+func WriteHTML(w io.Writer, entries []Entry) error {
+	return htmlTemplate.Execute(w, entries)
+}
+
+var htmlTemplate = template.Must(template.New("reference").Funcs(template.FuncMap{
+	"svg":  func(data []byte) template.HTML { return template.HTML(data) },
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Nagare component reference</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem auto; max-width: 960px; padding: 0 1rem; color: #1f2937; }
+code { background: #f3f4f6; padding: 0 .25rem; border-radius: 3px; }
+table { border-collapse: collapse; width: 100%; margin: 1rem 0 2rem; }
+th, td { border-bottom: 1px solid #e5e7eb; padding: .4rem .6rem; text-align: left; vertical-align: top; }
+.sample svg { max-width: 100%; height: auto; }
+nav a { margin-right: .75rem; }
+</style>
+</head>
+<body>
+<h1>Component reference</h1>
+<nav>{{range .}}<a href="#{{.Type}}">{{.Type}}</a>{{end}}</nav>
+<p>Every component accepts the geometry props <code>x</code>, <code>y</code>, <code>w</code> and <code>h</code>; <code>w</code> and <code>h</code> default to the size shown for each type.</p>
+{{range .}}
+<section id="{{.Type}}">
+<h2>{{.Type}}</h2>
+<p>{{.Summary}}{{if .Aliases}} Also available as <code>{{join .Aliases ", "}}</code>.{{end}}</p>
+<p>Default size: {{.Width}}×{{.Height}}</p>
+<div class="sample">{{svg .Sample}}</div>
+<table>
+<thead><tr><th>Prop</th><th>Type</th><th>Default</th><th>Description</th></tr></thead>
+<tbody>
+{{range .Props}}<tr><td><code>{{.Key}}</code></td><td>{{.Type}}</td><td>{{if .Default}}<code>{{.Default}}</code>{{end}}</td><td>{{.Doc}}{{if .Values}} One of <code>{{join .Values ", "}}</code>.{{end}}</td></tr>
+{{end}}</tbody>
+</table>
+</section>
+{{end}}
+</body>
+</html>
+`))
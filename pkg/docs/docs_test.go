@@ -0,0 +1,62 @@
+package docs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"github.com/saasuke-labs/nagare/pkg/layout"
+)
+
+func TestReferenceCoversEveryComponent(t *testing.T) {
+	entries, err := Reference(context.Background(), diagram.Options{})
+	if err != nil {
+		t.Fatalf("reference: %v", err)
+	}
+
+	byType := make(map[string]Entry)
+	for _, e := range entries {
+		byType[e.Type] = e
+		if !bytes.Contains(e.Sample, []byte("<svg")) {
+			t.Errorf("%s: expected an SVG sample", e.Type)
+		}
+	}
+	for _, c := range layout.Components() {
+		if _, ok := byType[c.Type]; ok != (c.AliasOf == "") {
+			t.Errorf("%s: expected an entry only for types that are not aliases, got documented=%v", c.Type, ok)
+		}
+	}
+
+	db := byType["Database"]
+	props := make(map[string]Prop)
+	for _, p := range db.Props {
+		props[p.Key] = p
+	}
+	if props["w"].Default != "200" || props["h"].Default != "200" {
+		t.Errorf("expected the database size as the w/h defaults, got %+v %+v", props["w"], props["h"])
+	}
+	if props["engine"].Default == "" || props["accent"].Type != "color" {
+		t.Errorf("unexpected database props %+v", db.Props)
+	}
+	if queue := byType["MessageQueue"]; len(queue.Aliases) != 1 || queue.Aliases[0] != "Queue" {
+		t.Errorf("expected Queue listed as an alias of MessageQueue, got %v", queue.Aliases)
+	}
+
+	var md strings.Builder
+	if err := WriteMarkdown(&md, entries, "images"); err != nil {
+		t.Fatalf("markdown: %v", err)
+	}
+	if !strings.Contains(md.String(), "![Database sample](images/database.svg)") {
+		t.Errorf("expected the markdown to link the database sample")
+	}
+
+	var html strings.Builder
+	if err := WriteHTML(&html, entries); err != nil {
+		t.Fatalf("html: %v", err)
+	}
+	if strings.Count(html.String(), "<svg") != len(entries) {
+		t.Errorf("expected one inline sample per entry")
+	}
+}
@@ -0,0 +1,431 @@
+// Package dot reads and writes the Graphviz DOT language. Parse resolves the node and
+// edge defaults a graph sets, so every node and edge carries the attributes it is drawn
+// with, and Write prints a graph back as DOT.
+package dot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Attrs holds attributes by name.
+type Attrs map[string]string
+
+// Graph is a DOT graph.
+type Graph struct {
+	Strict    bool
+	Directed  bool
+	ID        string
+	Attrs     Attrs   // Graph attributes set at the top level
+	Nodes     []*Node // Every node, in the order each first appears
+	Edges     []*Edge
+	Subgraphs []*Subgraph
+}
+
+// Subgraph is a subgraph of a graph, or of another subgraph.
+type Subgraph struct {
+	ID        string // Empty for an anonymous subgraph
+	Attrs     Attrs  // Graph attributes set in the subgraph
+	Nodes     []string
+	Subgraphs []*Subgraph
+}
+
+// IsCluster reports whether Graphviz draws the subgraph as a cluster: its name starts
+// with "cluster", or it sets cluster=true.
+func (s *Subgraph) IsCluster() bool {
+	return strings.HasPrefix(s.ID, "cluster") || strings.EqualFold(s.Attrs["cluster"], "true")
+}
+
+// Node is a node with the attributes it is drawn with.
+type Node struct {
+	ID    string
+	Attrs Attrs
+}
+
+// Edge connects two nodes, each optionally at a port such as "p" or "p:ne".
+type Edge struct {
+	From, To         string
+	FromPort, ToPort string
+	Attrs            Attrs
+}
+
+// Error is a syntax error at a line and column, both counted from 1.
+type Error struct {
+	Line, Column int
+	Message      string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Parse reads every graph in src.
+func Parse(src string) ([]*Graph, error) {
+	p := &parser{lex: newLexer(src)}
+	p.next()
+	var graphs []*Graph
+	for p.tok.kind != tokenEOF {
+		g, err := p.graph()
+		if err != nil {
+			return nil, err
+		}
+		graphs = append(graphs, g)
+	}
+	if len(graphs) == 0 {
+		return nil, &Error{Line: 1, Column: 1, Message: "no graph found"}
+	}
+	return graphs, nil
+}
+
+// scope holds the defaults in effect in a graph or subgraph.
+type scope struct {
+	subgraph *Subgraph // Nil at the top level
+	node     Attrs
+	edge     Attrs
+}
+
+type parser struct {
+	lex   *lexer
+	tok   token
+	err   error
+	g     *Graph // Being parsed
+	nodes map[string]*Node
+	named map[string]*Subgraph
+	scope *scope
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	tok, err := p.lex.next()
+	if err != nil {
+		p.err = err
+		tok = token{kind: tokenEOF}
+	}
+	p.tok = tok
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return &Error{Line: p.tok.line, Column: p.tok.column, Message: fmt.Sprintf(format, args...)}
+}
+
+// expect consumes a token of kind, or fails naming what was expected.
+func (p *parser) expect(kind tokenKind, what string) error {
+	if p.tok.kind != kind {
+		return p.errorf("expected %s, found %s", what, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+// graph parses [strict] (graph | digraph) [ID] '{' stmt_list '}'.
+func (p *parser) graph() (*Graph, error) {
+	g := &Graph{Attrs: make(Attrs)}
+	if p.tok.keyword("strict") {
+		g.Strict = true
+		p.next()
+	}
+	switch {
+	case p.tok.keyword("graph"):
+	case p.tok.keyword("digraph"):
+		g.Directed = true
+	default:
+		return nil, p.errorf("expected graph or digraph, found %s", p.tok)
+	}
+	p.next()
+	if p.tok.kind == tokenID {
+		g.ID = p.tok.text
+		p.next()
+	}
+
+	p.g, p.nodes, p.named = g, make(map[string]*Node), make(map[string]*Subgraph)
+	p.scope = &scope{node: make(Attrs), edge: make(Attrs)}
+	if err := p.expect(tokenLBrace, "{"); err != nil {
+		return nil, err
+	}
+	if err := p.statements(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenRBrace, "}"); err != nil {
+		return nil, err
+	}
+	return g, p.err
+}
+
+func (p *parser) statements() error {
+	for p.tok.kind != tokenRBrace && p.tok.kind != tokenEOF {
+		if err := p.statement(); err != nil {
+			return err
+		}
+		if p.tok.kind == tokenSemicolon {
+			p.next()
+		}
+	}
+	return p.err
+}
+
+func (p *parser) statement() error {
+	switch {
+	case p.tok.keyword("graph"), p.tok.keyword("node"), p.tok.keyword("edge"):
+		target := strings.ToLower(p.tok.text)
+		p.next()
+		attrs, err := p.attrLists()
+		if err != nil {
+			return err
+		}
+		switch target {
+		case "graph":
+			merge(p.graphAttrs(), attrs)
+		case "node":
+			merge(p.scope.node, attrs)
+		case "edge":
+			merge(p.scope.edge, attrs)
+		}
+		return nil
+
+	case p.tok.keyword("subgraph"), p.tok.kind == tokenLBrace:
+		nodes, err := p.subgraph()
+		if err != nil {
+			return err
+		}
+		return p.edges(operand{nodes: nodes})
+
+	case p.tok.kind == tokenID:
+		id := p.tok.text
+		p.next()
+		if p.tok.kind == tokenEquals {
+			p.next()
+			if p.tok.kind != tokenID {
+				return p.errorf("expected a value for %s, found %s", id, p.tok)
+			}
+			p.graphAttrs()[id] = p.tok.text
+			p.next()
+			return nil
+		}
+		port, err := p.port()
+		if err != nil {
+			return err
+		}
+		if p.tok.kind == tokenEdgeOp {
+			p.node(id)
+			return p.edges(operand{nodes: []string{id}, port: port})
+		}
+		attrs, err := p.attrLists()
+		if err != nil {
+			return err
+		}
+		merge(p.node(id).Attrs, attrs)
+		return nil
+	}
+	return p.errorf("unexpected %s", p.tok)
+}
+
+// graphAttrs returns the graph attributes of the current scope.
+func (p *parser) graphAttrs() Attrs {
+	if p.scope.subgraph != nil {
+		return p.scope.subgraph.Attrs
+	}
+	return p.g.Attrs
+}
+
+// operand is one side of an edge: a node, or every node of a subgraph.
+type operand struct {
+	nodes []string
+	port  string
+}
+
+// edges parses the edge operators and operands that follow first, if any, and the
+// attributes of the edges they make.
+func (p *parser) edges(first operand) error {
+	operands := []operand{first}
+	for p.tok.kind == tokenEdgeOp {
+		if want := edgeOp(p.g.Directed); p.tok.text != want {
+			return p.errorf("expected %s, found %s", want, p.tok.text)
+		}
+		p.next()
+		var next operand
+		switch {
+		case p.tok.keyword("subgraph"), p.tok.kind == tokenLBrace:
+			nodes, err := p.subgraph()
+			if err != nil {
+				return err
+			}
+			next.nodes = nodes
+		case p.tok.kind == tokenID:
+			id := p.tok.text
+			p.next()
+			port, err := p.port()
+			if err != nil {
+				return err
+			}
+			p.node(id)
+			next = operand{nodes: []string{id}, port: port}
+		default:
+			return p.errorf("expected a node or subgraph, found %s", p.tok)
+		}
+		operands = append(operands, next)
+	}
+	if len(operands) == 1 {
+		return nil
+	}
+
+	attrs, err := p.attrLists()
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(operands); i++ {
+		for _, from := range operands[i-1].nodes {
+			for _, to := range operands[i].nodes {
+				edge := &Edge{From: from, To: to, FromPort: operands[i-1].port, ToPort: operands[i].port, Attrs: make(Attrs)}
+				merge(edge.Attrs, p.scope.edge)
+				merge(edge.Attrs, attrs)
+				p.g.Edges = append(p.g.Edges, edge)
+			}
+		}
+	}
+	return nil
+}
+
+// port parses the optional ':' ID [':' compass] after a node id.
+func (p *parser) port() (string, error) {
+	var parts []string
+	for p.tok.kind == tokenColon && len(parts) < 2 {
+		p.next()
+		if p.tok.kind != tokenID {
+			return "", p.errorf("expected a port, found %s", p.tok)
+		}
+		parts = append(parts, p.tok.text)
+		p.next()
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// subgraph parses [subgraph [ID]] '{' stmt_list '}' and returns the nodes in it.
+func (p *parser) subgraph() ([]string, error) {
+	var id string
+	if p.tok.keyword("subgraph") {
+		p.next()
+		if p.tok.kind == tokenID {
+			id = p.tok.text
+			p.next()
+		}
+	}
+
+	sub, ok := p.named[id]
+	if !ok || id == "" {
+		sub = &Subgraph{ID: id, Attrs: make(Attrs)}
+		if id != "" {
+			p.named[id] = sub
+		}
+		if parent := p.scope.subgraph; parent != nil {
+			parent.Subgraphs = append(parent.Subgraphs, sub)
+		} else {
+			p.g.Subgraphs = append(p.g.Subgraphs, sub)
+		}
+	}
+	if p.tok.kind != tokenLBrace {
+		// A reference to a subgraph defined earlier.
+		return members(sub), nil
+	}
+	p.next()
+
+	outer := p.scope
+	p.scope = &scope{subgraph: sub, node: copyAttrs(outer.node), edge: copyAttrs(outer.edge)}
+	err := p.statements()
+	p.scope = outer
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenRBrace, "}"); err != nil {
+		return nil, err
+	}
+	return members(sub), nil
+}
+
+// members returns the nodes of sub and of the subgraphs inside it.
+func members(sub *Subgraph) []string {
+	nodes := append([]string{}, sub.Nodes...)
+	for _, nested := range sub.Subgraphs {
+		for _, id := range members(nested) {
+			if !contains(nodes, id) {
+				nodes = append(nodes, id)
+			}
+		}
+	}
+	return nodes
+}
+
+// node returns the node id, creating it with the node defaults in effect if it is new,
+// and records it in the current subgraph.
+func (p *parser) node(id string) *Node {
+	n, ok := p.nodes[id]
+	if !ok {
+		n = &Node{ID: id, Attrs: copyAttrs(p.scope.node)}
+		p.nodes[id] = n
+		p.g.Nodes = append(p.g.Nodes, n)
+	}
+	if sub := p.scope.subgraph; sub != nil && !contains(sub.Nodes, id) {
+		sub.Nodes = append(sub.Nodes, id)
+	}
+	return n
+}
+
+// attrLists parses zero or more '[' a_list ']'.
+func (p *parser) attrLists() (Attrs, error) {
+	attrs := make(Attrs)
+	for p.tok.kind == tokenLBracket {
+		p.next()
+		for p.tok.kind == tokenID {
+			key := p.tok.text
+			p.next()
+			if err := p.expect(tokenEquals, "= after "+key); err != nil {
+				return nil, err
+			}
+			if p.tok.kind != tokenID {
+				return nil, p.errorf("expected a value for %s, found %s", key, p.tok)
+			}
+			attrs[key] = p.tok.text
+			p.next()
+			if p.tok.kind == tokenComma || p.tok.kind == tokenSemicolon {
+				p.next()
+			}
+		}
+		if err := p.expect(tokenRBracket, "]"); err != nil {
+			return nil, err
+		}
+	}
+	return attrs, p.err
+}
+
+// edgeOp returns the edge operator of directed or undirected graphs.
+func edgeOp(directed bool) string {
+	if directed {
+		return "->"
+	}
+	return "--"
+}
+
+func merge(dst, src Attrs) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+func copyAttrs(attrs Attrs) Attrs {
+	c := make(Attrs, len(attrs))
+	merge(c, attrs)
+	return c
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package dot
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sample = `/* Checkout */
+# 1 "checkout.gv"
+strict digraph "checkout" {
+    rankdir=LR
+    node [shape=box, color=gray];
+    edge [style=dashed]
+    web [label="Web\nshop"];
+    subgraph cluster_backend {
+        label = "Back" + "end";
+        node [shape=cylinder]
+        db; cache [color="#ff0000"]
+        api [shape=box] // Overrides the cluster default
+    }
+    web -> api:http:ne [label=<<b>calls</b>>];
+    api -> {db cache} [style=solid];
+    "quoted \"id\"" -> web
+}
+`
+
+func TestParse(t *testing.T) {
+	graphs, err := Parse(sample)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(graphs) != 1 {
+		t.Fatalf("expected one graph, got %d", len(graphs))
+	}
+	g := graphs[0]
+	if !g.Strict || !g.Directed || g.ID != "checkout" || g.Attrs["rankdir"] != "LR" {
+		t.Fatalf("unexpected graph %+v", g)
+	}
+
+	attrs := make(map[string]Attrs)
+	var ids []string
+	for _, n := range g.Nodes {
+		ids = append(ids, n.ID)
+		attrs[n.ID] = n.Attrs
+	}
+	if want := []string{"web", "db", "cache", "api", `quoted "id"`}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("expected nodes %q, got %q", want, ids)
+	}
+	if attrs["web"]["label"] != `Web\nshop` || attrs["web"]["shape"] != "box" {
+		t.Errorf("unexpected web attributes %v", attrs["web"])
+	}
+	if attrs["db"]["shape"] != "cylinder" || attrs["db"]["color"] != "gray" || attrs["cache"]["color"] != "#ff0000" || attrs["api"]["shape"] != "box" {
+		t.Errorf("cluster defaults not applied: %v", attrs)
+	}
+
+	// The {db cache} of the edge is an anonymous subgraph.
+	if len(g.Subgraphs) != 2 || !g.Subgraphs[0].IsCluster() || g.Subgraphs[1].IsCluster() || g.Subgraphs[0].Attrs["label"] != "Backend" {
+		t.Fatalf("unexpected subgraphs %+v", g.Subgraphs)
+	}
+	if want := []string{"db", "cache", "api"}; !reflect.DeepEqual(g.Subgraphs[0].Nodes, want) {
+		t.Errorf("expected cluster nodes %q, got %q", want, g.Subgraphs[0].Nodes)
+	}
+
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+":"+e.FromPort+">"+e.To+":"+e.ToPort+" "+e.Attrs["style"]+" "+e.Attrs["label"])
+	}
+	want := []string{"web:>api:http:ne dashed <<b>calls</b>>", "api:>db: solid ", "api:>cache: solid ", `quoted "id":>web: dashed `}
+	if !reflect.DeepEqual(edges, want) {
+		t.Fatalf("expected edges %q, got %q", want, edges)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"", "1:1: no graph found"},
+		{"digraph { a -- b }", "1:13: expected ->, found --"},
+		{"graph {\n  a [label=]\n}", "2:12: expected a value for label"},
+		{"graph { a [label=\"x }", "1:22: unterminated string"},
+		{"tree { }", `1:1: expected graph or digraph, found "tree"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		var dotErr *Error
+		if !errors.As(err, &dotErr) || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("Parse(%q): expected %q, got %v", tt.src, tt.want, err)
+		}
+	}
+}
+
+func TestWriteRoundTrips(t *testing.T) {
+	graphs, err := Parse(sample)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var b strings.Builder
+	if err := Write(&b, graphs[0]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	want := `strict digraph checkout {
+    graph [rankdir=LR];
+    subgraph cluster_backend {
+        graph [label=Backend];
+        db [color=gray, shape=cylinder];
+        cache [color="#ff0000", shape=cylinder];
+        api [color=gray, shape=box];
+    }
+    web [color=gray, label="Web\nshop", shape=box];
+    "quoted \"id\"" [color=gray, shape=box];
+    web -> api:http:ne [label=<<b>calls</b>>, style=dashed];
+    api -> db [style=solid];
+    api -> cache [style=solid];
+    "quoted \"id\"" -> web [style=dashed];
+}
+`
+	if got := b.String(); got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+
+	again, err := Parse(want)
+	if err != nil {
+		t.Fatalf("written graph does not parse: %v", err)
+	}
+	byID := func(g *Graph) map[string]Attrs {
+		nodes := make(map[string]Attrs)
+		for _, n := range g.Nodes {
+			nodes[n.ID] = n.Attrs
+		}
+		return nodes
+	}
+	if !reflect.DeepEqual(byID(again[0]), byID(graphs[0])) || !reflect.DeepEqual(again[0].Edges, graphs[0].Edges) {
+		t.Fatal("written graph parses to different nodes or edges")
+	}
+}
+
+func TestID(t *testing.T) {
+	for in, want := range map[string]string{
+		"api":      "api",
+		"-1.5":     "-1.5",
+		"a b":      `"a b"`,
+		"node":     `"node"`,
+		"12ab":     `"12ab"`,
+		"":         `""`,
+		"say \"x":  `"say \"x"`,
+		"<b>x</b>": "<b>x</b>",
+	} {
+		if got := ID(in); got != want {
+			t.Errorf("ID(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package dot
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenID            // Name, numeral, quoted string or HTML string
+	tokenLBrace
+	tokenRBrace
+	tokenLBracket
+	tokenRBracket
+	tokenEquals
+	tokenSemicolon
+	tokenComma
+	tokenColon
+	tokenEdgeOp // -> or --
+)
+
+type token struct {
+	kind         tokenKind
+	text         string // Of an ID, without quotes; of an edge operator
+	quoted       bool   // The ID was a quoted or HTML string, so it is never a keyword
+	line, column int
+}
+
+// keyword reports whether the token is the keyword name, which DOT matches in any case.
+func (t token) keyword(name string) bool {
+	return t.kind == tokenID && !t.quoted && strings.EqualFold(t.text, name)
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenID:
+		return fmt.Sprintf("%q", t.text)
+	case tokenEdgeOp:
+		return t.text
+	}
+	return fmt.Sprintf("%q", "{}[]=;,:"[t.kind-tokenLBrace])
+}
+
+type lexer struct {
+	src          string
+	pos          int
+	line, column int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src, line: 1, column: 1}
+}
+
+func (l *lexer) peek() byte {
+	if l.pos < len(l.src) {
+		return l.src[l.pos]
+	}
+	return 0
+}
+
+func (l *lexer) advance() {
+	if l.src[l.pos] == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	l.pos++
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &Error{Line: l.line, Column: l.column, Message: fmt.Sprintf(format, args...)}
+}
+
+// skip moves past white space and comments. Lines starting with # are C preprocessor
+// output, which DOT ignores.
+func (l *lexer) skip() error {
+	atLineStart := l.pos == 0 || l.src[l.pos-1] == '\n'
+	for l.pos < len(l.src) {
+		switch c := l.peek(); {
+		case c == '\n':
+			l.advance()
+			atLineStart = true
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			l.advance()
+			continue
+		case c == '#' && atLineStart, strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.peek() != '\n' {
+				l.advance()
+			}
+			continue
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return l.errorf("unterminated comment")
+			}
+			for target := l.pos + 2 + end + 2; l.pos < target; {
+				l.advance()
+			}
+			continue
+		}
+		return nil
+	}
+	return nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skip(); err != nil {
+		return token{}, err
+	}
+	tok := token{line: l.line, column: l.column}
+	if l.pos >= len(l.src) {
+		tok.kind = tokenEOF
+		return tok, nil
+	}
+
+	c := l.peek()
+	if i := strings.IndexByte("{}[]=;,:", c); i >= 0 {
+		l.advance()
+		tok.kind = tokenLBrace + tokenKind(i)
+		return tok, nil
+	}
+	if strings.HasPrefix(l.src[l.pos:], "->") || strings.HasPrefix(l.src[l.pos:], "--") {
+		tok.kind, tok.text = tokenEdgeOp, l.src[l.pos:l.pos+2]
+		l.advance()
+		l.advance()
+		return tok, nil
+	}
+
+	tok.kind = tokenID
+	switch {
+	case c == '"':
+		text, err := l.quoted()
+		if err != nil {
+			return token{}, err
+		}
+		tok.text, tok.quoted = text, true
+	case c == '<':
+		text, err := l.html()
+		if err != nil {
+			return token{}, err
+		}
+		tok.text, tok.quoted = text, true
+	case c == '-' || c == '.' || c >= '0' && c <= '9':
+		tok.text = l.numeral()
+		if tok.text == "" {
+			return token{}, l.errorf("unexpected %q", c)
+		}
+	case isNameStart(c):
+		start := l.pos
+		for l.pos < len(l.src) && (isNameStart(l.peek()) || l.peek() >= '0' && l.peek() <= '9') {
+			l.advance()
+		}
+		tok.text = l.src[start:l.pos]
+	default:
+		r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+		return token{}, l.errorf("unexpected %q", r)
+	}
+	return tok, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// quoted reads a double-quoted string and any strings joined to it with +. Only \" is an
+// escape in DOT; other backslashes, such as the \n of labels, are kept.
+func (l *lexer) quoted() (string, error) {
+	var b strings.Builder
+	for {
+		l.advance() // The opening quote
+		for {
+			if l.pos >= len(l.src) {
+				return "", l.errorf("unterminated string")
+			}
+			c := l.peek()
+			if c == '"' {
+				l.advance()
+				break
+			}
+			if c == '\\' && l.pos+1 < len(l.src) {
+				switch l.src[l.pos+1] {
+				case '"':
+					l.advance()
+					l.advance()
+					b.WriteByte('"')
+					continue
+				case '\n':
+					// A line continuation.
+					l.advance()
+					l.advance()
+					continue
+				}
+			}
+			b.WriteByte(c)
+			l.advance()
+		}
+
+		// "a" + "b" is "ab".
+		save := *l
+		if err := l.skip(); err != nil || l.peek() != '+' {
+			*l = save
+			return b.String(), nil
+		}
+		l.advance()
+		if err := l.skip(); err != nil || l.peek() != '"' {
+			return "", l.errorf("expected a string after +")
+		}
+	}
+}
+
+// html reads an HTML string, <...> with balanced angle brackets, and returns it with its
+// outer brackets.
+func (l *lexer) html() (string, error) {
+	start, depth := l.pos, 0
+	for l.pos < len(l.src) {
+		switch l.peek() {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		}
+		l.advance()
+		if depth == 0 {
+			return l.src[start:l.pos], nil
+		}
+	}
+	return "", l.errorf("unterminated HTML string")
+}
+
+// numeral reads [-]?(.[0-9]+ | [0-9]+(.[0-9]*)?).
+func (l *lexer) numeral() string {
+	start := l.pos
+	if l.peek() == '-' {
+		l.advance()
+	}
+	digits := 0
+	for l.pos < len(l.src) && l.peek() >= '0' && l.peek() <= '9' {
+		l.advance()
+		digits++
+	}
+	if l.peek() == '.' {
+		l.advance()
+		for l.pos < len(l.src) && l.peek() >= '0' && l.peek() <= '9' {
+			l.advance()
+			digits++
+		}
+	}
+	if digits == 0 {
+		return ""
+	}
+	return l.src[start:l.pos]
+}
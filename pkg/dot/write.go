@@ -0,0 +1,142 @@
+package dot
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// indent is the indentation of each nesting level.
+const indent = "    "
+
+// Write prints g as DOT. Attributes are written sorted by name, subgraphs before the
+// nodes outside them, and edges last.
+func Write(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	if g.Strict {
+		b.WriteString("strict ")
+	}
+	if g.Directed {
+		b.WriteString("digraph")
+	} else {
+		b.WriteString("graph")
+	}
+	if g.ID != "" {
+		b.WriteString(" " + ID(g.ID))
+	}
+	b.WriteString(" {\n")
+
+	nodes := make(map[string]*Node, len(g.Nodes))
+	for _, n := range g.Nodes {
+		nodes[n.ID] = n
+	}
+	written := make(map[string]bool)
+	writeAttrStatement(&b, indent, "graph", g.Attrs)
+	for _, sub := range g.Subgraphs {
+		writeSubgraph(&b, indent, sub, nodes, written)
+	}
+	for _, n := range g.Nodes {
+		if !written[n.ID] {
+			writeNode(&b, indent, n)
+		}
+	}
+	op := " " + edgeOp(g.Directed) + " "
+	for _, e := range g.Edges {
+		b.WriteString(indent + endpoint(e.From, e.FromPort) + op + endpoint(e.To, e.ToPort))
+		b.WriteString(attrList(e.Attrs) + ";\n")
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeSubgraph writes sub with the nodes in it that are not written yet. An anonymous
+// subgraph left empty, such as the {a b} of an edge, is left out.
+func writeSubgraph(b *strings.Builder, prefix string, sub *Subgraph, nodes map[string]*Node, written map[string]bool) {
+	var body strings.Builder
+	inner := prefix + indent
+	writeAttrStatement(&body, inner, "graph", sub.Attrs)
+	for _, nested := range sub.Subgraphs {
+		writeSubgraph(&body, inner, nested, nodes, written)
+	}
+	for _, id := range sub.Nodes {
+		if n, ok := nodes[id]; ok && !written[id] {
+			writeNode(&body, inner, n)
+			written[id] = true
+		}
+	}
+	if sub.ID == "" && body.Len() == 0 {
+		return
+	}
+
+	b.WriteString(prefix + "subgraph")
+	if sub.ID != "" {
+		b.WriteString(" " + ID(sub.ID))
+	}
+	b.WriteString(" {\n" + body.String() + prefix + "}\n")
+}
+
+func writeAttrStatement(b *strings.Builder, prefix, target string, attrs Attrs) {
+	if len(attrs) > 0 {
+		b.WriteString(prefix + target + attrList(attrs) + ";\n")
+	}
+}
+
+func writeNode(b *strings.Builder, prefix string, n *Node) {
+	b.WriteString(prefix + ID(n.ID) + attrList(n.Attrs) + ";\n")
+}
+
+func endpoint(id, port string) string {
+	if port == "" {
+		return ID(id)
+	}
+	parts := strings.Split(port, ":")
+	for i, part := range parts {
+		parts[i] = ID(part)
+	}
+	return ID(id) + ":" + strings.Join(parts, ":")
+}
+
+// attrList returns attrs as " [key=value, ...]", or "" if there are none.
+func attrList(attrs Attrs) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = ID(key) + "=" + ID(attrs[key])
+	}
+	return " [" + strings.Join(pairs, ", ") + "]"
+}
+
+// keywords cannot be written as plain IDs.
+var keywords = map[string]bool{"strict": true, "graph": true, "digraph": true, "node": true, "edge": true, "subgraph": true}
+
+// ID returns s written as a DOT ID: as it is if it is a plain name or numeral, and quoted
+// otherwise. Values in angle brackets are written as HTML strings.
+func ID(s string) string {
+	if isPlainID(s) {
+		return s
+	}
+	if len(s) > 1 && s[0] == '<' && s[len(s)-1] == '>' {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func isPlainID(s string) bool {
+	if s == "" || keywords[strings.ToLower(s)] {
+		return false
+	}
+	if l := newLexer(s); isNameStart(s[0]) || s[0] == '-' || s[0] == '.' || s[0] >= '0' && s[0] <= '9' {
+		tok, err := l.next()
+		return err == nil && tok.kind == tokenID && !tok.quoted && l.pos == len(s)
+	}
+	return false
+}
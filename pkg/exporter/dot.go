@@ -0,0 +1,169 @@
+package exporter
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/dot"
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+)
+
+// pointsPerInch converts pixels, which DOT counts as points, to the inches of node
+// sizes.
+const pointsPerInch = 72.0
+
+// arrowLength is the length of the arrowhead Graphviz draws at the default arrowsize.
+const arrowLength = 10.0
+
+// dotShapes maps component types to the DOT shape closest to how they are drawn. Other
+// types are boxes.
+var dotShapes = map[string]string{
+	"Database": "cylinder",
+	"Package":  "folder",
+	"Artifact": "note",
+}
+
+// DOT returns the diagram laid out as l from root as a Graphviz graph. Every node keeps
+// its position as a pinned pos and its size in inches, containers become clusters with
+// their bb, and connections become edges whose pos follows the drawn arrow, so the
+// result renders as drawn with neato -n2 and imports back the same. The class of each
+// node is the type it is declared with.
+func DOT(root parser.Node, l layout.Layout) *dot.Graph {
+	height := l.Bounds.Height
+	// DOT puts the origin at the bottom left, and y grows upwards.
+	point := func(x, y float64) string {
+		return formatFloat(x) + "," + formatFloat(height-y)
+	}
+
+	g := &dot.Graph{
+		Directed: true,
+		Attrs:    dot.Attrs{"bb": "0,0," + formatFloat(l.Bounds.Width) + "," + formatFloat(height)},
+	}
+	types := declaredTypes(root)
+	clusters := make(map[string]*dot.Subgraph)
+	for _, e := range l.Elements() {
+		attrs := dot.Attrs{"label": e.Title()}
+		if bg, ok := color(e, "bg"); ok {
+			if fill, ok := hexColor(bg); ok {
+				attrs["style"], attrs["fillcolor"] = "filled", fill
+			}
+		}
+		if fg, ok := color(e, "fg"); ok {
+			if font, ok := hexColor(fg); ok {
+				attrs["fontcolor"] = font
+			}
+		}
+
+		var nodes *[]string
+		var subgraphs *[]*dot.Subgraph
+		if parent, ok := clusters[e.Parent]; ok {
+			nodes, subgraphs = &parent.Nodes, &parent.Subgraphs
+		} else {
+			subgraphs = &g.Subgraphs
+		}
+
+		b := e.Bounds
+		if layout.IsContainerType(e.Type) {
+			attrs["bb"] = point(b.X, b.Y+b.Height) + "," + point(b.X+b.Width, b.Y)
+			cluster := &dot.Subgraph{ID: "cluster_" + e.ID, Attrs: attrs}
+			clusters[e.ID] = cluster
+			*subgraphs = append(*subgraphs, cluster)
+			continue
+		}
+
+		shape, ok := dotShapes[e.Type]
+		if !ok {
+			shape = "box"
+		}
+		attrs["shape"] = shape
+		attrs["class"] = types[e.ID]
+		attrs["pos"] = point(b.X+b.Width/2, b.Y+b.Height/2) + "!"
+		attrs["width"] = formatFloat(b.Width / pointsPerInch)
+		attrs["height"] = formatFloat(b.Height / pointsPerInch)
+		attrs["fixedsize"] = "true"
+		g.Nodes = append(g.Nodes, &dot.Node{ID: e.ID, Attrs: attrs})
+		if nodes != nil {
+			*nodes = append(*nodes, e.ID)
+		}
+	}
+
+	for _, arrow := range l.Connections {
+		points := append(append([]layout.Point{arrow.Start}, arrow.BendPoints...), arrow.End)
+		var pos []string
+		if arrow.MarkerEnd {
+			// The spline stops short of the end point, where the arrowhead's tip is.
+			pos = append(pos, "e,"+point(arrow.End.X, arrow.End.Y))
+			points[len(points)-1] = shorten(points[len(points)-2], arrow.End, arrowLength)
+		}
+		// Each straight segment is a cubic Bézier with its control points at its ends.
+		pos = append(pos, point(points[0].X, points[0].Y))
+		for i := 1; i < len(points); i++ {
+			from, to := point(points[i-1].X, points[i-1].Y), point(points[i].X, points[i].Y)
+			pos = append(pos, from, to, to)
+		}
+
+		edge := &dot.Edge{From: arrow.FromID, To: arrow.ToID, Attrs: dot.Attrs{"pos": strings.Join(pos, " ")}}
+		edge.FromPort = compassPort(arrow.FromAnchor)
+		edge.ToPort = compassPort(arrow.ToAnchor)
+		if !arrow.MarkerEnd {
+			edge.Attrs["arrowhead"] = "none"
+		}
+		// The port of a node standing in for a cluster would be the wrong side of it.
+		if cluster, ok := clusters[arrow.FromID]; ok {
+			edge.From, edge.FromPort, edge.Attrs["ltail"] = anyNode(cluster), "", cluster.ID
+		}
+		if cluster, ok := clusters[arrow.ToID]; ok {
+			edge.To, edge.ToPort, edge.Attrs["lhead"] = anyNode(cluster), "", cluster.ID
+		}
+		if edge.From == "" || edge.To == "" {
+			continue // An empty container has no node to stand in for it
+		}
+		if edge.Attrs["ltail"] != "" || edge.Attrs["lhead"] != "" {
+			g.Attrs["compound"] = "true"
+		}
+		g.Edges = append(g.Edges, edge)
+	}
+	return g
+}
+
+// anyNode returns the first node drawn in cluster, which edges to the cluster start or
+// end at as DOT edges join nodes only.
+func anyNode(cluster *dot.Subgraph) string {
+	if len(cluster.Nodes) > 0 {
+		return cluster.Nodes[0]
+	}
+	for _, nested := range cluster.Subgraphs {
+		if id := anyNode(nested); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// compassPort returns the DOT compass point an anchor such as "n" or "se" names, or ""
+// for anchors DOT cannot express, such as "n30".
+func compassPort(anchor string) string {
+	switch a := strings.ToLower(anchor); a {
+	case "n", "ne", "e", "se", "s", "sw", "w", "nw":
+		return a
+	}
+	return ""
+}
+
+// shorten returns the point length before to on the line from from, or from itself if the
+// line is shorter than that.
+func shorten(from, to layout.Point, length float64) layout.Point {
+	dx, dy := to.X-from.X, to.Y-from.Y
+	d := math.Hypot(dx, dy)
+	if d <= length {
+		return from
+	}
+	return layout.Point{X: to.X - dx/d*length, Y: to.Y - dy/d*length}
+}
+
+// formatFloat writes v with at most two decimals.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(round(v), 'f', -1, 64)
+}
@@ -0,0 +1,117 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/saasuke-labs/nagare/pkg/dot"
+	"github.com/saasuke-labs/nagare/pkg/importer"
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/props"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+const shop = `@layout(w: 600, h: 500)
+web:Server@web
+backend:VM@backend {
+    api:Rectangle@api
+    orders:Database@orders
+}
+web.s --> api.n
+api.s --> orders.n
+web.e --> backend.n
+@web(x: 40, y: 20, w: 200, h: 60, title: "Web", bg: "rgb(30, 58, 138)")
+@backend(x: 40, y: 120, w: 500, h: 360, title: "Backend")
+@api(x: 20, y: 20, w: 160, h: 60, title: "API", fg: "#fff")
+@orders(x: 20, y: 140, w: 160, h: 100, title: "Orders")
+`
+
+func layoutOf(t *testing.T, source string) (parser.Node, layout.Layout) {
+	t.Helper()
+	root, err := parser.Parse(tokenizer.Tokenize(source))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return root, layout.Calculate(root, 800, 400)
+}
+
+func TestDOT(t *testing.T) {
+	root, l := layoutOf(t, shop)
+	g := DOT(root, l)
+
+	if g.Attrs["bb"] != "0,0,600,500" || g.Attrs["compound"] != "true" {
+		t.Fatalf("unexpected graph attributes %v", g.Attrs)
+	}
+	if len(g.Subgraphs) != 1 || g.Subgraphs[0].ID != "cluster_backend" || g.Subgraphs[0].Attrs["bb"] != "40,20,540,380" {
+		t.Fatalf("unexpected clusters %+v", g.Subgraphs)
+	}
+	if got := strings.Join(g.Subgraphs[0].Nodes, " "); got != "api orders" {
+		t.Fatalf("expected api and orders in the cluster, got %s", got)
+	}
+
+	web := g.Nodes[0].Attrs
+	for key, want := range map[string]string{"label": "Web", "class": "Server", "shape": "box", "pos": "140,450!", "width": "2.78", "height": "0.83", "fillcolor": "#1e3a8a"} {
+		if web[key] != want {
+			t.Errorf("web: expected %s=%s, got %q", key, want, web[key])
+		}
+	}
+	if orders := g.Nodes[2].Attrs; orders["shape"] != "cylinder" {
+		t.Errorf("expected orders to be a cylinder, got %v", orders)
+	}
+	if api := g.Nodes[1].Attrs; api["fontcolor"] != "#ffffff" {
+		t.Errorf("expected the short hex colour expanded, got %v", api)
+	}
+
+	edge := g.Edges[0]
+	if edge.From != "web" || edge.FromPort != "s" || edge.To != "api" || edge.ToPort != "n" || !strings.HasPrefix(edge.Attrs["pos"], "e,") {
+		t.Errorf("unexpected edge %+v", edge)
+	}
+	if toCluster := g.Edges[2]; toCluster.Attrs["lhead"] != "cluster_backend" || toCluster.To != "api" || toCluster.ToPort != "" {
+		t.Errorf("expected the edge to the VM to end at its cluster, got %+v", toCluster)
+	}
+}
+
+func TestDOTImportsBack(t *testing.T) {
+	root, l := layoutOf(t, shop)
+	var b strings.Builder
+	if err := dot.Write(&b, DOT(root, l)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	d, err := importer.DOT(importer.Source{Name: "shop.dot", Reader: strings.NewReader(b.String())})
+	if err != nil {
+		t.Fatalf("import: %v\n%s", err, b.String())
+	}
+
+	again := layout.Calculate(d.Root, 800, 400)
+	if again.Bounds != l.Bounds {
+		t.Errorf("expected canvas %+v, got %+v", l.Bounds, again.Bounds)
+	}
+	for _, id := range []string{"web", "backend", "api", "orders"} {
+		if got, want := again.NodeIndex[id], l.NodeIndex[id]; got.X != want.X || got.Y != want.Y || got.Width != want.Width || got.Height != want.Height {
+			t.Errorf("%s: expected %+v, got %+v", id, want, got)
+		}
+	}
+	if len(d.Root.Connections) != len(root.Connections) {
+		t.Errorf("expected %d connections, got %d", len(root.Connections), len(d.Root.Connections))
+	}
+}
+
+func TestHexColor(t *testing.T) {
+	for in, want := range map[string]string{
+		"#abc":               "#aabbcc",
+		"#AABBCCFF":          "#aabbcc",
+		"#11223344":          "#11223344",
+		"rgb(0, 119, 194)":   "#0077c2",
+		"rgba(0, 0, 0, 0.5)": "#00000080",
+		"rgb(100%, 0%, 50%)": "#ff0080",
+		"SteelBlue":          "steelblue",
+	} {
+		if got, ok := hexColor(props.Color(in)); !ok || got != want {
+			t.Errorf("hexColor(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if _, ok := hexColor("currentColor"); ok {
+		t.Error("expected currentColor to have no hex value")
+	}
+}
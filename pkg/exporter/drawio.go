@@ -0,0 +1,224 @@
+package exporter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+)
+
+// Ids of the two cells every mxGraph model starts with: the root and the default layer
+// the diagram is drawn on. Node ids cannot hold a dot, so they never clash.
+const (
+	drawioRoot  = "root.0"
+	drawioLayer = "root.1"
+)
+
+// drawioShapes maps component types to the style of the draw.io shape closest to how
+// they are drawn. Other types are rounded rectangles.
+var drawioShapes = map[string]string{
+	"Database": "shape=cylinder3;boundedLbl=1;backgroundOutline=1;size=15",
+	"Package":  "shape=folder;tabWidth=40;tabHeight=14;tabPosition=left",
+	"Artifact": "shape=note;size=15",
+}
+
+type mxFile struct {
+	XMLName xml.Name      `xml:"mxfile"`
+	Host    string        `xml:"host,attr"`
+	Diagram drawioDiagram `xml:"diagram"`
+}
+
+type drawioDiagram struct {
+	ID    string       `xml:"id,attr"`
+	Name  string       `xml:"name,attr"`
+	Model mxGraphModel `xml:"mxGraphModel"`
+}
+
+type mxGraphModel struct {
+	Grid       int      `xml:"grid,attr"`
+	GridSize   int      `xml:"gridSize,attr"`
+	PageWidth  float64  `xml:"pageWidth,attr"`
+	PageHeight float64  `xml:"pageHeight,attr"`
+	Cells      []mxCell `xml:"root>mxCell"`
+}
+
+type mxCell struct {
+	ID       string      `xml:"id,attr"`
+	Value    string      `xml:"value,attr,omitempty"`
+	Style    string      `xml:"style,attr,omitempty"`
+	Vertex   string      `xml:"vertex,attr,omitempty"`
+	Edge     string      `xml:"edge,attr,omitempty"`
+	Parent   string      `xml:"parent,attr,omitempty"`
+	Source   string      `xml:"source,attr,omitempty"`
+	Target   string      `xml:"target,attr,omitempty"`
+	Geometry *mxGeometry `xml:"mxGeometry"`
+}
+
+type mxGeometry struct {
+	X        float64   `xml:"x,attr,omitempty"`
+	Y        float64   `xml:"y,attr,omitempty"`
+	Width    float64   `xml:"width,attr,omitempty"`
+	Height   float64   `xml:"height,attr,omitempty"`
+	Relative string    `xml:"relative,attr,omitempty"`
+	As       string    `xml:"as,attr"`
+	Points   *mxPoints `xml:"Array"`
+}
+
+type mxPoints struct {
+	As     string    `xml:"as,attr"`
+	Points []mxPoint `xml:"mxPoint"`
+}
+
+type mxPoint struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+// DrawIO writes the diagram laid out as l as a draw.io file of mxGraph XML. Each
+// component becomes a vertex styled with its colours, and containers become swimlanes
+// whose children are cells inside them. Arrows become edges that leave and enter their
+// nodes where they are drawn and pass through the same bend points, so the diagram
+// opens in draw.io as laid out.
+func DrawIO(w io.Writer, l layout.Layout) error {
+	model := mxGraphModel{
+		Grid:       1,
+		GridSize:   10,
+		PageWidth:  round(l.Bounds.Width),
+		PageHeight: round(l.Bounds.Height),
+		Cells:      []mxCell{{ID: drawioRoot}, {ID: drawioLayer, Parent: drawioRoot}},
+	}
+
+	bounds := make(map[string]layout.Rect)
+	for _, e := range l.Elements() {
+		b := e.Bounds
+		bounds[e.ID] = b
+		parent := drawioLayer
+		if e.Parent != "" {
+			// Children are placed relative to their container.
+			p := bounds[e.Parent]
+			b.X, b.Y, parent = b.X-p.X, b.Y-p.Y, e.Parent
+		}
+		model.Cells = append(model.Cells, mxCell{
+			ID:       e.ID,
+			Value:    e.Title(),
+			Style:    drawioStyle(e),
+			Vertex:   "1",
+			Parent:   parent,
+			Geometry: &mxGeometry{X: round(b.X), Y: round(b.Y), Width: round(b.Width), Height: round(b.Height), As: "geometry"},
+		})
+	}
+
+	for i, arrow := range l.Connections {
+		style := []string{"edgeStyle=none", "rounded=0", "endArrow=none", "startArrow=none"}
+		if arrow.MarkerEnd {
+			style[2] = "endArrow=classic"
+		}
+		if arrow.MarkerStart {
+			style[3] = "startArrow=classic"
+		}
+		if arrow.Style == "dashed" || arrow.Style == "dotted" {
+			style = append(style, "dashed=1")
+		}
+		// Pin the ends to where they are drawn, as fractions of each node's size.
+		style = append(style, terminalStyle("exit", arrow.Start, bounds[arrow.FromID])...)
+		style = append(style, terminalStyle("entry", arrow.End, bounds[arrow.ToID])...)
+
+		geometry := &mxGeometry{Relative: "1", As: "geometry"}
+		if len(arrow.BendPoints) > 0 {
+			geometry.Points = &mxPoints{As: "points"}
+			for _, p := range arrow.BendPoints {
+				geometry.Points.Points = append(geometry.Points.Points, mxPoint{X: round(p.X), Y: round(p.Y)})
+			}
+		}
+		model.Cells = append(model.Cells, mxCell{
+			ID:       fmt.Sprintf("arrow.%d", i+1),
+			Style:    strings.Join(style, ";"),
+			Edge:     "1",
+			Parent:   drawioLayer,
+			Source:   arrow.FromID,
+			Target:   arrow.ToID,
+			Geometry: geometry,
+		})
+	}
+
+	file := mxFile{Host: "nagare", Diagram: drawioDiagram{ID: "nagare", Name: "Page-1", Model: model}}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(file); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// drawioStyle returns the style of the cell of e: its shape and its fill, stroke and
+// font colours. The stroke is the accent colour, or the text colour of components that
+// have none.
+func drawioStyle(e layout.Element) string {
+	style := map[string]string{"rounded": "1", "arcSize": "8"}
+	if layout.IsContainerType(e.Type) {
+		content, _ := layout.ContentArea(e.Type, e.Bounds)
+		style = map[string]string{"swimlane": "", "container": "1", "collapsible": "0", "rounded": "1", "arcSize": "4",
+			"startSize": fmt.Sprint(round(content.Y - e.Bounds.Y))}
+		if c, ok := color(e, "contentBg"); ok {
+			if hex, ok := hexColor(c); ok {
+				style["swimlaneFillColor"] = hex
+			}
+		}
+	} else if shape, ok := drawioShapes[e.Type]; ok {
+		style = map[string]string{}
+		for _, pair := range strings.Split(shape, ";") {
+			key, value, _ := strings.Cut(pair, "=")
+			style[key] = value
+		}
+	}
+
+	stroke := "accent"
+	if _, ok := color(e, stroke); !ok {
+		stroke = "fg"
+	}
+	for key, prop := range map[string]string{"fillColor": "bg", "strokeColor": stroke, "fontColor": "fg"} {
+		if c, ok := color(e, prop); ok {
+			if hex, ok := hexColor(c); ok {
+				style[key] = hex
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(style))
+	for key := range style {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var names, pairs []string
+	for _, key := range keys {
+		if style[key] == "" {
+			names = append(names, key) // A bare name, such as swimlane, goes first
+		} else {
+			pairs = append(pairs, key+"="+style[key])
+		}
+	}
+	return strings.Join(append(names, pairs...), ";")
+}
+
+// terminalStyle returns the style that pins the exit or entry of an edge to p on a node
+// at bounds.
+func terminalStyle(prefix string, p layout.Point, bounds layout.Rect) []string {
+	if bounds.Width == 0 || bounds.Height == 0 {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("%sX=%g", prefix, math.Round((p.X-bounds.X)/bounds.Width*1e4)/1e4),
+		fmt.Sprintf("%sY=%g", prefix, math.Round((p.Y-bounds.Y)/bounds.Height*1e4)/1e4),
+		prefix + "Dx=0",
+		prefix + "Dy=0",
+		prefix + "Perimeter=0",
+	}
+}
@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestDrawIO(t *testing.T) {
+	root, l := layoutOf(t, shop)
+	var b strings.Builder
+	if err := DrawIO(&b, l); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var file mxFile
+	if err := xml.Unmarshal([]byte(b.String()), &file); err != nil {
+		t.Fatalf("export is not valid XML: %v\n%s", err, b.String())
+	}
+	model := file.Diagram.Model
+	if model.PageWidth != 600 || model.PageHeight != 500 {
+		t.Errorf("expected a 600x500 page, got %vx%v", model.PageWidth, model.PageHeight)
+	}
+
+	cells := make(map[string]mxCell)
+	for _, cell := range model.Cells {
+		cells[cell.ID] = cell
+	}
+	if len(cells) != 2+4+len(root.Connections) {
+		t.Fatalf("expected the root, the layer, 4 vertices and 3 edges, got %d cells", len(cells))
+	}
+
+	web := cells["web"]
+	if web.Value != "Web" || web.Parent != drawioLayer || *web.Geometry != (mxGeometry{X: 40, Y: 20, Width: 200, Height: 60, As: "geometry"}) {
+		t.Errorf("unexpected web cell %+v %+v", web, web.Geometry)
+	}
+	if !strings.Contains(web.Style, "fillColor=#1e3a8a") || !strings.Contains(web.Style, "rounded=1") {
+		t.Errorf("expected web's bg as its fill, got %s", web.Style)
+	}
+	backend := cells["backend"]
+	if !strings.HasPrefix(backend.Style, "swimlane;") || !strings.Contains(backend.Style, "container=1") {
+		t.Errorf("expected the VM to be a swimlane container, got %s", backend.Style)
+	}
+
+	// Children sit in the VM, relative to its corner.
+	api := cells["api"]
+	vm, child := l.NodeIndex["backend"], l.NodeIndex["api"]
+	if api.Parent != "backend" || api.Geometry.X != round(child.X-vm.X) || api.Geometry.Y != round(child.Y-vm.Y) {
+		t.Errorf("expected api inside backend at its relative position, got %+v %+v", api, api.Geometry)
+	}
+	if orders := cells["orders"]; !strings.Contains(orders.Style, "shape=cylinder3") || !strings.Contains(orders.Style, "strokeColor=#14b8a6") {
+		t.Errorf("expected orders to be a cylinder stroked with its accent, got %s", orders.Style)
+	}
+
+	edge := cells["arrow.1"]
+	arrow := l.Connections[0]
+	if edge.Source != "web" || edge.Target != "api" || edge.Edge != "1" || !strings.Contains(edge.Style, "exitX=0.5;exitY=1") || !strings.Contains(edge.Style, "entryX=0.5;entryY=0") {
+		t.Errorf("unexpected edge %+v", edge)
+	}
+	if edge.Geometry.Points == nil || len(edge.Geometry.Points.Points) != len(arrow.BendPoints) {
+		t.Fatalf("expected the bend points as waypoints, got %+v", edge.Geometry)
+	}
+	for i, p := range arrow.BendPoints {
+		if got := edge.Geometry.Points.Points[i]; got.X != round(p.X) || got.Y != round(p.Y) {
+			t.Errorf("waypoint %d: expected %+v, got %+v", i, p, got)
+		}
+	}
+}
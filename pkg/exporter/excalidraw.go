@@ -0,0 +1,280 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+)
+
+// MaxRoughness is the most hand-drawn Excalidraw style, "cartoonist". 0 draws clean
+// lines and 1 is Excalidraw's default, "artist".
+const MaxRoughness = 2
+
+// Excalidraw font families.
+const (
+	excalidrawHandDrawn = 1 // Virgil
+	excalidrawNormal    = 2 // Helvetica
+)
+
+// excalidrawEllipses are the component types drawn as ellipses. Other types are
+// rectangles.
+var excalidrawEllipses = map[string]bool{"Database": true}
+
+type excalidrawFile struct {
+	Type     string                 `json:"type"`
+	Version  int                    `json:"version"`
+	Source   string                 `json:"source"`
+	Elements []interface{}          `json:"elements"`
+	AppState map[string]interface{} `json:"appState"`
+	Files    map[string]interface{} `json:"files"`
+}
+
+// excalidrawElement holds the fields every Excalidraw element has.
+type excalidrawElement struct {
+	ID              string              `json:"id"`
+	Type            string              `json:"type"`
+	X               float64             `json:"x"`
+	Y               float64             `json:"y"`
+	Width           float64             `json:"width"`
+	Height          float64             `json:"height"`
+	Angle           float64             `json:"angle"`
+	StrokeColor     string              `json:"strokeColor"`
+	BackgroundColor string              `json:"backgroundColor"`
+	FillStyle       string              `json:"fillStyle"`
+	StrokeWidth     float64             `json:"strokeWidth"`
+	StrokeStyle     string              `json:"strokeStyle"`
+	Roughness       int                 `json:"roughness"`
+	Opacity         int                 `json:"opacity"`
+	GroupIDs        []string            `json:"groupIds"`
+	FrameID         *string             `json:"frameId"`
+	Roundness       *excalidrawRound    `json:"roundness"`
+	Seed            uint32              `json:"seed"`
+	Version         int                 `json:"version"`
+	VersionNonce    uint32              `json:"versionNonce"`
+	IsDeleted       bool                `json:"isDeleted"`
+	BoundElements   []excalidrawBinding `json:"boundElements"`
+	Updated         int64               `json:"updated"`
+	Link            *string             `json:"link"`
+	Locked          bool                `json:"locked"`
+}
+
+type excalidrawRound struct {
+	Type int `json:"type"`
+}
+
+// excalidrawBinding is an element bound to another: a label in its container, or an
+// arrow to the shapes it joins.
+type excalidrawBinding struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type excalidrawText struct {
+	excalidrawElement
+	Text          string  `json:"text"`
+	OriginalText  string  `json:"originalText"`
+	FontSize      float64 `json:"fontSize"`
+	FontFamily    int     `json:"fontFamily"`
+	TextAlign     string  `json:"textAlign"`
+	VerticalAlign string  `json:"verticalAlign"`
+	ContainerID   *string `json:"containerId"`
+	LineHeight    float64 `json:"lineHeight"`
+	AutoResize    bool    `json:"autoResize"`
+}
+
+type excalidrawArrow struct {
+	excalidrawElement
+	Points             [][2]float64       `json:"points"`
+	LastCommittedPoint *[2]float64        `json:"lastCommittedPoint"`
+	StartBinding       *excalidrawPinning `json:"startBinding"`
+	EndBinding         *excalidrawPinning `json:"endBinding"`
+	StartArrowhead     *string            `json:"startArrowhead"`
+	EndArrowhead       *string            `json:"endArrowhead"`
+	Elbowed            bool               `json:"elbowed"`
+}
+
+// excalidrawPinning binds an end of an arrow to the shape it touches.
+type excalidrawPinning struct {
+	ElementID string  `json:"elementId"`
+	Focus     float64 `json:"focus"`
+	Gap       float64 `json:"gap"`
+}
+
+// Excalidraw writes the diagram laid out as l as an Excalidraw scene. Each component is
+// a rectangle, or an ellipse for databases, with its title as a text bound inside it;
+// containers carry their title in their header, and a container and everything in it
+// share a group so they move together. Arrows follow the drawn path and are bound to
+// the shapes they join, so they follow those shapes when moved. roughness, 0 to
+// MaxRoughness, sets how hand-drawn the scene looks; text is in Excalidraw's
+// handwritten font unless it is 0.
+func Excalidraw(w io.Writer, l layout.Layout, roughness int) error {
+	if roughness < 0 || roughness > MaxRoughness {
+		return fmt.Errorf("roughness must be between 0 and %d, got %d", MaxRoughness, roughness)
+	}
+	font := excalidrawNormal
+	if roughness > 0 {
+		font = excalidrawHandDrawn
+	}
+
+	base := func(id, typeName string, r layout.Rect) excalidrawElement {
+		return excalidrawElement{
+			ID: id, Type: typeName,
+			X: round(r.X), Y: round(r.Y), Width: round(r.Width), Height: round(r.Height),
+			StrokeColor: "#1e1e1e", BackgroundColor: "transparent", FillStyle: "solid",
+			StrokeWidth: 1, StrokeStyle: "solid", Roughness: roughness, Opacity: 100,
+			GroupIDs: []string{}, Seed: seed(id), Version: 1, VersionNonce: seed(id + ".nonce"), Updated: 1,
+		}
+	}
+
+	elements := l.Elements()
+	shapes := make(map[string]*excalidrawElement, len(elements))
+	groups := make(map[string][]string) // Of each element, innermost first
+	var ordered []interface{}
+	var texts []excalidrawText
+	for _, e := range elements {
+		var ids []string
+		if e.Parent != "" {
+			ids = append(ids, groups[e.Parent]...)
+		}
+		if layout.IsContainerType(e.Type) {
+			ids = append([]string{"group." + e.ID}, ids...)
+		}
+		groups[e.ID] = ids
+
+		typeName := "rectangle"
+		if excalidrawEllipses[e.Type] {
+			typeName = "ellipse"
+		}
+		shape := base(e.ID, typeName, e.Bounds)
+		shape.GroupIDs = append([]string{}, ids...)
+		if typeName == "rectangle" {
+			shape.Roundness = &excalidrawRound{Type: 3}
+		}
+		if bg, ok := color(e, "bg"); ok {
+			if hex, ok := hexColor(bg); ok {
+				shape.BackgroundColor = hex
+			}
+		}
+		stroke := "accent"
+		if _, ok := color(e, stroke); !ok {
+			stroke = "fg"
+		}
+		if c, ok := color(e, stroke); ok {
+			if hex, ok := hexColor(c); ok {
+				shape.StrokeColor = hex
+			}
+		}
+		textColor := "#1e1e1e"
+		if fg, ok := color(e, "fg"); ok {
+			if hex, ok := hexColor(fg); ok {
+				textColor = hex
+			}
+		}
+
+		label := e.Title()
+		size := math.Max(10, math.Min(20, e.Bounds.Height*0.25))
+		textW, textH := float64(len([]rune(label)))*size*0.6, size*1.25
+		text := excalidrawText{
+			excalidrawElement: base(e.ID+".label", "text", layout.Rect{}),
+			Text:              label,
+			OriginalText:      label,
+			FontSize:          size,
+			FontFamily:        font,
+			TextAlign:         "center",
+			VerticalAlign:     "middle",
+			LineHeight:        1.25,
+			AutoResize:        true,
+		}
+		text.StrokeColor = textColor
+		text.GroupIDs = append([]string{}, ids...)
+		if layout.IsContainerType(e.Type) {
+			// The title sits in the header, which a bound text cannot.
+			content, _ := layout.ContentArea(e.Type, e.Bounds)
+			header := content.Y - e.Bounds.Y
+			size = math.Max(10, math.Min(20, header*0.5))
+			textW, textH = float64(len([]rune(label)))*size*0.6, size*1.25
+			text.FontSize, text.TextAlign, text.VerticalAlign = size, "left", "top"
+			text.X, text.Y = round(content.X), round(e.Bounds.Y+(header-textH)/2)
+		} else {
+			id := shape.ID
+			text.ContainerID = &id
+			text.X, text.Y = round(e.Bounds.X+(e.Bounds.Width-textW)/2), round(e.Bounds.Y+(e.Bounds.Height-textH)/2)
+			shape.BoundElements = append(shape.BoundElements, excalidrawBinding{ID: text.ID, Type: "text"})
+		}
+		text.Width, text.Height = round(textW), round(textH)
+
+		shapes[e.ID] = &shape
+		ordered = append(ordered, &shape)
+		texts = append(texts, text)
+	}
+
+	var arrows []excalidrawArrow
+	for i, a := range l.Connections {
+		points := append(append([]layout.Point{a.Start}, a.BendPoints...), a.End)
+		minX, minY, maxX, maxY := a.Start.X, a.Start.Y, a.Start.X, a.Start.Y
+		relative := make([][2]float64, len(points))
+		for j, p := range points {
+			relative[j] = [2]float64{round(p.X - a.Start.X), round(p.Y - a.Start.Y)}
+			minX, minY = math.Min(minX, p.X), math.Min(minY, p.Y)
+			maxX, maxY = math.Max(maxX, p.X), math.Max(maxY, p.Y)
+		}
+
+		id := fmt.Sprintf("arrow.%d", i+1)
+		arrow := excalidrawArrow{
+			excalidrawElement: base(id, "arrow", layout.Rect{X: a.Start.X, Y: a.Start.Y, Width: maxX - minX, Height: maxY - minY}),
+			Points:            relative,
+		}
+		if a.MarkerEnd {
+			head := "arrow"
+			arrow.EndArrowhead = &head
+		}
+		if a.MarkerStart {
+			head := "arrow"
+			arrow.StartArrowhead = &head
+		}
+		if a.Style == "dashed" || a.Style == "dotted" {
+			arrow.StrokeStyle = a.Style
+		}
+		for _, end := range []struct {
+			id      string
+			binding **excalidrawPinning
+		}{{a.FromID, &arrow.StartBinding}, {a.ToID, &arrow.EndBinding}} {
+			if shape, ok := shapes[end.id]; ok {
+				*end.binding = &excalidrawPinning{ElementID: end.id}
+				shape.BoundElements = append(shape.BoundElements, excalidrawBinding{ID: id, Type: "arrow"})
+			}
+		}
+		arrows = append(arrows, arrow)
+	}
+
+	// Shapes first, so labels and arrows draw over them.
+	for i := range texts {
+		ordered = append(ordered, &texts[i])
+	}
+	for i := range arrows {
+		ordered = append(ordered, &arrows[i])
+	}
+	file := excalidrawFile{
+		Type:     "excalidraw",
+		Version:  2,
+		Source:   "https://github.com/saasuke-labs/nagare",
+		Elements: ordered,
+		AppState: map[string]interface{}{"viewBackgroundColor": "#ffffff", "gridSize": nil},
+		Files:    map[string]interface{}{},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(file)
+}
+
+// seed derives the random seed Excalidraw draws an element's strokes with from its id,
+// so the same diagram always exports the same scene.
+func seed(id string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return h.Sum32()%2147483646 + 1
+}
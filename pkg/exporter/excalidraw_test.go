@@ -0,0 +1,105 @@
+package exporter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// excalidrawScene is the part of an exported scene the tests read.
+type excalidrawScene struct {
+	Type     string `json:"type"`
+	Elements []struct {
+		ID            string              `json:"id"`
+		Type          string              `json:"type"`
+		X             float64             `json:"x"`
+		Y             float64             `json:"y"`
+		Roughness     int                 `json:"roughness"`
+		GroupIDs      []string            `json:"groupIds"`
+		BoundElements []excalidrawBinding `json:"boundElements"`
+		ContainerID   *string             `json:"containerId"`
+		FontFamily    int                 `json:"fontFamily"`
+		Points        [][2]float64        `json:"points"`
+		StartBinding  *excalidrawPinning  `json:"startBinding"`
+		EndBinding    *excalidrawPinning  `json:"endBinding"`
+		EndArrowhead  *string             `json:"endArrowhead"`
+	} `json:"elements"`
+}
+
+func TestExcalidraw(t *testing.T) {
+	_, l := layoutOf(t, shop)
+	var b strings.Builder
+	if err := Excalidraw(&b, l, 2); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var scene excalidrawScene
+	if err := json.Unmarshal([]byte(b.String()), &scene); err != nil {
+		t.Fatalf("export is not valid JSON: %v", err)
+	}
+	if scene.Type != "excalidraw" {
+		t.Fatalf("unexpected scene type %q", scene.Type)
+	}
+
+	byID := make(map[string]int)
+	for i, e := range scene.Elements {
+		byID[e.ID] = i
+		if e.Roughness != 2 {
+			t.Errorf("%s: expected roughness 2, got %d", e.ID, e.Roughness)
+		}
+	}
+	el := func(id string) int {
+		i, ok := byID[id]
+		if !ok {
+			t.Fatalf("no element %s", id)
+		}
+		return i
+	}
+
+	orders := scene.Elements[el("orders")]
+	if orders.Type != "ellipse" || scene.Elements[el("web")].Type != "rectangle" {
+		t.Errorf("expected orders to be an ellipse and web a rectangle")
+	}
+	label := scene.Elements[el("orders.label")]
+	if label.Type != "text" || label.ContainerID == nil || *label.ContainerID != "orders" || label.FontFamily != excalidrawHandDrawn {
+		t.Errorf("expected the orders label bound inside it in the handwritten font, got %+v", label)
+	}
+	if title := scene.Elements[el("backend.label")]; title.ContainerID != nil {
+		t.Errorf("expected the container title to be free text, got %+v", title)
+	}
+
+	// The VM, its title and its children move together.
+	for _, id := range []string{"backend", "backend.label", "api", "orders", "orders.label"} {
+		if groups := scene.Elements[el(id)].GroupIDs; len(groups) != 1 || groups[0] != "group.backend" {
+			t.Errorf("%s: expected group.backend, got %v", id, groups)
+		}
+	}
+	if groups := scene.Elements[el("web")].GroupIDs; len(groups) != 0 {
+		t.Errorf("expected web in no group, got %v", groups)
+	}
+
+	arrow := scene.Elements[el("arrow.1")]
+	a := l.Connections[0]
+	if arrow.X != round(a.Start.X) || arrow.Y != round(a.Start.Y) || len(arrow.Points) != len(a.BendPoints)+2 || arrow.Points[0] != [2]float64{0, 0} {
+		t.Errorf("expected the arrow to follow the routed path, got %+v", arrow)
+	}
+	if last := arrow.Points[len(arrow.Points)-1]; last != [2]float64{round(a.End.X - a.Start.X), round(a.End.Y - a.Start.Y)} {
+		t.Errorf("expected the arrow to end at %+v, got %v", a.End, last)
+	}
+	if arrow.StartBinding == nil || arrow.StartBinding.ElementID != "web" || arrow.EndBinding == nil || arrow.EndBinding.ElementID != "api" || arrow.EndArrowhead == nil {
+		t.Errorf("expected the arrow bound from web to api, got %+v", arrow)
+	}
+	bound := false
+	for _, binding := range scene.Elements[el("api")].BoundElements {
+		bound = bound || binding == excalidrawBinding{ID: "arrow.1", Type: "arrow"}
+	}
+	if !bound {
+		t.Errorf("expected api to list the arrow bound to it, got %v", scene.Elements[el("api")].BoundElements)
+	}
+}
+
+func TestExcalidrawRejectsRoughness(t *testing.T) {
+	_, l := layoutOf(t, shop)
+	if err := Excalidraw(&strings.Builder{}, l, 3); err == nil {
+		t.Fatal("expected an error for roughness 3")
+	}
+}
@@ -0,0 +1,192 @@
+// Package exporter writes laid out Nagare diagrams in the formats of other diagram
+// tools, so a diagram can be opened and edited there. Each exporter reads the resolved
+// layout, and the AST it was laid out from, and keeps as much of the drawing as the
+// target format can hold.
+package exporter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/props"
+)
+
+// color returns the colour prop key of e, and whether it is set.
+func color(e layout.Element, key string) (props.Color, bool) {
+	v, ok := props.Lookup(e.Props, key)
+	c, _ := v.(props.Color)
+	return c, ok && c != ""
+}
+
+// round rounds v to two decimals, which is finer than any format draws.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// declaredTypes maps the id of each node of root to the type it is declared with, which
+// keeps aliases such as Queue that the layout draws as another type.
+func declaredTypes(root parser.Node) map[string]string {
+	types := make(map[string]string)
+	var walk func(nodes []parser.Node)
+	walk = func(nodes []parser.Node) {
+		for _, n := range nodes {
+			types[n.Text] = string(n.Type)
+			walk(n.Children)
+		}
+	}
+	walk(root.Children)
+	return types
+}
+
+// hexColor returns c as #rrggbb, or #rrggbbaa if it is translucent, for formats that
+// read no other notation. Colour names are returned as they are, and ok is false for
+// colours it cannot convert, such as currentColor.
+func hexColor(c props.Color) (hex string, ok bool) {
+	s := strings.ToLower(strings.TrimSpace(string(c)))
+	switch {
+	case strings.HasPrefix(s, "#"):
+		digits := s[1:]
+		if len(digits) == 3 || len(digits) == 4 {
+			var expanded strings.Builder
+			for _, d := range digits {
+				expanded.WriteString(strings.Repeat(string(d), 2))
+			}
+			digits = expanded.String()
+		}
+		if strings.HasSuffix(digits, "ff") && len(digits) == 8 {
+			digits = digits[:6]
+		}
+		return "#" + digits, true
+	case strings.HasPrefix(s, "rgb"):
+		_, args, _ := strings.Cut(strings.TrimSuffix(s, ")"), "(")
+		parts := strings.Split(args, ",")
+		var hex strings.Builder
+		hex.WriteByte('#')
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			// Channels are 0-255 and alpha 0-1, or either a percentage.
+			limit := 255.0
+			if i == 3 {
+				limit = 1
+			}
+			if strings.HasSuffix(part, "%") {
+				part, limit = strings.TrimSuffix(part, "%"), 100
+			}
+			n, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return "", false
+			}
+			v := math.Round(math.Min(n/limit, 1) * 255)
+			if i == 3 && v == 255 {
+				break
+			}
+			fmt.Fprintf(&hex, "%02x", int(v))
+		}
+		return hex.String(), true
+	case s == "currentcolor":
+		return "", false
+	}
+	return s, true
+}
+
+// palette is the fill, stroke and text colour of a component, as hex where they
+// convert. A container is filled with the colour of its content area, which covers most
+// of it.
+type palette struct {
+	Fill, Stroke, Text string
+}
+
+func paletteOf(e layout.Element) palette {
+	hex := func(keys ...string) string {
+		for _, key := range keys {
+			if c, ok := color(e, key); ok {
+				if s, ok := hexColor(c); ok {
+					return s
+				}
+			}
+		}
+		return ""
+	}
+	fill := hex("bg")
+	if layout.IsContainerType(e.Type) {
+		fill = hex("contentBg", "bg")
+	}
+	return palette{Fill: fill, Stroke: hex("accent", "fg"), Text: hex("fg")}
+}
+
+// defaults returns e as it is drawn when none of its props are set.
+func defaults(e layout.Element) layout.Element {
+	if c, ok := layout.LookupComponent(e.Type); ok {
+		e.Props = c.Props
+	}
+	return e
+}
+
+// paletteKeys are the props paletteOf reads, and title the prop every format labels
+// components with; formats that keep nothing else drop the other props.
+var paletteKeys = map[string]bool{"title": true, "bg": true, "fg": true, "accent": true, "contentBg": true}
+
+// droppedProps adds to dropped the props of e set to other than their default that are
+// not in kept.
+func droppedProps(e layout.Element, kept map[string]bool, dropped map[string]bool) {
+	def := defaults(e)
+	for _, v := range props.Values(e.Props) {
+		if kept[v.Key] {
+			continue
+		}
+		if d, ok := props.Lookup(def.Props, v.Key); !ok || fmt.Sprint(d) != fmt.Sprint(v.Value) {
+			dropped[v.Key] = true
+		}
+	}
+}
+
+// identifiers maps the id of each element to one made of letters, digits and
+// underscores, which text formats read as a single name, and that is not in reserved.
+func identifiers(elements []layout.Element, reserved map[string]bool) map[string]string {
+	ids := make(map[string]string, len(elements))
+	taken := make(map[string]bool, len(elements))
+	for _, e := range elements {
+		base := strings.Map(func(r rune) rune {
+			if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, e.ID)
+		if reserved[strings.ToLower(base)] {
+			base += "_"
+		}
+		id := base
+		for n := 2; taken[id]; n++ {
+			id = fmt.Sprintf("%s_%d", base, n)
+		}
+		ids[e.ID], taken[id] = id, true
+	}
+	return ids
+}
+
+// anchoredConnections counts the connections of l that leave or enter a node at a
+// chosen anchor, or bend, which formats that route edges themselves drop.
+func anchoredConnections(l layout.Layout) int {
+	n := 0
+	for _, a := range l.Connections {
+		if a.FromAnchor != "" || a.ToAnchor != "" || len(a.BendPoints) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// sortedKeys returns the keys of set in order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
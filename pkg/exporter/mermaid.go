@@ -0,0 +1,178 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+)
+
+// mermaidShapes maps component types to the brackets of the Mermaid flowchart shape
+// closest to how they are drawn. Other types are rectangles.
+var mermaidShapes = map[string][2]string{
+	"Database":     {"[(", ")]"},
+	"MessageQueue": {">", "]"},
+	"CDN":          {"((", "))"},
+	"APIGateway":   {"{{", "}}"},
+	"Package":      {"[[", "]]"},
+	"Artifact":     {"[/", "/]"},
+}
+
+// mermaidReserved are the words Mermaid reads as keywords wherever a node id could go.
+var mermaidReserved = map[string]bool{"end": true, "subgraph": true, "graph": true, "flowchart": true, "class": true, "classdef": true, "style": true, "click": true, "linkstyle": true}
+
+// Mermaid writes the diagram laid out as l from root as a Mermaid flowchart, for
+// Markdown that renders Mermaid. Each component becomes a node of the shape closest to
+// how it is drawn and of a class named after its declared type, whose classDef holds the
+// type's colours; components coloured otherwise get a style of their own. Containers
+// become subgraphs, and connections edges with the same arrowheads and dashes.
+//
+// Mermaid lays the flowchart out itself, so positions, sizes, anchors and bend points
+// are lost. The returned warnings describe what else the flowchart could not keep.
+func Mermaid(w io.Writer, root parser.Node, l layout.Layout) ([]string, error) {
+	elements := l.Elements()
+	ids := identifiers(elements, mermaidReserved)
+	types := declaredTypes(root)
+	var warnings []string
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "flowchart %s\n", mermaidDirection(l))
+
+	// One classDef for each declared type, in order of first use.
+	classes := make(map[string]palette)
+	var classOrder []string
+	for _, e := range elements {
+		class := mermaidClass(types, e)
+		if _, ok := classes[class]; !ok {
+			classes[class] = paletteOf(defaults(e))
+			classOrder = append(classOrder, class)
+		}
+	}
+	for _, class := range classOrder {
+		if style := mermaidStyle(classes[class]); style != "" {
+			fmt.Fprintf(&b, "    classDef %s %s;\n", class, style)
+		}
+	}
+	b.WriteString("\n")
+
+	children := make(map[string][]layout.Element)
+	for _, e := range elements {
+		children[e.Parent] = append(children[e.Parent], e)
+	}
+	dropped := make(map[string]bool)
+	var classLines, styleLines []string
+	var write func(parent string, depth int)
+	write = func(parent string, depth int) {
+		indent := strings.Repeat("    ", depth)
+		for _, e := range children[parent] {
+			id, label := ids[e.ID], mermaidText(e.Title())
+			class := mermaidClass(types, e)
+			droppedProps(e, paletteKeys, dropped)
+			if p := paletteOf(e); p != classes[class] && mermaidStyle(p) != "" {
+				styleLines = append(styleLines, fmt.Sprintf("    style %s %s", id, mermaidStyle(p)))
+			}
+			if layout.IsContainerType(e.Type) {
+				fmt.Fprintf(&b, "%ssubgraph %s[\"%s\"]\n", indent, id, label)
+				write(e.ID, depth+1)
+				fmt.Fprintf(&b, "%send\n", indent)
+				classLines = append(classLines, fmt.Sprintf("    class %s %s", id, class))
+				continue
+			}
+			shape, ok := mermaidShapes[e.Type]
+			if !ok {
+				shape = [2]string{"[", "]"}
+			}
+			fmt.Fprintf(&b, "%s%s%s\"%s\"%s:::%s\n", indent, id, shape[0], label, shape[1], class)
+		}
+	}
+	write("", 1)
+
+	if len(l.Connections) > 0 {
+		b.WriteString("\n")
+	}
+	for _, a := range l.Connections {
+		from, to := mermaidID(ids, a.FromID), mermaidID(ids, a.ToID)
+		line := "--"
+		if a.Style == "dashed" || a.Style == "dotted" {
+			line = "-.-"
+		}
+		switch {
+		case a.MarkerStart && a.MarkerEnd:
+			line = "<" + line + ">"
+		case a.MarkerStart:
+			from, to, line = to, from, line+">"
+		case a.MarkerEnd:
+			line += ">"
+		default:
+			line += "-"
+		}
+		fmt.Fprintf(&b, "    %s %s %s\n", from, line, to)
+	}
+
+	if len(classLines)+len(styleLines) > 0 {
+		b.WriteString("\n")
+	}
+	for _, line := range append(classLines, styleLines...) {
+		b.WriteString(line + "\n")
+	}
+
+	if keys := sortedKeys(dropped); len(keys) > 0 {
+		warnings = append(warnings, fmt.Sprintf("Mermaid has no equivalent of props %s; they are dropped", strings.Join(keys, ", ")))
+	}
+	if n := anchoredConnections(l); n > 0 {
+		warnings = append(warnings, fmt.Sprintf("Mermaid routes edges itself; the anchors and bend points of %d connections are dropped", n))
+	}
+	_, err := io.WriteString(w, b.String())
+	return warnings, err
+}
+
+// mermaidDirection returns LR if the connections of l mostly run sideways, and TB
+// otherwise, so Mermaid lays the flowchart out in the direction it is drawn.
+func mermaidDirection(l layout.Layout) string {
+	var dx, dy float64
+	for _, a := range l.Connections {
+		dx += math.Abs(a.End.X - a.Start.X)
+		dy += math.Abs(a.End.Y - a.Start.Y)
+	}
+	if dx > dy {
+		return "LR"
+	}
+	return "TB"
+}
+
+// mermaidClass returns the class of e: the type it is declared with, or the type it is
+// drawn as if root does not declare it.
+func mermaidClass(types map[string]string, e layout.Element) string {
+	if t := types[e.ID]; t != "" {
+		return t
+	}
+	return e.Type
+}
+
+// mermaidID returns the Mermaid id of the node id, which connections to components the
+// layout did not draw still need.
+func mermaidID(ids map[string]string, id string) string {
+	if mapped, ok := ids[id]; ok {
+		return mapped
+	}
+	return identifiers([]layout.Element{{ID: id}}, mermaidReserved)[id]
+}
+
+// mermaidStyle writes p as the properties of a classDef or style statement.
+func mermaidStyle(p palette) string {
+	var parts []string
+	for _, prop := range []struct{ key, value string }{{"fill", p.Fill}, {"stroke", p.Stroke}, {"color", p.Text}} {
+		if prop.value != "" {
+			parts = append(parts, prop.key+":"+prop.value)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// mermaidText escapes s for a quoted Mermaid label.
+func mermaidText(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "\n", "<br/>").Replace(s)
+}
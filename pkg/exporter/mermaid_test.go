@@ -0,0 +1,70 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+)
+
+const queued = `@layout(w: 700, h: 300)
+end:Server@end
+events:Queue@events
+store:Database@store
+end.e --> events.w
+events.e --> store.w
+@end(x: 20, y: 100, title: "Client")
+@events(x: 260, y: 100)
+@store(x: 500, y: 80, engine: "Redis")
+`
+
+func TestMermaid(t *testing.T) {
+	root, l := layoutOf(t, shop)
+	var b strings.Builder
+	warnings, err := Mermaid(&b, root, l)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"flowchart TB\n",
+		"    classDef Server fill:#e6f3ff,stroke:#333333,color:#333333;\n",
+		"    classDef Database fill:#0f766e,stroke:#14b8a6,color:#ecfdf5;\n",
+		"    web[\"Web\"]:::Server\n",
+		"    subgraph backend[\"Backend\"]\n        api[\"API\"]:::Rectangle\n        orders[(\"Orders\")]:::Database\n    end\n",
+		"    web --> api\n    api --> orders\n    web --> backend\n",
+		"    class backend VM\n",
+		"    style web fill:#1e3a8a,stroke:#333333,color:#333333\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "style orders") {
+		t.Errorf("expected orders to take its colours from its class, got:\n%s", out)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "3 connections") {
+		t.Errorf("expected a warning for the anchors, got %v", warnings)
+	}
+}
+
+func TestMermaidKeepsDeclaredTypes(t *testing.T) {
+	root, l := layoutOf(t, queued)
+	var b strings.Builder
+	warnings, err := Mermaid(&b, root, l)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"flowchart LR\n",
+		"    end_[\"Client\"]:::Server\n",
+		"    events>\"Queue\"]:::Queue\n",
+		"    end_ --> events\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+	if len(warnings) != 2 || warnings[0] != "Mermaid has no equivalent of props engine; they are dropped" {
+		t.Errorf("expected warnings for the engine and the anchors, got %v", warnings)
+	}
+}
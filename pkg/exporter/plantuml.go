@@ -0,0 +1,128 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+)
+
+// plantUMLElements maps component types to the PlantUML deployment element closest to
+// what they stand for. Other types are rectangles.
+var plantUMLElements = map[string]string{
+	"VM":               "node",
+	"Cluster":          "cloud",
+	"Namespace":        "frame",
+	"Database":         "database",
+	"MessageQueue":     "queue",
+	"CDN":              "cloud",
+	"APIGateway":       "hexagon",
+	"BackgroundWorker": "component",
+	"Package":          "folder",
+	"Artifact":         "artifact",
+	"Terminal":         "card",
+	"Deployment":       "collections",
+	"ConfigMap":        "file",
+	"Secret":           "file",
+	"PersistentVolume": "storage",
+}
+
+// PlantUML writes the diagram laid out as l as a PlantUML deployment diagram. Each
+// component becomes the deployment element closest to what it stands for, such as a
+// database, queue or node for a VM, labelled with its title and coloured as drawn when
+// its colours are not the defaults of its type. Containers hold their children, and
+// connections become arrows with the same arrowheads and dashes.
+//
+// PlantUML lays the diagram out itself, so positions, sizes, anchors and bend points
+// are lost. The returned warnings describe what else the diagram could not keep.
+func PlantUML(w io.Writer, l layout.Layout) ([]string, error) {
+	elements := l.Elements()
+	ids := identifiers(elements, nil)
+	children := make(map[string][]layout.Element)
+	for _, e := range elements {
+		children[e.Parent] = append(children[e.Parent], e)
+	}
+
+	var b strings.Builder
+	b.WriteString("@startuml\n")
+	dropped := make(map[string]bool)
+	var write func(parent string, depth int)
+	write = func(parent string, depth int) {
+		indent := strings.Repeat("  ", depth)
+		for _, e := range children[parent] {
+			keyword, ok := plantUMLElements[e.Type]
+			if !ok {
+				keyword = "rectangle"
+			}
+			droppedProps(e, paletteKeys, dropped)
+			fmt.Fprintf(&b, "%s%s \"%s\" as %s", indent, keyword, plantUMLText(e.Title()), ids[e.ID])
+			if p := paletteOf(e); p != paletteOf(defaults(e)) {
+				b.WriteString(plantUMLColors(p))
+			}
+			if layout.IsContainerType(e.Type) {
+				b.WriteString(" {\n")
+				write(e.ID, depth+1)
+				fmt.Fprintf(&b, "%s}", indent)
+			}
+			b.WriteString("\n")
+		}
+	}
+	write("", 0)
+
+	if len(l.Connections) > 0 {
+		b.WriteString("\n")
+	}
+	for _, a := range l.Connections {
+		line := "--"
+		if a.Style == "dashed" || a.Style == "dotted" {
+			line = ".."
+		}
+		if a.MarkerStart {
+			line = "<" + line
+		}
+		if a.MarkerEnd {
+			line += ">"
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", plantUMLID(ids, a.FromID), line, plantUMLID(ids, a.ToID))
+	}
+	b.WriteString("@enduml\n")
+
+	var warnings []string
+	if keys := sortedKeys(dropped); len(keys) > 0 {
+		warnings = append(warnings, fmt.Sprintf("PlantUML has no equivalent of props %s; they are dropped", strings.Join(keys, ", ")))
+	}
+	if n := anchoredConnections(l); n > 0 {
+		warnings = append(warnings, fmt.Sprintf("PlantUML routes arrows itself; the anchors and bend points of %d connections are dropped", n))
+	}
+	_, err := io.WriteString(w, b.String())
+	return warnings, err
+}
+
+// plantUMLColors writes p as the colour spec that follows an element, as in
+// " #back:e6f3ff;line:333333;text:333333".
+func plantUMLColors(p palette) string {
+	var parts []string
+	for _, c := range []struct{ key, value string }{{"back", p.Fill}, {"line", p.Stroke}, {"text", p.Text}} {
+		if c.value != "" {
+			parts = append(parts, c.key+":"+strings.TrimPrefix(c.value, "#"))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " #" + strings.Join(parts, ";")
+}
+
+// plantUMLID returns the PlantUML alias of the node id.
+func plantUMLID(ids map[string]string, id string) string {
+	if mapped, ok := ids[id]; ok {
+		return mapped
+	}
+	return identifiers([]layout.Element{{ID: id}}, nil)[id]
+}
+
+// plantUMLText escapes s for a quoted PlantUML label, which cannot hold a double quote.
+func plantUMLText(s string) string {
+	return strings.NewReplacer(`"`, "'", "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,50 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlantUML(t *testing.T) {
+	_, l := layoutOf(t, shop)
+	var b strings.Builder
+	warnings, err := PlantUML(&b, l)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	want := `@startuml
+rectangle "Web" as web #back:1e3a8a;line:333333;text:333333
+node "Backend" as backend {
+  rectangle "API" as api #back:e6f3ff;line:ffffff;text:ffffff
+  database "Orders" as orders
+}
+
+web --> api
+api --> orders
+web --> backend
+@enduml
+`
+	if got := b.String(); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected a warning for the anchors, got %v", warnings)
+	}
+}
+
+func TestPlantUMLQueues(t *testing.T) {
+	_, l := layoutOf(t, queued)
+	var b strings.Builder
+	warnings, err := PlantUML(&b, l)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	for _, want := range []string{`rectangle "Client" as end`, `queue "Queue" as events`, `database "Database" as store`} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("expected %s in:\n%s", want, b.String())
+		}
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "props engine") {
+		t.Errorf("expected warnings for the engine and the anchors, got %v", warnings)
+	}
+}
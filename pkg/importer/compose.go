@@ -0,0 +1,340 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/saasuke-labs/nagare/pkg/parser"
+)
+
+// defaultNetwork is the network Compose attaches services that name none to.
+const defaultNetwork = "default"
+
+// Size of servers, which draw their icon, title and port in a row.
+const (
+	composeServerWidth  = 240.0
+	composeServerHeight = 50.0
+)
+
+// composeFile is the part of a Compose file the importer reads.
+type composeFile struct {
+	Services yaml.Node `yaml:"services"` // Kept as a node to keep the order services are written in
+}
+
+type composeService struct {
+	Image     string        `yaml:"image"`
+	Ports     []composePort `yaml:"ports"`
+	DependsOn composeNames  `yaml:"depends_on"`
+	Links     []string      `yaml:"links"`
+	Networks  composeNames  `yaml:"networks"`
+}
+
+// composeNames is a list of names that Compose also accepts as a mapping from each name
+// to its options, as depends_on and networks are.
+type composeNames []string
+
+func (n *composeNames) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.SequenceNode:
+		var names []string
+		if err := value.Decode(&names); err != nil {
+			return err
+		}
+		*n = names
+	case yaml.MappingNode:
+		*n = nil
+		for i := 0; i < len(value.Content); i += 2 {
+			*n = append(*n, value.Content[i].Value)
+		}
+	default:
+		return fmt.Errorf("line %d: expected a list or a mapping", value.Line)
+	}
+	return nil
+}
+
+// composePort is an entry of ports, in the short "8080:80/tcp" form or the long form.
+type composePort struct {
+	Target int // The port inside the container
+}
+
+func (p *composePort) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		var long struct {
+			Target int `yaml:"target"`
+		}
+		if err := value.Decode(&long); err != nil {
+			return err
+		}
+		p.Target = long.Target
+		return nil
+	}
+	// [host:][published:]target[/protocol], where target may be a range.
+	short := value.Value
+	if i := strings.IndexByte(short, '/'); i >= 0 {
+		short = short[:i]
+	}
+	short = short[strings.LastIndexByte(short, ':')+1:]
+	if i := strings.IndexByte(short, '-'); i >= 0 {
+		short = short[:i]
+	}
+	target, err := strconv.Atoi(short)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid port %q", value.Line, value.Value)
+	}
+	p.Target = target
+	return nil
+}
+
+// composeKind is the component an image is drawn as.
+type composeKind struct {
+	typeName string
+	prop     string // The prop naming the product
+	value    string
+}
+
+// composeImages maps image names to the component they are drawn as. Images that match
+// none are drawn as a Server with the default icon.
+var composeImages = []struct {
+	image string
+	kind  composeKind
+}{
+	{"postgres", composeKind{"Database", "engine", "PostgreSQL"}},
+	{"postgis", composeKind{"Database", "engine", "PostgreSQL"}},
+	{"mysql", composeKind{"Database", "engine", "MySQL"}},
+	{"mariadb", composeKind{"Database", "engine", "MariaDB"}},
+	{"mongo", composeKind{"Database", "engine", "MongoDB"}},
+	{"redis", composeKind{"Database", "engine", "Redis"}},
+	{"valkey", composeKind{"Database", "engine", "Valkey"}},
+	{"memcached", composeKind{"Database", "engine", "Memcached"}},
+	{"elasticsearch", composeKind{"Database", "engine", "Elasticsearch"}},
+	{"rabbitmq", composeKind{"MessageQueue", "kind", "RabbitMQ"}},
+	{"kafka", composeKind{"MessageQueue", "kind", "Kafka"}},
+	{"nats", composeKind{"MessageQueue", "kind", "NATS"}},
+	{"nginx", composeKind{"Server", "icon", "nginx"}},
+	{"golang", composeKind{"Server", "icon", "golang"}},
+}
+
+// imageKind guesses the component of a service from the name of its image, ignoring the
+// registry, the organisation and the tag.
+func imageKind(image string) composeKind {
+	name := image
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	for _, known := range composeImages {
+		if strings.Contains(name, known.image) {
+			return known.kind
+		}
+	}
+	return composeKind{typeName: "Server", prop: "icon", value: "default"}
+}
+
+// composeNode is a service and the node it becomes.
+type composeNode struct {
+	name    string
+	service composeService
+	id      string
+	item    item
+}
+
+// Compose reads the Compose files in sources and returns a diagram of their services.
+// Each service becomes a Database, a MessageQueue or a Server, guessed from its image,
+// and connects to the services it depends on or links to. When the files declare
+// networks, each network becomes a VM container holding the services on it, and a
+// service on several networks sits in the first and connects to the others. Services
+// are placed in rows, each above the services it depends on. A service defined in
+// several files takes the fields each later file sets.
+func Compose(sources ...Source) (Diagram, error) {
+	var services []*composeNode
+	byName := make(map[string]*composeNode)
+	for _, source := range sources {
+		var file composeFile
+		err := yaml.NewDecoder(source).Decode(&file)
+		if errors.Is(err, io.EOF) {
+			continue
+		}
+		if err != nil {
+			return Diagram{}, fmt.Errorf("%s: %v", source.Name, err)
+		}
+		entries := file.Services.Content
+		for i := 0; i+1 < len(entries); i += 2 {
+			name := entries[i].Value
+			svc, ok := byName[name]
+			if !ok {
+				svc = &composeNode{name: name}
+				byName[name] = svc
+				services = append(services, svc)
+			}
+			// Decoding over the earlier definition keeps the fields this file leaves out.
+			if err := entries[i+1].Decode(&svc.service); err != nil {
+				return Diagram{}, fmt.Errorf("%s: service %s: %v", source.Name, name, err)
+			}
+		}
+	}
+	if len(services) == 0 {
+		return Diagram{}, errors.New("no services found")
+	}
+
+	b := newBuilder()
+	var networks []string
+	netIDs := make(map[string]string)
+	grouped := false
+	for _, svc := range services {
+		grouped = grouped || len(svc.service.Networks) > 0
+	}
+	if grouped {
+		for _, svc := range services {
+			for _, net := range svcNetworks(svc) {
+				if _, ok := netIDs[net]; !ok {
+					networks = append(networks, net)
+					netIDs[net] = b.id(net, "network")
+				}
+			}
+		}
+	}
+
+	for _, svc := range services {
+		svc.id = b.id(svc.name, "service")
+		kind := imageKind(svc.service.Image)
+		svc.item = item{
+			node:  parser.Node{Type: parser.NodeType(kind.typeName), Text: svc.id},
+			props: []prop{text("title", svc.name), text(kind.prop, kind.value)},
+		}
+		if kind.typeName == "Server" {
+			svc.item.width, svc.item.height = composeServerWidth, composeServerHeight
+			if len(svc.service.Ports) > 0 {
+				svc.item.props = append(svc.item.props, integer("port", svc.service.Ports[0].Target))
+			}
+		}
+	}
+
+	for _, svc := range services {
+		for _, dep := range svc.dependencies() {
+			if target, ok := byName[dep]; ok {
+				b.connect(svc.id, "s", target.id, "n")
+			} else {
+				b.warnf("service %s depends on %s, which is not in the files", svc.name, dep)
+			}
+		}
+		if grouped {
+			// Networks are laid out left to right in the order they appear.
+			joined := svcNetworks(svc)
+			for _, net := range joined[1:] {
+				if networkIndex(networks, net) > networkIndex(networks, joined[0]) {
+					b.connect(svc.id, "e", netIDs[net], "w")
+				} else {
+					b.connect(svc.id, "w", netIDs[net], "e")
+				}
+			}
+		}
+	}
+
+	rows := composeRows(services, byName)
+	if !grouped {
+		b.placeGroups(nil, nil, composeItems(rows, func(*composeNode) bool { return true }))
+		return b.diagram(), nil
+	}
+
+	b.alignRows = true
+	var groups []group
+	for _, net := range networks {
+		groups = append(groups, group{
+			node:  parser.Node{Type: "VM", Text: netIDs[net]},
+			props: []prop{text("title", net)},
+			rows:  composeItems(rows, func(svc *composeNode) bool { return svcNetworks(svc)[0] == net }),
+		})
+	}
+	b.placeGroups(nil, groups, nil)
+	return b.diagram(), nil
+}
+
+func networkIndex(networks []string, name string) int {
+	for i, net := range networks {
+		if net == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// dependencies returns the services svc depends on or links to.
+func (svc *composeNode) dependencies() []string {
+	deps := append([]string{}, svc.service.DependsOn...)
+	for _, link := range svc.service.Links {
+		// SERVICE[:ALIAS]
+		deps = append(deps, strings.SplitN(link, ":", 2)[0])
+	}
+	return deps
+}
+
+// svcNetworks returns the networks a service joins, which is the default network when it
+// names none.
+func svcNetworks(svc *composeNode) []string {
+	if len(svc.service.Networks) == 0 {
+		return []string{defaultNetwork}
+	}
+	return svc.service.Networks
+}
+
+// composeRows orders services in rows so that each service sits above everything it
+// depends on: services nothing depends on come first and services that depend on nothing
+// last. Dependency cycles are cut where they close.
+func composeRows(services []*composeNode, byName map[string]*composeNode) [][]*composeNode {
+	depth := make(map[string]int)
+	visiting := make(map[string]bool)
+	var measure func(name string) int
+	measure = func(name string) int {
+		if d, ok := depth[name]; ok {
+			return d
+		}
+		if visiting[name] {
+			return 0
+		}
+		visiting[name] = true
+		d := 0
+		for _, dep := range byName[name].dependencies() {
+			if _, ok := byName[dep]; ok {
+				if below := measure(dep) + 1; below > d {
+					d = below
+				}
+			}
+		}
+		visiting[name] = false
+		depth[name] = d
+		return d
+	}
+
+	deepest := 0
+	for _, svc := range services {
+		if d := measure(svc.name); d > deepest {
+			deepest = d
+		}
+	}
+	rows := make([][]*composeNode, deepest+1)
+	for _, svc := range services {
+		row := deepest - depth[svc.name]
+		rows[row] = append(rows[row], svc)
+	}
+	return rows
+}
+
+// composeItems returns the items of the services in rows that keep selects.
+func composeItems(rows [][]*composeNode, keep func(*composeNode) bool) [][]item {
+	items := make([][]item, len(rows))
+	for i, row := range rows {
+		for _, svc := range row {
+			if keep(svc) {
+				items[i] = append(items[i], svc.item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,159 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/saasuke-labs/nagare/pkg/lint"
+)
+
+const stackCompose = `services:
+  proxy:
+    image: nginx:1.27
+    ports:
+      - "443:443"
+    depends_on:
+      - api
+    networks: [frontend]
+  api:
+    build: ./api
+    ports:
+      - target: 8080
+        published: 80
+    depends_on:
+      db:
+        condition: service_healthy
+    links:
+      - broker:mq
+    networks:
+      backend:
+      frontend:
+  db:
+    image: postgres:16
+    networks: [backend]
+  broker:
+    image: docker.io/library/rabbitmq:3-management
+    networks: [backend]
+`
+
+func importCompose(t *testing.T, files ...string) Diagram {
+	t.Helper()
+	var sources []Source
+	for i, file := range files {
+		sources = append(sources, Source{Name: fmt.Sprintf("compose%d.yml", i), Reader: strings.NewReader(file)})
+	}
+	d, err := Compose(sources...)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return d
+}
+
+func TestImageKind(t *testing.T) {
+	tests := []struct {
+		image string
+		want  composeKind
+	}{
+		{"postgres:16", composeKind{"Database", "engine", "PostgreSQL"}},
+		{"bitnami/redis:7.2", composeKind{"Database", "engine", "Redis"}},
+		{"rabbitmq@sha256:abc", composeKind{"MessageQueue", "kind", "RabbitMQ"}},
+		{"ghcr.io/acme/nginx-proxy:latest", composeKind{"Server", "icon", "nginx"}},
+		{"golang:1.22", composeKind{"Server", "icon", "golang"}},
+		{"acme/api:1.0", composeKind{"Server", "icon", "default"}},
+		{"", composeKind{"Server", "icon", "default"}},
+	}
+	for _, tt := range tests {
+		if got := imageKind(tt.image); got != tt.want {
+			t.Errorf("imageKind(%q) = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestComposeNetworksBecomeContainers(t *testing.T) {
+	d := importCompose(t, stackCompose)
+
+	var got []string
+	for _, net := range d.Root.Children {
+		var children []string
+		for _, child := range net.Children {
+			children = append(children, child.Text+":"+string(child.Type))
+		}
+		got = append(got, net.Text+":"+string(net.Type)+" {"+strings.Join(children, " ")+"}")
+	}
+	want := "frontend:VM {proxy:Server} backend:VM {api:Server db:Database broker:MessageQueue}"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("expected %s, got %s", want, strings.Join(got, " "))
+	}
+
+	source := d.Source()
+	for _, state := range []string{
+		`@proxy(x: 20, y: 20, w: 240, h: 50, title: "proxy", icon: "nginx", port: 443)`,
+		`@api(x: 20, y: 110, w: 240, h: 50, title: "api", icon: "default", port: 8080)`,
+		`@broker(x: 260, y: 200, title: "broker", kind: "RabbitMQ")`,
+	} {
+		if !strings.Contains(source, state) {
+			t.Errorf("expected %s in:\n%s", state, source)
+		}
+	}
+}
+
+func TestComposeConnections(t *testing.T) {
+	d := importCompose(t, stackCompose)
+
+	var got []string
+	for _, conn := range d.Root.Connections {
+		got = append(got, conn.FromID+"."+conn.FromAnchor.Raw+" --> "+conn.ToID+"."+conn.ToAnchor.Raw)
+	}
+	want := "proxy.s --> api.n, api.s --> db.n, api.s --> broker.n, api.w --> frontend.e"
+	if strings.Join(got, ", ") != want {
+		t.Fatalf("expected %s, got %s", want, strings.Join(got, ", "))
+	}
+}
+
+func TestComposeWithoutNetworks(t *testing.T) {
+	d := importCompose(t, `services:
+  web:
+    image: acme/web
+    depends_on: [cache, missing]
+  cache:
+    image: redis
+`)
+	if len(d.Root.Children) != 2 || len(d.Root.Children[0].Children) != 0 {
+		t.Fatalf("expected the services at the top level, got %+v", d.Root.Children)
+	}
+	if len(d.Warnings) != 1 || !strings.Contains(d.Warnings[0], "depends on missing") {
+		t.Fatalf("expected a warning for the missing dependency, got %v", d.Warnings)
+	}
+	if source := d.Source(); !strings.Contains(source, "@web(x: 40, y: 40,") || !strings.Contains(source, "@cache(x: 40, y: 130,") {
+		t.Fatalf("expected web above cache, got:\n%s", source)
+	}
+}
+
+func TestComposeLaterFilesOverride(t *testing.T) {
+	d := importCompose(t, "services:\n  app:\n    image: acme/app\n    ports: [\"8080\"]\n", "services:\n  app:\n    image: golang:1.22\n")
+	source := d.Source()
+	if !strings.Contains(source, `icon: "golang", port: 8080`) {
+		t.Fatalf("expected the override image and the base port, got:\n%s", source)
+	}
+}
+
+func TestComposeErrors(t *testing.T) {
+	if _, err := Compose(Source{Name: "empty.yml", Reader: strings.NewReader("version: '3'\n")}); err == nil {
+		t.Fatal("expected an error for a file without services")
+	}
+	_, err := Compose(Source{Name: "bad.yml", Reader: strings.NewReader("services:\n  a:\n    ports: [\"http\"]\n")})
+	if err == nil || !strings.Contains(err.Error(), `bad.yml: service a: line 3: invalid port "http"`) {
+		t.Fatalf("expected a located port error, got %v", err)
+	}
+}
+
+func TestComposeSourceLintsClean(t *testing.T) {
+	findings, err := lint.Lint(importCompose(t, stackCompose).Source(), lint.Config{})
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	for _, finding := range findings {
+		t.Errorf("unexpected finding %s: %s", finding.Rule, finding.Message)
+	}
+}
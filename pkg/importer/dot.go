@@ -0,0 +1,512 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/components"
+	"github.com/saasuke-labs/nagare/pkg/dot"
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/props"
+)
+
+// pointsPerInch converts the inches of DOT node sizes to pixels, which DOT counts as
+// points.
+const pointsPerInch = 72.0
+
+// dotNode is a DOT node and the node it becomes.
+type dotNode struct {
+	node    *dot.Node
+	id      string
+	cluster *dotCluster // Nil outside any cluster
+	item    item
+}
+
+// dotCluster is a top-level cluster and the VM it becomes.
+type dotCluster struct {
+	sub   *dot.Subgraph
+	id    string
+	title string
+}
+
+// DOT reads the Graphviz graph in sources and returns a diagram of it. Nodes whose class
+// names a component type become that type, nodes with shape=cylinder a Database and
+// other nodes a Rectangle, each titled with its label.
+// Each top-level cluster becomes a VM holding its nodes; the nodes of nested clusters go
+// in the outermost one. Edges become connections, and an edge with lhead or ltail ends
+// at the cluster it names. When every node has a pos and the graph a bb, as in the
+// output of dot -Tdot or of the DOT render format, nodes are placed where they are drawn;
+// otherwise they are placed in rows, each above the nodes its edges point to. Anchors
+// follow compass ports, or else the side of each node facing the other.
+func DOT(sources ...Source) (Diagram, error) {
+	var graph *dot.Graph
+	var extra []string
+	for _, source := range sources {
+		src, err := io.ReadAll(source)
+		if err != nil {
+			return Diagram{}, fmt.Errorf("%s: %v", source.Name, err)
+		}
+		graphs, err := dot.Parse(string(src))
+		if err != nil {
+			return Diagram{}, fmt.Errorf("%s: %v", source.Name, err)
+		}
+		for _, g := range graphs {
+			if graph == nil {
+				graph = g
+			} else {
+				extra = append(extra, source.Name)
+			}
+		}
+	}
+	if graph == nil || len(graph.Nodes) == 0 {
+		return Diagram{}, errors.New("no nodes found")
+	}
+
+	b := newBuilder()
+	if len(extra) > 0 {
+		b.warnf("only the first graph is imported; %d more in %s skipped", len(extra), strings.Join(unique(extra), ", "))
+	}
+
+	var clusters []*dotCluster
+	inCluster := make(map[string]*dotCluster)
+	byCluster := make(map[string]*dotCluster)
+	nested := 0
+	var collect func(subs []*dot.Subgraph, top *dotCluster)
+	collect = func(subs []*dot.Subgraph, top *dotCluster) {
+		for _, sub := range subs {
+			owner := top
+			if sub.IsCluster() {
+				if top == nil {
+					owner = &dotCluster{sub: sub, id: b.id(clusterName(sub.ID), "cluster"), title: clusterTitle(sub, graph)}
+					clusters = append(clusters, owner)
+				} else {
+					nested++
+				}
+				byCluster[sub.ID] = owner
+			}
+			if owner != nil {
+				for _, id := range sub.Nodes {
+					if _, ok := inCluster[id]; !ok {
+						inCluster[id] = owner
+					}
+				}
+			}
+			collect(sub.Subgraphs, owner)
+		}
+	}
+	collect(graph.Subgraphs, nil)
+	if nested > 0 {
+		b.warnf("%d nested clusters flattened into the top-level cluster around them", nested)
+	}
+
+	nodes := make([]*dotNode, 0, len(graph.Nodes))
+	byID := make(map[string]*dotNode)
+	otherShapes := 0
+	for _, n := range graph.Nodes {
+		dn := &dotNode{node: n, id: b.id(n.ID, "node"), cluster: inCluster[n.ID]}
+		typeName := "Rectangle"
+		if c, ok := layout.LookupComponent(n.Attrs["class"]); ok && !layout.IsContainerType(c.Type) {
+			// The DOT render format writes the type of each node as its class.
+			typeName = c.Type
+		} else {
+			switch shape := strings.ToLower(n.Attrs["shape"]); shape {
+			case "cylinder":
+				typeName = "Database"
+			case "", "box", "rect", "rectangle", "square", "ellipse", "oval", "circle":
+			default:
+				otherShapes++
+			}
+		}
+		dn.item = item{
+			node:  parser.Node{Type: parser.NodeType(typeName), Text: dn.id},
+			props: []prop{text("title", nodeTitle(n, graph))},
+		}
+		if typeName == "Database" {
+			// The engine is not known; leave it blank rather than show the default.
+			dn.item.props = append(dn.item.props, blank("engine"))
+		}
+		dn.item.props = append(dn.item.props, b.dotColors(n)...)
+		nodes = append(nodes, dn)
+		byID[n.ID] = dn
+	}
+	if otherShapes > 0 {
+		b.warnf("%d nodes with shapes other than box, ellipse or cylinder drawn as rectangles", otherShapes)
+	}
+
+	type dotEdge struct {
+		from, to             string // Node ids
+		fromAnchor, toAnchor string // Compass points, if the ports name one
+	}
+	var edges []dotEdge
+	var loops, labels, colors, styles int
+	for _, e := range graph.Edges {
+		from, to := byID[e.From].id, byID[e.To].id
+		if c, ok := byCluster[e.Attrs["ltail"]]; ok {
+			from = c.id
+		}
+		if c, ok := byCluster[e.Attrs["lhead"]]; ok {
+			to = c.id
+		}
+		if from == to {
+			loops++
+			continue
+		}
+		if e.Attrs["label"] != "" || e.Attrs["xlabel"] != "" {
+			labels++
+		}
+		if e.Attrs["color"] != "" {
+			colors++
+		}
+		if style := e.Attrs["style"]; style != "" && style != "solid" {
+			styles++
+		}
+		edges = append(edges, dotEdge{from, to, compass(e.FromPort), compass(e.ToPort)})
+	}
+	if !graph.Directed && len(edges) > 0 {
+		b.warnf("the graph is undirected; its edges are drawn as arrows from the first node to the second")
+	}
+	for _, dropped := range []struct {
+		count int
+		what  string
+	}{{loops, "edges from a node to itself skipped"}, {labels, "edge labels dropped"}, {colors, "edge colours dropped"}, {styles, "edge styles dropped"}} {
+		if dropped.count > 0 {
+			b.warnf("%d %s", dropped.count, dropped.what)
+		}
+	}
+
+	if bounds, ok := graphBounds(graph); !ok || !b.placeDrawn(bounds, clusters, nodes) {
+		b.placeRanked(graph, clusters, nodes)
+	}
+
+	// Pick the anchors from where the nodes ended up.
+	d := b.diagram()
+	shapes := layout.Calculate(d.Root, 800, 400).NodeIndex
+	for _, e := range edges {
+		fromAnchor, toAnchor := facingAnchors(shapes[e.from], shapes[e.to])
+		if e.fromAnchor != "" {
+			fromAnchor = e.fromAnchor
+		}
+		if e.toAnchor != "" {
+			toAnchor = e.toAnchor
+		}
+		b.connect(e.from, fromAnchor, e.to, toAnchor)
+	}
+	return b.diagram(), nil
+}
+
+// placeRanked places nodes in rows by the longest chain of edges leading to each, inside
+// their cluster's VM or else above or below the VMs.
+func (b *builder) placeRanked(graph *dot.Graph, clusters []*dotCluster, nodes []*dotNode) {
+	rank := make(map[string]int)
+	visiting := make(map[string]bool)
+	incoming := make(map[string][]string)
+	for _, e := range graph.Edges {
+		if e.From != e.To {
+			incoming[e.To] = append(incoming[e.To], e.From)
+		}
+	}
+	var measure func(id string) int
+	measure = func(id string) int {
+		if r, ok := rank[id]; ok {
+			return r
+		}
+		if visiting[id] {
+			return 0 // Cycles are cut where they close
+		}
+		visiting[id] = true
+		r := 0
+		for _, from := range incoming[id] {
+			if below := measure(from) + 1; below > r {
+				r = below
+			}
+		}
+		visiting[id] = false
+		rank[id] = r
+		return r
+	}
+
+	// Loose nodes ranked before every clustered node go above the VMs.
+	first := math.MaxInt
+	for _, dn := range nodes {
+		if dn.cluster != nil && measure(dn.node.ID) < first {
+			first = measure(dn.node.ID)
+		}
+	}
+	var above, below [][]item
+	for _, dn := range nodes {
+		if dn.cluster != nil {
+			continue
+		}
+		if r := measure(dn.node.ID); r < first {
+			above = addToRow(above, r, dn.item)
+		} else {
+			below = addToRow(below, r-first, dn.item)
+		}
+	}
+
+	b.alignRows = true
+	var groups []group
+	for _, c := range clusters {
+		g := group{node: parser.Node{Type: "VM", Text: c.id}, props: []prop{text("title", c.title)}}
+		for _, dn := range nodes {
+			if dn.cluster == c {
+				g.rows = addToRow(g.rows, measure(dn.node.ID)-first, dn.item)
+			}
+		}
+		groups = append(groups, g)
+	}
+	b.placeGroups(above, groups, below)
+}
+
+// addToRow appends it to row r of rows, adding rows up to r.
+func addToRow(rows [][]item, r int, it item) [][]item {
+	for len(rows) <= r {
+		rows = append(rows, nil)
+	}
+	rows[r] = append(rows[r], it)
+	return rows
+}
+
+// placeDrawn places nodes and clusters at the pos and bb Graphviz gave them, in the
+// bounding box bounds of the graph. It reports false, placing nothing, if a node has no
+// pos.
+func (b *builder) placeDrawn(bounds layout.Rect, clusters []*dotCluster, nodes []*dotNode) bool {
+	rects := make(map[*dotNode]layout.Rect, len(nodes))
+	for _, dn := range nodes {
+		center, ok := parsePoint(dn.node.Attrs["pos"])
+		if !ok {
+			return false
+		}
+		w, h := dn.item.size()
+		if inches, err := strconv.ParseFloat(dn.node.Attrs["width"], 64); err == nil {
+			w = inches * pointsPerInch
+		}
+		if inches, err := strconv.ParseFloat(dn.node.Attrs["height"], 64); err == nil {
+			h = inches * pointsPerInch
+		}
+		// DOT puts the origin at the bottom left, and y grows upwards.
+		rects[dn] = layout.Rect{X: center.X - bounds.X - w/2, Y: bounds.Y + bounds.Height - center.Y - h/2, Width: w, Height: h}
+	}
+
+	for _, c := range clusters {
+		box, ok := parseBox(c.sub.Attrs["bb"])
+		if ok {
+			box = layout.Rect{X: box.X - bounds.X, Y: bounds.Y + bounds.Height - box.Y - box.Height, Width: box.Width, Height: box.Height}
+		} else {
+			box = clusterBox(c, nodes, rects)
+		}
+		vm := parser.Node{Type: "VM", Text: c.id}
+		content, _ := layout.ContentArea("VM", box)
+		for _, dn := range nodes {
+			if dn.cluster != c {
+				continue
+			}
+			r := rects[dn]
+			b.setState(dn.id, append([]prop{number("x", r.X-content.X), number("y", r.Y-content.Y), number("w", r.Width), number("h", r.Height)}, dn.item.props...)...)
+			vm.Children = append(vm.Children, dn.item.node)
+		}
+		b.setState(c.id, number("x", box.X), number("y", box.Y), number("w", box.Width), number("h", box.Height), text("title", c.title))
+		b.root.Children = append(b.root.Children, vm)
+	}
+	for _, dn := range nodes {
+		if dn.cluster != nil {
+			continue
+		}
+		r := rects[dn]
+		b.setState(dn.id, append([]prop{number("x", r.X), number("y", r.Y), number("w", r.Width), number("h", r.Height)}, dn.item.props...)...)
+		b.root.Children = append(b.root.Children, dn.item.node)
+	}
+	b.setState("layout", number("w", bounds.Width), number("h", bounds.Height))
+	return true
+}
+
+// clusterBox returns a box around the nodes of c that leaves room for the VM's title
+// bar.
+func clusterBox(c *dotCluster, nodes []*dotNode, rects map[*dotNode]layout.Rect) layout.Rect {
+	left, top, right, bottom := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, dn := range nodes {
+		if dn.cluster == c {
+			r := rects[dn]
+			left, top = math.Min(left, r.X), math.Min(top, r.Y)
+			right, bottom = math.Max(right, r.X+r.Width), math.Max(bottom, r.Y+r.Height)
+		}
+	}
+	if math.IsInf(left, 1) {
+		return layout.Rect{Width: gap, Height: gap}
+	}
+	unit, _ := layout.ContentArea("VM", layout.Rect{Width: 1, Height: 1})
+	w := (right - left + gap) / unit.Width
+	h := (bottom - top + gap) / unit.Height
+	return layout.Rect{X: left - gap/2 - unit.X*w, Y: top - gap/2 - unit.Y*h, Width: w, Height: h}
+}
+
+// dotColors maps the fill and font colours of n to bg and fg, warning about colours
+// Nagare cannot read, such as HSV triples.
+func (b *builder) dotColors(n *dot.Node) []prop {
+	var colors []prop
+	add := func(key, attr, value string) {
+		// A list such as "red:blue" fills with gradients or stripes; keep the first colour.
+		value = strings.SplitN(strings.SplitN(value, ":", 2)[0], ";", 2)[0]
+		if value == "" {
+			return
+		}
+		if _, err := props.ParseColor(value); err != nil {
+			b.warnf("node %s: %s %q is not a colour Nagare reads", n.ID, attr, value)
+			return
+		}
+		colors = append(colors, text(key, value))
+	}
+	if strings.Contains(n.Attrs["style"], "filled") {
+		fill, attr := n.Attrs["fillcolor"], "fillcolor"
+		if fill == "" {
+			fill, attr = n.Attrs["color"], "color"
+		}
+		add("bg", attr, fill)
+	}
+	add("fg", "fontcolor", n.Attrs["fontcolor"])
+	return colors
+}
+
+// facingAnchors returns the sides of from and to that face each other: top and bottom
+// when they are further apart vertically, left and right otherwise.
+func facingAnchors(from, to components.Shape) (string, string) {
+	dx := (to.X + to.Width/2) - (from.X + from.Width/2)
+	dy := (to.Y + to.Height/2) - (from.Y + from.Height/2)
+	switch {
+	case math.Abs(dy) >= math.Abs(dx) && dy >= 0:
+		return "s", "n"
+	case math.Abs(dy) >= math.Abs(dx):
+		return "n", "s"
+	case dx >= 0:
+		return "e", "w"
+	}
+	return "w", "e"
+}
+
+// compassPoints are the compass points of DOT ports that Nagare anchors draw the same.
+var compassPoints = map[string]bool{"n": true, "ne": true, "e": true, "se": true, "s": true, "sw": true, "w": true, "nw": true}
+
+// compass returns the compass point a port such as "p:ne" or "s" ends at, or "" if it
+// names none.
+func compass(port string) string {
+	point := strings.ToLower(port[strings.LastIndexByte(port, ':')+1:])
+	if compassPoints[point] {
+		return point
+	}
+	return ""
+}
+
+var (
+	tag         = regexp.MustCompile(`<[^>]*>`) // An HTML tag, or the port of a record field
+	whitespace  = regexp.MustCompile(`\s+`)
+	labelEscape = strings.NewReplacer(`\n`, " ", `\l`, " ", `\r`, " ", `\\`, `\`)
+)
+
+// nodeTitle returns the label of n as one line of text.
+func nodeTitle(n *dot.Node, graph *dot.Graph) string {
+	label, ok := n.Attrs["label"]
+	if !ok {
+		return n.ID
+	}
+	switch shape := strings.ToLower(n.Attrs["shape"]); {
+	case isHTMLLabel(label):
+	case shape == "record" || shape == "mrecord":
+		// {a|<p> b} draws fields a and b.
+		label = tag.ReplaceAllString(label, "")
+		label = strings.NewReplacer("{", " ", "}", " ", "|", " ").Replace(label)
+	}
+	return labelText(label, n.ID, graph)
+}
+
+// clusterTitle returns the label of a cluster, or its name without the cluster prefix.
+func clusterTitle(sub *dot.Subgraph, graph *dot.Graph) string {
+	if label := sub.Attrs["label"]; label != "" {
+		return labelText(label, sub.ID, graph)
+	}
+	return clusterName(sub.ID)
+}
+
+// clusterName returns the name of a cluster without the cluster prefix.
+func clusterName(id string) string {
+	name := strings.TrimLeft(strings.TrimPrefix(id, "cluster"), "_")
+	if name == "" {
+		return id
+	}
+	return name
+}
+
+// labelText resolves the escapes of a DOT label, \N for the object's name and \G for
+// the graph's, and strips the tags of an HTML label.
+func labelText(label, name string, graph *dot.Graph) string {
+	if isHTMLLabel(label) {
+		label = tag.ReplaceAllString(label[1:len(label)-1], " ")
+		label = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&amp;", "&").Replace(label)
+	} else {
+		label = strings.NewReplacer(`\N`, name, `\G`, graph.ID).Replace(label)
+		label = labelEscape.Replace(label)
+	}
+	return strings.TrimSpace(whitespace.ReplaceAllString(label, " "))
+}
+
+func isHTMLLabel(label string) bool {
+	return strings.HasPrefix(label, "<") && strings.HasSuffix(label, ">")
+}
+
+// graphBounds returns the bb of graph, which Graphviz sets on the graphs it lays out.
+func graphBounds(graph *dot.Graph) (layout.Rect, bool) {
+	box, ok := parseBox(graph.Attrs["bb"])
+	return box, ok && box.Width > 0 && box.Height > 0
+}
+
+// parsePoint reads a pos of "x,y", ignoring the ! that pins a node.
+func parsePoint(s string) (layout.Point, bool) {
+	values, ok := parseNumbers(strings.TrimSuffix(s, "!"), 2)
+	if !ok {
+		return layout.Point{}, false
+	}
+	return layout.Point{X: values[0], Y: values[1]}, true
+}
+
+// parseBox reads a bb of "llx,lly,urx,ury" as the rectangle from its lower left corner.
+func parseBox(s string) (layout.Rect, bool) {
+	values, ok := parseNumbers(s, 4)
+	if !ok {
+		return layout.Rect{}, false
+	}
+	return layout.Rect{X: values[0], Y: values[1], Width: values[2] - values[0], Height: values[3] - values[1]}, true
+}
+
+func parseNumbers(s string, n int) ([]float64, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, false
+	}
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, false
+		}
+		values[i] = v
+	}
+	return values, true
+}
+
+// unique returns list without repeats, in order.
+func unique(list []string) []string {
+	seen := make(map[string]bool)
+	var kept []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,162 @@
+package importer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/lint"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/props"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+const shopDOT = `digraph shop {
+    node [shape=box];
+    web [label="Web\nshop", style=filled, fillcolor="#1e3a8a", fontcolor=white];
+    subgraph cluster_backend {
+        label = "Backend";
+        api; worker [label=<<b>Worker</b>>];
+        db [shape=cylinder, label="\N"];
+        subgraph cluster_inner { cache [shape=cylinder, color="0.5 0.5 0.5", style=filled] }
+    }
+    web -> api [label="https"];
+    api -> db; api -> cache:w; worker -> db [style=dashed];
+    web -> worker [lhead=cluster_backend];
+    api -> api;
+}
+`
+
+func importDOT(t *testing.T, src string) Diagram {
+	t.Helper()
+	d, err := DOT(Source{Name: "shop.gv", Reader: strings.NewReader(src)})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return d
+}
+
+func TestDOTClustersBecomeContainers(t *testing.T) {
+	d := importDOT(t, shopDOT)
+
+	var got []string
+	for _, node := range d.Root.Children {
+		entry := node.Text + ":" + string(node.Type)
+		for _, child := range node.Children {
+			entry += " " + child.Text + ":" + string(child.Type)
+		}
+		got = append(got, entry)
+	}
+	want := []string{"web:Rectangle", "backend:VM api:Rectangle worker:Rectangle db:Database cache:Database"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	source := d.Source()
+	for _, state := range []string{
+		`@web(x: 40, y: 40, title: "Web shop", bg: "#1e3a8a", fg: "white")`,
+		`@backend(x: 40, y: 220,`,
+		`title: "Backend")`,
+		`@worker(x: 260, y: 20, title: "Worker")`,
+		`@db(x: 20, y: 200, title: "db", engine: "")`,
+	} {
+		if !strings.Contains(source, state) {
+			t.Errorf("expected %s in:\n%s", state, source)
+		}
+	}
+}
+
+func TestDOTConnections(t *testing.T) {
+	d := importDOT(t, shopDOT)
+
+	var got []string
+	for _, conn := range d.Root.Connections {
+		got = append(got, conn.FromID+"."+conn.FromAnchor.Raw+" --> "+conn.ToID+"."+conn.ToAnchor.Raw)
+	}
+	want := "web.s --> api.n, api.s --> db.n, api.e --> cache.w, worker.w --> db.e, web.s --> backend.n"
+	if strings.Join(got, ", ") != want {
+		t.Fatalf("expected %s, got %s", want, strings.Join(got, ", "))
+	}
+}
+
+func TestDOTWarnings(t *testing.T) {
+	d := importDOT(t, shopDOT)
+	want := []string{
+		"1 nested clusters flattened into the top-level cluster around them",
+		`node cache: color "0.5 0.5 0.5" is not a colour Nagare reads`,
+		"1 edges from a node to itself skipped",
+		"1 edge labels dropped",
+		"1 edge styles dropped",
+	}
+	if !reflect.DeepEqual(d.Warnings, want) {
+		t.Fatalf("expected warnings %q, got %q", want, d.Warnings)
+	}
+
+	d = importDOT(t, "graph { a -- b }\ngraph { c }")
+	if len(d.Warnings) != 2 || !strings.Contains(d.Warnings[0], "only the first graph") || !strings.Contains(d.Warnings[1], "undirected") {
+		t.Fatalf("expected warnings for the second graph and undirected edges, got %q", d.Warnings)
+	}
+}
+
+func TestDOTUsesDrawnPositions(t *testing.T) {
+	d := importDOT(t, `digraph {
+    graph [bb="0,0,400,300"];
+    subgraph cluster_vm {
+        graph [bb="20,20,380,200"];
+        b [class=Server, pos="200,100!", width=2, height=1];
+    }
+    a [pos="100,250", width=1, height=0.5];
+    a -> b;
+}`)
+	source := d.Source()
+	for _, state := range []string{"@layout(w: 400, h: 300)", "@vm(x: 20, y: 100, w: 360, h: 180, title: \"vm\")", "@a(x: 64, y: 32, w: 72, h: 36, title: \"a\")"} {
+		if !strings.Contains(source, state) {
+			t.Errorf("expected %s in:\n%s", state, source)
+		}
+	}
+	if d.Root.Children[0].Children[0].Type != "Server" {
+		t.Errorf("expected the class to set the type, got %s", d.Root.Children[0].Children[0].Type)
+	}
+}
+
+func TestDOTQuotedLabelsReadBack(t *testing.T) {
+	d := importDOT(t, `digraph { web [label="Web \"app\""]; ops [label="it's"]; both [label="it's \"both\""] }`)
+	root, err := parser.Parse(tokenizer.Tokenize(d.Source()))
+	if err != nil {
+		t.Fatalf("parse:\n%s\n%v", d.Source(), err)
+	}
+
+	var titles []string
+	for _, e := range layout.Calculate(root, 800, 400).Elements() {
+		title, _ := props.Lookup(e.Props, "title")
+		titles = append(titles, fmt.Sprint(title))
+	}
+	if want := []string{`Web "app"`, "it's", "it's 'both'"}; !reflect.DeepEqual(titles, want) {
+		t.Fatalf("expected titles %q, got %q from:\n%s", want, titles, d.Source())
+	}
+	if want := []string{"both title: double quotes replaced with single ones, as a value cannot hold both"}; !reflect.DeepEqual(d.Warnings, want) {
+		t.Fatalf("expected warnings %q, got %q", want, d.Warnings)
+	}
+}
+
+func TestDOTErrors(t *testing.T) {
+	if _, err := DOT(Source{Name: "empty.gv", Reader: strings.NewReader("digraph {}")}); err == nil {
+		t.Fatal("expected an error for a graph without nodes")
+	}
+	_, err := DOT(Source{Name: "bad.gv", Reader: strings.NewReader("digraph { a -> }")})
+	if err == nil || !strings.HasPrefix(err.Error(), "bad.gv: 1:16:") {
+		t.Fatalf("expected a located syntax error, got %v", err)
+	}
+}
+
+func TestDOTSourceLintsClean(t *testing.T) {
+	findings, err := lint.Lint(importDOT(t, shopDOT).Source(), lint.Config{})
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	for _, finding := range findings {
+		t.Errorf("unexpected finding %s: %s", finding.Rule, finding.Message)
+	}
+}
@@ -0,0 +1,340 @@
+// Package importer builds Nagare diagrams from other descriptions of a system, such as
+// Kubernetes manifests. Each importer returns an AST with every node placed, so the
+// result renders as it is and prints as editable source.
+package importer
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+)
+
+// Spacing of the generated layout.
+const (
+	gap    = 40.0 // Between nodes, and between containers
+	margin = 40.0 // Around the canvas
+)
+
+// Source is one input file.
+type Source struct {
+	Name string // Used in errors and warnings
+	io.Reader
+}
+
+// Diagram is an imported diagram.
+type Diagram struct {
+	Root     parser.Node
+	Warnings []string // What the importer skipped or could not resolve
+}
+
+// Source returns the diagram as .nagare source.
+func (d Diagram) Source() string {
+	return parser.PrintNode(d.Root)
+}
+
+// builder assembles the AST of an imported diagram.
+type builder struct {
+	root     parser.Node
+	ids      map[string]bool
+	warnings []string
+	// alignRows gives each row the same top in every group, so that rows of groups
+	// side by side line up.
+	alignRows bool
+}
+
+func newBuilder() *builder {
+	return &builder{
+		root: parser.Node{Type: parser.NODE_ELEMENT, Globals: make(map[string]parser.State)},
+		ids:  make(map[string]bool),
+	}
+}
+
+func (b *builder) warnf(format string, args ...interface{}) {
+	b.warnings = append(b.warnings, fmt.Sprintf(format, args...))
+}
+
+// id returns an unused node id for name. Characters ids cannot hold become _, and a
+// name that is taken gets the first free suffix, trying suffixes in order and then
+// numbers.
+func (b *builder) id(name string, suffixes ...string) string {
+	base := identifier(name)
+	candidates := []string{base}
+	for _, suffix := range suffixes {
+		candidates = append(candidates, base+"_"+identifier(suffix))
+	}
+	for _, candidate := range candidates {
+		if !b.ids[candidate] {
+			b.ids[candidate] = true
+			return candidate
+		}
+	}
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s_%d", base, n)
+		if !b.ids[candidate] {
+			b.ids[candidate] = true
+			return candidate
+		}
+	}
+}
+
+// connect adds a connection from.fromAnchor --> to.toAnchor.
+func (b *builder) connect(from, fromAnchor, to, toAnchor string) {
+	for _, conn := range b.root.Connections {
+		if conn.FromID == from && conn.ToID == to {
+			return
+		}
+	}
+	b.root.Connections = append(b.root.Connections, parser.Connection{
+		FromID:     from,
+		FromAnchor: parser.AnchorDescriptor{Raw: fromAnchor},
+		ToID:       to,
+		ToAnchor:   parser.AnchorDescriptor{Raw: toAnchor},
+	})
+}
+
+// diagram returns the AST, with each node's id state attached to it as the parser would.
+func (b *builder) diagram() Diagram {
+	var attach func(nodes []parser.Node)
+	attach = func(nodes []parser.Node) {
+		for i := range nodes {
+			if state, ok := b.root.Globals[nodes[i].Text]; ok {
+				nodes[i].States = map[string]parser.State{state.Name: state}
+			}
+			attach(nodes[i].Children)
+		}
+	}
+	attach(b.root.Children)
+	return Diagram{Root: b.root, Warnings: b.warnings}
+}
+
+// prop is one key: value of a generated state.
+type prop struct {
+	key   string
+	value string
+	// altered is set when the value held both quote characters, and its double quotes
+	// were replaced.
+	altered bool
+}
+
+// text quotes value. An empty value is left out of the state, so the prop keeps its
+// default; blank sets a prop to the empty string instead.
+func text(key, value string) prop {
+	if value == "" {
+		return prop{key: key}
+	}
+	quoted, altered := quote(value)
+	return prop{key: key, value: quoted, altered: altered}
+}
+
+func blank(key string) prop {
+	return prop{key: key, value: `""`}
+}
+
+// quote quotes s as the DSL reads strings: between double quotes, or single quotes
+// when s holds a double quote. There are no escapes, so a string holding both loses
+// its double quotes to single ones, and quote reports it was altered.
+func quote(s string) (string, bool) {
+	switch {
+	case !strings.Contains(s, `"`):
+		return `"` + s + `"`, false
+	case !strings.Contains(s, "'"):
+		return "'" + s + "'", false
+	}
+	return `"` + strings.ReplaceAll(s, `"`, "'") + `"`, true
+}
+
+// number rounds v to whole pixels.
+func number(key string, v float64) prop {
+	return prop{key: key, value: strconv.FormatFloat(math.Round(v), 'f', -1, 64)}
+}
+
+func integer(key string, v int) prop {
+	return prop{key: key, value: strconv.Itoa(v)}
+}
+
+func list(key string, values []string) prop {
+	p := prop{key: key}
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		var altered bool
+		quoted[i], altered = quote(v)
+		p.altered = p.altered || altered
+	}
+	p.value = "[" + strings.Join(quoted, ", ") + "]"
+	return p
+}
+
+// setState defines the state name with props, leaving out those without a value.
+func (b *builder) setState(name string, props ...prop) {
+	var pairs []string
+	for _, p := range props {
+		if p.value == "" {
+			continue
+		}
+		if p.altered {
+			b.warnf("%s %s: double quotes replaced with single ones, as a value cannot hold both", name, p.key)
+		}
+		pairs = append(pairs, p.key+":"+p.value)
+	}
+	b.root.Globals[name] = parser.State{Name: name, PropsDef: strings.Join(pairs, ",")}
+}
+
+// item is a node waiting to be placed, with the props of its id state. Items are drawn
+// at the default size of their type unless width and height are set.
+type item struct {
+	node          parser.Node
+	props         []prop
+	width, height float64
+}
+
+// size returns the size the item is drawn at.
+func (it item) size() (w, h float64) {
+	if it.width > 0 && it.height > 0 {
+		return it.width, it.height
+	}
+	c, ok := layout.LookupComponent(string(it.node.Type))
+	if !ok {
+		c, _ = layout.LookupComponent("Rectangle")
+	}
+	return c.Width, c.Height
+}
+
+// placeRows lays rows out top to bottom, each left to right starting at x, y, and
+// defines the id state of each item with its position. Row i is at least heights[i]
+// tall, if given. It returns the size the rows take.
+func (b *builder) placeRows(rows [][]item, x, y float64, heights []float64) (width, height float64) {
+	top := y
+	for i, row := range rows {
+		tallest := 0.0
+		if i < len(heights) {
+			tallest = heights[i]
+		}
+		if len(row) == 0 && tallest == 0 {
+			continue
+		}
+		left := x
+		for _, it := range row {
+			w, h := it.size()
+			position := []prop{number("x", left), number("y", top)}
+			if it.width > 0 && it.height > 0 {
+				position = append(position, number("w", w), number("h", h))
+			}
+			b.setState(it.node.Text, append(position, it.props...)...)
+			left += w + gap
+			tallest = math.Max(tallest, h)
+		}
+		width = math.Max(width, left-gap-x)
+		top += tallest + gap
+	}
+	if top > y {
+		height = top - gap - y
+	}
+	return width, height
+}
+
+// group is a container and the rows of nodes drawn inside it.
+type group struct {
+	node  parser.Node
+	props []prop
+	rows  [][]item
+}
+
+// placeGroups places each group's rows inside it, sizes the group to fit and lays the
+// groups out left to right, then sets the canvas size. Nodes outside any group go in
+// loose rows, those in above over the groups and those in below under them.
+func (b *builder) placeGroups(above [][]item, groups []group, below [][]item) {
+	var heights []float64
+	if b.alignRows {
+		for _, g := range groups {
+			for i, row := range g.rows {
+				for len(heights) <= i {
+					heights = append(heights, 0)
+				}
+				for _, it := range row {
+					_, h := it.size()
+					heights[i] = math.Max(heights[i], h)
+				}
+			}
+		}
+	}
+
+	aboveW, aboveH := b.placeRows(above, margin, margin, nil)
+	b.addRows(above)
+	top := margin
+	if aboveH > 0 {
+		top += aboveH + gap
+	}
+
+	x, bottom := margin, top
+	for _, g := range groups {
+		contentW, contentH := b.placeRows(g.rows, gap/2, gap/2, heights)
+		// The content area of a unit container is the fraction of its size it takes.
+		unit, _ := layout.ContentArea(string(g.node.Type), layout.Rect{Width: 1, Height: 1})
+		w := (contentW + gap) / unit.Width
+		h := (contentH + gap) / unit.Height
+		b.setState(g.node.Text, append([]prop{number("x", x), number("y", top), number("w", w), number("h", h)}, g.props...)...)
+		for _, row := range g.rows {
+			for _, it := range row {
+				g.node.Children = append(g.node.Children, it.node)
+			}
+		}
+		b.root.Children = append(b.root.Children, g.node)
+		x += w + gap
+		bottom = math.Max(bottom, top+h+gap)
+	}
+
+	belowW, belowH := b.placeRows(below, margin, bottom, nil)
+	b.addRows(below)
+	width := math.Max(x-gap, margin+math.Max(aboveW, belowW)) + margin
+	height := bottom + belowH + margin
+	if belowH == 0 {
+		height = bottom - gap + margin
+	}
+	b.setState("layout", number("w", width), number("h", height))
+}
+
+// addRows adds the nodes of rows at the top level.
+func (b *builder) addRows(rows [][]item) {
+	for _, row := range rows {
+		for _, it := range row {
+			b.root.Children = append(b.root.Children, it.node)
+		}
+	}
+}
+
+// identifier turns name into a node id.
+func identifier(name string) string {
+	var id strings.Builder
+	for _, r := range name {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			id.WriteRune(r)
+		} else {
+			id.WriteByte('_')
+		}
+	}
+	if id.Len() == 0 {
+		return "node"
+	}
+	if s := id.String(); s[0] >= '0' && s[0] <= '9' {
+		return "n" + s
+	}
+	return id.String()
+}
+
+// isAnchorName reports whether name can be written as a connection anchor.
+func isAnchorName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,434 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/saasuke-labs/nagare/pkg/parser"
+)
+
+// defaultNamespace holds resources whose manifest names no namespace.
+const defaultNamespace = "default"
+
+// k8sObject is the part of a Kubernetes manifest the importer reads.
+type k8sObject struct {
+	Kind     string      `yaml:"kind"`
+	Metadata k8sMeta     `yaml:"metadata"`
+	Spec     k8sSpec     `yaml:"spec"`
+	Items    []k8sObject `yaml:"items"` // Of a List
+}
+
+type k8sMeta struct {
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace"`
+	Labels    map[string]string `yaml:"labels"`
+}
+
+type k8sSpec struct {
+	// Deployments and StatefulSets
+	Replicas *int `yaml:"replicas"`
+	Template struct {
+		Metadata k8sMeta    `yaml:"metadata"`
+		Spec     k8sPodSpec `yaml:"spec"`
+	} `yaml:"template"`
+	VolumeClaimTemplates []struct {
+		Metadata k8sMeta      `yaml:"metadata"`
+		Spec     k8sClaimSpec `yaml:"spec"`
+	} `yaml:"volumeClaimTemplates"`
+
+	// Pods
+	k8sPodSpec `yaml:",inline"`
+
+	// Services. Workloads have a selector too, with matchLabels, so it is read loosely.
+	Type     string                 `yaml:"type"`
+	Selector map[string]interface{} `yaml:"selector"`
+	Ports    []struct {
+		Port int `yaml:"port"`
+	} `yaml:"ports"`
+
+	// Ingresses
+	Rules []struct {
+		Host string `yaml:"host"`
+		HTTP struct {
+			Paths []struct {
+				Path    string     `yaml:"path"`
+				Backend k8sBackend `yaml:"backend"`
+			} `yaml:"paths"`
+		} `yaml:"http"`
+	} `yaml:"rules"`
+	DefaultBackend *k8sBackend `yaml:"defaultBackend"`
+	Backend        *k8sBackend `yaml:"backend"` // extensions/v1beta1
+
+	// PersistentVolumeClaims
+	k8sClaimSpec `yaml:",inline"`
+}
+
+type k8sPodSpec struct {
+	Containers []k8sContainer `yaml:"containers"`
+	Volumes    []struct {
+		ConfigMap struct {
+			Name string `yaml:"name"`
+		} `yaml:"configMap"`
+		Secret struct {
+			SecretName string `yaml:"secretName"`
+		} `yaml:"secret"`
+		PersistentVolumeClaim struct {
+			ClaimName string `yaml:"claimName"`
+		} `yaml:"persistentVolumeClaim"`
+	} `yaml:"volumes"`
+}
+
+type k8sContainer struct {
+	Image string `yaml:"image"`
+	Env   []struct {
+		ValueFrom struct {
+			ConfigMapKeyRef k8sRef `yaml:"configMapKeyRef"`
+			SecretKeyRef    k8sRef `yaml:"secretKeyRef"`
+		} `yaml:"valueFrom"`
+	} `yaml:"env"`
+	EnvFrom []struct {
+		ConfigMapRef k8sRef `yaml:"configMapRef"`
+		SecretRef    k8sRef `yaml:"secretRef"`
+	} `yaml:"envFrom"`
+}
+
+type k8sRef struct {
+	Name string `yaml:"name"`
+}
+
+type k8sClaimSpec struct {
+	StorageClassName string `yaml:"storageClassName"`
+	Resources        struct {
+		Requests map[string]string `yaml:"requests"`
+	} `yaml:"resources"`
+}
+
+type k8sBackend struct {
+	Service struct {
+		Name string `yaml:"name"`
+	} `yaml:"service"`
+	ServiceName string `yaml:"serviceName"` // extensions/v1beta1
+}
+
+func (b k8sBackend) service() string {
+	if b.Service.Name != "" {
+		return b.Service.Name
+	}
+	return b.ServiceName
+}
+
+// Rows of a namespace, top to bottom.
+const (
+	rowIngress = iota
+	rowService
+	rowWorkload
+	rowConfig
+	rowCount
+)
+
+// k8sResource is a manifest object and the node it becomes.
+type k8sResource struct {
+	object k8sObject
+	kind   string // Kind of the object; StatefulSets are drawn as Deployments
+	id     string
+	row    int
+	item   item
+}
+
+// Kubernetes reads the Kubernetes manifests in sources, each of which may hold several
+// YAML documents, and returns a diagram of their Deployments, StatefulSets, Pods,
+// Services, Ingresses, ConfigMaps, Secrets and PersistentVolumeClaims. Each namespace
+// becomes a Namespace container with ingresses at the top, then services, workloads and
+// finally configuration and storage. Connections run from each ingress to its backend
+// services, from each service to the workloads its selector matches, and from each
+// workload to the config maps, secrets and claims its containers use. A Namespace object
+// draws its container even when nothing else is in it. Other kinds are skipped with a
+// warning.
+func Kubernetes(sources ...Source) (Diagram, error) {
+	var objects []k8sObject
+	for _, source := range sources {
+		decoder := yaml.NewDecoder(source)
+		for doc := 1; ; doc++ {
+			var object k8sObject
+			err := decoder.Decode(&object)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return Diagram{}, fmt.Errorf("%s: document %d: %v", source.Name, doc, err)
+			}
+			if object.Kind == "List" {
+				objects = append(objects, object.Items...)
+			} else if object.Kind != "" {
+				objects = append(objects, object)
+			}
+		}
+	}
+
+	b := newBuilder()
+	var namespaces []string
+	nsIDs := make(map[string]string)
+	byNamespace := make(map[string][]*k8sResource)
+	addNamespace := func(ns string) {
+		if _, ok := nsIDs[ns]; !ok {
+			namespaces = append(namespaces, ns)
+			nsIDs[ns] = b.id(ns, "ns")
+		}
+	}
+	for _, object := range objects {
+		if object.Kind == "Namespace" {
+			addNamespace(object.Metadata.Name)
+			continue
+		}
+
+		res := &k8sResource{object: object, kind: object.Kind}
+		var typeName string
+		var props []prop
+		switch object.Kind {
+		case "Deployment", "StatefulSet":
+			typeName, res.row = "Deployment", rowWorkload
+			props = []prop{integer("replicas", replicas(object.Spec.Replicas)), text("image", firstImage(object.Spec.Template.Spec))}
+		case "Pod":
+			typeName, res.row = "Pod", rowWorkload
+			props = []prop{text("image", firstImage(object.Spec.k8sPodSpec))}
+		case "Service":
+			typeName, res.row = "Service", rowService
+			props = []prop{text("kind", object.Spec.Type), list("selector", selectorPairs(object.Spec.Selector))}
+			if len(object.Spec.Ports) > 0 {
+				props = append(props, integer("port", object.Spec.Ports[0].Port))
+			}
+		case "Ingress":
+			typeName, res.row = "Ingress", rowIngress
+			if len(object.Spec.Rules) > 0 {
+				props = []prop{text("host", object.Spec.Rules[0].Host)}
+			}
+		case "ConfigMap":
+			typeName, res.row = "ConfigMap", rowConfig
+		case "Secret":
+			typeName, res.row = "Secret", rowConfig
+		case "PersistentVolumeClaim":
+			typeName, res.row = "PersistentVolume", rowConfig
+			props = []prop{text("capacity", object.Spec.Resources.Requests["storage"]), text("storageClass", object.Spec.StorageClassName)}
+		default:
+			b.warnf("%s %s skipped: the importer does not draw %s", object.Kind, object.Metadata.Name, object.Kind)
+			continue
+		}
+
+		ns := namespaceOf(object)
+		addNamespace(ns)
+		res.id = b.id(object.Metadata.Name, strings.ToLower(object.Kind), ns)
+		title := object.Metadata.Name
+		if object.Kind == "StatefulSet" {
+			title += " (StatefulSet)"
+		}
+		res.item = item{
+			node:  parser.Node{Type: parser.NodeType(typeName), Text: res.id},
+			props: append([]prop{text("title", title), text("namespace", ns)}, props...),
+		}
+		byNamespace[ns] = append(byNamespace[ns], res)
+
+		// StatefulSets claim their volumes from templates.
+		for _, claim := range object.Spec.VolumeClaimTemplates {
+			volume := &k8sResource{
+				object: k8sObject{Kind: "PersistentVolumeClaim", Metadata: claim.Metadata},
+				kind:   "PersistentVolumeClaim",
+				id:     b.id(claim.Metadata.Name, "pvc", ns),
+				row:    rowConfig,
+			}
+			volume.object.Metadata.Namespace = ns
+			volume.item = item{
+				node: parser.Node{Type: "PersistentVolume", Text: volume.id},
+				props: []prop{text("title", claim.Metadata.Name), text("namespace", ns),
+					text("capacity", claim.Spec.Resources.Requests["storage"]), text("storageClass", claim.Spec.StorageClassName)},
+			}
+			byNamespace[ns] = append(byNamespace[ns], volume)
+			b.connect(res.id, "s", volume.id, "n")
+		}
+	}
+
+	var groups []group
+	for _, ns := range namespaces {
+		resources := byNamespace[ns]
+		connectKubernetes(b, ns, resources)
+
+		rows := make([][]item, rowCount)
+		for _, res := range resources {
+			rows[res.row] = append(rows[res.row], res.item)
+		}
+		groups = append(groups, group{
+			node:  parser.Node{Type: "Namespace", Text: nsIDs[ns]},
+			props: []prop{text("title", ns)},
+			rows:  rows,
+		})
+	}
+	b.placeGroups(nil, groups, nil)
+	return b.diagram(), nil
+}
+
+// connectKubernetes connects the resources of one namespace.
+func connectKubernetes(b *builder, ns string, resources []*k8sResource) {
+	find := func(kind, name string) *k8sResource {
+		for _, res := range resources {
+			if res.kind == kind && res.object.Metadata.Name == name {
+				return res
+			}
+		}
+		return nil
+	}
+
+	for _, res := range resources {
+		switch res.kind {
+		case "Ingress":
+			var backends []string
+			if res.object.Spec.DefaultBackend != nil {
+				backends = append(backends, res.object.Spec.DefaultBackend.service())
+			}
+			if res.object.Spec.Backend != nil {
+				backends = append(backends, res.object.Spec.Backend.service())
+			}
+			for _, rule := range res.object.Spec.Rules {
+				for _, path := range rule.HTTP.Paths {
+					backends = append(backends, path.Backend.service())
+				}
+			}
+			for _, name := range backends {
+				if name == "" {
+					continue
+				}
+				if svc := find("Service", name); svc != nil {
+					b.connect(res.id, "s", svc.id, "n")
+				} else {
+					b.warnf("ingress %s/%s routes to service %s, which is not in the manifests", ns, res.object.Metadata.Name, name)
+				}
+			}
+
+		case "Service":
+			pairs := selectorPairs(res.object.Spec.Selector)
+			if len(pairs) == 0 {
+				continue
+			}
+			anchor := "s"
+			if name := selectorValue(pairs[0]); isAnchorName(name) {
+				anchor = name // The selector anchor the Service component draws
+			}
+			for _, workload := range resources {
+				if workload.row == rowWorkload && matches(res.object.Spec.Selector, workload.labels()) {
+					b.connect(res.id, anchor, workload.id, "n")
+				}
+			}
+
+		case "Deployment", "StatefulSet", "Pod":
+			for _, ref := range res.references() {
+				if target := find(ref.kind, ref.name); target != nil {
+					b.connect(res.id, "s", target.id, "n")
+				} else {
+					b.warnf("%s %s/%s uses %s %s, which is not in the manifests", strings.ToLower(res.kind), ns, res.object.Metadata.Name, ref.kind, ref.name)
+				}
+			}
+		}
+	}
+}
+
+// labels returns the labels of the pods a workload runs.
+func (r *k8sResource) labels() map[string]string {
+	if r.kind == "Pod" {
+		return r.object.Metadata.Labels
+	}
+	return r.object.Spec.Template.Metadata.Labels
+}
+
+type k8sReference struct {
+	kind string
+	name string
+}
+
+// references returns the config maps, secrets and claims the pods of a workload use, in
+// the order they are written, each once.
+func (r *k8sResource) references() []k8sReference {
+	spec := r.object.Spec.Template.Spec
+	if r.kind == "Pod" {
+		spec = r.object.Spec.k8sPodSpec
+	}
+
+	var refs []k8sReference
+	seen := make(map[k8sReference]bool)
+	add := func(kind, name string) {
+		ref := k8sReference{kind, name}
+		if name != "" && !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	for _, c := range spec.Containers {
+		for _, env := range c.Env {
+			add("ConfigMap", env.ValueFrom.ConfigMapKeyRef.Name)
+			add("Secret", env.ValueFrom.SecretKeyRef.Name)
+		}
+		for _, env := range c.EnvFrom {
+			add("ConfigMap", env.ConfigMapRef.Name)
+			add("Secret", env.SecretRef.Name)
+		}
+	}
+	for _, v := range spec.Volumes {
+		add("ConfigMap", v.ConfigMap.Name)
+		add("Secret", v.Secret.SecretName)
+		add("PersistentVolumeClaim", v.PersistentVolumeClaim.ClaimName)
+	}
+	return refs
+}
+
+func namespaceOf(object k8sObject) string {
+	if object.Metadata.Namespace == "" {
+		return defaultNamespace
+	}
+	return object.Metadata.Namespace
+}
+
+func replicas(n *int) int {
+	if n == nil {
+		return 1 // The Kubernetes default
+	}
+	return *n
+}
+
+func firstImage(spec k8sPodSpec) string {
+	if len(spec.Containers) == 0 {
+		return ""
+	}
+	return spec.Containers[0].Image
+}
+
+// selectorPairs returns a Service selector as key=value pairs, sorted.
+func selectorPairs(selector map[string]interface{}) []string {
+	var pairs []string
+	for key, value := range selector {
+		if s, ok := value.(string); ok {
+			pairs = append(pairs, key+"="+s)
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func selectorValue(pair string) string {
+	return pair[strings.IndexByte(pair, '=')+1:]
+}
+
+// matches reports whether a Service selector selects pods with labels.
+func matches(selector map[string]interface{}, labels map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	for key, value := range selector {
+		s, ok := value.(string)
+		if !ok || labels[key] != s {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/saasuke-labs/nagare/pkg/lint"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+const shopManifests = `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: shop
+  namespace: shop
+spec:
+  rules:
+    - host: shop.example.com
+      http:
+        paths:
+          - path: /
+            backend:
+              service:
+                name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: shop
+spec:
+  selector:
+    app: web
+  ports:
+    - port: 80
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+spec:
+  replicas: 3
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: shop/web:1.4
+          envFrom:
+            - configMapRef:
+                name: web-config
+          env:
+            - name: DB_PASSWORD
+              valueFrom:
+                secretKeyRef:
+                  name: db-credentials
+                  key: password
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+  namespace: shop
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db-credentials
+  namespace: shop
+`
+
+const dataManifests = `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+  namespace: data
+spec:
+  template:
+    metadata:
+      labels:
+        app: db
+    spec:
+      containers:
+        - name: postgres
+          image: postgres:16
+  volumeClaimTemplates:
+    - metadata:
+        name: data
+      spec:
+        resources:
+          requests:
+            storage: 20Gi
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: db
+  namespace: data
+spec:
+  selector:
+    app: db
+  ports:
+    - port: 5432
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+  namespace: shop
+`
+
+func importShop(t *testing.T) Diagram {
+	t.Helper()
+	d, err := Kubernetes(
+		Source{Name: "shop.yaml", Reader: strings.NewReader(shopManifests)},
+		Source{Name: "data.yaml", Reader: strings.NewReader(dataManifests)},
+	)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return d
+}
+
+func TestKubernetesNamespacesBecomeContainers(t *testing.T) {
+	d := importShop(t)
+
+	children := make(map[string][]string)
+	for _, ns := range d.Root.Children {
+		if ns.Type != "Namespace" {
+			t.Fatalf("expected only namespaces at the top level, got %s:%s", ns.Text, ns.Type)
+		}
+		for _, child := range ns.Children {
+			children[ns.Text] = append(children[ns.Text], child.Text+":"+string(child.Type))
+		}
+	}
+
+	expected := map[string]string{
+		"shop": "shop_ingress:Ingress web:Service web_deployment:Deployment web_config:ConfigMap db_credentials:Secret",
+		"data": "db_service:Service db:Deployment data_pvc:PersistentVolume",
+	}
+	for ns, want := range expected {
+		if got := strings.Join(children[ns], " "); got != want {
+			t.Errorf("namespace %s: expected %s, got %s", ns, want, got)
+		}
+	}
+}
+
+func TestKubernetesConnections(t *testing.T) {
+	d := importShop(t)
+
+	var got []string
+	for _, conn := range d.Root.Connections {
+		got = append(got, conn.FromID+"."+conn.FromAnchor.Raw+" --> "+conn.ToID+"."+conn.ToAnchor.Raw)
+	}
+	for _, want := range []string{
+		"shop_ingress.s --> web.n",
+		"web.web --> web_deployment.n",
+		"web_deployment.s --> web_config.n",
+		"web_deployment.s --> db_credentials.n",
+		"db_service.db --> db.n",
+		"db.s --> data_pvc.n",
+	} {
+		if !strings.Contains(strings.Join(got, "\n"), want) {
+			t.Errorf("expected connection %s, got %v", want, got)
+		}
+	}
+}
+
+func TestKubernetesWarnings(t *testing.T) {
+	d := importShop(t)
+	if len(d.Warnings) != 1 || !strings.Contains(d.Warnings[0], "HorizontalPodAutoscaler web skipped") {
+		t.Fatalf("expected a warning for the autoscaler, got %v", d.Warnings)
+	}
+
+	d, err := Kubernetes(Source{Name: "svc.yaml", Reader: strings.NewReader(`kind: Ingress
+metadata:
+  name: edge
+spec:
+  defaultBackend:
+    service:
+      name: missing
+`)})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(d.Warnings) != 1 || !strings.Contains(d.Warnings[0], "missing") {
+		t.Fatalf("expected a warning for the missing backend, got %v", d.Warnings)
+	}
+}
+
+func TestKubernetesNamespaceObjects(t *testing.T) {
+	d, err := Kubernetes(Source{Name: "ns.yaml", Reader: strings.NewReader(`kind: Namespace
+metadata:
+  name: shop
+---
+kind: Namespace
+metadata:
+  name: empty
+---
+kind: Service
+metadata:
+  name: web
+  namespace: shop
+`)})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(d.Warnings) != 0 {
+		t.Fatalf("expected no warnings for namespace objects, got %v", d.Warnings)
+	}
+
+	var got []string
+	for _, ns := range d.Root.Children {
+		got = append(got, ns.Text+":"+string(ns.Type))
+	}
+	if want := "shop:Namespace empty:Namespace"; strings.Join(got, " ") != want {
+		t.Fatalf("expected %s, got %s", want, strings.Join(got, " "))
+	}
+	if _, err := parser.Parse(tokenizer.Tokenize(d.Source())); err != nil {
+		t.Fatalf("imported source does not parse: %v\n%s", err, d.Source())
+	}
+}
+
+func TestKubernetesRejectsInvalidYAML(t *testing.T) {
+	_, err := Kubernetes(Source{Name: "bad.yaml", Reader: strings.NewReader("kind: Service\n---\nkind: [\n")})
+	if err == nil || !strings.Contains(err.Error(), "bad.yaml: document 2") {
+		t.Fatalf("expected an error naming the document, got %v", err)
+	}
+}
+
+func TestKubernetesSourceParsesAndLintsClean(t *testing.T) {
+	source := importShop(t).Source()
+
+	node, err := parser.Parse(tokenizer.Tokenize(source))
+	if err != nil {
+		t.Fatalf("imported source does not parse: %v\n%s", err, source)
+	}
+	if len(node.Children) != 2 || len(node.Connections) != 6 {
+		t.Fatalf("expected 2 namespaces and 6 connections, got %d and %d", len(node.Children), len(node.Connections))
+	}
+
+	findings, err := lint.Lint(source, lint.Config{})
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	for _, finding := range findings {
+		t.Errorf("unexpected finding %s: %s", finding.Rule, finding.Message)
+	}
+}
@@ -0,0 +1,120 @@
+package layout
+
+import (
+	"sort"
+
+	"github.com/saasuke-labs/nagare/pkg/components"
+	"github.com/saasuke-labs/nagare/pkg/props"
+)
+
+// Component describes a type buildComponentTree understands, so tooling can discover
+// prop keys and sizes without building a layout.
+type Component struct {
+	Type    string
+	Summary string
+	// AliasOf names the type this one is drawn as, if it is an alias.
+	AliasOf string
+	// Width and Height are the size used when the diagram sets no w or h.
+	Width, Height float64
+	// Props holds the component's default props, as returned by its Default*Props.
+	Props interface{}
+}
+
+var catalog = []Component{
+	{Type: componentTypeBrowser, Summary: "A browser window with a title bar and address bar.", Width: defaultBrowserWidth, Height: defaultBrowserHeight, Props: components.DefaultBrowserProps()},
+	{Type: componentTypeVM, Summary: "A virtual machine that can contain other components.", Width: defaultVMWidth, Height: defaultVMHeight, Props: components.DefaultVMProps()},
+	{Type: componentTypeServer, Summary: "A server with an optional technology icon.", Width: defaultServerWidth, Height: defaultServerHeight, Props: components.DefaultServerProps()},
+	{Type: componentTypeRectangle, Summary: "A plain labelled box. Unknown types are drawn as rectangles.", Width: defaultServerWidth, Height: defaultServerHeight, Props: components.DefaultRectangleProps()},
+	{Type: componentTypeTerminal, Summary: "A terminal window with a command prompt.", Width: defaultTerminalWidth, Height: defaultTerminalHeight, Props: components.DefaultTerminalProps()},
+	{Type: componentTypeDatabase, Summary: "A database cylinder labelled with its engine.", Width: defaultDatabaseWidth, Height: defaultDatabaseHeight, Props: components.DefaultDatabaseProps()},
+	{Type: componentTypeMessageQueue, Summary: "A message queue or topic.", Width: defaultQueueWidth, Height: defaultQueueHeight, Props: components.DefaultMessageQueueProps()},
+	{Type: componentTypeQueue, AliasOf: componentTypeMessageQueue, Width: defaultQueueWidth, Height: defaultQueueHeight, Props: components.DefaultMessageQueueProps()},
+	{Type: componentTypeCDN, Summary: "An edge network or CDN.", Width: defaultCDNWidth, Height: defaultCDNHeight, Props: components.DefaultCDNProps()},
+	{Type: componentTypeEdge, AliasOf: componentTypeCDN, Width: defaultCDNWidth, Height: defaultCDNHeight, Props: components.DefaultCDNProps()},
+	{Type: componentTypeAPIGateway, Summary: "An API gateway in front of other services.", Width: defaultAPIGatewayWidth, Height: defaultAPIGatewayHeight, Props: components.DefaultAPIGatewayProps()},
+	{Type: componentTypeBackgroundWorker, Summary: "A background worker or job runner.", Width: defaultBackgroundWorkerW, Height: defaultBackgroundWorkerH, Props: components.DefaultBackgroundWorkerProps()},
+	{Type: componentTypePackage, Summary: "A package or build artifact with a version.", Width: defaultPackageWidth, Height: defaultPackageHeight, Props: components.DefaultPackageProps()},
+	{Type: componentTypeArtifact, Summary: "A file or artifact.", Width: defaultArtifactWidth, Height: defaultArtifactHeight, Props: components.DefaultArtifactProps()},
+	{Type: componentTypeFile, AliasOf: componentTypeArtifact, Width: defaultArtifactWidth, Height: defaultArtifactHeight, Props: components.DefaultArtifactProps()},
+	{Type: componentTypeCluster, Summary: "A Kubernetes cluster that can contain namespaces and resources.", Width: defaultClusterWidth, Height: defaultClusterHeight, Props: components.DefaultClusterProps()},
+	{Type: componentTypeNamespace, Summary: "A Kubernetes namespace that can contain resources.", Width: defaultNamespaceWidth, Height: defaultNamespaceHeight, Props: components.DefaultNamespaceProps()},
+	{Type: componentTypeDeployment, Summary: "A Kubernetes deployment with its image and replica count.", Width: defaultDeploymentWidth, Height: defaultDeploymentHeight, Props: components.DefaultDeploymentProps()},
+	{Type: componentTypePod, Summary: "A Kubernetes pod, drawn as a stack when it has several replicas.", Width: defaultPodWidth, Height: defaultPodHeight, Props: components.DefaultPodProps()},
+	{Type: componentTypeService, Summary: "A Kubernetes service with an anchor for each selector.", Width: defaultServiceWidth, Height: defaultServiceHeight, Props: components.DefaultServiceProps()},
+	{Type: componentTypeIngress, Summary: "A Kubernetes ingress routing a host and path.", Width: defaultIngressWidth, Height: defaultIngressHeight, Props: components.DefaultIngressProps()},
+	{Type: componentTypeConfigMap, Summary: "A Kubernetes config map.", Width: defaultConfigMapWidth, Height: defaultConfigMapHeight, Props: components.DefaultConfigMapProps()},
+	{Type: componentTypeSecret, Summary: "A Kubernetes secret.", Width: defaultSecretWidth, Height: defaultSecretHeight, Props: components.DefaultSecretProps()},
+	{Type: componentTypePersistentVolume, Summary: "A Kubernetes persistent volume with its capacity.", Width: defaultVolumeWidth, Height: defaultVolumeHeight, Props: components.DefaultPersistentVolumeProps()},
+}
+
+// Components returns every component type understood by the layout engine, sorted by
+// name.
+func Components() []Component {
+	sorted := append([]Component(nil), catalog...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Type < sorted[j].Type })
+	return sorted
+}
+
+// LookupComponent returns the component named typeName.
+func LookupComponent(typeName string) (Component, bool) {
+	for _, c := range catalog {
+		if c.Type == typeName {
+			return c, true
+		}
+	}
+	return Component{}, false
+}
+
+// ComponentTypes returns the component type names understood by the layout engine,
+// sorted by name.
+func ComponentTypes() []string {
+	names := make([]string, 0, len(catalog))
+	for _, c := range Components() {
+		names = append(names, c.Type)
+	}
+	return names
+}
+
+// GeometryFields returns the position and size props every component accepts.
+func GeometryFields() []props.Field {
+	return props.Fields(geometryProps{})
+}
+
+// CanvasFields returns the props @layout accepts.
+func CanvasFields() []props.Field {
+	return props.Fields(canvasProps{})
+}
+
+// ComponentFields returns the props accepted by typeName, geometry first. Unknown
+// types are drawn as rectangles, so they report the rectangle props and ok is false.
+func ComponentFields(typeName string) (fields []props.Field, ok bool) {
+	c, ok := LookupComponent(typeName)
+	if !ok {
+		c, _ = LookupComponent(componentTypeRectangle)
+	}
+	return append(GeometryFields(), props.Fields(c.Props)...), ok
+}
+
+// Schema describes the props of every component type as JSON Schema. Each type is a
+// definition under $defs listing the geometry props, defaulting to its size, and its own.
+func Schema() *props.Schema {
+	schema := &props.Schema{
+		Schema:      props.SchemaVersion,
+		Title:       "Nagare component props",
+		Description: "The props each component type accepts in a @name(...) state.",
+		Defs:        make(map[string]*props.Schema, len(catalog)),
+	}
+	for _, c := range catalog {
+		def := props.SchemaOf(geometryProps{X: defaultComponentX, Y: defaultComponentY, Width: c.Width, Height: c.Height})
+		for key, property := range props.SchemaOf(c.Props).Properties {
+			def.Properties[key] = property
+		}
+		def.Title = c.Type
+		def.Description = c.Summary
+		if c.AliasOf != "" {
+			def.Description = "Alias of " + c.AliasOf + "."
+		}
+		schema.Defs[c.Type] = def
+	}
+	return schema
+}
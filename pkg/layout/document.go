@@ -0,0 +1,114 @@
+package layout
+
+import (
+	"math"
+
+	"github.com/saasuke-labs/nagare/pkg/props"
+)
+
+// DocumentVersion is the version of the schema Document is serialized in. It changes
+// only when a field is removed or changes meaning; fields may be added within a version.
+const DocumentVersion = 1
+
+// Document is the resolved geometry of a layout in a stable shape for serialization, so
+// click-maps and custom renderers can be built on it without reading SVG. All
+// coordinates are absolute canvas coordinates, rounded to hundredths so the output does
+// not change with floating-point noise.
+type Document struct {
+	Version int             `json:"version"`
+	Canvas  DocumentRect    `json:"canvas"`
+	Nodes   []DocumentNode  `json:"nodes"`
+	Arrows  []DocumentArrow `json:"arrows"`
+}
+
+// DocumentRect is a rectangle of a Document.
+type DocumentRect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// DocumentPoint is a point of a Document.
+type DocumentPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// DocumentNode is a component of a Document, listed after the container it is drawn in.
+type DocumentNode struct {
+	ID     string                 `json:"id"`
+	Type   string                 `json:"type"`            // Aliases are reported as the type they draw
+	State  string                 `json:"state,omitempty"` // State the component was drawn in
+	Props  map[string]interface{} `json:"props"`           // Resolved props by key, defaults included
+	Bounds DocumentRect           `json:"bounds"`
+	Parent string                 `json:"parent,omitempty"` // Id of the container; empty at the root
+}
+
+// DocumentArrow is a connection of a Document, in the order the connections are drawn.
+type DocumentArrow struct {
+	From        DocumentEnd     `json:"from"`
+	To          DocumentEnd     `json:"to"`
+	Points      []DocumentPoint `json:"points"` // Start, bend points and end, in order
+	Style       string          `json:"style,omitempty"`
+	MarkerStart bool            `json:"markerStart"`
+	MarkerEnd   bool            `json:"markerEnd"`
+}
+
+// DocumentEnd is where an arrow leaves or enters a node.
+type DocumentEnd struct {
+	Node   string        `json:"node"`
+	Anchor string        `json:"anchor,omitempty"` // As written, such as "e" or "n30"
+	Point  DocumentPoint `json:"point"`
+}
+
+// Document returns the resolved geometry of l for serialization.
+func (l Layout) Document() Document {
+	doc := Document{
+		Version: DocumentVersion,
+		Canvas:  documentRect(l.Bounds),
+		Nodes:   []DocumentNode{},
+		Arrows:  []DocumentArrow{},
+	}
+	for _, e := range l.Elements() {
+		values := make(map[string]interface{})
+		for _, v := range props.Values(e.Props) {
+			values[v.Key] = v.Value
+		}
+		doc.Nodes = append(doc.Nodes, DocumentNode{
+			ID:     e.ID,
+			Type:   e.Type,
+			State:  e.State,
+			Props:  values,
+			Bounds: documentRect(e.Bounds),
+			Parent: e.Parent,
+		})
+	}
+	for _, a := range l.Connections {
+		points := make([]DocumentPoint, 0, len(a.BendPoints)+2)
+		for _, p := range append(append([]Point{a.Start}, a.BendPoints...), a.End) {
+			points = append(points, documentPoint(p))
+		}
+		doc.Arrows = append(doc.Arrows, DocumentArrow{
+			From:        DocumentEnd{Node: a.FromID, Anchor: a.FromAnchor, Point: documentPoint(a.Start)},
+			To:          DocumentEnd{Node: a.ToID, Anchor: a.ToAnchor, Point: documentPoint(a.End)},
+			Points:      points,
+			Style:       a.Style,
+			MarkerStart: a.MarkerStart,
+			MarkerEnd:   a.MarkerEnd,
+		})
+	}
+	return doc
+}
+
+func documentRect(r Rect) DocumentRect {
+	return DocumentRect{X: hundredths(r.X), Y: hundredths(r.Y), Width: hundredths(r.Width), Height: hundredths(r.Height)}
+}
+
+func documentPoint(p Point) DocumentPoint {
+	return DocumentPoint{X: hundredths(p.X), Y: hundredths(p.Y)}
+}
+
+func hundredths(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,106 @@
+package layout
+
+import (
+	"github.com/saasuke-labs/nagare/pkg/components"
+	"github.com/saasuke-labs/nagare/pkg/props"
+)
+
+// Element is a component of a layout with what exporters need to draw it in another
+// format.
+type Element struct {
+	ID     string
+	Type   string      // Component type, such as Server; aliases are reported as the type they draw
+	State  string      // State the component was drawn in
+	Bounds Rect        // Absolute position and size
+	Props  interface{} // Resolved props, such as components.ServerProps
+	Parent string      // Id of the container the component is drawn in; empty at the root
+}
+
+// Title returns the title prop of e, or its id if it has none.
+func (e Element) Title() string {
+	if v, ok := props.Lookup(e.Props, "title"); ok {
+		if s, ok := v.(string); ok && s != "" {
+			return s
+		}
+	}
+	return e.ID
+}
+
+// Elements returns the components of l in drawing order, each container before its
+// children.
+func (l Layout) Elements() []Element {
+	var elements []Element
+	var walk func(children []components.Component, parent string)
+	walk = func(children []components.Component, parent string) {
+		for _, child := range children {
+			_, id := componentShape(child)
+			typeName, props, state, nested := describeComponent(child)
+			if typeName == "" {
+				continue
+			}
+			shape := l.NodeIndex[id]
+			elements = append(elements, Element{
+				ID:     id,
+				Type:   typeName,
+				State:  state,
+				Bounds: Rect{X: shape.X, Y: shape.Y, Width: shape.Width, Height: shape.Height},
+				Props:  props,
+				Parent: parent,
+			})
+			walk(nested, id)
+		}
+	}
+	walk(l.Children, "")
+	return elements
+}
+
+// describeComponent returns the type, resolved props and state of component, and the
+// components drawn inside it. Arrows and other components that are not nodes have no
+// type.
+func describeComponent(component components.Component) (typeName string, props interface{}, state string, children []components.Component) {
+	switch comp := component.(type) {
+	case *components.Browser:
+		return componentTypeBrowser, comp.Props, comp.State, nil
+	case *components.VM:
+		return componentTypeVM, comp.Props, comp.State, comp.Children
+	case *components.Server:
+		return componentTypeServer, comp.Props, comp.State, nil
+	case *components.Terminal:
+		return componentTypeTerminal, comp.Props, comp.State, nil
+	case *components.Database:
+		return componentTypeDatabase, comp.Props, comp.State, nil
+	case *components.MessageQueue:
+		return componentTypeMessageQueue, comp.Props, comp.State, nil
+	case *components.CDN:
+		return componentTypeCDN, comp.Props, comp.State, nil
+	case *components.APIGateway:
+		return componentTypeAPIGateway, comp.Props, comp.State, nil
+	case *components.BackgroundWorker:
+		return componentTypeBackgroundWorker, comp.Props, comp.State, nil
+	case *components.Package:
+		return componentTypePackage, comp.Props, comp.State, nil
+	case *components.Artifact:
+		return componentTypeArtifact, comp.Props, comp.State, nil
+	case *components.Rectangle:
+		return componentTypeRectangle, comp.Props, comp.State, nil
+	case *components.Cluster:
+		return componentTypeCluster, comp.Props, comp.State, comp.Children
+	case *components.Namespace:
+		return componentTypeNamespace, comp.Props, comp.State, comp.Children
+	case *components.Deployment:
+		return componentTypeDeployment, comp.Props, comp.State, nil
+	case *components.Pod:
+		return componentTypePod, comp.Props, comp.State, nil
+	case *components.Service:
+		return componentTypeService, comp.Props, comp.State, nil
+	case *components.Ingress:
+		return componentTypeIngress, comp.Props, comp.State, nil
+	case *components.ConfigMap:
+		return componentTypeConfigMap, comp.Props, comp.State, nil
+	case *components.Secret:
+		return componentTypeSecret, comp.Props, comp.State, nil
+	case *components.PersistentVolume:
+		return componentTypePersistentVolume, comp.Props, comp.State, nil
+	}
+	return "", nil, "", nil
+}
@@ -0,0 +1,467 @@
+package layout
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Geometry props accept expressions as well as numbers:
+//
+//	x: 50%                 half the width of the parent (the VM content area, or the canvas)
+//	w: &vps.w - 40         another node's size
+//	y: &browser.b + 20     another node's edge
+//	x: 2col                the canvas grid, see canvasProps
+//	w: min(&a.w, 30%) * 2  arithmetic, parentheses, min and max
+//
+// A reference names a node, or parent or canvas, and one of its properties. Positions
+// are read in the coordinate space of the shape being placed, so a VM child can refer
+// to nodes outside its VM.
+
+// Reference is an &node.property reference inside a geometry expression.
+type Reference struct {
+	Node     string
+	Property string
+	// Start and End are the byte offsets of the node name within the expression.
+	Start, End int
+}
+
+// reservedRefs name the frames a geometry expression can refer to besides nodes.
+const (
+	refParent = "parent"
+	refCanvas = "canvas"
+)
+
+// refProperties documents the properties a reference can read.
+var refProperties = map[string]string{
+	"x": "Left edge",
+	"y": "Top edge",
+	"w": "Width",
+	"h": "Height",
+	"l": "Left edge",
+	"r": "Right edge",
+	"t": "Top edge",
+	"b": "Bottom edge",
+	"c": "Centre, horizontally for x and w, vertically for y and h",
+}
+
+// exprUnits are the units a number can carry. Percentages are of the parent, along the
+// axis of the prop being set.
+var exprUnits = map[string]bool{"": true, "px": true, "%": true, "col": true, "row": true}
+
+// expr is a parsed geometry expression.
+type expr interface {
+	eval(env *exprEnv) (float64, error)
+}
+
+type (
+	numberExpr struct {
+		value float64
+		unit  string
+	}
+	refExpr struct {
+		Reference
+	}
+	negExpr    struct{ operand expr }
+	binaryExpr struct {
+		op          byte
+		left, right expr
+	}
+	callExpr struct {
+		name string
+		args []expr
+	}
+)
+
+// References returns the &node.property references in a geometry value, in order. Values
+// that are not expressions have none.
+func References(value string) []Reference {
+	e, err := parseExpr(value)
+	if err != nil {
+		return nil
+	}
+	var refs []Reference
+	walkExpr(e, func(e expr) {
+		if ref, ok := e.(refExpr); ok {
+			refs = append(refs, ref.Reference)
+		}
+	})
+	return refs
+}
+
+func walkExpr(e expr, visit func(expr)) {
+	visit(e)
+	switch e := e.(type) {
+	case negExpr:
+		walkExpr(e.operand, visit)
+	case binaryExpr:
+		walkExpr(e.left, visit)
+		walkExpr(e.right, visit)
+	case callExpr:
+		for _, arg := range e.args {
+			walkExpr(arg, visit)
+		}
+	}
+}
+
+// exprParser is a recursive descent parser over the expression text:
+//
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number [unit] | "&" name { "." name } "." property | ("min" | "max") "(" sum { "," sum } ")" | "(" sum ")"
+type exprParser struct {
+	src string
+	pos int
+}
+
+func parseExpr(src string) (expr, error) {
+	p := &exprParser{src: src}
+	e, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return e, nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid expression %q: %s", strings.TrimSpace(p.src), fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end.
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) sum() (expr, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) product() (expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) unary() (expr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (expr, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return nil, p.errorf("unexpected end")
+	case c == '(':
+		p.pos++
+		inner, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return inner, nil
+	case c == '&':
+		return p.reference()
+	case isDigit(c) || c == '.':
+		return p.number()
+	case isLetter(c):
+		return p.call()
+	default:
+		return nil, p.errorf("unexpected %q", string(c))
+	}
+}
+
+func (p *exprParser) number() (expr, error) {
+	start := p.pos
+	for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+		p.pos++
+	}
+	value, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		return nil, p.errorf("%q is not a number", p.src[start:p.pos])
+	}
+
+	unitStart := p.pos
+	if p.pos < len(p.src) && p.src[p.pos] == '%' {
+		p.pos++
+	} else {
+		for p.pos < len(p.src) && isLetter(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	unit := p.src[unitStart:p.pos]
+	if !exprUnits[unit] {
+		return nil, p.errorf("unknown unit %q: use px, %%, col or row", unit)
+	}
+	return numberExpr{value: value, unit: unit}, nil
+}
+
+func (p *exprParser) reference() (expr, error) {
+	p.pos++ // &
+	p.skipSpace()
+	// Node names may be namespaced by an import, as in &edge.cdn.b, so the property is
+	// the last dotted part.
+	start, property := p.pos, -1
+	for {
+		partStart := p.pos
+		for p.pos < len(p.src) && isNameByte(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == partStart {
+			break
+		}
+		if p.pos >= len(p.src) || p.src[p.pos] != '.' {
+			property = partStart
+			break
+		}
+		p.pos++
+	}
+	if property <= start {
+		return nil, p.errorf("expected &node.property")
+	}
+
+	// The property is letters only, so &a.w-10 subtracts.
+	p.pos = property
+	for p.pos < len(p.src) && isLetter(p.src[p.pos]) {
+		p.pos++
+	}
+	ref := Reference{Node: p.src[start : property-1], Property: p.src[property:p.pos], Start: start, End: property - 1}
+	if _, ok := refProperties[ref.Property]; !ok {
+		return nil, p.errorf("unknown property %q in &%s.%s: use x, y, w, h, l, r, t, b or c", ref.Property, ref.Node, ref.Property)
+	}
+	return refExpr{ref}, nil
+}
+
+func (p *exprParser) call() (expr, error) {
+	start := p.pos
+	for p.pos < len(p.src) && isLetter(p.src[p.pos]) {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+	if name != "min" && name != "max" {
+		return nil, p.errorf("unknown function %q: use min or max", name)
+	}
+	if p.peek() != '(' {
+		return nil, p.errorf("expected ( after %s", name)
+	}
+	p.pos++
+
+	call := callExpr{name: name}
+	for {
+		arg, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return call, nil
+		default:
+			return nil, p.errorf("missing ) after the arguments of %s", name)
+		}
+	}
+}
+
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isNameByte(c byte) bool {
+	return isLetter(c) || isDigit(c) || c == '_' || c == '-'
+}
+
+// exprEnv is what an expression is evaluated against.
+type exprEnv struct {
+	horizontal bool // Whether the prop being set is x or w
+	frame      Rect // The parent, in canvas coordinates; positions are read relative to it
+	canvas     Rect
+	column     float64 // Size of the col and row units
+	row        float64
+	lookup     func(node string) (Rect, bool) // Nodes in canvas coordinates
+}
+
+func (n numberExpr) eval(env *exprEnv) (float64, error) {
+	switch n.unit {
+	case "%":
+		if env.horizontal {
+			return n.value / 100 * env.frame.Width, nil
+		}
+		return n.value / 100 * env.frame.Height, nil
+	case "col":
+		return n.value * env.column, nil
+	case "row":
+		return n.value * env.row, nil
+	default:
+		return n.value, nil
+	}
+}
+
+func (r refExpr) eval(env *exprEnv) (float64, error) {
+	target, err := env.resolve(r.Node)
+	if err != nil {
+		return 0, err
+	}
+	// Read positions relative to the frame the result is placed in.
+	target.X -= env.frame.X
+	target.Y -= env.frame.Y
+
+	switch r.Property {
+	case "x", "l":
+		return target.X, nil
+	case "y", "t":
+		return target.Y, nil
+	case "w":
+		return target.Width, nil
+	case "h":
+		return target.Height, nil
+	case "r":
+		return target.X + target.Width, nil
+	case "b":
+		return target.Y + target.Height, nil
+	default: // c
+		if env.horizontal {
+			return target.X + target.Width/2, nil
+		}
+		return target.Y + target.Height/2, nil
+	}
+}
+
+func (env *exprEnv) resolve(node string) (Rect, error) {
+	if rect, ok := env.lookup(node); ok {
+		return rect, nil
+	}
+	switch node {
+	case refParent:
+		return env.frame, nil
+	case refCanvas:
+		return env.canvas, nil
+	}
+	return Rect{}, fmt.Errorf("component %s not found", node)
+}
+
+func (n negExpr) eval(env *exprEnv) (float64, error) {
+	v, err := n.operand.eval(env)
+	return -v, err
+}
+
+func (b binaryExpr) eval(env *exprEnv) (float64, error) {
+	left, err := b.left.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	right, err := b.right.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	default:
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return left / right, nil
+	}
+}
+
+func (c callExpr) eval(env *exprEnv) (float64, error) {
+	var result float64
+	for i, arg := range c.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 || (c.name == "min" && v < result) || (c.name == "max" && v > result) {
+			result = v
+		}
+	}
+	return result, nil
+}
+
+// alignment reports whether e is a lone reference that aligns a shape rather than reads
+// an edge: &node.t, &node.c or &node.b for y, and &node.l, &node.c or &node.r for x.
+// These keep their original meaning of lining the shape up with the node, so
+// `y: &api.b` puts the shape's bottom level with the bottom of api.
+func alignment(e expr, horizontal bool) (refExpr, bool) {
+	ref, ok := e.(refExpr)
+	if !ok {
+		return refExpr{}, false
+	}
+	switch ref.Property {
+	case "c":
+		return ref, true
+	case "l", "r":
+		return ref, horizontal
+	case "t", "b":
+		return ref, !horizontal
+	}
+	return refExpr{}, false
+}
+
+// evalPosition evaluates a position prop of a shape of the given size, applying the
+// alignment shorthand.
+func evalPosition(e expr, size float64, env *exprEnv) (float64, error) {
+	v, err := e.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	if ref, ok := alignment(e, env.horizontal); ok {
+		switch ref.Property {
+		case "c":
+			v -= size / 2
+		case "r", "b":
+			v -= size
+		}
+	}
+	return v, nil
+}
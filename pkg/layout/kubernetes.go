@@ -0,0 +1,287 @@
+package layout
+
+import (
+	"github.com/saasuke-labs/nagare/pkg/components"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+)
+
+func buildCluster(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) *components.Cluster {
+	cluster := components.NewCluster(node.Text)
+	cluster.Shape = components.Shape{
+		Width:  defaultClusterWidth,
+		Height: defaultClusterHeight,
+		X:      defaultComponentX,
+		Y:      defaultComponentY,
+	}
+
+	cluster.State = applyStates(node, &cluster.Shape, &cluster.Props, true, warn)
+
+	layoutContainerChildren(node, cluster.Shape, cluster.AddChild, nodeIndex, warn)
+	nodeIndex[node.Text] = cluster.Shape
+	return cluster
+}
+
+func buildNamespace(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) *components.Namespace {
+	namespace := components.NewNamespace(node.Text)
+	namespace.Shape = components.Shape{
+		Width:  defaultNamespaceWidth,
+		Height: defaultNamespaceHeight,
+		X:      defaultComponentX,
+		Y:      defaultComponentY,
+	}
+
+	namespace.State = applyStates(node, &namespace.Shape, &namespace.Props, true, warn)
+
+	layoutContainerChildren(node, namespace.Shape, namespace.AddChild, nodeIndex, warn)
+	nodeIndex[node.Text] = namespace.Shape
+	return namespace
+}
+
+// layoutContainerChildren builds the children of a Cluster or Namespace at shape. Each
+// child is built as if it were at the root and then moved, with everything drawn inside
+// it, into the container's content area, so containers nest to any depth.
+func layoutContainerChildren(parent parser.Node, shape components.Shape, add func(components.Component), nodeIndex map[string]components.Shape, warn *warnings) {
+	area := contentArea(string(parent.Type), shape)
+	for _, child := range parent.Children {
+		for _, component := range buildComponentTree(child, nodeIndex, warn) {
+			add(component)
+		}
+		moveNodes(child, area.X, area.Y, nodeIndex)
+	}
+}
+
+// moveNodes moves node, and every node drawn inside it, by dx and dy.
+func moveNodes(node parser.Node, dx, dy float64, nodeIndex map[string]components.Shape) {
+	if shape, ok := nodeIndex[node.Text]; ok {
+		shape.X += dx
+		shape.Y += dy
+		nodeIndex[node.Text] = shape
+	}
+	if !IsContainerType(string(node.Type)) {
+		return
+	}
+	for _, child := range node.Children {
+		moveNodes(child, dx, dy, nodeIndex)
+	}
+}
+
+func buildDeployment(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) *components.Deployment {
+	deployment := components.NewDeployment(node.Text)
+	deployment.Shape = components.Shape{
+		Width:  defaultDeploymentWidth,
+		Height: defaultDeploymentHeight,
+		X:      defaultComponentX,
+		Y:      defaultComponentY,
+	}
+
+	deployment.State = applyStates(node, &deployment.Shape, &deployment.Props, true, warn)
+	nodeIndex[node.Text] = deployment.Shape
+	return deployment
+}
+
+func buildPod(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) *components.Pod {
+	pod := components.NewPod(node.Text)
+	pod.Shape = components.Shape{
+		Width:  defaultPodWidth,
+		Height: defaultPodHeight,
+		X:      defaultComponentX,
+		Y:      defaultComponentY,
+	}
+
+	pod.State = applyStates(node, &pod.Shape, &pod.Props, true, warn)
+	nodeIndex[node.Text] = pod.Shape
+	return pod
+}
+
+func buildService(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) *components.Service {
+	service := components.NewService(node.Text)
+	service.Shape = components.Shape{
+		Width:  defaultServiceWidth,
+		Height: defaultServiceHeight,
+		X:      defaultComponentX,
+		Y:      defaultComponentY,
+	}
+
+	service.State = applyStates(node, &service.Shape, &service.Props, true, warn)
+	nodeIndex[node.Text] = service.Shape
+	return service
+}
+
+func buildIngress(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) *components.Ingress {
+	ingress := components.NewIngress(node.Text)
+	ingress.Shape = components.Shape{
+		Width:  defaultIngressWidth,
+		Height: defaultIngressHeight,
+		X:      defaultComponentX,
+		Y:      defaultComponentY,
+	}
+
+	ingress.State = applyStates(node, &ingress.Shape, &ingress.Props, true, warn)
+	nodeIndex[node.Text] = ingress.Shape
+	return ingress
+}
+
+func buildConfigMap(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) *components.ConfigMap {
+	configMap := components.NewConfigMap(node.Text)
+	configMap.Shape = components.Shape{
+		Width:  defaultConfigMapWidth,
+		Height: defaultConfigMapHeight,
+		X:      defaultComponentX,
+		Y:      defaultComponentY,
+	}
+
+	configMap.State = applyStates(node, &configMap.Shape, &configMap.Props, true, warn)
+	nodeIndex[node.Text] = configMap.Shape
+	return configMap
+}
+
+func buildSecret(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) *components.Secret {
+	secret := components.NewSecret(node.Text)
+	secret.Shape = components.Shape{
+		Width:  defaultSecretWidth,
+		Height: defaultSecretHeight,
+		X:      defaultComponentX,
+		Y:      defaultComponentY,
+	}
+
+	secret.State = applyStates(node, &secret.Shape, &secret.Props, true, warn)
+	nodeIndex[node.Text] = secret.Shape
+	return secret
+}
+
+func buildPersistentVolume(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) *components.PersistentVolume {
+	volume := components.NewPersistentVolume(node.Text)
+	volume.Shape = components.Shape{
+		Width:  defaultVolumeWidth,
+		Height: defaultVolumeHeight,
+		X:      defaultComponentX,
+		Y:      defaultComponentY,
+	}
+
+	volume.State = applyStates(node, &volume.Shape, &volume.Props, true, warn)
+	nodeIndex[node.Text] = volume.Shape
+	return volume
+}
+
+// syncContainerChildren copies the resolved geometry of children, drawn in a container
+// whose content area starts at origin, from nodeIndex. Children are drawn relative to
+// origin, and the children of nested containers relative to their own content area.
+func syncContainerChildren(children []components.Component, origin Point, nodeIndex map[string]components.Shape) {
+	for _, child := range children {
+		shape, id := componentShape(child)
+		resolved, ok := nodeIndex[id]
+		if shape == nil || !ok {
+			continue
+		}
+		applyResolvedShape(shape, resolved)
+		shape.X -= origin.X
+		shape.Y -= origin.Y
+
+		switch comp := child.(type) {
+		case *components.VM:
+			area := contentArea(componentTypeVM, resolved)
+			syncContainerChildren(comp.Children, Point{X: area.X, Y: area.Y}, nodeIndex)
+		case *components.Cluster:
+			area := contentArea(componentTypeCluster, resolved)
+			syncContainerChildren(comp.Children, Point{X: area.X, Y: area.Y}, nodeIndex)
+		case *components.Namespace:
+			area := contentArea(componentTypeNamespace, resolved)
+			syncContainerChildren(comp.Children, Point{X: area.X, Y: area.Y}, nodeIndex)
+		}
+	}
+}
+
+// componentShape returns the shape of a component and the id it is indexed by.
+func componentShape(component components.Component) (*components.Shape, string) {
+	switch comp := component.(type) {
+	case *components.Browser:
+		return &comp.Shape, comp.Text
+	case *components.VM:
+		return &comp.Shape, comp.Text
+	case *components.Server:
+		return &comp.Shape, comp.Text
+	case *components.Terminal:
+		return &comp.Shape, comp.Text
+	case *components.Database:
+		return &comp.Shape, comp.Text
+	case *components.MessageQueue:
+		return &comp.Shape, comp.Text
+	case *components.CDN:
+		return &comp.Shape, comp.Text
+	case *components.APIGateway:
+		return &comp.Shape, comp.Text
+	case *components.BackgroundWorker:
+		return &comp.Shape, comp.Text
+	case *components.Package:
+		return &comp.Shape, comp.Text
+	case *components.Artifact:
+		return &comp.Shape, comp.Text
+	case *components.Rectangle:
+		return &comp.Shape, comp.Text
+	case *components.Cluster:
+		return &comp.Shape, comp.Text
+	case *components.Namespace:
+		return &comp.Shape, comp.Text
+	case *components.Deployment:
+		return &comp.Shape, comp.Text
+	case *components.Pod:
+		return &comp.Shape, comp.Text
+	case *components.Service:
+		return &comp.Shape, comp.Text
+	case *components.Ingress:
+		return &comp.Shape, comp.Text
+	case *components.ConfigMap:
+		return &comp.Shape, comp.Text
+	case *components.Secret:
+		return &comp.Shape, comp.Text
+	case *components.PersistentVolume:
+		return &comp.Shape, comp.Text
+	}
+	return nil, ""
+}
+
+// selectorAnchors returns the anchors the selectors of each Service add, by service id
+// and anchor name. A selector anchor sits on the bottom edge of its service, so
+// svc.web --> pod.n connects the web selector of svc to pod.
+func selectorAnchors(children []components.Component) map[string]map[string]parser.AnchorDescriptor {
+	anchors := make(map[string]map[string]parser.AnchorDescriptor)
+	var walk func(children []components.Component)
+	walk = func(children []components.Component) {
+		for _, child := range children {
+			switch comp := child.(type) {
+			case *components.Service:
+				names := comp.Props.SelectorAnchors()
+				if len(names) == 0 {
+					continue
+				}
+				anchors[comp.Text] = make(map[string]parser.AnchorDescriptor, len(names))
+				for i, name := range names {
+					anchors[comp.Text][name] = parser.AnchorDescriptor{
+						Raw:                   name,
+						Vertical:              1,
+						Directions:            []rune{'s'},
+						HorizontalFraction:    components.SelectorAnchorFraction(i, len(names)),
+						HasHorizontalFraction: true,
+					}
+				}
+			case *components.VM:
+				walk(comp.Children)
+			case *components.Cluster:
+				walk(comp.Children)
+			case *components.Namespace:
+				walk(comp.Children)
+			}
+		}
+	}
+	walk(children)
+	return anchors
+}
+
+// namedAnchor returns the named anchor of node that anchor refers to, or anchor itself if
+// it does not name one.
+func namedAnchor(anchors map[string]map[string]parser.AnchorDescriptor, node string, anchor parser.AnchorDescriptor) parser.AnchorDescriptor {
+	if named, ok := anchors[node][anchor.Raw]; ok {
+		return named
+	}
+	return anchor
+}
@@ -1,8 +1,10 @@
 package layout
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 
 	"github.com/saasuke-labs/nagare/pkg/components"
@@ -33,6 +35,24 @@ const (
 	defaultPackageHeight     = 180.0
 	defaultArtifactWidth     = 200.0
 	defaultArtifactHeight    = 180.0
+	defaultClusterWidth      = 900.0
+	defaultClusterHeight     = 600.0
+	defaultNamespaceWidth    = 600.0
+	defaultNamespaceHeight   = 360.0
+	defaultDeploymentWidth   = 220.0
+	defaultDeploymentHeight  = 140.0
+	defaultPodWidth          = 180.0
+	defaultPodHeight         = 120.0
+	defaultServiceWidth      = 200.0
+	defaultServiceHeight     = 100.0
+	defaultIngressWidth      = 220.0
+	defaultIngressHeight     = 100.0
+	defaultConfigMapWidth    = 160.0
+	defaultConfigMapHeight   = 120.0
+	defaultSecretWidth       = 160.0
+	defaultSecretHeight      = 120.0
+	defaultVolumeWidth       = 180.0
+	defaultVolumeHeight      = 140.0
 	defaultComponentX        = 0.0
 	defaultComponentY        = 0.0
 	arrowElbowPadding        = 24.0
@@ -55,6 +75,15 @@ const (
 	componentTypePackage          = "Package"
 	componentTypeArtifact         = "Artifact"
 	componentTypeFile             = "File"
+	componentTypeCluster          = "Cluster"
+	componentTypeNamespace        = "Namespace"
+	componentTypeDeployment       = "Deployment"
+	componentTypePod              = "Pod"
+	componentTypeService          = "Service"
+	componentTypeIngress          = "Ingress"
+	componentTypeConfigMap        = "ConfigMap"
+	componentTypeSecret           = "Secret"
+	componentTypePersistentVolume = "PersistentVolume"
 )
 
 // Rect represents a rectangle in the layout
@@ -71,6 +100,34 @@ type Layout struct {
 	Children    []components.Component
 	NodeIndex   map[string]components.Shape
 	Connections []Arrow
+	Warnings    []Warning // Problems the layout worked around, in the order met
+}
+
+// Warning is a problem the layout worked around instead of failing, such as a prop that
+// does not parse or a connection to an unknown node. Node, State, Prop, From and To name
+// what it is about so callers can locate it in the source.
+type Warning struct {
+	Message string
+	Node    string // Declaration the warning is about
+	State   string // State definition the warning is about
+	Prop    string // Prop key within State
+	From    string // Connection the warning is about, by its ends
+	To      string
+}
+
+// warnings collects Warnings during a layout. A nil collector drops them.
+type warnings []Warning
+
+func (w *warnings) add(warning Warning) {
+	if w == nil {
+		return
+	}
+	for _, existing := range *w {
+		if existing == warning {
+			return // A named state applied to several nodes reports once
+		}
+	}
+	*w = append(*w, warning)
 }
 
 // Point represents a 2D coordinate in canvas space.
@@ -94,10 +151,10 @@ type Arrow struct {
 }
 
 type geometryProps struct {
-	X      interface{} `prop:"x"`
-	Y      interface{} `prop:"y"`
-	Width  *int        `prop:"w"`
-	Height *int        `prop:"h"`
+	X      interface{} `prop:"x" doc:"Horizontal position, or an expression such as 50%, &node.r + 20 or &node.c to align"`
+	Y      interface{} `prop:"y" doc:"Vertical position, or an expression such as 2row, &node.b + 20 or &node.c to align"`
+	Width  interface{} `prop:"w" doc:"Width in pixels, or an expression such as 30% or &node.w - 40"`
+	Height interface{} `prop:"h" doc:"Height in pixels, or an expression such as min(&node.h, 50%)"`
 }
 
 type propertyParser interface {
@@ -115,143 +172,264 @@ func parseGeometryProps(def string) (geometryProps, error) {
 	return geom, nil
 }
 
-func applyGeometryProps(shape *components.Shape, geom geometryProps, nodeIndex map[string]components.Shape) {
-	if geom.Width != nil {
-		shape.Width = float64(*geom.Width)
+func applyGeometryProps(shape *components.Shape, geom geometryProps) {
+	applyGeometryValue(shape, "w", geom.Width, &shape.Width)
+	applyGeometryValue(shape, "h", geom.Height, &shape.Height)
+	applyGeometryValue(shape, "x", geom.X, &shape.X)
+	applyGeometryValue(shape, "y", geom.Y, &shape.Y)
+}
+
+// applyGeometryValue sets a number straight away and stores an expression for
+// resolveGeometry, so the last state to set key wins either way.
+func applyGeometryValue(shape *components.Shape, key string, value interface{}, target *float64) {
+	switch v := value.(type) {
+	case int:
+		*target = float64(v)
+		delete(shape.AlignmentRefs, key)
+	case float64:
+		*target = v
+		delete(shape.AlignmentRefs, key)
+	case string:
+		fmt.Printf("Geometry expression detected for %s: %s (deferred)\n", key, v)
+		if shape.AlignmentRefs == nil {
+			shape.AlignmentRefs = make(map[string]string)
+		}
+		shape.AlignmentRefs[key] = v
 	}
-	if geom.Height != nil {
-		shape.Height = float64(*geom.Height)
+}
+
+// geometryKeys are the geometry props in the order resolveGeometry evaluates them: sizes
+// first, so aligning a shape uses its final size.
+var geometryKeys = []string{"w", "h", "x", "y"}
+
+// resolveGeometry evaluates the geometry expressions stored on each shape, after every
+// component has been built. A shape is resolved after the nodes it refers to and after
+// its VM, so expressions see final positions; shapes whose references form a cycle keep
+// their literal geometry. VM children are moved along with their VM.
+func resolveGeometry(nodeIndex map[string]components.Shape, parents, kinds map[string]string, area canvas, warn *warnings) {
+	names := make([]string, 0, len(nodeIndex))
+	for name := range nodeIndex {
+		names = append(names, name)
+	}
+	// Resolve in a fixed order so warnings come out the same way every run
+	sort.Strings(names)
+
+	frameOf := func(name string) Rect {
+		if parent, ok := parents[name]; ok {
+			return contentArea(kinds[parent], nodeIndex[parent])
+		}
+		return area.Rect
 	}
-	if geom.X != nil {
-		if intVal, ok := geom.X.(int); ok {
-			shape.X = float64(intVal)
-		} else if strVal, ok := geom.X.(string); ok && strings.HasPrefix(strVal, "&") {
-			// Handle alignment reference - store for later resolution
-			fmt.Printf("Alignment reference detected for X: %s (deferred)\n", strVal)
-			if shape.AlignmentRefs == nil {
-				shape.AlignmentRefs = make(map[string]string)
+
+	// Remember where each shape sits in its frame as built, so children follow their VM.
+	local := make(map[string]Point, len(names))
+	exprs := make(map[string]map[string]expr)
+	deps := make(map[string][]string)
+	for _, name := range names {
+		shape := nodeIndex[name]
+		frame := frameOf(name)
+		local[name] = Point{X: shape.X - frame.X, Y: shape.Y - frame.Y}
+
+		if parent, ok := parents[name]; ok {
+			deps[name] = append(deps[name], parent)
+		}
+		for _, key := range geometryKeys {
+			raw, ok := shape.AlignmentRefs[key]
+			if !ok {
+				continue
 			}
-			shape.AlignmentRefs["x"] = strVal
-		} else if strVal, ok := geom.X.(string); ok {
-			// Check if this looks like a broken alignment reference (e.g., "browser  c")
-			if strings.Contains(strVal, "  ") {
-				fmt.Printf("Possible broken alignment reference detected for X: %s (deferred)\n", strVal)
-				if shape.AlignmentRefs == nil {
-					shape.AlignmentRefs = make(map[string]string)
-				}
-				shape.AlignmentRefs["x_string"] = strVal
+			e, err := parseExpr(raw)
+			if err != nil {
+				warn.add(Warning{Node: name, Prop: key, Message: fmt.Sprintf("%s of %s is ignored: %v", key, name, err)})
+				continue
 			}
-		}
-	}
-	if geom.Y != nil {
-		if intVal, ok := geom.Y.(int); ok {
-			shape.Y = float64(intVal)
-		} else if strVal, ok := geom.Y.(string); ok && strings.HasPrefix(strVal, "&") {
-			// Handle alignment reference - store for later resolution
-			fmt.Printf("Alignment reference detected for Y: %s (deferred)\n", strVal)
-			if shape.AlignmentRefs == nil {
-				shape.AlignmentRefs = make(map[string]string)
+			if exprs[name] == nil {
+				exprs[name] = make(map[string]expr)
 			}
-			shape.AlignmentRefs["y"] = strVal
-		} else if strVal, ok := geom.Y.(string); ok {
-			// Check if this looks like a broken alignment reference (e.g., "browser  c")
-			if strings.Contains(strVal, "  ") {
-				fmt.Printf("Possible broken alignment reference detected for Y: %s (deferred)\n", strVal)
-				if shape.AlignmentRefs == nil {
-					shape.AlignmentRefs = make(map[string]string)
+			exprs[name][key] = e
+			walkExpr(e, func(e expr) {
+				if ref, ok := e.(refExpr); ok {
+					if _, known := nodeIndex[ref.Node]; known {
+						deps[name] = append(deps[name], ref.Node)
+					}
 				}
-				shape.AlignmentRefs["y_string"] = strVal
-			}
+			})
 		}
 	}
-}
 
-func resolveAlignmentReference(ref string, nodeIndex map[string]components.Shape, currentShape *components.Shape) (float64, error) {
-	// Parse &component.alignment syntax
-	if !strings.HasPrefix(ref, "&") {
-		return 0, fmt.Errorf("alignment reference must start with &")
+	order, cycles := dependencyOrder(names, deps)
+	for _, name := range names {
+		if cycle, ok := cycles[name]; ok && len(exprs[name]) > 0 {
+			warn.add(Warning{Node: name, Message: fmt.Sprintf("geometry of %s is ignored: its references form a cycle %s", name, strings.Join(cycle, " -> "))})
+			delete(exprs, name)
+		}
 	}
 
-	// Remove & prefix
-	ref = strings.TrimPrefix(ref, "&")
+	moved := make(map[string]bool)
+	for _, name := range order {
+		if len(exprs[name]) == 0 && !moved[parents[name]] {
+			continue
+		}
 
-	// Split by dot
-	parts := strings.Split(ref, ".")
-	if len(parts) != 2 {
-		return 0, fmt.Errorf("invalid alignment reference format: expected &component.alignment")
+		shape := nodeIndex[name]
+		frame := frameOf(name)
+		env := &exprEnv{
+			frame:  frame,
+			canvas: area.Rect,
+			column: area.column,
+			row:    area.row,
+			lookup: func(node string) (Rect, bool) {
+				s, ok := nodeIndex[node]
+				return Rect{X: s.X, Y: s.Y, Width: s.Width, Height: s.Height}, ok
+			},
+		}
+		pos := local[name]
+		for _, key := range geometryKeys {
+			e, ok := exprs[name][key]
+			if !ok {
+				continue
+			}
+			env.horizontal = key == "x" || key == "w"
+			var v float64
+			var err error
+			switch key {
+			case "w", "h":
+				v, err = e.eval(env)
+			case "x":
+				v, err = evalPosition(e, shape.Width, env)
+			case "y":
+				v, err = evalPosition(e, shape.Height, env)
+			}
+			if err != nil {
+				fmt.Printf("Failed to resolve %s %s for %s: %v\n", key, shape.AlignmentRefs[key], name, err)
+				warn.add(Warning{Node: name, Prop: key, Message: fmt.Sprintf("%s %s for %s is ignored: %v", key, shape.AlignmentRefs[key], name, err)})
+				continue
+			}
+			fmt.Printf("Resolved %s for %s: %s -> %f\n", key, name, shape.AlignmentRefs[key], v)
+			switch key {
+			case "w":
+				shape.Width = v
+			case "h":
+				shape.Height = v
+			case "x":
+				pos.X = v
+			case "y":
+				pos.Y = v
+			}
+		}
+		shape.X = frame.X + pos.X
+		shape.Y = frame.Y + pos.Y
+		nodeIndex[name] = shape
+		moved[name] = true
 	}
+}
 
-	componentName := parts[0]
-	alignment := parts[1]
-
-	// Find the target component
-	targetShape, exists := nodeIndex[componentName]
-	if !exists {
-		return 0, fmt.Errorf("component %s not found", componentName)
+// dependencyOrder sorts names so each comes after the names it depends on. Names on a
+// cycle are returned too, in an arbitrary position, with the cycle they are part of.
+func dependencyOrder(names []string, deps map[string][]string) ([]string, map[string][]string) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(names))
+	cycles := make(map[string][]string)
+	order := make([]string, 0, len(names))
+	var stack []string
+
+	var visit func(name string)
+	visit = func(name string) {
+		switch state[name] {
+		case done:
+			return
+		case visiting:
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] == name {
+					cycle := append(append([]string(nil), stack[i:]...), name)
+					for _, member := range stack[i:] {
+						if _, ok := cycles[member]; !ok {
+							cycles[member] = cycle
+						}
+					}
+					break
+				}
+			}
+			return
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range deps[name] {
+			visit(dep)
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+		order = append(order, name)
 	}
-
-	// Calculate alignment position
-	switch alignment {
-	case "c": // center
-		return targetShape.Y + targetShape.Height/2 - currentShape.Height/2, nil
-	case "t": // top
-		return targetShape.Y, nil
-	case "b": // bottom
-		return targetShape.Y + targetShape.Height - currentShape.Height, nil
-	default:
-		return 0, fmt.Errorf("unsupported alignment: %s", alignment)
+	for _, name := range names {
+		visit(name)
 	}
+	return order, cycles
 }
 
-func resolveAlignmentReferences(nodeIndex map[string]components.Shape) {
-	// Iterate through all shapes and resolve alignment references
-	for componentName, shape := range nodeIndex {
-		updated := false
-
-		// Check if there are alignment references to resolve
-		if shape.AlignmentRefs != nil {
-			for axis, ref := range shape.AlignmentRefs {
-				resolved, err := resolveAlignmentReference(ref, nodeIndex, &shape)
-				if err != nil {
-					fmt.Printf("Failed to resolve alignment reference %s for %s: %v\n", ref, componentName, err)
-					continue
-				}
-
-				switch axis {
-				case "x":
-					shape.X = resolved
-					updated = true
-					fmt.Printf("Resolved X alignment for %s: %s -> %f\n", componentName, ref, resolved)
-				case "y":
-					shape.Y = resolved
-					updated = true
-					fmt.Printf("Resolved Y alignment for %s: %s -> %f\n", componentName, ref, resolved)
-				}
+// containerParents maps each node drawn in a container to that container, at any depth,
+// and each container to its type.
+func containerParents(root parser.Node) (parents, kinds map[string]string) {
+	parents = make(map[string]string)
+	kinds = make(map[string]string)
+	var walk func(nodes []parser.Node)
+	walk = func(nodes []parser.Node) {
+		for _, node := range nodes {
+			if !IsContainerType(string(node.Type)) {
+				continue
 			}
+			kinds[node.Text] = string(node.Type)
+			for _, child := range node.Children {
+				parents[child.Text] = node.Text
+			}
+			walk(node.Children)
 		}
+	}
+	walk(root.Children)
+	return parents, kinds
+}
 
-		// Also check for alignment patterns in string values (fallback for current parsing)
-		// This handles the case where tokenizer breaks "&browser.c" into "browser  c"
-		if strY, ok := shape.AlignmentRefs["y_string"]; ok {
-			// Try to reconstruct the alignment reference
-			reconstructed := strings.ReplaceAll(strY, "  ", ".")
-			reconstructed = "&" + reconstructed
+// IsContainerType reports whether components of type typeName draw their children.
+func IsContainerType(typeName string) bool {
+	_, ok := ContentArea(typeName, Rect{})
+	return ok
+}
 
-			resolved, err := resolveAlignmentReference(reconstructed, nodeIndex, &shape)
-			if err != nil {
-				fmt.Printf("Failed to resolve reconstructed alignment reference %s for %s: %v\n", reconstructed, componentName, err)
-			} else {
-				shape.Y = resolved
-				updated = true
-				fmt.Printf("Resolved Y alignment (reconstructed) for %s: %s -> %f\n", componentName, reconstructed, resolved)
-			}
-		}
+// ContentArea returns the area of a container of type typeName at bounds that its
+// children are placed in. ok is false if typeName does not draw children.
+func ContentArea(typeName string, bounds Rect) (area Rect, ok bool) {
+	switch typeName {
+	case componentTypeVM:
+		return Rect{
+			X:      bounds.X + bounds.Width*components.VMContentAreaXRatio,
+			Y:      bounds.Y + bounds.Height*components.VMContentAreaYRatio,
+			Width:  bounds.Width * components.VMContentAreaWidthRatio,
+			Height: bounds.Height * components.VMContentAreaHeightRatio,
+		}, true
+	case componentTypeCluster, componentTypeNamespace:
+		return Rect{
+			X:      bounds.X + bounds.Width*components.KubernetesContentAreaXRatio,
+			Y:      bounds.Y + bounds.Height*components.KubernetesContentAreaYRatio,
+			Width:  bounds.Width * components.KubernetesContentAreaWidthRatio,
+			Height: bounds.Height * components.KubernetesContentAreaHeightRatio,
+		}, true
+	}
+	return Rect{}, false
+}
 
-		// Update the nodeIndex with the modified shape
-		if updated {
-			nodeIndex[componentName] = shape
-		}
-	}
+// contentArea returns the area of the container shape of type typeName its children are
+// placed in.
+func contentArea(typeName string, shape components.Shape) Rect {
+	area, _ := ContentArea(typeName, Rect{X: shape.X, Y: shape.Y, Width: shape.Width, Height: shape.Height})
+	return area
+}
+
+// vmContentArea returns the area of vm its children are placed in.
+func vmContentArea(vm components.Shape) Rect {
+	return contentArea(componentTypeVM, vm)
 }
 
 func syncComponentGeometry(children []components.Component, nodeIndex map[string]components.Shape) {
@@ -306,6 +484,9 @@ func syncComponentGeometry(children []components.Component, nodeIndex map[string
 			if shape, ok := nodeIndex[comp.Text]; ok {
 				applyResolvedShape(&comp.Shape, shape)
 			}
+		case *components.Cluster, *components.Namespace, *components.Deployment, *components.Pod, *components.Service,
+			*components.Ingress, *components.ConfigMap, *components.Secret, *components.PersistentVolume:
+			syncContainerChildren([]components.Component{comp}, Point{}, nodeIndex)
 		}
 	}
 }
@@ -392,93 +573,128 @@ func syncVMChildGeometry(vm *components.VM, nodeIndex map[string]components.Shap
 
 // Calculate computes the layout for an AST
 func Calculate(node parser.Node, canvasWidth, canvasHeight float64) Layout {
-	boundsWidth, boundsHeight := calculateCanvasBounds(node, canvasWidth, canvasHeight)
+	var warn warnings
+	area := calculateCanvas(node, canvasWidth, canvasHeight, &warn)
 	nodeIndex := make(map[string]components.Shape)
 
 	children := make([]components.Component, 0, len(node.Children))
 	for _, child := range node.Children {
-		children = append(children, buildComponentTree(child, nodeIndex)...)
+		children = append(children, buildComponentTree(child, nodeIndex, &warn)...)
 	}
 
-	// Resolve alignment references after all components are positioned
-	resolveAlignmentReferences(nodeIndex)
+	// Resolve geometry expressions after all components are positioned
+	parents, kinds := containerParents(node)
+	resolveGeometry(nodeIndex, parents, kinds, area, &warn)
 	syncComponentGeometry(children, nodeIndex)
 
-	arrows := resolveConnections(node.Connections, nodeIndex)
+	arrows := resolveConnections(node.Connections, nodeIndex, selectorAnchors(children), &warn)
 	if len(arrows) > 0 {
 		children = append(children, buildArrowComponents(arrows)...)
 	}
 
 	return Layout{
-		Bounds: Rect{
-			X:      defaultComponentX,
-			Y:      defaultComponentY,
-			Width:  boundsWidth,
-			Height: boundsHeight,
-		},
+		Bounds:      area.Rect,
 		Children:    children,
 		NodeIndex:   nodeIndex,
 		Connections: arrows,
+		Warnings:    warn,
 	}
 }
 
-func calculateCanvasBounds(node parser.Node, defaultWidth, defaultHeight float64) (float64, float64) {
-	boundsWidth := defaultWidth
-	boundsHeight := defaultHeight
+// canvas is the area a diagram is laid out on, and the size of its grid units.
+type canvas struct {
+	Rect
+	column, row float64
+}
 
-	layoutState, ok := node.Globals["layout"]
-	if !ok {
-		return boundsWidth, boundsHeight
+func calculateCanvas(node parser.Node, defaultWidth, defaultHeight float64, warn *warnings) canvas {
+	var settings canvasProps
+	props.SetDefaults(&settings)
+
+	if layoutState, ok := node.Globals["layout"]; ok {
+		checkProps(Warning{State: "layout"}, layoutState.PropsDef, warn, canvasProps{})
+		var parsed canvasProps
+		props.SetDefaults(&parsed)
+		if err := props.ParseProps(layoutState.PropsDef, &parsed); err != nil {
+			fmt.Printf("failed to parse @layout props: %v\n", err)
+			warnProps(Warning{State: "layout"}, "@layout ignored", err, warn)
+		} else if parsed.Columns <= 0 || parsed.Rows < 0 {
+			warn.add(Warning{State: "layout", Message: "@layout ignored: cols must be positive and rows must not be negative"})
+		} else {
+			settings = parsed
+		}
 	}
 
-	geometry, err := parseGeometryProps(layoutState.PropsDef)
-	if err != nil {
-		fmt.Printf("failed to parse @layout props: %v\n", err)
-		return boundsWidth, boundsHeight
+	area := canvas{Rect: Rect{X: defaultComponentX, Y: defaultComponentY, Width: defaultWidth, Height: defaultHeight}}
+	if settings.Width != nil {
+		area.Width = *settings.Width
 	}
-
-	if geometry.Width != nil {
-		boundsWidth = float64(*geometry.Width)
+	if settings.Height != nil {
+		area.Height = *settings.Height
 	}
-	if geometry.Height != nil {
-		boundsHeight = float64(*geometry.Height)
+	area.column = area.Width / float64(settings.Columns)
+	area.row = area.column
+	if settings.Rows > 0 {
+		area.row = area.Height / float64(settings.Rows)
 	}
-
-	return boundsWidth, boundsHeight
+	return area
 }
 
-func buildComponentTree(node parser.Node, nodeIndex map[string]components.Shape) []components.Component {
+func buildComponentTree(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) []components.Component {
+	if len(node.Children) > 0 && !IsContainerType(string(node.Type)) {
+		warn.add(Warning{Node: node.Text, Message: fmt.Sprintf("children of %s are not drawn: only VM, Cluster and Namespace containers draw children", node.Text)})
+	}
+
 	switch string(node.Type) {
 	case componentTypeBrowser:
-		return []components.Component{buildBrowser(node, nodeIndex)}
+		return []components.Component{buildBrowser(node, nodeIndex, warn)}
 	case componentTypeVM:
-		return []components.Component{buildVM(node, nodeIndex)}
+		return []components.Component{buildVM(node, nodeIndex, warn)}
 	case componentTypeServer:
-		return []components.Component{buildServer(node, nil, nodeIndex)}
+		return []components.Component{buildServer(node, nil, nodeIndex, warn)}
 	case componentTypeTerminal:
-		return []components.Component{buildTerminal(node, nil, nodeIndex)}
+		return []components.Component{buildTerminal(node, nil, nodeIndex, warn)}
 	case componentTypeDatabase:
-		return []components.Component{buildDatabase(node, nil, nodeIndex)}
+		return []components.Component{buildDatabase(node, nil, nodeIndex, warn)}
 	case componentTypeMessageQueue, componentTypeQueue:
-		return []components.Component{buildMessageQueue(node, nil, nodeIndex)}
+		return []components.Component{buildMessageQueue(node, nil, nodeIndex, warn)}
 	case componentTypeCDN, componentTypeEdge:
-		return []components.Component{buildCDN(node, nil, nodeIndex)}
+		return []components.Component{buildCDN(node, nil, nodeIndex, warn)}
 	case componentTypeAPIGateway:
-		return []components.Component{buildAPIGateway(node, nil, nodeIndex)}
+		return []components.Component{buildAPIGateway(node, nil, nodeIndex, warn)}
 	case componentTypeBackgroundWorker:
-		return []components.Component{buildBackgroundWorker(node, nil, nodeIndex)}
+		return []components.Component{buildBackgroundWorker(node, nil, nodeIndex, warn)}
 	case componentTypePackage:
-		return []components.Component{buildPackage(node, nil, nodeIndex)}
+		return []components.Component{buildPackage(node, nil, nodeIndex, warn)}
 	case componentTypeArtifact, componentTypeFile:
-		return []components.Component{buildArtifact(node, nil, nodeIndex)}
-	case componentTypeRectangle:
-		return []components.Component{buildRectangle(node, nil, nodeIndex)}
+		return []components.Component{buildArtifact(node, nil, nodeIndex, warn)}
+	case componentTypeCluster:
+		return []components.Component{buildCluster(node, nodeIndex, warn)}
+	case componentTypeNamespace:
+		return []components.Component{buildNamespace(node, nodeIndex, warn)}
+	case componentTypeDeployment:
+		return []components.Component{buildDeployment(node, nodeIndex, warn)}
+	case componentTypePod:
+		return []components.Component{buildPod(node, nodeIndex, warn)}
+	case componentTypeService:
+		return []components.Component{buildService(node, nodeIndex, warn)}
+	case componentTypeIngress:
+		return []components.Component{buildIngress(node, nodeIndex, warn)}
+	case componentTypeConfigMap:
+		return []components.Component{buildConfigMap(node, nodeIndex, warn)}
+	case componentTypeSecret:
+		return []components.Component{buildSecret(node, nodeIndex, warn)}
+	case componentTypePersistentVolume:
+		return []components.Component{buildPersistentVolume(node, nodeIndex, warn)}
+	case componentTypeRectangle, string(parser.NODE_ELEMENT), string(parser.NODE_CONTAINER):
+		return []components.Component{buildRectangle(node, nil, nodeIndex, warn)}
 	default:
-		return []components.Component{buildRectangle(node, nil, nodeIndex)}
+		warn.add(Warning{Node: node.Text, Message: fmt.Sprintf("unknown type %s for %s, drawn as a Rectangle", node.Type, node.Text)})
+		return []components.Component{buildRectangle(node, nil, nodeIndex, warn)}
 	}
 }
 
-func buildBrowser(node parser.Node, nodeIndex map[string]components.Shape) components.Component {
+func buildBrowser(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) components.Component {
 	browser := components.NewBrowser()
 	browser.Text = node.Text
 	browser.Shape = components.Shape{
@@ -488,15 +704,14 @@ func buildBrowser(node parser.Node, nodeIndex map[string]components.Shape) compo
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &browser.Shape, &browser.Props, node.Text)
-	browser.State = applyNamedStateProperties(node, &browser.Shape, &browser.Props, false)
+	browser.State = applyStates(node, &browser.Shape, &browser.Props, false, warn)
 
 	nodeIndex[node.Text] = browser.Shape
 	fmt.Printf("State: %s, Props: %+v\n", browser.State, browser.Props)
 	return browser
 }
 
-func buildVM(node parser.Node, nodeIndex map[string]components.Shape) components.Component {
+func buildVM(node parser.Node, nodeIndex map[string]components.Shape, warn *warnings) components.Component {
 	vm := components.NewVM()
 	vm.Text = node.Text
 	vm.Shape = components.Shape{
@@ -506,16 +721,15 @@ func buildVM(node parser.Node, nodeIndex map[string]components.Shape) components
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &vm.Shape, &vm.Props, node.Text)
-	vm.State = applyNamedStateProperties(node, &vm.Shape, &vm.Props, false)
+	vm.State = applyStates(node, &vm.Shape, &vm.Props, false, warn)
 
-	layoutVMChildren(node, vm, nodeIndex)
+	layoutVMChildren(node, vm, nodeIndex, warn)
 	nodeIndex[node.Text] = vm.Shape
 	fmt.Printf("State: %s, Props: %+v\n", vm.State, vm.Props)
 	return vm
 }
 
-func layoutVMChildren(parent parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) {
+func layoutVMChildren(parent parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) {
 	if len(parent.Children) == 0 {
 		return
 	}
@@ -523,47 +737,48 @@ func layoutVMChildren(parent parser.Node, vm *components.VM, nodeIndex map[strin
 	for _, child := range parent.Children {
 		switch string(child.Type) {
 		case componentTypeServer:
-			server := buildServer(child, vm, nodeIndex)
+			server := buildServer(child, vm, nodeIndex, warn)
 			vm.AddChild(server)
 		case componentTypeTerminal:
-			terminal := buildTerminal(child, vm, nodeIndex)
+			terminal := buildTerminal(child, vm, nodeIndex, warn)
 			vm.AddChild(terminal)
 		case componentTypeDatabase:
-			database := buildDatabase(child, vm, nodeIndex)
+			database := buildDatabase(child, vm, nodeIndex, warn)
 			vm.AddChild(database)
 		case componentTypeMessageQueue, componentTypeQueue:
-			queue := buildMessageQueue(child, vm, nodeIndex)
+			queue := buildMessageQueue(child, vm, nodeIndex, warn)
 			vm.AddChild(queue)
 		case componentTypeCDN, componentTypeEdge:
-			cdn := buildCDN(child, vm, nodeIndex)
+			cdn := buildCDN(child, vm, nodeIndex, warn)
 			vm.AddChild(cdn)
 		case componentTypeAPIGateway:
-			gateway := buildAPIGateway(child, vm, nodeIndex)
+			gateway := buildAPIGateway(child, vm, nodeIndex, warn)
 			vm.AddChild(gateway)
 		case componentTypeBackgroundWorker:
-			worker := buildBackgroundWorker(child, vm, nodeIndex)
+			worker := buildBackgroundWorker(child, vm, nodeIndex, warn)
 			vm.AddChild(worker)
 		case componentTypePackage:
-			pkg := buildPackage(child, vm, nodeIndex)
+			pkg := buildPackage(child, vm, nodeIndex, warn)
 			vm.AddChild(pkg)
 		case componentTypeArtifact, componentTypeFile:
-			artifact := buildArtifact(child, vm, nodeIndex)
+			artifact := buildArtifact(child, vm, nodeIndex, warn)
 			vm.AddChild(artifact)
 		case componentTypeRectangle:
-			rect := buildRectangle(child, vm, nodeIndex)
+			rect := buildRectangle(child, vm, nodeIndex, warn)
 			vm.AddChild(rect)
 		default:
 			if child.Type == parser.NODE_ELEMENT {
-				rect := buildRectangle(child, vm, nodeIndex)
+				rect := buildRectangle(child, vm, nodeIndex, warn)
 				vm.AddChild(rect)
 				continue
 			}
 			fmt.Printf("Unknown child type: %s\n", child.Type)
+			warn.add(Warning{Node: child.Text, Message: fmt.Sprintf("%s of type %s is not drawn: VMs cannot contain it", child.Text, child.Type)})
 		}
 	}
 }
 
-func buildServer(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) *components.Server {
+func buildServer(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) *components.Server {
 	server := components.NewServer(node.Text)
 	server.Shape = components.Shape{
 		Width:  defaultServerWidth,
@@ -572,8 +787,7 @@ func buildServer(node parser.Node, vm *components.VM, nodeIndex map[string]compo
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &server.Shape, &server.Props, node.Text)
-	server.State = applyNamedStateProperties(node, &server.Shape, &server.Props, true)
+	server.State = applyStates(node, &server.Shape, &server.Props, true, warn)
 
 	absServerShape := server.Shape
 	if vm != nil {
@@ -587,7 +801,7 @@ func buildServer(node parser.Node, vm *components.VM, nodeIndex map[string]compo
 	return server
 }
 
-func buildTerminal(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) *components.Terminal {
+func buildTerminal(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) *components.Terminal {
 	terminal := components.NewTerminal(node.Text)
 	terminal.Shape = components.Shape{
 		Width:  defaultTerminalWidth,
@@ -596,8 +810,7 @@ func buildTerminal(node parser.Node, vm *components.VM, nodeIndex map[string]com
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &terminal.Shape, &terminal.Props, node.Text)
-	terminal.State = applyNamedStateProperties(node, &terminal.Shape, &terminal.Props, true)
+	terminal.State = applyStates(node, &terminal.Shape, &terminal.Props, true, warn)
 
 	absShape := terminal.Shape
 	if vm != nil {
@@ -611,7 +824,7 @@ func buildTerminal(node parser.Node, vm *components.VM, nodeIndex map[string]com
 	return terminal
 }
 
-func buildDatabase(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) *components.Database {
+func buildDatabase(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) *components.Database {
 	database := components.NewDatabase(node.Text)
 	database.Shape = components.Shape{
 		Width:  defaultDatabaseWidth,
@@ -620,8 +833,7 @@ func buildDatabase(node parser.Node, vm *components.VM, nodeIndex map[string]com
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &database.Shape, &database.Props, node.Text)
-	database.State = applyNamedStateProperties(node, &database.Shape, &database.Props, true)
+	database.State = applyStates(node, &database.Shape, &database.Props, true, warn)
 
 	absShape := database.Shape
 	if vm != nil {
@@ -635,7 +847,7 @@ func buildDatabase(node parser.Node, vm *components.VM, nodeIndex map[string]com
 	return database
 }
 
-func buildMessageQueue(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) *components.MessageQueue {
+func buildMessageQueue(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) *components.MessageQueue {
 	queue := components.NewMessageQueue(node.Text)
 	queue.Shape = components.Shape{
 		Width:  defaultQueueWidth,
@@ -644,8 +856,7 @@ func buildMessageQueue(node parser.Node, vm *components.VM, nodeIndex map[string
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &queue.Shape, &queue.Props, node.Text)
-	queue.State = applyNamedStateProperties(node, &queue.Shape, &queue.Props, true)
+	queue.State = applyStates(node, &queue.Shape, &queue.Props, true, warn)
 
 	absShape := queue.Shape
 	if vm != nil {
@@ -659,7 +870,7 @@ func buildMessageQueue(node parser.Node, vm *components.VM, nodeIndex map[string
 	return queue
 }
 
-func buildCDN(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) *components.CDN {
+func buildCDN(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) *components.CDN {
 	cdn := components.NewCDN(node.Text)
 	cdn.Shape = components.Shape{
 		Width:  defaultCDNWidth,
@@ -668,8 +879,7 @@ func buildCDN(node parser.Node, vm *components.VM, nodeIndex map[string]componen
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &cdn.Shape, &cdn.Props, node.Text)
-	cdn.State = applyNamedStateProperties(node, &cdn.Shape, &cdn.Props, true)
+	cdn.State = applyStates(node, &cdn.Shape, &cdn.Props, true, warn)
 
 	absShape := cdn.Shape
 	if vm != nil {
@@ -683,7 +893,7 @@ func buildCDN(node parser.Node, vm *components.VM, nodeIndex map[string]componen
 	return cdn
 }
 
-func buildAPIGateway(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) *components.APIGateway {
+func buildAPIGateway(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) *components.APIGateway {
 	gateway := components.NewAPIGateway(node.Text)
 	gateway.Shape = components.Shape{
 		Width:  defaultAPIGatewayWidth,
@@ -692,8 +902,7 @@ func buildAPIGateway(node parser.Node, vm *components.VM, nodeIndex map[string]c
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &gateway.Shape, &gateway.Props, node.Text)
-	gateway.State = applyNamedStateProperties(node, &gateway.Shape, &gateway.Props, true)
+	gateway.State = applyStates(node, &gateway.Shape, &gateway.Props, true, warn)
 
 	absShape := gateway.Shape
 	if vm != nil {
@@ -707,7 +916,7 @@ func buildAPIGateway(node parser.Node, vm *components.VM, nodeIndex map[string]c
 	return gateway
 }
 
-func buildBackgroundWorker(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) *components.BackgroundWorker {
+func buildBackgroundWorker(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) *components.BackgroundWorker {
 	worker := components.NewBackgroundWorker(node.Text)
 	worker.Shape = components.Shape{
 		Width:  defaultBackgroundWorkerW,
@@ -716,8 +925,7 @@ func buildBackgroundWorker(node parser.Node, vm *components.VM, nodeIndex map[st
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &worker.Shape, &worker.Props, node.Text)
-	worker.State = applyNamedStateProperties(node, &worker.Shape, &worker.Props, true)
+	worker.State = applyStates(node, &worker.Shape, &worker.Props, true, warn)
 
 	absShape := worker.Shape
 	if vm != nil {
@@ -731,7 +939,7 @@ func buildBackgroundWorker(node parser.Node, vm *components.VM, nodeIndex map[st
 	return worker
 }
 
-func buildPackage(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) *components.Package {
+func buildPackage(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) *components.Package {
 	pkg := components.NewPackage(node.Text)
 	pkg.Shape = components.Shape{
 		Width:  defaultPackageWidth,
@@ -740,8 +948,7 @@ func buildPackage(node parser.Node, vm *components.VM, nodeIndex map[string]comp
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &pkg.Shape, &pkg.Props, node.Text)
-	pkg.State = applyNamedStateProperties(node, &pkg.Shape, &pkg.Props, true)
+	pkg.State = applyStates(node, &pkg.Shape, &pkg.Props, true, warn)
 
 	absShape := pkg.Shape
 	if vm != nil {
@@ -755,7 +962,7 @@ func buildPackage(node parser.Node, vm *components.VM, nodeIndex map[string]comp
 	return pkg
 }
 
-func buildArtifact(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) *components.Artifact {
+func buildArtifact(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) *components.Artifact {
 	artifact := components.NewArtifact(node.Text)
 	artifact.Shape = components.Shape{
 		Width:  defaultArtifactWidth,
@@ -764,8 +971,7 @@ func buildArtifact(node parser.Node, vm *components.VM, nodeIndex map[string]com
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &artifact.Shape, &artifact.Props, node.Text)
-	artifact.State = applyNamedStateProperties(node, &artifact.Shape, &artifact.Props, true)
+	artifact.State = applyStates(node, &artifact.Shape, &artifact.Props, true, warn)
 
 	absShape := artifact.Shape
 	if vm != nil {
@@ -779,7 +985,7 @@ func buildArtifact(node parser.Node, vm *components.VM, nodeIndex map[string]com
 	return artifact
 }
 
-func buildRectangle(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape) *components.Rectangle {
+func buildRectangle(node parser.Node, vm *components.VM, nodeIndex map[string]components.Shape, warn *warnings) *components.Rectangle {
 	rect := components.NewRectangle(node.Text)
 	rect.Shape = components.Shape{
 		Width:  defaultServerWidth,
@@ -788,8 +994,7 @@ func buildRectangle(node parser.Node, vm *components.VM, nodeIndex map[string]co
 		Y:      defaultComponentY,
 	}
 
-	applyIDStateProperties(node, &rect.Shape, &rect.Props, node.Text)
-	rect.State = applyNamedStateProperties(node, &rect.Shape, &rect.Props, true)
+	rect.State = applyStates(node, &rect.Shape, &rect.Props, true, warn)
 
 	absRectShape := rect.Shape
 	if vm != nil {
@@ -803,34 +1008,68 @@ func buildRectangle(node parser.Node, vm *components.VM, nodeIndex map[string]co
 	return rect
 }
 
-func applyIDStateProperties(node parser.Node, shape *components.Shape, props propertyParser, componentID string) {
-	idState, ok := node.States[node.Text]
-	if !ok {
-		return
+// applyStates applies the states of a node in cascade order, each overriding the ones
+// before it, and returns the names of the states applied with @:
+//
+//  1. the type state, named after the node's type, as in @Server(...)
+//  2. the id state, named after the node
+//  3. the states applied with @, left to right, as in app:Server@base@highlight
+//
+// Browsers and VMs take their geometry from the type and id states only, unless
+// includeGeometry is set.
+func applyStates(node parser.Node, shape *components.Shape, props propertyParser, includeGeometry bool, warn *warnings) string {
+	if state, ok := node.States[string(node.Type)]; ok && state.Name != node.Text {
+		applyState(node.Text, state, shape, props, true, warn)
+	}
+	if state, ok := node.States[node.Text]; ok {
+		applyState(node.Text, state, shape, props, true, warn)
+	}
+
+	var applied []string
+	for _, name := range node.StateNames() {
+		state, ok := node.States[name]
+		if !ok {
+			continue
+		}
+		if state.Name != node.Text { // The id state has been applied already
+			applyState(fmt.Sprintf("state %s", state.Name), state, shape, props, includeGeometry, warn)
+		}
+		applied = append(applied, state.Name)
 	}
-
-	applyGeometryDefinition(componentID, shape, idState.PropsDef)
-	parseComponentProps(componentID, props, idState.PropsDef)
+	return strings.Join(applied, "@")
 }
 
-func applyNamedStateProperties(node parser.Node, shape *components.Shape, props propertyParser, includeGeometry bool) string {
-	if node.State == "" {
-		return ""
+// applyState applies the geometry, if includeGeometry is set, and the props of one state.
+func applyState(target string, state parser.State, shape *components.Shape, props propertyParser, includeGeometry bool, warn *warnings) {
+	source := Warning{State: state.Name}
+	if includeGeometry {
+		checkProps(source, state.PropsDef, warn, geometryProps{}, props)
+		applyGeometryDefinition(target, shape, state.PropsDef, source, warn)
+	} else {
+		checkProps(source, state.PropsDef, warn, props)
 	}
+	parseComponentProps(target, props, state.PropsDef, source, warn)
+}
 
-	state, ok := node.States[node.State]
-	if !ok {
-		return ""
-	}
+// canvasProps are the props @layout understands.
+type canvasProps struct {
+	Width   *float64 `prop:"w" doc:"Canvas width in pixels"`
+	Height  *float64 `prop:"h" doc:"Canvas height in pixels"`
+	Columns int      `prop:"cols" default:"48" doc:"Columns in the grid the col unit measures"`
+	Rows    int      `prop:"rows" doc:"Rows in the grid the row unit measures; by default rows are as tall as columns are wide"`
+}
 
-	if includeGeometry {
-		applyGeometryDefinition(fmt.Sprintf("state %s", state.Name), shape, state.PropsDef)
+// checkProps reports the props of a state definition that none of targets applies.
+func checkProps(source Warning, propsDef string, warn *warnings, targets ...interface{}) {
+	for _, issue := range props.Check(propsDef, targets...) {
+		warning := source
+		warning.Prop = issue.Key
+		warning.Message = fmt.Sprintf("@%s: %s", source.State, issue.Message)
+		warn.add(warning)
 	}
-	parseComponentProps(fmt.Sprintf("state %s", state.Name), props, state.PropsDef)
-	return state.Name
 }
 
-func applyGeometryDefinition(target string, shape *components.Shape, propsDef string) {
+func applyGeometryDefinition(target string, shape *components.Shape, propsDef string, source Warning, warn *warnings) {
 	if shape == nil {
 		return
 	}
@@ -838,21 +1077,46 @@ func applyGeometryDefinition(target string, shape *components.Shape, propsDef st
 	geometry, err := parseGeometryProps(propsDef)
 	if err != nil {
 		fmt.Printf("failed to parse geometry for %s: %v\n", target, err)
+		warnProps(source, fmt.Sprintf("geometry of @%s ignored", source.State), err, warn)
 		return
 	}
-	// Pass empty nodeIndex for now - alignment resolution will happen later
-	applyGeometryProps(shape, geometry, make(map[string]components.Shape))
+	// Expressions are stored on the shape and resolved once every node is placed
+	applyGeometryProps(shape, geometry)
 }
 
-func parseComponentProps(target string, parser propertyParser, propsDef string) {
+func parseComponentProps(target string, parser propertyParser, propsDef string, source Warning, warn *warnings) {
 	if parser == nil {
 		return
 	}
 	if err := parser.Parse(propsDef); err != nil {
 		fmt.Printf("failed to parse props for %s: %v\n", target, err)
+		warnProps(source, fmt.Sprintf("props of @%s partly ignored", source.State), err, warn)
 	}
 }
 
+// warnProps reports an error of props.ParseProps as one warning per prop that failed,
+// each naming its prop so it is located at the key.
+func warnProps(source Warning, summary string, err error, warn *warnings) {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, err := range errs {
+		warning := source
+		var propErr *props.PropError
+		if errors.As(err, &propErr) {
+			warning.Prop = propErr.Key
+		}
+		warning.Message = fmt.Sprintf("%s: %s", summary, oneLine(err))
+		warn.add(warning)
+	}
+}
+
+// oneLine flattens a multi-line error message for a warning.
+func oneLine(err error) string {
+	return strings.ReplaceAll(err.Error(), "\n", "; ")
+}
+
 func buildArrowComponents(arrows []Arrow) []components.Component {
 	arrowComponents := make([]components.Component, 0, len(arrows))
 	for _, arrow := range arrows {
@@ -872,18 +1136,23 @@ func buildArrowComponents(arrows []Arrow) []components.Component {
 	return arrowComponents
 }
 
-func resolveConnections(connections []parser.Connection, nodeIndex map[string]components.Shape) []Arrow {
+func resolveConnections(connections []parser.Connection, nodeIndex map[string]components.Shape, anchors map[string]map[string]parser.AnchorDescriptor, warn *warnings) []Arrow {
 	arrows := make([]Arrow, 0, len(connections))
 	for _, conn := range connections {
 		fromShape, okFrom := nodeIndex[conn.FromID]
 		toShape, okTo := nodeIndex[conn.ToID]
 		if !okFrom || !okTo {
 			fmt.Printf("connection skipped: missing endpoint %s -> %s\n", conn.FromID, conn.ToID)
+			missing := conn.FromID
+			if okFrom {
+				missing = conn.ToID
+			}
+			warn.add(Warning{From: conn.FromID, To: conn.ToID, Message: fmt.Sprintf("connection %s --> %s skipped: unknown node %s", conn.FromID, conn.ToID, missing)})
 			continue
 		}
 
-		fromAnchor := normalizeAnchor(conn.FromAnchor)
-		toAnchor := normalizeAnchor(conn.ToAnchor)
+		fromAnchor := normalizeAnchor(namedAnchor(anchors, conn.FromID, conn.FromAnchor))
+		toAnchor := normalizeAnchor(namedAnchor(anchors, conn.ToID, conn.ToAnchor))
 		start := computeAnchorPoint(fromShape, fromAnchor)
 		end := computeAnchorPoint(toShape, toAnchor)
 
@@ -214,6 +214,41 @@ func TestCalculateUsesLayoutGlobalOverrides(t *testing.T) {
 	}
 }
 
+func TestCalculateCollectsWarningsForFallbacks(t *testing.T) {
+	source := "a:Servr\nb:Server@b\nvm:VM {\n  web:Browser\n}\na.e --> c.w\n@b(x: 10, prot: 80, junk)\n@layout(w: 900, dpi: 2)"
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	root, err := parser.ParseWithSpans(tokens, spans)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	result := Calculate(root, 800, 400)
+
+	want := []Warning{
+		{State: "layout", Prop: "dpi"},
+		{Node: "a"},
+		{Node: "web"},
+		{State: "b", Prop: "prot"},
+		{State: "b"}, // junk has no key
+		{From: "a", To: "c"},
+	}
+	for _, w := range want {
+		found := false
+		for _, got := range result.Warnings {
+			if got.Node == w.Node && got.State == w.State && got.Prop == w.Prop && got.From == w.From && got.To == w.To {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expected warning %+v, got %+v", w, result.Warnings)
+		}
+	}
+	if len(result.Warnings) != len(want) {
+		t.Fatalf("expected %d warnings, got %+v", len(want), result.Warnings)
+	}
+}
+
 func TestRouteArrowPointsRespectsAnchorPriority(t *testing.T) {
 	start := Point{X: 10, Y: 10}
 	end := Point{X: 110, Y: 80}
@@ -299,7 +334,7 @@ vps:VM@ubuntu {
 	}
 }
 
-func TestApplyNamedStatePropertiesWithGeometry(t *testing.T) {
+func TestApplyStatesWithGeometry(t *testing.T) {
 	shape := &components.Shape{Width: 50, Height: 40, X: 0, Y: 0}
 	props := &stubProps{}
 	node := parser.Node{
@@ -309,7 +344,7 @@ func TestApplyNamedStatePropertiesWithGeometry(t *testing.T) {
 		},
 	}
 
-	stateName := applyNamedStateProperties(node, shape, props, true)
+	stateName := applyStates(node, shape, props, true, nil)
 
 	if stateName != "custom" {
 		t.Fatalf("expected state name 'custom', got %q", stateName)
@@ -324,3 +359,253 @@ func TestApplyNamedStatePropertiesWithGeometry(t *testing.T) {
 		t.Fatalf("expected props parser to be invoked")
 	}
 }
+
+func TestStateCascade(t *testing.T) {
+	source := `a:Server@base@highlight
+b:Server@loud
+web:Browser@wide
+@Server(x: 1, y: 1, w: 100, title: "type")
+@a(x: 2, title: "id")
+@base(x: 3, y: 3, port: 1)
+@highlight(x: 4)
+@loud(extends: [base, highlight], port: 2)
+@Browser(w: 500)
+@wide(w: 900, url: "https://example.com")`
+
+	ast, err := parser.Parse(tokenizer.Tokenize(source))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	l := Calculate(ast, 800, 400)
+
+	servers := make(map[string]*components.Server)
+	for _, child := range l.Children {
+		if server, ok := child.(*components.Server); ok {
+			servers[server.Text] = server
+		}
+	}
+	a, b := servers["a"], servers["b"]
+	if a == nil || b == nil {
+		t.Fatalf("expected servers a and b, got %v", servers)
+	}
+	if a.X != 4 || a.Y != 3 || a.Width != 100 || a.Props.Title != "id" || a.Props.Port != 1 {
+		t.Errorf("expected a to cascade type, id, base then highlight, got %+v %+v", a.Shape, a.Props)
+	}
+	if a.State != "base@highlight" {
+		t.Errorf("expected a's states to be base@highlight, got %q", a.State)
+	}
+	if b.X != 4 || b.Y != 3 || b.Props.Title != "type" || b.Props.Port != 2 {
+		t.Errorf("expected b to inherit base and highlight, got %+v %+v", b.Shape, b.Props)
+	}
+	if web := l.NodeIndex["web"]; web.Width != 500 {
+		t.Errorf("expected the browser to take its width from @Browser but not @wide, got %v", web.Width)
+	}
+	if len(l.Warnings) != 1 || l.Warnings[0].State != "wide" || l.Warnings[0].Prop != "w" {
+		t.Errorf("expected only the width of @wide to be reported, got %+v", l.Warnings)
+	}
+}
+
+func TestGeometryExpressions(t *testing.T) {
+	source := `@layout(w: 800, h: 600, cols: 8)
+
+vps:VM {
+  app:Server
+}
+web:Browser
+db:Database
+
+web.s --> db.n
+
+@vps(x: 50%, y: 20, w: 45%, h: 300)
+@app(x: 10%, y: &parent.t, w: &parent.w - 40)
+@web(x: 1col, y: 20, w: &vps.x - 2col, h: min(300, 50%))
+@db(x: &web.c, y: &web.b + 20, w: max(100, &vps.w / 4))`
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	root, err := parser.ParseWithSpans(tokens, spans)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	result := Calculate(root, 800, 600)
+	if len(result.Warnings) != 0 {
+		t.Fatalf("unexpected warnings %+v", result.Warnings)
+	}
+
+	content := vmContentArea(result.NodeIndex["vps"])
+	want := map[string]components.Shape{
+		"vps": {X: 400, Y: 20, Width: 360, Height: 300},
+		"app": {X: content.X + content.Width*0.1, Y: content.Y, Width: content.Width - 40, Height: defaultServerHeight},
+		"web": {X: 100, Y: 20, Width: 200, Height: 300},
+		"db":  {X: 150, Y: 340, Width: 100, Height: defaultDatabaseHeight}, // Centred under web
+	}
+	for name, w := range want {
+		got := result.NodeIndex[name]
+		if !floatsNearlyEqual(got.X, w.X) || !floatsNearlyEqual(got.Y, w.Y) || !floatsNearlyEqual(got.Width, w.Width) || !floatsNearlyEqual(got.Height, w.Height) {
+			t.Errorf("%s: got %+v, want %+v", name, got, w)
+		}
+	}
+}
+
+func TestGeometryExpressionsReportCyclesAndErrors(t *testing.T) {
+	source := "a:Server\nb:Server\nc:Server\n\na.e --> b.w\n\n@a(x: &b.r + 10)\n@b(x: &a.x)\n@c(y: 3 +, w: 2em)"
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	root, err := parser.ParseWithSpans(tokens, spans)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	result := Calculate(root, 800, 400)
+	want := []Warning{{Node: "c", Prop: "w"}, {Node: "c", Prop: "y"}, {Node: "a"}, {Node: "b"}}
+	if len(result.Warnings) != len(want) {
+		t.Fatalf("expected %d warnings, got %+v", len(want), result.Warnings)
+	}
+	for i, w := range want {
+		if got := result.Warnings[i]; got.Node != w.Node || got.Prop != w.Prop {
+			t.Errorf("warning %d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if a := result.NodeIndex["a"]; a.X != 0 {
+		t.Errorf("expected a to keep its position, got %+v", a)
+	}
+}
+
+func TestKubernetesContainersNest(t *testing.T) {
+	source := `prod:Cluster {
+  shop:Namespace {
+    pods:Pod
+    svc:Service
+  }
+}
+
+svc.web --> pods.n
+
+@prod(x: 10%, y: 20, w: 800, h: 500)
+@shop(x: 10, y: 10, w: 600, h: 400)
+@pods(x: 20, y: 200, replicas: 3)
+@svc(x: 20, y: 20, selector: ["app=web", "app=api"])`
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	root, err := parser.ParseWithSpans(tokens, spans)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	result := Calculate(root, 1000, 600)
+	if len(result.Warnings) != 0 {
+		t.Fatalf("unexpected warnings %+v", result.Warnings)
+	}
+
+	cluster := contentArea(componentTypeCluster, result.NodeIndex["prod"])
+	namespace := contentArea(componentTypeNamespace, result.NodeIndex["shop"])
+	want := map[string]components.Shape{
+		"prod": {X: 100, Y: 20, Width: 800, Height: 500},
+		"shop": {X: cluster.X + 10, Y: cluster.Y + 10, Width: 600, Height: 400},
+		"pods": {X: namespace.X + 20, Y: namespace.Y + 200, Width: defaultPodWidth, Height: defaultPodHeight},
+	}
+	for name, w := range want {
+		got := result.NodeIndex[name]
+		if !floatsNearlyEqual(got.X, w.X) || !floatsNearlyEqual(got.Y, w.Y) || !floatsNearlyEqual(got.Width, w.Width) || !floatsNearlyEqual(got.Height, w.Height) {
+			t.Errorf("%s: got %+v, want %+v", name, got, w)
+		}
+	}
+
+	// Children are drawn relative to their container's content area.
+	prod := result.Children[0].(*components.Cluster)
+	shop := prod.Children[0].(*components.Namespace)
+	pods := shop.Children[0].(*components.Pod)
+	if !floatsNearlyEqual(shop.X, 10) || !floatsNearlyEqual(pods.X, 20) || !floatsNearlyEqual(pods.Y, 200) {
+		t.Errorf("expected drawn positions relative to the content area, got namespace %+v and pod %+v", shop.Shape, pods.Shape)
+	}
+
+	if len(result.Connections) != 1 {
+		t.Fatalf("expected one connection, got %+v", result.Connections)
+	}
+	svc := result.NodeIndex["svc"]
+	start := result.Connections[0].Start
+	if !floatsNearlyEqual(start.X, svc.X+svc.Width/3) || !floatsNearlyEqual(start.Y, svc.Y+svc.Height) {
+		t.Errorf("expected the arrow to start at the web selector anchor, got %+v for service %+v", start, svc)
+	}
+}
+
+func TestContainersNestSeveralLevels(t *testing.T) {
+	source := `prod:Cluster@prod {
+  shop:Namespace@shop {
+    host:VM@host {
+      api:Server@api
+    }
+  }
+}
+@prod(x: 20, y: 20, w: 700, h: 500)
+@shop(x: 20, y: 20, w: 600, h: 400)
+@host(x: 20, y: 20, w: 400, h: 250)
+@api(x: 20, y: 20, w: 160, h: 60)`
+	root, err := parser.Parse(tokenizer.Tokenize(source))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	result := Calculate(root, 800, 600)
+	if len(result.Warnings) != 0 {
+		t.Fatalf("unexpected warnings %+v", result.Warnings)
+	}
+	host := vmContentArea(result.NodeIndex["host"])
+	want := components.Shape{X: host.X + 20, Y: host.Y + 20, Width: 160, Height: 60}
+	if got := result.NodeIndex["api"]; !floatsNearlyEqual(got.X, want.X) || !floatsNearlyEqual(got.Y, want.Y) || got.Width != want.Width || got.Height != want.Height {
+		t.Errorf("expected the server in the content area of its VM at %+v, got %+v", want, got)
+	}
+}
+
+func TestElements(t *testing.T) {
+	source := "q:Queue@q\nvps:VM@vps {\n  db:Database@db\n}\nq.e --> db.w\n@q(x: 10, y: 10, title: \"Jobs\")\n@vps(x: 200, y: 10, w: 300, h: 200)\n@db(x: 10, y: 10)"
+	root, err := parser.Parse(tokenizer.Tokenize(source))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	result := Calculate(root, 800, 400)
+
+	elements := result.Elements()
+	if len(elements) != 3 {
+		t.Fatalf("expected three elements and no arrows, got %+v", elements)
+	}
+	q, vps, db := elements[0], elements[1], elements[2]
+	if q.Type != componentTypeMessageQueue || q.Props.(components.MessageQueueProps).Title != "Jobs" || q.State != "q" {
+		t.Errorf("unexpected queue %+v", q)
+	}
+	if vps.Type != componentTypeVM || vps.Parent != "" || db.Parent != "vps" {
+		t.Errorf("expected db inside vps, got %+v and %+v", vps, db)
+	}
+	if shape := result.NodeIndex["db"]; db.Bounds != (Rect{X: shape.X, Y: shape.Y, Width: shape.Width, Height: shape.Height}) || db.Bounds.X <= vps.Bounds.X {
+		t.Errorf("expected absolute bounds for db, got %+v", db.Bounds)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	source := "q:Queue@q\nvps:VM@vps {\n  db:Database@db\n}\nq.e --> db.w\n@q(x: 10, y: 10, title: \"Jobs\")\n@vps(x: 200, y: 10, w: 300, h: 200)\n@db(x: 10, y: 10)"
+	root, err := parser.Parse(tokenizer.Tokenize(source))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	result := Calculate(root, 800, 400)
+
+	doc := result.Document()
+	if doc.Version != DocumentVersion || doc.Canvas != (DocumentRect{Width: 800, Height: 400}) {
+		t.Fatalf("unexpected header %d %+v", doc.Version, doc.Canvas)
+	}
+	if len(doc.Nodes) != 3 || len(doc.Arrows) != 1 {
+		t.Fatalf("expected three nodes and one arrow, got %+v", doc)
+	}
+	q, db := doc.Nodes[0], doc.Nodes[2]
+	if q.Type != componentTypeMessageQueue || q.Props["title"] != "Jobs" || q.Props["kind"] != "RabbitMQ" || q.Bounds.X != 10 {
+		t.Errorf("unexpected queue %+v", q)
+	}
+	if db.Parent != "vps" || db.Bounds.X <= 200 {
+		t.Errorf("expected db inside vps at absolute bounds, got %+v", db)
+	}
+
+	arrow := doc.Arrows[0]
+	if arrow.From.Node != "q" || arrow.From.Anchor != "e" || arrow.To.Node != "db" || arrow.To.Anchor != "w" || !arrow.MarkerEnd {
+		t.Errorf("unexpected arrow ends %+v", arrow)
+	}
+	if n := len(arrow.Points); n != len(result.Connections[0].BendPoints)+2 || arrow.Points[0] != arrow.From.Point || arrow.Points[n-1] != arrow.To.Point {
+		t.Errorf("expected the points to run from start to end, got %+v", arrow.Points)
+	}
+}
@@ -0,0 +1,278 @@
+// Package lint checks diagrams for mistakes the render pipeline accepts silently, such
+// as connections to unknown nodes, misspelt prop keys and shapes drawn on top of each
+// other. Every rule has an ID, a default severity that Config can override, and an
+// autofix where the intended source is unambiguous.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+// Severity is how much a finding matters. SeverityOff disables a rule.
+type Severity string
+
+const (
+	SeverityOff     Severity = "off"
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+var severityRank = map[Severity]int{SeverityOff: 0, SeverityInfo: 1, SeverityWarning: 2, SeverityError: 3}
+
+// ParseSeverity validates a severity name.
+func ParseSeverity(name string) (Severity, error) {
+	severity := Severity(name)
+	if _, ok := severityRank[severity]; !ok {
+		return "", fmt.Errorf("unknown severity %q (use off, info, warning or error)", name)
+	}
+	return severity, nil
+}
+
+// AtLeast reports whether s is as severe as other.
+func (s Severity) AtLeast(other Severity) bool {
+	return severityRank[s] >= severityRank[other]
+}
+
+// Edit replaces the source in Span with NewText. An empty span inserts.
+type Edit struct {
+	Span    tokenizer.Span `json:"span"`
+	NewText string         `json:"newText"`
+}
+
+// Fix is an autofix for a finding. Its edits are applied together or not at all.
+type Fix struct {
+	Message string `json:"message"`
+	Edits   []Edit `json:"edits"`
+}
+
+// Finding is one problem reported by a rule.
+type Finding struct {
+	Rule     string         `json:"rule"`
+	Severity Severity       `json:"severity"`
+	Message  string         `json:"message"`
+	Span     tokenizer.Span `json:"span"`
+	Fix      *Fix           `json:"fix,omitempty"`
+}
+
+// Config overrides rule severities by rule ID. Rules it does not mention keep their
+// default severity.
+type Config struct {
+	Rules map[string]Severity `json:"rules"`
+}
+
+// LoadConfig reads a JSON config such as {"rules": {"unused-state": "error"}}.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Set overrides the severity of one rule, validating both names.
+func (c *Config) Set(rule string, severity Severity) error {
+	if c.Rules == nil {
+		c.Rules = make(map[string]Severity)
+	}
+	c.Rules[rule] = severity
+	return c.Validate()
+}
+
+// Validate reports unknown rule IDs and severities.
+func (c Config) Validate() error {
+	for id, severity := range c.Rules {
+		if _, ok := lookupRule(id); !ok {
+			return fmt.Errorf("unknown lint rule %q", id)
+		}
+		if _, err := ParseSeverity(string(severity)); err != nil {
+			return fmt.Errorf("rule %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (c Config) severity(rule Rule) Severity {
+	if severity, ok := c.Rules[rule.ID]; ok {
+		return severity
+	}
+	return rule.Severity
+}
+
+// Lint runs every enabled rule over source. Findings are sorted by position. An error
+// is returned only when source does not parse.
+func Lint(source string, cfg Config) ([]Finding, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	m, err := newModel(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, rule := range rules {
+		severity := cfg.severity(rule)
+		if severity == SeverityOff {
+			continue
+		}
+		for _, finding := range rule.check(m) {
+			finding.Rule = rule.ID
+			finding.Severity = severity
+			findings = append(findings, finding)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Span.Start < findings[j].Span.Start
+	})
+	return findings, nil
+}
+
+// ApplyFixes applies the fixes of findings to source and returns the result with the
+// number of fixes applied. A fix whose edits overlap an earlier fix is skipped; running
+// Lint again on the result reports it afresh.
+func ApplyFixes(source string, findings []Finding) (string, int) {
+	type edit struct {
+		Edit
+		order int
+	}
+	var edits []edit
+	var taken []tokenizer.Span
+	applied := 0
+
+	for _, finding := range findings {
+		if finding.Fix == nil || !fixFits(finding.Fix, taken, len(source)) {
+			continue
+		}
+		for _, e := range finding.Fix.Edits {
+			edits = append(edits, edit{Edit: e, order: len(edits)})
+			taken = append(taken, e.Span)
+		}
+		applied++
+	}
+
+	// Apply back to front so earlier offsets stay valid. Inserts at the same offset
+	// keep their finding order.
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].Span.Start != edits[j].Span.Start {
+			return edits[i].Span.Start > edits[j].Span.Start
+		}
+		return edits[i].order > edits[j].order
+	})
+	for _, e := range edits {
+		source = source[:e.Span.Start] + e.NewText + source[e.Span.End:]
+	}
+	return source, applied
+}
+
+func fixFits(fix *Fix, taken []tokenizer.Span, size int) bool {
+	for _, e := range fix.Edits {
+		if e.Span.Start < 0 || e.Span.End > size || e.Span.Start > e.Span.End {
+			return false
+		}
+		for _, span := range taken {
+			if e.Span.Start < span.End && span.Start < e.Span.End {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Autofix lints source and applies autofixes until none are left, returning the fixed source
+// and the number of fixes applied.
+func Autofix(source string, cfg Config) (string, int, error) {
+	total := 0
+	// Each pass applies at least one fix, so this only bounds pathological inputs.
+	for pass := 0; pass < 16; pass++ {
+		findings, err := Lint(source, cfg)
+		if err != nil {
+			return source, total, err
+		}
+		fixed, applied := ApplyFixes(source, findings)
+		if applied == 0 || fixed == source {
+			break
+		}
+		source, total = fixed, total+applied
+	}
+	return source, total, nil
+}
+
+// lineSpan widens span to whole lines when nothing else shares them, so deleting it
+// does not leave a blank line behind.
+func lineSpan(source string, span tokenizer.Span) tokenizer.Span {
+	start := span.Start
+	for start > 0 && (source[start-1] == ' ' || source[start-1] == '\t') {
+		start--
+	}
+	end := span.End
+	for end < len(source) && (source[end] == ' ' || source[end] == '\t' || source[end] == '\r') {
+		end++
+	}
+	if (start > 0 && source[start-1] != '\n') || (end < len(source) && source[end] != '\n') {
+		return span
+	}
+	if end < len(source) {
+		end++
+	} else if start > 0 {
+		start--
+	}
+	return tokenizer.Span{Start: start, End: end}
+}
+
+// closest returns the candidate nearest to name, if exactly one is close enough to be a
+// typo: one edit for short names, two for longer ones.
+func closest(name string, candidates []string) (string, bool) {
+	limit := 1
+	if len(name) > 4 {
+		limit = 2
+	}
+	best, bestDistance, unique := "", limit+1, false
+	for _, candidate := range candidates {
+		d := distance(strings.ToLower(name), strings.ToLower(candidate))
+		switch {
+		case d < bestDistance:
+			best, bestDistance, unique = candidate, d, true
+		case d == bestDistance && candidate != best:
+			unique = false
+		}
+	}
+	return best, unique
+}
+
+// distance is the edit distance between a and b, counting an adjacent transposition as
+// one edit.
+func distance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
@@ -0,0 +1,127 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+)
+
+func rulesOf(findings []Finding) []string {
+	var ids []string
+	for _, finding := range findings {
+		ids = append(ids, finding.Rule)
+	}
+	return ids
+}
+
+func TestRulesReportTheirProblems(t *testing.T) {
+	tests := []struct {
+		rule   string
+		source string
+		at     string // Text the finding should point at
+	}{
+		{rule: "unknown-node", source: "a:Server\nb:Server\na.e --> bb.w", at: "bb"},
+		{rule: "unknown-node", source: "a:Server\nb:Server@s\n@s(y: &c.c)", at: "c"},
+		{rule: "unknown-node", source: "a:Server\nb:Server@s\n@s(w: min(&a.w, &parent.w) - &cc.w)", at: "cc"},
+		{rule: "unknown-prop", source: "a:Server@s\n@s(prot: 80)", at: "prot"},
+		{rule: "unknown-prop", source: "@layout(w: 100, dpi: 2)", at: "dpi"},
+		{rule: "unused-state", source: "a:Server\nb:Server\na.e --> b.w\n@c(x: 1)", at: "@c(x: 1)"},
+		{rule: "unused-state", source: "@a(x: 1)\na:Server", at: "@a(x: 1)"},
+		{rule: "overlapping-shapes", source: "a:Server@p\nb:Server@q\n@p(x: 0, y: 0)\n@q(x: 100, y: 50)", at: "b:Server@q"},
+		{rule: "outside-content-area", source: "vm:VM {\n    app:Server\n}\n@vm(w: 300, h: 200)\n@app(x: 250)", at: "app:Server"},
+		{rule: "outside-content-area", source: "c:Cluster {\n    ns:Namespace {\n        p:Pod\n    }\n}\n@c(w: 800, h: 600)\n@ns(w: 300, h: 200)\n@p(y: 150)", at: "p:Pod"},
+		{rule: "arrow-crosses-shape", source: "a:Server\nm:Server\nc:Server\na.e --> c.w\n@a(x: 0, y: 0)\n@m(x: 300, y: 0)\n@c(x: 600, y: 0)", at: "a.e --> c.w"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			findings, err := Lint(tt.source, Config{})
+			if err != nil {
+				t.Fatalf("lint: %v", err)
+			}
+			for _, finding := range findings {
+				if finding.Rule == tt.rule {
+					if got := tt.source[finding.Span.Start:finding.Span.End]; got != tt.at {
+						t.Fatalf("expected finding at %q, got %q", tt.at, got)
+					}
+					return
+				}
+			}
+			t.Fatalf("expected a %s finding, got %v", tt.rule, rulesOf(findings))
+		})
+	}
+}
+
+func TestCleanDiagramHasNoFindings(t *testing.T) {
+	source := "@layout(w: 900, h: 400)\nweb:Browser@home\nvm:VM {\n    api:Server@api\n}\nweb.e --> api.w\n@home(url: \"https://example.com\")\n@web(x: 0, y: 0, w: 300, h: 200)\n@vm(x: 400, y: 0, w: 400, h: 300)\n@api(x: 20, y: 20, w: 150, h: 80, port: 80)"
+	findings, err := Lint(source, Config{})
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	if len(findings) != 0 {
+		t.Fatalf("expected no findings, got %+v", findings)
+	}
+}
+
+func TestImportedNamesAreNotReported(t *testing.T) {
+	source := "@import \"shared/edge.nagare\" as edge\napi:Server\nedge.cdn.e --> api.w\n@edge.cdn(x: 10)\n@api(x: &edge.cdn.r + 40)"
+	findings, err := Lint(source, Config{})
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	if len(findings) != 0 {
+		t.Fatalf("expected no findings, got %+v", findings)
+	}
+}
+
+func TestConfigOverridesSeverity(t *testing.T) {
+	source := "a:Server@p\n@p(x: 0)\n@c(x: 1)"
+	findings, _ := Lint(source, Config{Rules: map[string]Severity{"unused-state": SeverityError}})
+	if len(findings) != 1 || findings[0].Severity != SeverityError {
+		t.Fatalf("expected one error, got %+v", findings)
+	}
+
+	findings, _ = Lint(source, Config{Rules: map[string]Severity{"unused-state": SeverityOff}})
+	if len(findings) != 0 {
+		t.Fatalf("expected the rule to be disabled, got %+v", findings)
+	}
+
+	if _, err := Lint(source, Config{Rules: map[string]Severity{"no-such-rule": SeverityError}}); err == nil {
+		t.Fatal("expected unknown rule to be rejected")
+	}
+}
+
+func TestAutofix(t *testing.T) {
+	source := "@a(x: 1)\na:Server\nb:Server@s\na.e --> bb.w\n@s(x: 300, titel: \"B\", 5)\n@unused(x: 1)\n"
+	want := "a:Server\nb:Server@s\na.e --> b.w\n@s(x: 300, title: \"B\")\n@a(x: 1)\n"
+
+	fixed, applied, err := Autofix(source, Config{})
+	if err != nil {
+		t.Fatalf("autofix: %v", err)
+	}
+	if fixed != want {
+		t.Fatalf("unexpected result:\n%s\nwant:\n%s", fixed, want)
+	}
+	if applied != 5 {
+		t.Fatalf("expected 5 fixes, got %d", applied)
+	}
+	if findings, _ := Lint(fixed, Config{}); len(findings) != 0 {
+		t.Fatalf("expected fixed source to be clean, got %+v", findings)
+	}
+}
+
+func TestAmbiguousStateIsAnError(t *testing.T) {
+	// Parse reads @b as the state of a, so the props become stray nodes.
+	if _, err := Lint("a:Server\n@b(x: 1)", Config{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestRulesHaveUniqueIDs(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, rule := range Rules() {
+		if seen[rule.ID] || strings.TrimSpace(rule.Summary) == "" {
+			t.Fatalf("rule %q is duplicated or undocumented", rule.ID)
+		}
+		seen[rule.ID] = true
+	}
+}
@@ -0,0 +1,547 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+// Rule is one lint check.
+type Rule struct {
+	ID       string
+	Summary  string
+	Severity Severity // Default severity
+	Fixable  bool     // Whether the rule offers autofixes
+	check    func(m *model) []Finding
+}
+
+// The canvas size used by the render pipeline when @layout does not set one.
+const defaultCanvasWidth, defaultCanvasHeight = 800.0, 400.0
+
+// geometryEpsilon keeps shapes that only touch from counting as overlapping.
+const geometryEpsilon = 0.5
+
+var rules = []Rule{
+	{ID: "unknown-node", Summary: "connections and alignment references must name a declared node", Severity: SeverityError, Fixable: true, check: checkUnknownNodes},
+	{ID: "unknown-prop", Summary: "state props must be understood by the nodes they apply to", Severity: SeverityWarning, Fixable: true, check: checkUnknownProps},
+	{ID: "unused-state", Summary: "state definitions must apply to at least one node", Severity: SeverityWarning, Fixable: true, check: checkUnusedStates},
+	{ID: "overlapping-shapes", Summary: "sibling shapes must not overlap", Severity: SeverityWarning, check: checkOverlaps},
+	{ID: "outside-content-area", Summary: "children of a VM, Cluster or Namespace must fit inside its content area", Severity: SeverityWarning, check: checkContentArea},
+	{ID: "arrow-crosses-shape", Summary: "arrows should not pass through unrelated shapes", Severity: SeverityInfo, check: checkArrowCrossings},
+}
+
+// Rules returns every rule in the order they run.
+func Rules() []Rule {
+	return append([]Rule(nil), rules...)
+}
+
+func lookupRule(id string) (Rule, bool) {
+	for _, rule := range rules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// model is what the rules inspect: the concrete syntax for locations and fixes, and the
+// AST and layout for what the renderer will actually draw.
+type model struct {
+	source  string
+	file    *parser.File
+	ast     parser.Node
+	layout  layout.Layout
+	decls   map[string]parser.Statement // First declaration of each node id
+	order   []string                    // Node ids in declaration order
+	parents map[string]string           // Child id to container id
+}
+
+func newModel(source string) (*model, error) {
+	file, err := parser.ParseFile(source)
+	if err != nil {
+		return nil, err
+	}
+	ast, err := parser.Parse(tokenizer.Tokenize(source))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &model{
+		source:  source,
+		file:    file,
+		ast:     ast,
+		layout:  layout.Calculate(ast, defaultCanvasWidth, defaultCanvasHeight),
+		decls:   make(map[string]parser.Statement),
+		parents: make(map[string]string),
+	}
+	var index func(statements []parser.Statement, parent string)
+	index = func(statements []parser.Statement, parent string) {
+		for _, stmt := range statements {
+			if stmt.Kind != parser.StatementDeclaration {
+				continue
+			}
+			if _, ok := m.decls[stmt.ID]; !ok {
+				m.decls[stmt.ID] = stmt
+				m.order = append(m.order, stmt.ID)
+			}
+			if parent != "" {
+				m.parents[stmt.ID] = parent
+			}
+			index(stmt.Children, stmt.ID)
+		}
+	}
+	index(file.Statements, "")
+	return m, nil
+}
+
+// states returns the state definitions in source order.
+func (m *model) states() []parser.Statement {
+	var states []parser.Statement
+	for _, stmt := range m.file.Statements {
+		if stmt.Kind == parser.StatementState {
+			states = append(states, stmt)
+		}
+	}
+	return states
+}
+
+// nodes returns every AST node, depth first.
+func (m *model) nodes() []parser.Node {
+	var nodes []parser.Node
+	var walk func(children []parser.Node)
+	walk = func(children []parser.Node) {
+		for _, node := range children {
+			nodes = append(nodes, node)
+			walk(node.Children)
+		}
+	}
+	walk(m.ast.Children)
+	return nodes
+}
+
+// unknownNodeFinding reports a reference to id at span, suggesting a declared node with
+// a similar name.
+func (m *model) unknownNodeFinding(id string, span tokenizer.Span, what string) Finding {
+	finding := Finding{Message: fmt.Sprintf("%s references unknown node %q", what, id), Span: span}
+	if suggestion, ok := closest(id, m.order); ok {
+		finding.Message += fmt.Sprintf("; did you mean %q?", suggestion)
+		finding.Fix = &Fix{
+			Message: fmt.Sprintf("replace %s with %s", id, suggestion),
+			Edits:   []Edit{{Span: span, NewText: suggestion}},
+		}
+	}
+	return finding
+}
+
+func checkUnknownNodes(m *model) []Finding {
+	var findings []Finding
+	var walk func(statements []parser.Statement)
+	walk = func(statements []parser.Statement) {
+		for _, stmt := range statements {
+			switch stmt.Kind {
+			case parser.StatementDeclaration:
+				walk(stmt.Children)
+			case parser.StatementConnection:
+				// The layout skips the whole connection when either end is missing.
+				if _, ok := m.decls[stmt.From]; !ok && !m.fromImport(stmt.From) {
+					findings = append(findings, m.unknownNodeFinding(stmt.From, stmt.FromSpan, "connection"))
+				}
+				if _, ok := m.decls[stmt.To]; !ok && !m.fromImport(stmt.To) {
+					findings = append(findings, m.unknownNodeFinding(stmt.To, stmt.ToSpan, "connection"))
+				}
+			case parser.StatementState:
+				for _, prop := range stmt.Props {
+					for _, ref := range m.references(prop) {
+						if _, declared := m.decls[ref.id]; !declared && !reservedRefs[ref.id] && !m.fromImport(ref.id) {
+							findings = append(findings, m.unknownNodeFinding(ref.id, ref.span, fmt.Sprintf("%s of @%s", prop.Key, stmt.Name)))
+						}
+					}
+				}
+			}
+		}
+	}
+	walk(m.file.Statements)
+	return findings
+}
+
+// fromImport reports whether name may be declared by an imported file, which lint does
+// not read.
+func (m *model) fromImport(name string) bool {
+	for _, imp := range m.ast.Imports {
+		if imp.Namespace == "" || strings.HasPrefix(name, imp.Namespace+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// reservedRefs are the frames geometry expressions can refer to besides nodes.
+var reservedRefs = map[string]bool{"parent": true, "canvas": true}
+
+// nodeRef is a node named by an &node.property reference in a prop value.
+type nodeRef struct {
+	id   string
+	span tokenizer.Span
+}
+
+// references returns the nodes a geometry expression such as &api.b + 20 refers to.
+func (m *model) references(prop parser.Prop) []nodeRef {
+	raw := m.source[prop.ValueSpan.Start:prop.ValueSpan.End]
+	var refs []nodeRef
+	for _, ref := range layout.References(raw) {
+		start := prop.ValueSpan.Start + ref.Start
+		refs = append(refs, nodeRef{id: ref.Node, span: tokenizer.Span{Start: start, End: prop.ValueSpan.Start + ref.End}})
+	}
+	return refs
+}
+
+// stateTargets returns the component types each state applies to, as layout reads
+// them: a state reaches the nodes declared before it that are named after it, are
+// declared with its type or apply it with @.
+func (m *model) stateTargets() map[string][]string {
+	targets := make(map[string][]string)
+	for _, node := range m.nodes() {
+		for name := range node.States {
+			targets[name] = append(targets[name], string(node.Type))
+		}
+	}
+	return targets
+}
+
+func checkUnknownProps(m *model) []Finding {
+	targets := m.stateTargets()
+	var findings []Finding
+	for _, stmt := range m.states() {
+		var known []string
+		if stmt.Name == parser.VariablesState {
+			continue // Variables take any name
+		} else if stmt.Name == "layout" {
+			for _, field := range layout.CanvasFields() {
+				known = append(known, field.Key)
+			}
+		} else if types, ok := targets[stmt.Name]; ok {
+			known = knownKeys(types)
+		} else {
+			continue // Unused states are reported by unused-state
+		}
+
+		for i, prop := range stmt.Props {
+			if prop.Key == "" {
+				findings = append(findings, Finding{
+					Message: fmt.Sprintf("value %s in @%s has no key and is ignored", prop.Value, stmt.Name),
+					Span:    prop.Span,
+					Fix:     &Fix{Message: "remove the value", Edits: []Edit{removeProp(stmt, i)}},
+				})
+				continue
+			}
+			if prop.Key == parser.ExtendsKey || contains(known, prop.Key) {
+				continue
+			}
+
+			finding := Finding{
+				Message: fmt.Sprintf("@%s sets unknown prop %q", stmt.Name, prop.Key),
+				Span:    prop.KeySpan,
+			}
+			if suggestion, ok := closest(prop.Key, known); ok {
+				finding.Message += fmt.Sprintf("; did you mean %q?", suggestion)
+				finding.Fix = &Fix{
+					Message: fmt.Sprintf("rename %s to %s", prop.Key, suggestion),
+					Edits:   []Edit{{Span: prop.KeySpan, NewText: suggestion}},
+				}
+			} else {
+				finding.Fix = &Fix{Message: fmt.Sprintf("remove %s", prop.Key), Edits: []Edit{removeProp(stmt, i)}}
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// knownKeys returns the prop keys every one of types accepts.
+func knownKeys(types []string) []string {
+	counts := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, typ := range types {
+		if seen[typ] {
+			continue
+		}
+		seen[typ] = true
+		fields, _ := layout.ComponentFields(typ)
+		for _, field := range fields {
+			counts[field.Key]++
+		}
+	}
+	var keys []string
+	for key, n := range counts {
+		if n == len(seen) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removeProp deletes prop i of a state definition together with one separating comma.
+func removeProp(stmt parser.Statement, i int) Edit {
+	props := stmt.Props
+	span := props[i].Span
+	switch {
+	case i+1 < len(props):
+		span.End = props[i+1].Span.Start
+	case i > 0:
+		span.Start = props[i-1].Span.End
+	}
+	return Edit{Span: span}
+}
+
+func checkUnusedStates(m *model) []Finding {
+	targets := m.stateTargets()
+	var findings []Finding
+	for _, stmt := range m.states() {
+		if stmt.Name == "layout" || stmt.Name == parser.VariablesState || m.fromImport(stmt.Name) {
+			continue
+		}
+		if _, ok := targets[stmt.Name]; ok || m.extended(stmt.Name) {
+			continue
+		}
+
+		text := m.source[stmt.Span.Start:stmt.Span.End]
+		remove := Edit{Span: lineSpan(m.source, stmt.Span)}
+		if _, declared := m.decls[stmt.Name]; declared || m.applied(stmt.Name) || m.typed(stmt.Name) {
+			// States only reach nodes declared before them, so moving it to the end of
+			// the file makes it apply.
+			insert := "\n" + text + "\n"
+			if strings.HasSuffix(m.source, "\n") {
+				insert = text + "\n"
+			}
+			findings = append(findings, Finding{
+				Message: fmt.Sprintf("@%s is defined before the nodes that use it and does not apply to them", stmt.Name),
+				Span:    stmt.Span,
+				Fix: &Fix{
+					Message: fmt.Sprintf("move @%s to the end of the file", stmt.Name),
+					Edits:   []Edit{remove, {Span: tokenizer.Span{Start: len(m.source), End: len(m.source)}, NewText: insert}},
+				},
+			})
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Message: fmt.Sprintf("@%s is not applied to any node", stmt.Name),
+			Span:    stmt.Span,
+			Fix:     &Fix{Message: fmt.Sprintf("remove @%s", stmt.Name), Edits: []Edit{remove}},
+		})
+	}
+	return findings
+}
+
+// applied reports whether any node applies state with @.
+func (m *model) applied(state string) bool {
+	for _, node := range m.nodes() {
+		if contains(node.StateNames(), state) {
+			return true
+		}
+	}
+	return false
+}
+
+// extended reports whether another state extends state.
+func (m *model) extended(state string) bool {
+	for _, stmt := range m.states() {
+		for _, prop := range stmt.Props {
+			if prop.Key != parser.ExtendsKey {
+				continue
+			}
+			for _, name := range strings.Split(strings.Trim(prop.Value, "[]"), ",") {
+				if strings.Trim(strings.TrimSpace(name), `"`) == state {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// typed reports whether any node is declared with type typeName.
+func (m *model) typed(typeName string) bool {
+	for _, node := range m.nodes() {
+		if string(node.Type) == typeName {
+			return true
+		}
+	}
+	return false
+}
+
+// rect returns the absolute bounds of node id as laid out.
+func (m *model) rect(id string) (layout.Rect, bool) {
+	shape, ok := m.layout.NodeIndex[id]
+	if !ok {
+		return layout.Rect{}, false
+	}
+	return layout.Rect{X: shape.X, Y: shape.Y, Width: shape.Width, Height: shape.Height}, true
+}
+
+func overlaps(a, b layout.Rect) bool {
+	return a.X+geometryEpsilon < b.X+b.Width && b.X+geometryEpsilon < a.X+a.Width &&
+		a.Y+geometryEpsilon < b.Y+b.Height && b.Y+geometryEpsilon < a.Y+a.Height
+}
+
+func checkOverlaps(m *model) []Finding {
+	// Shapes overlap their container by design, so only siblings are compared.
+	groups := make(map[string][]string)
+	for _, id := range m.order {
+		groups[m.parents[id]] = append(groups[m.parents[id]], id)
+	}
+
+	var findings []Finding
+	for _, id := range m.order {
+		a, ok := m.rect(id)
+		if !ok {
+			continue
+		}
+		for _, other := range groups[m.parents[id]] {
+			if other == id {
+				break // Report each pair once, at the later declaration
+			}
+			if b, ok := m.rect(other); ok && overlaps(a, b) {
+				findings = append(findings, Finding{
+					Message: fmt.Sprintf("%s overlaps %s", id, other),
+					Span:    m.decls[id].Span,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func checkContentArea(m *model) []Finding {
+	var findings []Finding
+	for _, id := range m.order {
+		parent, ok := m.parents[id]
+		if !ok {
+			continue
+		}
+		container, okParent := m.rect(parent)
+		child, okChild := m.rect(id)
+		if !okParent || !okChild {
+			continue
+		}
+		area, ok := layout.ContentArea(m.decls[parent].Type, container)
+		if !ok {
+			continue
+		}
+		if child.X+geometryEpsilon < area.X || child.Y+geometryEpsilon < area.Y ||
+			child.X+child.Width > area.X+area.Width+geometryEpsilon || child.Y+child.Height > area.Y+area.Height+geometryEpsilon {
+			findings = append(findings, Finding{
+				Message: fmt.Sprintf("%s extends outside the content area of %s (%.0fx%.0f)", id, parent, area.Width, area.Height),
+				Span:    m.decls[id].Span,
+			})
+		}
+	}
+	return findings
+}
+
+func checkArrowCrossings(m *model) []Finding {
+	var connections []parser.Statement
+	for _, stmt := range m.file.Statements {
+		if stmt.Kind == parser.StatementConnection {
+			connections = append(connections, stmt)
+		}
+	}
+
+	var findings []Finding
+	next := 0
+	for _, stmt := range connections {
+		// Layout drops connections with unknown ends, so match arrows up in order.
+		if next >= len(m.layout.Connections) {
+			break
+		}
+		arrow := m.layout.Connections[next]
+		if arrow.FromID != stmt.From || arrow.ToID != stmt.To {
+			continue
+		}
+		next++
+
+		points := append([]layout.Point{arrow.Start}, arrow.BendPoints...)
+		points = append(points, arrow.End)
+		for _, id := range m.order {
+			if m.related(id, arrow.FromID) || m.related(id, arrow.ToID) {
+				continue
+			}
+			rect, ok := m.rect(id)
+			if !ok {
+				continue
+			}
+			for i := 1; i < len(points); i++ {
+				if segmentCrosses(points[i-1], points[i], rect) {
+					findings = append(findings, Finding{
+						Message: fmt.Sprintf("arrow %s --> %s crosses %s", arrow.FromID, arrow.ToID, id),
+						Span:    stmt.Span,
+					})
+					break
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// related reports whether id is endpoint or one of its containers; arrows necessarily
+// touch those.
+func (m *model) related(id, endpoint string) bool {
+	for node := endpoint; node != ""; node = m.parents[node] {
+		if node == id {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentCrosses reports whether the segment from a to b passes through the interior of
+// r, using Liang-Barsky clipping against r shrunk by geometryEpsilon.
+func segmentCrosses(a, b layout.Point, r layout.Rect) bool {
+	minX, maxX := r.X+geometryEpsilon, r.X+r.Width-geometryEpsilon
+	minY, maxY := r.Y+geometryEpsilon, r.Y+r.Height-geometryEpsilon
+	if minX >= maxX || minY >= maxY {
+		return false
+	}
+
+	dx, dy := b.X-a.X, b.Y-a.Y
+	t0, t1 := 0.0, 1.0
+	for _, edge := range [4][2]float64{
+		{-dx, a.X - minX},
+		{dx, maxX - a.X},
+		{-dy, a.Y - minY},
+		{dy, maxY - a.Y},
+	} {
+		p, q := edge[0], edge[1]
+		if p == 0 {
+			if q < 0 {
+				return false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			t0 = max(t0, t)
+		} else {
+			t1 = min(t1, t)
+		}
+		if t0 > t1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,345 @@
+package lsp
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+// symbolKind classifies an identifier occurrence in a document.
+type symbolKind int
+
+const (
+	symbolNode      symbolKind = iota // Node id in a declaration: `app`:Server
+	symbolType                        // Component type in a declaration: app:`Server`
+	symbolStateRef                    // State applied in a declaration: app:Server@`api`
+	symbolStateDef                    // State definition: @`api`(...)
+	symbolNodeRef                     // Node id in a connection or alignment reference
+	symbolAnchor                      // Connection anchor: app.`e`
+	symbolAlignment                   // Alignment edge: &app.`c`
+	symbolPropKey                     // Prop key inside a state definition: @api(`port`: 80)
+)
+
+// symbol is one identifier occurrence with its byte span in the source.
+type symbol struct {
+	Kind  symbolKind
+	Name  string
+	Span  tokenizer.Span
+	State string // For symbolPropKey, the state being defined
+}
+
+// stateBlock is the parenthesised props list of a state definition.
+type stateBlock struct {
+	Name  string
+	Open  int // Offset of (
+	Close int // Offset of ), or len(source) when unclosed
+}
+
+// document is an open text document and what the server knows about it.
+type document struct {
+	URI     string
+	Text    string
+	Symbols []symbol
+	States  []stateBlock
+	Types   map[string]string // Node id to declared type
+	Err     error
+}
+
+// analyze tokenizes and parses text, indexing every identifier it can locate. The index
+// is built from tokens so it stays useful while the document does not parse.
+func analyze(uri, text string) *document {
+	doc := &document{URI: uri, Text: text, Types: make(map[string]string)}
+
+	tokens, spans := tokenizer.TokenizeWithSpans(text)
+	_, doc.Err = parser.ParseWithSpans(tokens, spans)
+
+	add := func(kind symbolKind, i int) {
+		doc.Symbols = append(doc.Symbols, symbol{Kind: kind, Name: tokens[i].Value, Span: spans[i]})
+	}
+	is := func(i int, typ tokenizer.TokenType) bool {
+		return i < len(tokens) && tokens[i].Type == typ
+	}
+
+	for i := 0; i < len(tokens); {
+		switch tokens[i].Type {
+		case tokenizer.AT:
+			if next, ok := parser.ImportEnd(tokens, i); ok {
+				i = next // The path is not a symbol
+				continue
+			}
+			i = doc.indexState(tokens, spans, i)
+		case tokenizer.IDENTIFIER:
+			// Connections mirror parser.tryParseConnection: a.e --> b.w
+			if is(i+1, tokenizer.DOT) && is(i+2, tokenizer.IDENTIFIER) && is(i+3, tokenizer.ARROW) &&
+				is(i+4, tokenizer.IDENTIFIER) && is(i+5, tokenizer.DOT) && is(i+6, tokenizer.IDENTIFIER) {
+				add(symbolNodeRef, i)
+				add(symbolAnchor, i+2)
+				add(symbolNodeRef, i+4)
+				add(symbolAnchor, i+6)
+				i += 7
+				continue
+			}
+
+			add(symbolNode, i)
+			id := tokens[i].Value
+			i++
+			if is(i, tokenizer.COLON) && is(i+1, tokenizer.IDENTIFIER) {
+				add(symbolType, i+1)
+				doc.Types[id] = tokens[i+1].Value
+				i += 2
+			}
+			// Several states, as in @base@highlight, mirror the parser.
+			for n := 0; is(i, tokenizer.AT) && is(i+1, tokenizer.IDENTIFIER); n++ {
+				if _, ok := parser.ImportEnd(tokens, i); ok || n > 0 && is(i+2, tokenizer.LEFT_PAREN) {
+					break // An import or a state definition
+				}
+				add(symbolStateRef, i+1)
+				i += 2
+			}
+		default:
+			i++
+		}
+	}
+	return doc
+}
+
+// indexState indexes a state definition starting at the @ token and returns the index
+// of the first token after it.
+func (d *document) indexState(tokens []tokenizer.Token, spans []tokenizer.Span, at int) int {
+	i := at + 1
+	if i >= len(tokens) || tokens[i].Type != tokenizer.IDENTIFIER {
+		return i
+	}
+	name := tokens[i].Value
+	d.Symbols = append(d.Symbols, symbol{Kind: symbolStateDef, Name: name, Span: spans[i]})
+	i++
+	if i >= len(tokens) || tokens[i].Type != tokenizer.LEFT_PAREN {
+		return i
+	}
+
+	block := stateBlock{Name: name, Open: spans[i].Start, Close: len(d.Text)}
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].Type {
+		case tokenizer.LEFT_PAREN:
+			depth++
+		case tokenizer.RIGHT_PAREN:
+			depth--
+			if depth == 0 {
+				block.Close = spans[i].Start
+				d.States = append(d.States, block)
+				return i + 1
+			}
+		case tokenizer.IDENTIFIER:
+			prev := tokens[i-1].Type
+			if (prev == tokenizer.LEFT_PAREN || prev == tokenizer.COMMA) && i+1 < len(tokens) && tokens[i+1].Type == tokenizer.COLON {
+				d.Symbols = append(d.Symbols, symbol{Kind: symbolPropKey, Name: tokens[i].Value, Span: spans[i], State: name})
+				if tokens[i].Value == parser.ExtendsKey {
+					i = d.indexExtends(tokens, spans, i+2) - 1
+				}
+			}
+		case tokenizer.AMPERSAND:
+			if i+3 < len(tokens) && tokens[i+1].Type == tokenizer.IDENTIFIER && tokens[i+2].Type == tokenizer.DOT && tokens[i+3].Type == tokenizer.IDENTIFIER {
+				d.Symbols = append(d.Symbols,
+					symbol{Kind: symbolNodeRef, Name: tokens[i+1].Value, Span: spans[i+1]},
+					symbol{Kind: symbolAlignment, Name: tokens[i+3].Value, Span: spans[i+3]},
+				)
+				i += 3
+			}
+		}
+	}
+	d.States = append(d.States, block)
+	return i
+}
+
+// indexExtends indexes the state names of an extends value starting at token i, a
+// single name or a list such as [base, loud], and returns the index of the first token
+// after it. The brackets are part of the tokens next to them, and quotes are tokens of
+// their own.
+func (d *document) indexExtends(tokens []tokenizer.Token, spans []tokenizer.Span, i int) int {
+	list := i < len(tokens) && tokens[i].Type == tokenizer.IDENTIFIER && strings.HasPrefix(tokens[i].Value, "[")
+	for ; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.Type == tokenizer.RIGHT_PAREN || tok.Type == tokenizer.COMMA && !list {
+			return i
+		}
+		if tok.Type != tokenizer.IDENTIFIER {
+			continue
+		}
+		value, span := tok.Value, spans[i]
+		closed := strings.HasSuffix(value, "]")
+		if trimmed := strings.TrimPrefix(value, "["); trimmed != value {
+			value, span.Start = trimmed, span.Start+1
+		}
+		if trimmed := strings.TrimSuffix(value, "]"); trimmed != value {
+			value, span.End = trimmed, span.End-1
+		}
+		if value != "" && value != `"` && value != `'` {
+			d.Symbols = append(d.Symbols, symbol{Kind: symbolStateRef, Name: value, Span: span})
+			if !list {
+				return i + 1
+			}
+		}
+		if closed {
+			return i + 1
+		}
+	}
+	return i
+}
+
+// symbolAt returns the symbol whose span contains offset. A cursor just past the end of
+// an identifier still counts, as editors place it there after typing.
+func (d *document) symbolAt(offset int) (symbol, bool) {
+	for _, sym := range d.Symbols {
+		if offset >= sym.Span.Start && offset <= sym.Span.End {
+			return sym, true
+		}
+	}
+	return symbol{}, false
+}
+
+// stateAt returns the state definition whose props list contains offset.
+func (d *document) stateAt(offset int) (stateBlock, bool) {
+	for _, block := range d.States {
+		if offset > block.Open && offset <= block.Close {
+			return block, true
+		}
+	}
+	return stateBlock{}, false
+}
+
+// nodeIDs returns the declared node ids, sorted.
+func (d *document) nodeIDs() []string {
+	return d.names(symbolNode)
+}
+
+// stateNames returns every state name that is defined or applied, sorted.
+func (d *document) stateNames() []string {
+	return d.names(symbolStateDef, symbolStateRef)
+}
+
+func (d *document) names(kinds ...symbolKind) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, sym := range d.Symbols {
+		for _, kind := range kinds {
+			if sym.Kind == kind && !seen[sym.Name] {
+				seen[sym.Name] = true
+				names = append(names, sym.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isNode reports whether name is a declared node id.
+func (d *document) isNode(name string) bool {
+	for _, sym := range d.Symbols {
+		if sym.Kind == symbolNode && sym.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stateTypes returns the component types a state definition applies to: the type of the
+// node it is named after, the type it is named after, or the types of every node that
+// applies it.
+func (d *document) stateTypes(state string) []string {
+	if typ, ok := d.Types[state]; ok {
+		return []string{typ}
+	}
+	if _, ok := layout.LookupComponent(state); ok {
+		return []string{state} // A type state, as in @Server(...)
+	}
+	seen := make(map[string]bool)
+	var types []string
+	var node string
+	for _, sym := range d.Symbols {
+		switch sym.Kind {
+		case symbolNode:
+			node = sym.Name
+		case symbolStateRef:
+			if typ, ok := d.Types[node]; sym.Name == state && ok && !seen[typ] {
+				seen[typ] = true
+				types = append(types, typ)
+			}
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// diagnostics converts the parse error, if any, into LSP diagnostics.
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	if d.Err == nil {
+		return diagnostics
+	}
+
+	span := tokenizer.Span{Start: len(d.Text), End: len(d.Text)}
+	var parseErr *parser.Error
+	if errors.As(d.Err, &parseErr) && parseErr.HasSpan {
+		span = parseErr.Span
+	}
+	return append(diagnostics, Diagnostic{
+		Range:    d.rangeOf(span),
+		Severity: severityError,
+		Source:   "nagare",
+		Message:  d.Err.Error(),
+	})
+}
+
+func (d *document) rangeOf(span tokenizer.Span) Range {
+	return Range{Start: d.position(span.Start), End: d.position(span.End)}
+}
+
+// position converts a byte offset into an LSP position, counting UTF-16 code units.
+func (d *document) position(offset int) Position {
+	if offset > len(d.Text) {
+		offset = len(d.Text)
+	}
+	lineStart := strings.LastIndex(d.Text[:offset], "\n") + 1
+	return Position{
+		Line:      strings.Count(d.Text[:offset], "\n"),
+		Character: utf16Len(d.Text[lineStart:offset]),
+	}
+}
+
+// offset converts an LSP position into a byte offset, clamping to the document.
+func (d *document) offset(pos Position) int {
+	start := 0
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(d.Text[start:], '\n')
+		if next < 0 {
+			return len(d.Text)
+		}
+		start += next + 1
+	}
+
+	units := 0
+	for i, r := range d.Text[start:] {
+		if r == '\n' || units >= pos.Character {
+			return start + i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(d.Text)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
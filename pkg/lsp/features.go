@@ -0,0 +1,360 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/props"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+// anchorDocs documents the connection anchors understood by the layout engine. Any
+// direction may be followed by digits giving a position along the edge, e.g. n25.
+var anchorDocs = map[string]string{
+	"n":  "Top edge, centred",
+	"s":  "Bottom edge, centred",
+	"e":  "Right edge, centred",
+	"w":  "Left edge, centred",
+	"ne": "Top-right corner",
+	"nw": "Top-left corner",
+	"se": "Bottom-right corner",
+	"sw": "Bottom-left corner",
+}
+
+// alignmentDocs documents the properties accepted by &node.property references.
+var alignmentDocs = map[string]string{
+	"c": "Centre of the referenced node. On its own, centres the shape on it",
+	"t": "Top edge of the referenced node. On its own in y, aligns the tops",
+	"b": "Bottom edge of the referenced node. On its own in y, aligns the bottoms",
+	"l": "Left edge of the referenced node. On its own in x, aligns the left edges",
+	"r": "Right edge of the referenced node. On its own in x, aligns the right edges",
+	"x": "Horizontal position of the referenced node",
+	"y": "Vertical position of the referenced node",
+	"w": "Width of the referenced node",
+	"h": "Height of the referenced node",
+}
+
+// canvasState is the reserved state that sizes the canvas.
+const canvasState = "layout"
+
+func markdown(value string) *MarkupContent {
+	return &MarkupContent{Kind: "markdown", Value: value}
+}
+
+// completion returns the items valid at offset. The context is decided by the
+// character in front of the identifier being typed.
+func (d *document) completion(offset int) []CompletionItem {
+	start := offset
+	for start > 0 && isIdentByte(d.Text[start-1]) {
+		start--
+	}
+	before := strings.TrimRight(d.Text[:start], " \t")
+	trigger := byte(0)
+	if before != "" {
+		trigger = before[len(before)-1]
+	}
+
+	if block, ok := d.stateAt(offset); ok {
+		switch trigger {
+		case '(', ',':
+			return d.propCompletions(block.Name)
+		case '&':
+			return d.nodeCompletions()
+		case '.':
+			return simpleCompletions(alignmentDocs, completionKindEnumMem)
+		}
+		return nil
+	}
+
+	switch trigger {
+	case ':':
+		return typeCompletions()
+	case '@':
+		return d.stateCompletions(lineStart(before))
+	case '.':
+		return simpleCompletions(anchorDocs, completionKindEnumMem)
+	case '>', '\n', 0:
+		return d.nodeCompletions()
+	}
+	return nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// lineStart reports whether text ends with only whitespace and @ on its last line,
+// where @ begins a state definition rather than applying a state to a node.
+func lineStart(text string) bool {
+	line := text[strings.LastIndex(text, "\n")+1:]
+	return strings.TrimSpace(line) == "@"
+}
+
+func typeCompletions() []CompletionItem {
+	var items []CompletionItem
+	for _, name := range layout.ComponentTypes() {
+		fields, _ := layout.ComponentFields(name)
+		items = append(items, CompletionItem{
+			Label:         name,
+			Kind:          completionKindClass,
+			Detail:        "component",
+			Documentation: markdown(fieldTable(fields)),
+		})
+	}
+	return items
+}
+
+func (d *document) stateCompletions(definition bool) []CompletionItem {
+	var items []CompletionItem
+	seen := make(map[string]bool)
+	addItem := func(name, detail string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		items = append(items, CompletionItem{Label: name, Kind: completionKindVariable, Detail: detail})
+	}
+
+	for _, name := range d.stateNames() {
+		addItem(name, "state")
+	}
+	if definition {
+		addItem(canvasState, "canvas size")
+		addItem(parser.VariablesState, "variables")
+		addItem(parser.ImportKeyword, "import a file")
+		for _, id := range d.nodeIDs() {
+			addItem(id, "node "+d.Types[id])
+		}
+	}
+	return items
+}
+
+func (d *document) nodeCompletions() []CompletionItem {
+	var items []CompletionItem
+	for _, id := range d.nodeIDs() {
+		items = append(items, CompletionItem{Label: id, Kind: completionKindVariable, Detail: d.Types[id]})
+	}
+	return items
+}
+
+// propFields returns the props a state definition accepts, merged across every
+// component type it applies to. States that apply to nothing yet offer every prop.
+func (d *document) propFields(state string) []props.Field {
+	if state == canvasState {
+		return layout.CanvasFields()
+	}
+	if state == parser.VariablesState {
+		return nil // Variables take any name
+	}
+
+	types := d.stateTypes(state)
+	if len(types) == 0 {
+		types = layout.ComponentTypes()
+	}
+	seen := make(map[string]bool)
+	var fields []props.Field
+	for _, typ := range types {
+		typeFields, _ := layout.ComponentFields(typ)
+		for _, field := range typeFields {
+			if !seen[field.Key] {
+				seen[field.Key] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+func (d *document) propCompletions(state string) []CompletionItem {
+	var items []CompletionItem
+	for _, field := range d.propFields(state) {
+		items = append(items, CompletionItem{
+			Label:         field.Key,
+			Kind:          completionKindField,
+			Detail:        field.Type,
+			Documentation: markdown(field.Doc),
+			InsertText:    field.Key + ": ",
+		})
+	}
+	return items
+}
+
+func simpleCompletions(docs map[string]string, kind int) []CompletionItem {
+	names := make([]string, 0, len(docs))
+	for name := range docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]CompletionItem, 0, len(names))
+	for _, name := range names {
+		items = append(items, CompletionItem{Label: name, Kind: kind, Detail: docs[name]})
+	}
+	return items
+}
+
+// fieldValues describes the accepted values and default of field, if it declares them.
+func fieldValues(field props.Field) string {
+	var b strings.Builder
+	if len(field.Enum) > 0 {
+		fmt.Fprintf(&b, "\n\nOne of: `%s`", strings.Join(field.Enum, "`, `"))
+	}
+	if field.Default != "" {
+		fmt.Fprintf(&b, "\n\nDefault: `%s`", field.Default)
+	}
+	return b.String()
+}
+
+func fieldTable(fields []props.Field) string {
+	var b strings.Builder
+	b.WriteString("| Prop | Type | Description |\n|---|---|---|\n")
+	for _, field := range fields {
+		fmt.Fprintf(&b, "| `%s` | %s | %s |\n", field.Key, field.Type, field.Doc)
+	}
+	return b.String()
+}
+
+// hover describes the symbol at offset.
+func (d *document) hover(offset int) *Hover {
+	sym, ok := d.symbolAt(offset)
+	if !ok {
+		return nil
+	}
+
+	var text string
+	switch sym.Kind {
+	case symbolPropKey:
+		for _, field := range d.propFields(sym.State) {
+			if field.Key == sym.Name {
+				text = fmt.Sprintf("**%s** `%s`\n\n%s%s", field.Key, field.Type, field.Doc, fieldValues(field))
+			}
+		}
+		if text == "" {
+			text = fmt.Sprintf("**%s**\n\nUnknown prop for `@%s`.", sym.Name, sym.State)
+		}
+	case symbolType:
+		fields, known := layout.ComponentFields(sym.Name)
+		if known {
+			text = fmt.Sprintf("**%s** component\n\n%s", sym.Name, fieldTable(fields))
+		} else {
+			text = fmt.Sprintf("**%s** is not a known component and is drawn as a Rectangle.\n\n%s", sym.Name, fieldTable(fields))
+		}
+	case symbolNode, symbolNodeRef:
+		if typ, ok := d.Types[sym.Name]; ok {
+			text = fmt.Sprintf("`%s`: %s", sym.Name, typ)
+		} else {
+			text = fmt.Sprintf("`%s`", sym.Name)
+		}
+	case symbolStateRef, symbolStateDef:
+		text = fmt.Sprintf("state `@%s`", sym.Name)
+		if types := d.stateTypes(sym.Name); len(types) > 0 {
+			text += " applied to " + strings.Join(types, ", ")
+		}
+	case symbolAnchor:
+		text = anchorDocs[strings.ToLower(strings.TrimRight(sym.Name, "0123456789"))]
+	case symbolAlignment:
+		text = alignmentDocs[sym.Name]
+	}
+	if text == "" {
+		return nil
+	}
+
+	r := d.rangeOf(sym.Span)
+	return &Hover{Contents: *markdown(text), Range: &r}
+}
+
+// definition resolves the symbol at offset: states applied to a node jump to their
+// definitions, and node references jump to the node declaration.
+func (d *document) definition(offset int) []Location {
+	sym, ok := d.symbolAt(offset)
+	if !ok {
+		return nil
+	}
+
+	var target []symbolKind
+	switch sym.Kind {
+	case symbolStateRef:
+		target = []symbolKind{symbolStateDef}
+	case symbolNodeRef:
+		target = []symbolKind{symbolNode}
+	case symbolStateDef:
+		if d.isNode(sym.Name) {
+			target = []symbolKind{symbolNode}
+		} else {
+			target = []symbolKind{symbolStateDef}
+		}
+	default:
+		return nil
+	}
+
+	var locations []Location
+	for _, candidate := range d.Symbols {
+		for _, kind := range target {
+			if candidate.Kind == kind && candidate.Name == sym.Name {
+				locations = append(locations, Location{URI: d.URI, Range: d.rangeOf(candidate.Span)})
+			}
+		}
+	}
+	return locations
+}
+
+// renameTarget returns the symbol at offset when it can be renamed, and the kinds of
+// symbol that share its name. A state named after a node applies to that node, so
+// renaming either renames both.
+func (d *document) renameTarget(offset int) (symbol, map[symbolKind]bool, bool) {
+	sym, ok := d.symbolAt(offset)
+	if !ok || sym.Name == canvasState || sym.Name == parser.VariablesState {
+		return sym, nil, false
+	}
+
+	switch sym.Kind {
+	case symbolNode, symbolNodeRef, symbolStateDef, symbolStateRef:
+	default:
+		return sym, nil, false
+	}
+	if d.isNode(sym.Name) {
+		return sym, map[symbolKind]bool{symbolNode: true, symbolNodeRef: true, symbolStateDef: true, symbolStateRef: true}, true
+	}
+	return sym, map[symbolKind]bool{symbolStateRef: true, symbolStateDef: true}, true
+}
+
+// rename renames the node or state at offset across declarations, connections,
+// alignment references and state definitions.
+func (d *document) rename(offset int, newName string) (*WorkspaceEdit, error) {
+	if newName == "" || strings.IndexFunc(newName, func(r rune) bool { return r > 0x7f || !isIdentByte(byte(r)) }) >= 0 {
+		return nil, fmt.Errorf("%q is not a valid identifier", newName)
+	}
+	if newName == canvasState || newName == parser.VariablesState {
+		return nil, fmt.Errorf("%q is reserved", newName)
+	}
+
+	sym, kinds, ok := d.renameTarget(offset)
+	if !ok {
+		return nil, fmt.Errorf("nothing to rename here")
+	}
+
+	var edits []TextEdit
+	for _, candidate := range d.Symbols {
+		if kinds[candidate.Kind] && candidate.Name == sym.Name {
+			edits = append(edits, TextEdit{Range: d.rangeOf(candidate.Span), NewText: newName})
+		}
+	}
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{d.URI: edits}}, nil
+}
+
+// format returns an edit replacing the whole document with its canonical form, or no
+// edits when it is already formatted.
+func (d *document) format() ([]TextEdit, error) {
+	formatted, err := diagram.Format(d.Text)
+	if err != nil {
+		return nil, err
+	}
+	if formatted == d.Text {
+		return []TextEdit{}, nil
+	}
+	return []TextEdit{{Range: d.rangeOf(tokenizer.Span{End: len(d.Text)}), NewText: formatted}}, nil
+}
@@ -0,0 +1,240 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const sample = `@layout(w:950,h:400)
+
+browser:Browser@home
+vps:VM {
+    nginx:Server@proxy
+}
+
+browser.e --> nginx.w
+
+@home(url: "https://nagare.dev")
+@proxy(title: "nginx", port: 80)
+@nginx(x:50,y:&browser.c)`
+
+// offsetOf returns the offset of the n-th occurrence of needle plus delta.
+func offsetOf(t *testing.T, text, needle string, n, delta int) int {
+	t.Helper()
+	offset := -1
+	for i := 0; i <= n; i++ {
+		next := strings.Index(text[offset+1:], needle)
+		if next < 0 {
+			t.Fatalf("occurrence %d of %q not found", n, needle)
+		}
+		offset += next + 1
+	}
+	return offset + delta
+}
+
+func labels(items []CompletionItem) []string {
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Label)
+	}
+	return names
+}
+
+func TestCompletionContexts(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		absent string
+	}{
+		{name: "component types", text: "db:Data", want: "Database"},
+		{name: "prop keys by node type", text: "db:Database\nx.e --> db.w\n@db(en", want: "engine", absent: "port"},
+		{name: "prop keys by state", text: "a:Server@api\nx.e --> a.w\n@api(po", want: "port"},
+		{name: "anchors", text: "a:Server\nb:Server\na.", want: "ne"},
+		{name: "alignment edges", text: "a:Server\nb:Server\nb.e --> a.w\n@b(y:&a.", want: "c"},
+		{name: "state names", text: "a:Server@api\nb:Server@", want: "api"},
+		{name: "node references", text: "a:Server\nb:Server\na.e --> ", want: "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := analyze("file:///a.nagare", tt.text)
+			got := strings.Join(labels(doc.completion(len(tt.text))), ",")
+			if !strings.Contains(","+got+",", ","+tt.want+",") {
+				t.Fatalf("expected %q in completions, got %s", tt.want, got)
+			}
+			if tt.absent != "" && strings.Contains(","+got+",", ","+tt.absent+",") {
+				t.Fatalf("did not expect %q in completions, got %s", tt.absent, got)
+			}
+		})
+	}
+}
+
+func TestHoverDocumentsProps(t *testing.T) {
+	doc := analyze("file:///a.nagare", sample)
+	hover := doc.hover(offsetOf(t, sample, "port", 0, 1))
+	if hover == nil || !strings.Contains(hover.Contents.Value, "Port number") {
+		t.Fatalf("expected port docs, got %+v", hover)
+	}
+}
+
+func TestDefinitionOfStateReference(t *testing.T) {
+	doc := analyze("file:///a.nagare", sample)
+	locations := doc.definition(offsetOf(t, sample, "proxy", 0, 1))
+	want := doc.position(offsetOf(t, sample, "proxy", 1, 0))
+	if len(locations) != 1 || locations[0].Range.Start != want {
+		t.Fatalf("expected definition at %+v, got %+v", want, locations)
+	}
+
+	locations = doc.definition(offsetOf(t, sample, "browser.c", 0, 1))
+	if len(locations) != 1 || locations[0].Range.Start.Line != 2 {
+		t.Fatalf("expected alignment reference to resolve to line 2, got %+v", locations)
+	}
+}
+
+func TestRenameNodeAcrossConnectionsAndStates(t *testing.T) {
+	doc := analyze("file:///a.nagare", sample)
+	edit, err := doc.rename(offsetOf(t, sample, "browser", 0, 0), "client")
+	if err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	edits := edit.Changes["file:///a.nagare"]
+	// Declaration, connection and alignment reference.
+	if len(edits) != 3 {
+		t.Fatalf("expected 3 edits, got %+v", edits)
+	}
+
+	if _, err := doc.rename(offsetOf(t, sample, "browser", 0, 0), "not valid"); err == nil {
+		t.Fatal("expected invalid identifier to be rejected")
+	}
+}
+
+const extendsSample = `api:Server@loud
+@base(bg: "#fff")
+@loud(extends: base, c: "#000")
+@api(extends: [loud, "base"], x: 10)
+`
+
+func TestDefinitionOfExtendedState(t *testing.T) {
+	doc := analyze("file:///a.nagare", extendsSample)
+	want := doc.position(offsetOf(t, extendsSample, "@base", 0, 1))
+	for n := 1; n <= 2; n++ {
+		locations := doc.definition(offsetOf(t, extendsSample, "base", n, 1))
+		if len(locations) != 1 || locations[0].Range.Start != want {
+			t.Fatalf("occurrence %d: expected definition at %+v, got %+v", n, want, locations)
+		}
+	}
+
+	locations := doc.definition(offsetOf(t, extendsSample, "[loud", 0, 2))
+	if want := doc.position(offsetOf(t, extendsSample, "@loud", 1, 1)); len(locations) != 1 || locations[0].Range.Start != want {
+		t.Fatalf("expected definition of loud at %+v, got %+v", want, locations)
+	}
+}
+
+func TestRenameExtendedState(t *testing.T) {
+	doc := analyze("file:///a.nagare", extendsSample)
+	edit, err := doc.rename(offsetOf(t, extendsSample, "@base", 0, 1), "plain")
+	if err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	edits := edit.Changes["file:///a.nagare"]
+	var starts []Position
+	for _, e := range edits {
+		starts = append(starts, e.Range.Start)
+		if e.Range.End.Character-e.Range.Start.Character != len("base") {
+			t.Fatalf("expected each edit to cover just the name, got %+v", e.Range)
+		}
+	}
+	// Definition, single extends and list extends.
+	want := []Position{
+		doc.position(offsetOf(t, extendsSample, "base", 0, 0)),
+		doc.position(offsetOf(t, extendsSample, "base", 1, 0)),
+		doc.position(offsetOf(t, extendsSample, "base", 2, 0)),
+	}
+	if len(starts) != len(want) {
+		t.Fatalf("expected %d edits, got %+v", len(want), edits)
+	}
+	for i := range want {
+		if starts[i] != want[i] {
+			t.Fatalf("expected edits at %+v, got %+v", want, starts)
+		}
+	}
+}
+
+func TestImportIsNotIndexed(t *testing.T) {
+	text := "api:Server\n@import \"d.nagare\" as d\nweb:Server@card"
+	doc := analyze("file:///a.nagare", text)
+	if got := strings.Join(doc.nodeIDs(), ","); got != "api,web" {
+		t.Fatalf("expected only api and web as nodes, got %s", got)
+	}
+	if got := strings.Join(doc.stateNames(), ","); got != "card" {
+		t.Fatalf("expected only card as a state, got %s", got)
+	}
+}
+
+func TestServeOpensDocumentAndPublishesDiagnostics(t *testing.T) {
+	var in bytes.Buffer
+	send := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+	send(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]interface{}{}})
+	send(map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": didOpenParams{
+		TextDocument: textDocumentItem{URI: "file:///a.nagare", Text: "vm:VM {\n  app:Server"},
+	}})
+	send(map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": "shutdown"})
+	send(map[string]interface{}{"jsonrpc": "2.0", "method": "exit"})
+
+	var out bytes.Buffer
+	if err := NewServer(&out).Serve(context.Background(), &in); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+
+	reader := bufio.NewReader(&out)
+	var methods []string
+	var diagnostics publishDiagnosticsParams
+	for {
+		body, err := readMessage(reader)
+		if err != nil {
+			break
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		methods = append(methods, msg.Method)
+		if msg.Method == "textDocument/publishDiagnostics" {
+			json.Unmarshal(msg.Params, &diagnostics)
+		}
+	}
+
+	if len(methods) != 3 {
+		t.Fatalf("expected initialize result, diagnostics and shutdown result, got %q", methods)
+	}
+	if len(diagnostics.Diagnostics) != 1 || diagnostics.Diagnostics[0].Range.Start.Line != 1 {
+		t.Fatalf("expected one diagnostic on line 1, got %+v", diagnostics)
+	}
+}
+
+func TestFormattingReplacesWholeDocument(t *testing.T) {
+	doc := analyze("file:///a.nagare", "a.e-->b.w\na:Server\nb:Server\n")
+	edits, err := doc.format()
+	if err != nil {
+		t.Fatalf("format: %v", err)
+	}
+	if len(edits) != 1 || edits[0].NewText != "a:Server\nb:Server\n\na.e --> b.w\n" || edits[0].Range.End.Line != 3 {
+		t.Fatalf("unexpected edits %+v", edits)
+	}
+
+	formatted := analyze("file:///a.nagare", edits[0].NewText)
+	if edits, err := formatted.format(); err != nil || len(edits) != 0 {
+		t.Fatalf("expected no edits for a formatted document, got %+v (%v)", edits, err)
+	}
+}
@@ -0,0 +1,269 @@
+// Package lsp implements a Language Server Protocol server for .nagare files. It speaks
+// JSON-RPC over a byte stream, normally the stdio of `nagare lsp`, and offers parser
+// diagnostics, completion, hover, go-to-definition, rename and formatting.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/saasuke-labs/nagare/pkg/version"
+)
+
+// Server holds the open documents of one client connection.
+type Server struct {
+	out      io.Writer
+	writeMu  sync.Mutex
+	docs     map[string]*document
+	shutdown bool
+}
+
+// NewServer returns a server that writes responses and notifications to out.
+func NewServer(out io.Writer) *Server {
+	return &Server{out: out, docs: make(map[string]*document)}
+}
+
+// Serve reads requests from in until the client sends exit, in reaches EOF or ctx is
+// done. Requests are handled in order.
+func (s *Server) Serve(ctx context.Context, in io.Reader) error {
+	reader := bufio.NewReader(in)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		body, err := readMessage(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			continue // Notifications get no response
+		}
+		var rpcErr *responseError
+		if err != nil && !errors.As(err, &rpcErr) {
+			rpcErr = &responseError{Code: codeRequestFailed, Message: err.Error()}
+		}
+		s.reply(msg.ID, result, rpcErr)
+	}
+}
+
+func (s *Server) handle(msg message) (interface{}, error) {
+	switch msg.Method {
+	case "initialize":
+		return s.initialize(), nil
+	case "initialized", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		return nil, nil
+	case "textDocument/completion":
+		doc, offset, err := s.locate(msg)
+		if err != nil {
+			return nil, err
+		}
+		items := doc.completion(offset)
+		if items == nil {
+			items = []CompletionItem{}
+		}
+		return items, nil
+	case "textDocument/hover":
+		doc, offset, err := s.locate(msg)
+		if err != nil {
+			return nil, err
+		}
+		return nullable(doc.hover(offset)), nil
+	case "textDocument/definition":
+		doc, offset, err := s.locate(msg)
+		if err != nil {
+			return nil, err
+		}
+		return nullable(doc.definition(offset)), nil
+	case "textDocument/prepareRename":
+		doc, offset, err := s.locate(msg)
+		if err != nil {
+			return nil, err
+		}
+		sym, _, ok := doc.renameTarget(offset)
+		if !ok {
+			return json.RawMessage("null"), nil
+		}
+		return doc.rangeOf(sym.Span), nil
+	case "textDocument/rename":
+		var params renameParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, &responseError{Code: codeInvalidParams, Message: "document is not open"}
+		}
+		return doc.rename(doc.offset(params.Position), params.NewName)
+	case "textDocument/formatting":
+		var params formattingParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil, &responseError{Code: codeInvalidParams, Message: "document is not open"}
+		}
+		return doc.format()
+	}
+
+	if strings.HasPrefix(msg.Method, "$/") || msg.ID == nil {
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %q not supported", msg.Method)}
+}
+
+func (s *Server) initialize() interface{} {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync": syncFull,
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{":", "@", ".", "&", "(", ",", ">"},
+			},
+			"hoverProvider":              true,
+			"definitionProvider":         true,
+			"renameProvider":             map[string]interface{}{"prepareProvider": true},
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]string{"name": "nagare", "version": version.Version},
+	}
+}
+
+// update re-analyses a document and publishes its diagnostics.
+func (s *Server) update(uri, text string) {
+	doc := analyze(uri, text)
+	s.docs[uri] = doc
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics()})
+}
+
+// locate decodes position params and returns the document and byte offset they name.
+func (s *Server) locate(msg message) (*document, int, error) {
+	var params positionParams
+	if err := decodeParams(msg, &params); err != nil {
+		return nil, 0, err
+	}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, 0, &responseError{Code: codeInvalidParams, Message: "document is not open"}
+	}
+	return doc, doc.offset(params.Position), nil
+}
+
+func decodeParams(msg message, v interface{}) error {
+	if err := json.Unmarshal(msg.Params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// nullable turns a nil pointer or slice into an explicit JSON null result.
+func nullable[T any](v T) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(data)
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, err *responseError) {
+	msg := message{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		msg.Error = err
+	} else if result == nil {
+		msg.Result = json.RawMessage("null")
+	} else {
+		msg.Result = result
+	}
+	s.write(msg)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	s.write(message{JSONRPC: "2.0", Method: method, Params: data})
+}
+
+func (s *Server) write(msg message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// readMessage reads one Content-Length framed message body.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesPrometheusTextFormat(t *testing.T) {
+	registry := NewRegistry()
+	renders := registry.NewCounterVec("nagare_renders_total", "Rendered diagrams.", "format", "outcome")
+	latency := registry.NewHistogramVec("nagare_stage_seconds", "Stage latency.", []float64{0.1, 1}, "stage")
+	inflight := registry.NewGauge("nagare_inflight", "In-flight jobs.")
+
+	renders.WithLabelValues("svg", "ok").Inc()
+	renders.WithLabelValues("svg", "ok").Inc()
+	renders.WithLabelValues("webp", "error").Inc()
+	latency.WithLabelValues("parse").Observe(0.05)
+	latency.WithLabelValues("parse").Observe(0.5)
+	inflight.Inc()
+
+	var out strings.Builder
+	if _, err := registry.WriteTo(&out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"# TYPE nagare_renders_total counter",
+		`nagare_renders_total{format="svg",outcome="ok"} 2`,
+		`nagare_renders_total{format="webp",outcome="error"} 1`,
+		"# TYPE nagare_stage_seconds histogram",
+		`nagare_stage_seconds_bucket{stage="parse",le="0.1"} 1`,
+		`nagare_stage_seconds_bucket{stage="parse",le="1"} 2`,
+		`nagare_stage_seconds_bucket{stage="parse",le="+Inf"} 2`,
+		`nagare_stage_seconds_sum{stage="parse"} 0.55`,
+		`nagare_stage_seconds_count{stage="parse"} 2`,
+		"# TYPE nagare_inflight gauge",
+		"nagare_inflight 1",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Fatalf("expected output to contain %q, got:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/props"
+)
+
+// ExtendsKey is the prop that makes a state inherit the props of other states:
+//
+//	@server(bg: "#fff", fg: "#111")
+//	@dark-server(extends: server, bg: "#111")
+//	@loud(extends: [dark-server, big])
+//
+// The parents' props come first, left to right, and the state's own props override
+// them. A parent must be defined above the state that extends it, in the same file or
+// an import, so inheritance cannot form a cycle.
+const ExtendsKey = "extends"
+
+// resolveExtends replaces the extends prop of state, defined at token at, with the props
+// of the states it names.
+func (p *Parser) resolveExtends(root *Node, state *State, at int) error {
+	var value string
+	found := false
+	for _, pair := range props.Pairs(state.PropsDef) {
+		if pair.Key == ExtendsKey {
+			value, found = pair.Value, true
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	names := []string{strings.TrimSpace(value)}
+	if strings.HasPrefix(names[0], "[") && strings.HasSuffix(names[0], "]") {
+		names = strings.Split(names[0][1:len(names[0])-1], ",")
+	}
+
+	var parts []string
+	for _, name := range names {
+		name = strings.Trim(strings.TrimSpace(name), `"`)
+		if name == "" {
+			return p.errorAt(at, "@%s: extends needs a state name", state.Name)
+		}
+		parent, ok := root.Globals[name]
+		if !ok {
+			parent, ok = p.imported[name]
+		}
+		if !ok {
+			return p.errorAt(at, "@%s extends unknown state %q: define it above @%s", state.Name, name, state.Name)
+		}
+		if def := strings.TrimSpace(parent.PropsDef); def != "" {
+			parts = append(parts, def)
+		}
+	}
+	if own := props.Without(state.PropsDef, ExtendsKey); own != "" {
+		parts = append(parts, own)
+	}
+	state.PropsDef = strings.Join(parts, ",")
+	return nil
+}
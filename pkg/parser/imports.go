@@ -0,0 +1,396 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+// ImportKeyword starts an import statement:
+//
+//	@import "shared/edge.nagare"
+//	@import "shared/edge.nagare" as edge
+//
+// An import adds the nodes, connections and state definitions of another file to the
+// diagram. With a namespace the imported nodes and states are renamed ns.name, so
+// edge.cdn.e --> api.w connects to the cdn node of the import and @edge.cdn(...) restyles
+// it. The importing file's own state definitions win over imported ones of the same name,
+// and imported states apply to every node that uses them wherever the @import is written.
+// The @layout and variables of an imported file stay private to it.
+const ImportKeyword = "import"
+
+// Import is an @import statement.
+type Import struct {
+	Path      string
+	Namespace string // Empty when the imported names are used as they are
+}
+
+// Imports configures how ParseWithImports reads @import statements.
+type Imports struct {
+	FS   fs.FS  // Files that can be imported; nil rejects every @import
+	Path string // Path of the diagram within FS; imports are relative to its directory
+}
+
+// ParseWithImports is ParseWithSpans that also reads the files named by @import from
+// imports.FS and merges them into the AST. Import paths are slash separated, are relative
+// to the importing file unless they start with /, and cannot leave FS. A file that
+// imports itself, directly or through other files, is an error. A file reached through
+// several imports under the same namespace, such as one both imported files import, is
+// merged once.
+func ParseWithImports(tokens []tokenizer.Token, spans []tokenizer.Span, imports Imports) (Node, error) {
+	im := &importer{Imports: imports, merged: make(map[string]bool)}
+	if imports.Path != "" {
+		im.stack = []string{path.Clean(imports.Path)}
+	}
+	return parseTokens(tokens, spans, im)
+}
+
+// importer reads the files imported by one diagram.
+type importer struct {
+	Imports
+	stack     []string // Files being imported, outermost first
+	namespace string   // Namespace the names of im.Path end up in within the diagram
+	// merged holds the files already merged into the diagram, keyed by path and the
+	// namespace they were merged under. It is shared by the importers of nested files.
+	merged map[string]bool
+}
+
+// load reads and parses the file imp names from im.Path. It returns false, and no
+// node, when the file is already part of the diagram under the same namespace.
+func (im *importer) load(imp Import) (Node, bool, error) {
+	name := imp.Path
+	if im.FS == nil {
+		return Node{}, false, fmt.Errorf("cannot import %q: imports are not enabled", name)
+	}
+	file := path.Clean(name)
+	if !strings.HasPrefix(name, "/") {
+		file = path.Join(path.Dir(im.Path), name)
+	}
+	file = strings.TrimPrefix(file, "/")
+	if !fs.ValidPath(file) {
+		return Node{}, false, fmt.Errorf("cannot import %q: it is outside the import directory", name)
+	}
+	for i, open := range im.stack {
+		if open == file {
+			cycle := append(append([]string(nil), im.stack[i:]...), file)
+			return Node{}, false, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	namespace := im.namespace
+	if imp.Namespace != "" {
+		namespace = strings.TrimPrefix(namespace+"."+imp.Namespace, ".")
+	}
+	key := file + " as " + namespace
+	if im.merged[key] {
+		return Node{}, false, nil
+	}
+	im.merged[key] = true
+
+	source, err := fs.ReadFile(im.FS, file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Node{}, false, fmt.Errorf("cannot import %q: %s does not exist", name, file)
+		}
+		return Node{}, false, fmt.Errorf("cannot import %q: %v", name, err)
+	}
+
+	nested := &importer{
+		Imports:   Imports{FS: im.FS, Path: file},
+		stack:     append(append([]string(nil), im.stack...), file),
+		namespace: namespace,
+		merged:    im.merged,
+	}
+	tokens, spans := tokenizer.TokenizeWithSpans(string(source))
+	node, err := parseTokens(tokens, spans, nested)
+	if err != nil {
+		var parseErr *Error
+		if errors.As(err, &parseErr) && parseErr.HasSpan {
+			line, column := tokenizer.Position(string(source), parseErr.Span.Start)
+			return Node{}, false, fmt.Errorf("%s:%d:%d: %s", file, line, column, parseErr.Msg)
+		}
+		return Node{}, false, fmt.Errorf("%s: %v", file, err)
+	}
+	return node, true, nil
+}
+
+// isImport reports whether an import statement starts at token i. A declaration stops
+// at one, so @import on the line after it is not read as its state.
+func isImport(tokens []tokenizer.Token, i int) bool {
+	return i+2 < len(tokens) && tokens[i].Type == tokenizer.AT &&
+		tokens[i+1].Type == tokenizer.IDENTIFIER && tokens[i+1].Value == ImportKeyword && isQuote(tokens[i+2])
+}
+
+// ImportEnd returns the index of the token after the import statement starting at
+// token i, and false if none starts there. Tools that index tokens step over imports
+// with it as Parse does.
+func ImportEnd(tokens []tokenizer.Token, i int) (int, bool) {
+	if !isImport(tokens, i) {
+		return i, false
+	}
+	_, next, err := readImport(tokens, i)
+	if err != nil {
+		return i + 2, true
+	}
+	return next, true
+}
+
+// readImport reads the import statement starting at token i. It returns the index of the
+// token after it, or on error the index of the offending token.
+func readImport(tokens []tokenizer.Token, i int) (Import, int, error) {
+	var imp Import
+	j := i + 2 // Opening quote
+	quote := tokens[j].Value
+	j++
+	if j < len(tokens) && tokens[j].Type == tokenizer.IDENTIFIER && tokens[j].Value != quote {
+		imp.Path = tokens[j].Value
+		j++
+	}
+	if j >= len(tokens) || tokens[j].Type != tokenizer.IDENTIFIER || tokens[j].Value != quote {
+		return imp, j - 1, fmt.Errorf("unterminated import path")
+	}
+	j++
+	if strings.TrimSpace(imp.Path) == "" {
+		return imp, i, fmt.Errorf("@import needs a file path")
+	}
+
+	if j < len(tokens) && tokens[j].Type == tokenizer.IDENTIFIER && tokens[j].Value == "as" {
+		if j+1 >= len(tokens) || tokens[j+1].Type != tokenizer.IDENTIFIER {
+			return imp, j, fmt.Errorf("expected a namespace after as")
+		}
+		if !isVariableName(tokens[j+1].Value) {
+			return imp, j + 1, fmt.Errorf("invalid namespace %q: use letters, digits and _", tokens[j+1].Value)
+		}
+		imp.Namespace = tokens[j+1].Value
+		j += 2
+	}
+	return imp, j, nil
+}
+
+// parseImport reads the import statement at the current token and merges the file it
+// names into root. Without an importer the statement is only recorded.
+func (p *Parser) parseImport(root *Node) error {
+	at := p.current
+	imp, next, err := readImport(p.tokens, at)
+	if err != nil {
+		return p.errorAt(next, "%v", err)
+	}
+	p.current = next
+	root.Imports = append(root.Imports, imp)
+	if p.imports == nil {
+		return nil
+	}
+
+	imported, ok, err := p.imports.load(imp)
+	if err != nil {
+		return p.errorAt(at, "%v", err)
+	}
+	if ok {
+		p.merge(root, imported, imp.Namespace)
+	}
+	return nil
+}
+
+// merge adds the nodes, connections and states of an imported file to root, renaming
+// them into namespace ns.
+func (p *Parser) merge(root *Node, imported Node, ns string) {
+	nodes := make(map[string]bool)
+	var collect func(children []Node)
+	collect = func(children []Node) {
+		for _, child := range children {
+			nodes[child.Text] = true
+			collect(child.Children)
+		}
+	}
+	collect(imported.Children)
+	states := make(map[string]bool) // States to rename
+	for name := range imported.Globals {
+		// Type states, such as @Server, style every node of their type and keep their
+		// name. Id states follow their node.
+		typeState := !nodes[name] && unicode.IsUpper(rune(name[0]))
+		states[name] = !typeState
+	}
+	rename := func(name string, declared map[string]bool) string {
+		if ns == "" || !declared[name] {
+			return name
+		}
+		return ns + "." + name
+	}
+	renameState := func(state State) State {
+		state.Name = rename(state.Name, states)
+		state.PropsDef = renameRefs(state.PropsDef, nodes, ns)
+		return state
+	}
+
+	var renameNode func(node *Node)
+	renameNode = func(node *Node) {
+		node.Text = rename(node.Text, nodes)
+		names := node.StateNames()
+		for i, name := range names {
+			names[i] = rename(name, states)
+		}
+		node.State = strings.Join(names, stateSeparator)
+		if node.States != nil {
+			renamed := make(map[string]State, len(node.States))
+			for _, state := range node.States {
+				state = renameState(state)
+				renamed[state.Name] = state
+			}
+			node.States = renamed
+		}
+		// States the importing file has already defined win over the imported ones.
+		for _, name := range append([]string{string(node.Type), node.Text}, node.StateNames()...) {
+			if state, ok := root.Globals[name]; ok {
+				if node.States == nil {
+					node.States = make(map[string]State)
+				}
+				node.States[name] = state
+			}
+		}
+		for i := range node.Children {
+			renameNode(&node.Children[i])
+		}
+	}
+	for _, child := range imported.Children {
+		renameNode(&child)
+		root.Children = append(root.Children, child)
+	}
+
+	for _, conn := range imported.Connections {
+		conn.FromID = rename(conn.FromID, nodes)
+		conn.ToID = rename(conn.ToID, nodes)
+		root.Connections = append(root.Connections, conn)
+	}
+
+	if p.imported == nil {
+		p.imported = make(map[string]State)
+	}
+	for name, state := range imported.Globals {
+		if name == "layout" {
+			continue // The importing diagram owns the canvas
+		}
+		state = renameState(state)
+		p.imported[state.Name] = state
+	}
+}
+
+// applyImportedStates defines the imported states the file does not define itself and
+// applies them to every node that uses them.
+func (p *Parser) applyImportedStates(root *Node) {
+	var apply func(node *Node, name string, state State)
+	apply = func(node *Node, name string, state State) {
+		if node.Text == name || string(node.Type) == name || node.usesState(name) {
+			if _, ok := node.States[name]; !ok {
+				if node.States == nil {
+					node.States = make(map[string]State)
+				}
+				node.States[name] = state
+			}
+		}
+		for i := range node.Children {
+			apply(&node.Children[i], name, state)
+		}
+	}
+	for name, state := range p.imported {
+		if _, own := root.Globals[name]; own {
+			continue
+		}
+		root.Globals[name] = state
+		for i := range root.Children {
+			apply(&root.Children[i], name, state)
+		}
+	}
+}
+
+// renameRefs namespaces the &node.property references in a prop value that name one of
+// the imported nodes.
+func renameRefs(value string, nodes map[string]bool, ns string) string {
+	if ns == "" || !strings.Contains(value, "&") {
+		return value
+	}
+	var b strings.Builder
+	inQuotes := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '"' {
+			inQuotes = !inQuotes
+		}
+		b.WriteByte(c)
+		if c != '&' || inQuotes {
+			continue
+		}
+		end := i + 1
+		for end < len(value) && isNameByte(value[end]) {
+			end++
+		}
+		ref := value[i+1 : end]
+		if dot := strings.LastIndexByte(ref, '.'); dot > 0 && nodes[ref[:dot]] {
+			b.WriteString(ns + ".")
+		}
+	}
+	return b.String()
+}
+
+func isNameByte(c byte) bool {
+	return isVariableByte(c, false) || c == '-' || c == '.'
+}
+
+// joinNamespaces reads ns.name, where ns is the namespace of an @import, as one
+// identifier wherever a node or state is named: after @ and &, and at either end of a
+// connection. The last part of a reference or a connection end is its property or
+// anchor and stays separate, so edge.cdn.e --> api.w reads as a connection from edge.cdn.
+func joinNamespaces(tokens []tokenizer.Token, spans []tokenizer.Span) ([]tokenizer.Token, []tokenizer.Span) {
+	namespaces := make(map[string]bool)
+	for i := range tokens {
+		if !isImport(tokens, i) {
+			continue
+		}
+		if imp, _, err := readImport(tokens, i); err == nil && imp.Namespace != "" {
+			namespaces[imp.Namespace] = true
+		}
+	}
+	if len(namespaces) == 0 {
+		return tokens, spans
+	}
+
+	var joinedTokens []tokenizer.Token
+	var joinedSpans []tokenizer.Span
+	for i := 0; i < len(tokens); i++ {
+		last := i
+		if tokens[i].Type == tokenizer.IDENTIFIER && namespaces[tokens[i].Value] {
+			end := i // Last identifier of the dotted name
+			for end+2 < len(tokens) && tokens[end+1].Type == tokenizer.DOT && tokens[end+2].Type == tokenizer.IDENTIFIER {
+				end += 2
+			}
+			switch {
+			case i > 0 && tokens[i-1].Type == tokenizer.AT:
+				last = end
+			case i > 0 && (tokens[i-1].Type == tokenizer.AMPERSAND || tokens[i-1].Type == tokenizer.ARROW),
+				end+1 < len(tokens) && tokens[end+1].Type == tokenizer.ARROW:
+				last = end - 2
+			}
+		}
+		if last <= i {
+			joinedTokens = append(joinedTokens, tokens[i])
+			if spans != nil {
+				joinedSpans = append(joinedSpans, spans[i])
+			}
+			continue
+		}
+
+		parts := make([]string, 0, (last-i)/2+1)
+		for j := i; j <= last; j += 2 {
+			parts = append(parts, tokens[j].Value)
+		}
+		joinedTokens = append(joinedTokens, tokenizer.Token{Type: tokenizer.IDENTIFIER, Value: strings.Join(parts, ".")})
+		if spans != nil {
+			joinedSpans = append(joinedSpans, tokenizer.Span{Start: spans[i].Start, End: spans[last].End})
+		}
+		i = last
+	}
+	return joinedTokens, joinedSpans
+}
@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -29,10 +28,11 @@ type Node struct {
 	Text        string   // The name/label of the node
 	Children    []Node
 	Depth       int    // Track nesting level
-	State       string // Current state name if specified with @
+	State       string // State names given with @, joined by @ when there are several; see StateNames
 	States      map[string]State
 	Globals     map[string]State
 	Connections []Connection
+	Imports     []Import // The @import statements of the file, in order
 }
 
 // AnchorDescriptor captures anchor metadata for connection endpoints.
@@ -59,6 +59,25 @@ type Connection struct {
 	Style      string
 }
 
+// stateSeparator joins the names of a node with several states, as in app:Server@base@highlight.
+const stateSeparator = "@"
+
+// maxNestingDepth is how deep containers nest. It leaves room for a Cluster holding a
+// Namespace holding a VM and beyond, but stops hostile input from nesting without end.
+const maxNestingDepth = 16
+
+// StateNames returns the states the node applies with @, in the order written.
+func (n Node) StateNames() []string {
+	return splitStates(n.State)
+}
+
+func splitStates(state string) []string {
+	if state == "" {
+		return nil
+	}
+	return strings.Split(state, stateSeparator)
+}
+
 func (n Node) String() string {
 	tabs := strings.Repeat("  ", n.Depth)
 	childrenStr := ""
@@ -76,22 +95,82 @@ func (n Node) String() string {
 
 // Parse converts tokens into an AST
 func Parse(tokens []tokenizer.Token) (Node, error) {
+	return ParseWithSpans(tokens, nil)
+}
+
+// ParseWithSpans converts tokens into an AST. When spans (as returned by
+// tokenizer.TokenizeWithSpans) are provided, returned errors are *Error values that
+// carry the location of the offending token.
+// @import statements are recorded in Node.Imports but not read; see ParseWithImports.
+func ParseWithSpans(tokens []tokenizer.Token, spans []tokenizer.Span) (Node, error) {
+	return parseTokens(tokens, spans, nil)
+}
+
+func parseTokens(tokens []tokenizer.Token, spans []tokenizer.Span, imports *importer) (Node, error) {
+	if len(spans) != len(tokens) {
+		spans = nil
+	}
+	tokens, spans = joinNamespaces(tokens, spans)
 	parser := &Parser{
 		tokens:  tokens,
+		spans:   spans,
 		current: 0,
+		imports: imports,
+	}
+	if err := parser.collectVariables(); err != nil {
+		return Node{}, err
 	}
 	return parser.parse(0)
 }
 
 type Parser struct {
 	tokens  []tokenizer.Token
+	spans   []tokenizer.Span
 	current int
+	vars    map[string]string // Resolved @var values; nil while they are collected
+	imports *importer         // Reads @import statements; nil only records them
+	// imported holds the states of imported files, applied once the file is parsed.
+	imported map[string]State
+}
+
+// Error is a parse error. Span is only meaningful when HasSpan is set.
+type Error struct {
+	Msg     string
+	Span    tokenizer.Span
+	HasSpan bool
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// errorf reports an error at the current token.
+func (p *Parser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.current, format, args...)
+}
+
+// errorAt reports an error at the token with the given index, clamped to the last
+// token so errors at end of input point at the final token.
+func (p *Parser) errorAt(index int, format string, args ...interface{}) error {
+	err := &Error{Msg: fmt.Sprintf(format, args...)}
+	if len(p.spans) == 0 {
+		return err
+	}
+	if index >= len(p.spans) {
+		index = len(p.spans) - 1
+	}
+	if index < 0 {
+		index = 0
+	}
+	err.Span = p.spans[index]
+	err.HasSpan = true
+	return err
 }
 
 // findNodesWithState returns all nodes in the tree that use the given state
 func (p *Parser) findNodesWithState(root *Node, stateName string) []*Node {
 	var nodes []*Node
-	if root.State == stateName {
+	if root.usesState(stateName) {
 		nodes = append(nodes, root)
 	}
 	for i := range root.Children {
@@ -100,6 +179,28 @@ func (p *Parser) findNodesWithState(root *Node, stateName string) []*Node {
 	return nodes
 }
 
+// usesState reports whether the node applies the state with @.
+func (n *Node) usesState(name string) bool {
+	for _, state := range n.StateNames() {
+		if state == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findNodesWithType returns all nodes in the tree declared with the given type
+func (p *Parser) findNodesWithType(root *Node, typeName string) []*Node {
+	var nodes []*Node
+	if root.Text != "" && string(root.Type) == typeName {
+		nodes = append(nodes, root)
+	}
+	for i := range root.Children {
+		nodes = append(nodes, p.findNodesWithType(&root.Children[i], typeName)...)
+	}
+	return nodes
+}
+
 // findNodesWithName returns all nodes in the tree that have the given identifier
 func (p *Parser) findNodesWithName(root *Node, name string) []*Node {
 	var nodes []*Node
@@ -114,18 +215,18 @@ func (p *Parser) findNodesWithName(root *Node, name string) []*Node {
 
 func (p *Parser) parseState() (*State, error) {
 	if p.current >= len(p.tokens) || p.tokens[p.current].Type != tokenizer.AT {
-		return nil, errors.New("expected @ for state definition")
+		return nil, p.errorf("expected @ for state definition")
 	}
 	p.current++ // Move past @
 
 	if p.current >= len(p.tokens) || p.tokens[p.current].Type != tokenizer.IDENTIFIER {
-		return nil, errors.New("expected state name after @")
+		return nil, p.errorf("expected state name after @")
 	}
 	name := p.tokens[p.current].Value
 	p.current++ // Move past state name
 
 	if p.current >= len(p.tokens) || p.tokens[p.current].Type != tokenizer.LEFT_PAREN {
-		return nil, errors.New("expected ( after state name")
+		return nil, p.errorf("expected ( after state name")
 	}
 	p.current++ // Move past (
 
@@ -155,11 +256,22 @@ func (p *Parser) parseState() (*State, error) {
 			if parenCount > 0 {
 				propsDef.WriteString(")")
 			}
+		case token.Type == tokenizer.DOT || token.Type == tokenizer.AMPERSAND:
+			// Written without spaces so 1.5 and &node.c read back as one value
+			propsDef.WriteString(tokenText(token))
 		default:
-			propsDef.WriteString(token.Value)
+			text := tokenText(token)
+			if !inQuotes && p.vars != nil {
+				substituted, err := substituteVariables(text, p.variable)
+				if err != nil {
+					return nil, p.errorf("%v", err)
+				}
+				text = substituted
+			}
+			propsDef.WriteString(text)
 			if !inQuotes && token.Type != tokenizer.COLON && token.Type != tokenizer.COMMA {
 				nextToken := p.peekNext()
-				if nextToken != nil && nextToken.Type != tokenizer.COLON && nextToken.Type != tokenizer.COMMA {
+				if nextToken != nil && nextToken.Type != tokenizer.COLON && nextToken.Type != tokenizer.COMMA && nextToken.Type != tokenizer.DOT {
 					propsDef.WriteString(" ")
 				}
 			}
@@ -168,7 +280,7 @@ func (p *Parser) parseState() (*State, error) {
 	}
 
 	if parenCount > 0 {
-		return nil, errors.New("unclosed parenthesis in state definition")
+		return nil, p.errorf("unclosed parenthesis in state definition")
 	}
 
 	return &State{
@@ -185,8 +297,8 @@ func (p *Parser) peekNext() *tokenizer.Token {
 }
 
 func (p *Parser) parse(depth int) (Node, error) {
-	if depth > 1 {
-		return Node{}, errors.New("nesting depth exceeded maximum of 1")
+	if depth > maxNestingDepth {
+		return Node{}, p.errorf("nesting depth exceeded maximum of %d", maxNestingDepth)
 	}
 
 	root := Node{
@@ -200,14 +312,31 @@ func (p *Parser) parse(depth int) (Node, error) {
 
 		switch token.Type {
 		case tokenizer.AT:
+			if isImport(p.tokens, p.current) {
+				if depth > 0 {
+					return Node{}, p.errorf("@import must be at root level")
+				}
+				if err := p.parseImport(&root); err != nil {
+					return Node{}, err
+				}
+				continue
+			}
 			if depth > 0 {
-				return Node{}, errors.New("state definitions must be at root level")
+				return Node{}, p.errorf("state definitions must be at root level")
 			}
+			at := p.current
 			state, err := p.parseState()
 			if err != nil {
 				return Node{}, err
 			}
 
+			if state.Name == VariablesState {
+				continue // Already collected, and applies to no node
+			}
+			if err := p.resolveExtends(&root, state, at); err != nil {
+				return Node{}, err
+			}
+
 			// Store the state definition for lookup during layout/render phases
 			root.Globals[state.Name] = *state
 
@@ -230,9 +359,18 @@ func (p *Parser) parse(depth int) (Node, error) {
 				node.States[state.Name] = *state
 			}
 
+			// And with nodes declared with the type it is named after, as in @Server(...)
+			nodesByType := p.findNodesWithType(&root, state.Name)
+			for _, node := range nodesByType {
+				if node.States == nil {
+					node.States = make(map[string]State)
+				}
+				node.States[state.Name] = *state
+			}
+
 		case tokenizer.RIGHT_BRACE:
 			if depth == 0 {
-				return Node{}, errors.New("unexpected closing brace at root level")
+				return Node{}, p.errorf("unexpected closing brace at root level")
 			}
 			return root, nil
 		case tokenizer.IDENTIFIER:
@@ -252,29 +390,36 @@ func (p *Parser) parse(depth int) (Node, error) {
 			if p.current < len(p.tokens) && p.tokens[p.current].Type == tokenizer.COLON {
 				p.current++ // Move past colon
 				if p.current >= len(p.tokens) {
-					return Node{}, errors.New("unexpected end of input after colon")
+					return Node{}, p.errorf("unexpected end of input after colon")
 				}
 				if p.tokens[p.current].Type != tokenizer.IDENTIFIER {
-					return Node{}, errors.New("expected type after colon")
+					return Node{}, p.errorf("expected type after colon")
 				}
 				// Use the declared type
 				nodeType = NodeType(p.tokens[p.current].Value)
 				p.current++ // Move past type
 			}
 
-			// Check for state declaration with @
-			var stateName string
-			if p.current < len(p.tokens) && p.tokens[p.current].Type == tokenizer.AT {
+			// Check for state declarations with @, as in @base@highlight
+			var stateNames []string
+			for p.current < len(p.tokens) && p.tokens[p.current].Type == tokenizer.AT {
+				if isImport(p.tokens, p.current) {
+					break // An import on the next line
+				}
+				if len(stateNames) > 0 && p.current+2 < len(p.tokens) && p.tokens[p.current+2].Type == tokenizer.LEFT_PAREN {
+					break // A state definition on the next line
+				}
 				p.current++ // Move past @
 				if p.current >= len(p.tokens) {
-					return Node{}, errors.New("unexpected end of input after @")
+					return Node{}, p.errorf("unexpected end of input after @")
 				}
 				if p.tokens[p.current].Type != tokenizer.IDENTIFIER {
-					return Node{}, errors.New("expected state name after @")
+					return Node{}, p.errorf("expected state name after @")
 				}
-				stateName = p.tokens[p.current].Value
+				stateNames = append(stateNames, p.tokens[p.current].Value)
 				p.current++ // Move past state name
 			}
+			stateName := strings.Join(stateNames, stateSeparator)
 
 			// Check if it's a container (has braces)
 			isContainer := p.current < len(p.tokens) &&
@@ -306,10 +451,10 @@ func (p *Parser) parse(depth int) (Node, error) {
 				}
 
 				if p.current >= len(p.tokens) {
-					return Node{}, errors.New("unexpected end of input: missing closing brace")
+					return Node{}, p.errorf("unexpected end of input: missing closing brace")
 				}
 				if p.tokens[p.current].Type != tokenizer.RIGHT_BRACE {
-					return Node{}, errors.New("expected closing brace")
+					return Node{}, p.errorf("expected closing brace")
 				}
 				p.current++ // Skip the right brace
 
@@ -339,6 +484,9 @@ func (p *Parser) parse(depth int) (Node, error) {
 		}
 	}
 
+	if depth == 0 {
+		p.applyImportedStates(&root)
+	}
 	if len(root.Globals) == 0 {
 		root.Globals = nil
 	}
@@ -361,7 +509,7 @@ func (p *Parser) tryParseConnection() (*Connection, bool, error) {
 	}
 
 	if p.tokens[start+2].Type != tokenizer.IDENTIFIER {
-		return nil, false, errors.New("expected anchor identifier after dot in connection")
+		return nil, false, p.errorAt(start+2, "expected anchor identifier after dot in connection")
 	}
 
 	if p.tokens[start+3].Type != tokenizer.ARROW {
@@ -369,15 +517,15 @@ func (p *Parser) tryParseConnection() (*Connection, bool, error) {
 	}
 
 	if p.tokens[start+4].Type != tokenizer.IDENTIFIER {
-		return nil, false, errors.New("expected target identifier after connection arrow")
+		return nil, false, p.errorAt(start+4, "expected target identifier after connection arrow")
 	}
 
 	if p.tokens[start+5].Type != tokenizer.DOT {
-		return nil, false, errors.New("expected dot before target anchor in connection")
+		return nil, false, p.errorAt(start+5, "expected dot before target anchor in connection")
 	}
 
 	if p.tokens[start+6].Type != tokenizer.IDENTIFIER {
-		return nil, false, errors.New("expected anchor identifier after dot in connection")
+		return nil, false, p.errorAt(start+6, "expected anchor identifier after dot in connection")
 	}
 
 	toID := strings.TrimSpace(p.tokens[start+4].Value)
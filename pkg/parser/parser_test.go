@@ -1,12 +1,30 @@
 package parser
 
 import (
+	"errors"
+	"io/fs"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/saasuke-labs/nagare/pkg/tokenizer"
 )
 
+// nestedContainers returns the tokens of n containers, each inside the one before, with
+// a node in the innermost one.
+func nestedContainers(n int) []tokenizer.Token {
+	var tokens []tokenizer.Token
+	for i := 0; i < n; i++ {
+		tokens = append(tokens, tokenizer.Token{Type: tokenizer.IDENTIFIER, Value: "VM"}, tokenizer.Token{Type: tokenizer.LEFT_BRACE})
+	}
+	tokens = append(tokens, tokenizer.Token{Type: tokenizer.IDENTIFIER, Value: "app"})
+	for i := 0; i < n; i++ {
+		tokens = append(tokens, tokenizer.Token{Type: tokenizer.RIGHT_BRACE})
+	}
+	return tokens
+}
+
 func TestParse(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -53,17 +71,9 @@ func TestParse(t *testing.T) {
 			},
 		},
 		{
-			name: "too deep nesting",
-			tokens: []tokenizer.Token{
-				{Type: tokenizer.IDENTIFIER, Value: "VM"},
-				{Type: tokenizer.LEFT_BRACE},
-				{Type: tokenizer.IDENTIFIER, Value: "Server"},
-				{Type: tokenizer.LEFT_BRACE},
-				{Type: tokenizer.IDENTIFIER, Value: "App"},
-				{Type: tokenizer.RIGHT_BRACE},
-				{Type: tokenizer.RIGHT_BRACE},
-			},
-			expectedError: "nesting depth exceeded maximum of 1",
+			name:          "too deep nesting",
+			tokens:        nestedContainers(maxNestingDepth + 1),
+			expectedError: "nesting depth exceeded maximum of 16",
 		},
 		{
 			name:     "empty tokens",
@@ -218,3 +228,334 @@ func TestParse(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFileAndPrint(t *testing.T) {
+	source := "vm:VM@box {\n  app:Server\n\n\n  db:Database\n}\n@box(title:  'home', text: Hello   World)\napp.e-->db.w"
+	file, err := ParseFile(source)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(file.Statements) != 3 || len(file.Statements[0].Children) != 2 || !file.Statements[0].Children[1].BlankBefore {
+		t.Fatalf("unexpected statements: %+v", file.Statements)
+	}
+
+	want := "vm:VM@box {\n    app:Server\n\n    db:Database\n}\n\napp.e --> db.w\n\n@box(title: \"home\", text: Hello World)\n"
+	if got := Print(file); got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrintNode(t *testing.T) {
+	root := Node{
+		Type: NODE_ELEMENT,
+		Children: []Node{
+			{Type: "VM", Text: "vm", Children: []Node{{Type: "Server", Text: "app"}}},
+			{Type: "Database", Text: "db"},
+		},
+		Globals: map[string]State{
+			"db":     {Name: "db", PropsDef: "x:300"},
+			"vm":     {Name: "vm", PropsDef: `title:"home"`},
+			"layout": {Name: "layout", PropsDef: "w:600,h:400"},
+			"app":    {Name: "app", PropsDef: "x:20"},
+			"extra":  {Name: "extra", PropsDef: "y:1"},
+		},
+	}
+
+	want := "vm:VM {\n    app:Server\n}\ndb:Database@db\n\n@layout(w: 600, h: 400)\n@vm(title: \"home\")\n@app(x: 20)\n@db(x: 300)\n@extra(y: 1)\n"
+	if got := PrintNode(root); got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err := ParseFile(want); err != nil {
+		t.Fatalf("printed node does not parse: %v", err)
+	}
+
+	root.Connections = []Connection{{FromID: "app", FromAnchor: AnchorDescriptor{Raw: "e"}, ToID: "db", ToAnchor: AnchorDescriptor{Raw: "w"}}}
+	if got := PrintNode(root); !strings.Contains(got, "db:Database\n\napp.e --> db.w\n") {
+		t.Fatalf("expected the connection after the declarations, got:\n%s", got)
+	}
+}
+
+func TestParseFileRejectsAmbiguousState(t *testing.T) {
+	_, err := ParseFile("app:Server\n@app(x: 1)")
+	var parseErr *Error
+	if !errors.As(err, &parseErr) || !parseErr.HasSpan {
+		t.Fatalf("expected located error, got %v", err)
+	}
+}
+
+func TestStatePropsKeepTypedValues(t *testing.T) {
+	source := `a:Server@a
+@a(w: 120.5, y: &b.c, tags: ["x", "y"], labels: {tier: "web", n: 2}, fill: "rgb(1, 2, 3)")`
+
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	root, err := ParseWithSpans(tokens, spans)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := `w:120.5,y:&b.c,tags:[ "x","y"],labels:{ tier:"web",n:2 },fill:"rgb(1, 2, 3)"`
+	if got := root.Globals["a"].PropsDef; got != want {
+		t.Fatalf("unexpected props definition\n got: %s\nwant: %s", got, want)
+	}
+
+	file, err := ParseFile(source)
+	if err != nil {
+		t.Fatalf("parse file: %v", err)
+	}
+	var keys []string
+	for _, prop := range file.Statements[1].Props {
+		keys = append(keys, prop.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"w", "y", "tags", "labels", "fill"}) {
+		t.Fatalf("expected list and map values to stay in one prop, got keys %v", keys)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	source := `a:Server@a
+@a(bg: $primary, title: "costs $5", x: $gap * 2, y: $inner)
+@var(primary: "#2563eb", gap: 10 + 30, inner: $gap)`
+
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	root, err := ParseWithSpans(tokens, spans)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := `bg:"#2563eb",title:"costs $5",x:(10 + 30) * 2,y:(10 + 30)`
+	if got := strings.TrimSpace(root.Globals["a"].PropsDef); got != want {
+		t.Fatalf("unexpected props definition\n got: %s\nwant: %s", got, want)
+	}
+	if _, ok := root.Globals[VariablesState]; ok {
+		t.Fatalf("expected @var not to be stored as a state")
+	}
+
+	for _, tt := range []struct {
+		source, want, at string
+	}{
+		{source: "a:Server@a\n@a(x: $nope)", want: "undefined variable $nope", at: "$nope"},
+		{source: "@var(a: 1)\n@var(a: 2)", want: "variable $a is already defined", at: "@"},
+		{source: "@var(a: $b, b: $a)", want: "variable $a is defined in terms of itself", at: "@"},
+	} {
+		tokens, spans := tokenizer.TokenizeWithSpans(tt.source)
+		_, err := ParseWithSpans(tokens, spans)
+		var parseErr *Error
+		if !errors.As(err, &parseErr) || parseErr.Msg != tt.want {
+			t.Errorf("%q: expected %q, got %v", tt.source, tt.want, err)
+			continue
+		}
+		if got := tt.source[parseErr.Span.Start:parseErr.Span.End]; got != tt.at {
+			t.Errorf("%q: expected the error at %q, got %q", tt.source, tt.at, got)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	files := fstest.MapFS{
+		"shared/edge.nagare": {Data: []byte(`cdn:CDN@tinted
+gw:APIGateway
+cdn.e --> gw.w
+@cdn(x: 10)
+@gw(x: &cdn.r + 20)
+@tinted(bg: "#eee")
+@layout(w: 2000)`)},
+		"shared/palette.nagare": {Data: []byte(`@card(bg: "#fff")`)},
+		"diagrams/loop.nagare":  {Data: []byte(`@import "../shared/loop.nagare"`)},
+		"shared/loop.nagare":    {Data: []byte(`@import "/diagrams/loop.nagare"`)},
+	}
+	source := `@import "../shared/edge.nagare" as edge
+@import "../shared/palette.nagare"
+api:Server@card
+edge.gw.e --> api.w
+@edge.cdn(x: 30)
+@layout(w: 400)`
+
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	root, err := ParseWithImports(tokens, spans, Imports{FS: files, Path: "diagrams/main.nagare"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	var ids []string
+	for _, child := range root.Children {
+		ids = append(ids, child.Text)
+	}
+	if !reflect.DeepEqual(ids, []string{"edge.cdn", "edge.gw", "api"}) {
+		t.Fatalf("unexpected nodes %v", ids)
+	}
+	cdn, gw, api := root.Children[0], root.Children[1], root.Children[2]
+	if cdn.State != "edge.tinted" || cdn.States["edge.tinted"].PropsDef == "" {
+		t.Errorf("expected the imported state to be namespaced, got %q %v", cdn.State, cdn.States)
+	}
+	if got := cdn.States["edge.cdn"].PropsDef; !strings.Contains(got, "30") {
+		t.Errorf("expected the importing file to restyle edge.cdn, got %q", got)
+	}
+	if got := gw.States["edge.gw"].PropsDef; !strings.Contains(got, "&edge.cdn.r") {
+		t.Errorf("expected references to be namespaced, got %q", got)
+	}
+	if _, ok := api.States["card"]; !ok {
+		t.Errorf("expected the imported palette state to apply to api")
+	}
+	if got := root.Globals["layout"].PropsDef; !strings.Contains(got, "400") {
+		t.Errorf("expected the importing file to keep its canvas, got %q", got)
+	}
+	var conns []string
+	for _, conn := range root.Connections {
+		conns = append(conns, conn.FromID+"."+conn.FromAnchor.Raw+" --> "+conn.ToID+"."+conn.ToAnchor.Raw)
+	}
+	if !reflect.DeepEqual(conns, []string{"edge.cdn.e --> edge.gw.w", "edge.gw.e --> api.w"}) {
+		t.Errorf("unexpected connections %v", conns)
+	}
+
+	for _, tt := range []struct {
+		source string
+		fsys   fs.FS
+		want   string
+	}{
+		{source: `@import "x.nagare"`, want: `cannot import "x.nagare": imports are not enabled`},
+		{source: `@import "x.nagare"`, fsys: files, want: `cannot import "x.nagare": diagrams/x.nagare does not exist`},
+		{source: `@import "../../etc/passwd"`, fsys: files, want: `cannot import "../../etc/passwd": it is outside the import directory`},
+		{source: `@import "loop.nagare"`, fsys: files, want: "diagrams/loop.nagare:1:1: shared/loop.nagare:1:1: import cycle: diagrams/loop.nagare -> shared/loop.nagare -> diagrams/loop.nagare"},
+		{source: `@import "x.nagare" as 1-2`, fsys: files, want: `invalid namespace "1-2": use letters, digits and _`},
+	} {
+		tokens, spans := tokenizer.TokenizeWithSpans(tt.source)
+		_, err := ParseWithImports(tokens, spans, Imports{FS: tt.fsys, Path: "diagrams/main.nagare"})
+		var parseErr *Error
+		if !errors.As(err, &parseErr) || parseErr.Msg != tt.want || !parseErr.HasSpan {
+			t.Errorf("%q: expected %q, got %v", tt.source, tt.want, err)
+		}
+	}
+}
+
+func TestImportAfterDeclaration(t *testing.T) {
+	files := fstest.MapFS{"d.nagare": {Data: []byte("db:Database")}}
+	source := "api:Server\n@import \"d.nagare\"\napi:Server@card\n@import \"d.nagare\" as d"
+
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	root, err := ParseWithImports(tokens, spans, Imports{FS: files, Path: "main.nagare"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var nodes []string
+	for _, child := range root.Children {
+		nodes = append(nodes, child.Text+"@"+child.State)
+	}
+	if want := []string{"api@", "db@", "api@card", "d.db@"}; !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("expected the imports not to be read as states, got %v", nodes)
+	}
+
+	file, err := ParseFile(source)
+	if err != nil {
+		t.Fatalf("parse file: %v", err)
+	}
+	var kinds []StatementKind
+	for _, stmt := range file.Statements {
+		kinds = append(kinds, stmt.Kind)
+	}
+	if want := []StatementKind{StatementDeclaration, StatementImport, StatementDeclaration, StatementImport}; !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("unexpected statements %v", kinds)
+	}
+}
+
+func TestDiamondImportIsMergedOnce(t *testing.T) {
+	files := fstest.MapFS{
+		"b.nagare": {Data: []byte("@import \"d.nagare\"\nb:Server@card\nb.e --> db.w")},
+		"c.nagare": {Data: []byte("@import \"d.nagare\"\nc:Server@card\nc.e --> db.w")},
+		"d.nagare": {Data: []byte("@card(bg: \"#fff\")\ndb:Database")},
+		"e.nagare": {Data: []byte("@import \"d.nagare\" as d")},
+	}
+	source := "@import \"b.nagare\"\n@import \"c.nagare\"\n@import \"d.nagare\" as d\n@import \"e.nagare\""
+
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	root, err := ParseWithImports(tokens, spans, Imports{FS: files, Path: "top.nagare"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var nodes []string
+	for _, child := range root.Children {
+		nodes = append(nodes, child.Text)
+		if child.Type == "Server" {
+			if _, ok := child.States["card"]; !ok {
+				t.Errorf("expected the shared state to apply to %s", child.Text)
+			}
+		}
+	}
+	// d.nagare is merged once as it is and once under the d namespace, which e.nagare
+	// reaches too.
+	if want := []string{"db", "b", "c", "d.db"}; !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("expected each imported node once, got %v", nodes)
+	}
+	if len(root.Connections) != 2 {
+		t.Fatalf("expected the connections of b and c, got %+v", root.Connections)
+	}
+}
+
+func TestImportsWithoutResolver(t *testing.T) {
+	source := "@import 'shared/edge.nagare' as edge\napi:Server\nedge.cdn.e --> api.w\n@edge.cdn(x: &api.r)"
+
+	root, err := Parse(tokenizer.Tokenize(source))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if want := []Import{{Path: "shared/edge.nagare", Namespace: "edge"}}; !reflect.DeepEqual(root.Imports, want) {
+		t.Fatalf("expected the import to be recorded, got %+v", root.Imports)
+	}
+	if len(root.Connections) != 1 || root.Connections[0].FromID != "edge.cdn" {
+		t.Fatalf("expected a connection from edge.cdn, got %+v", root.Connections)
+	}
+
+	file, err := ParseFile(source)
+	if err != nil {
+		t.Fatalf("parse file: %v", err)
+	}
+	want := "@import \"shared/edge.nagare\" as edge\n\napi:Server\n\nedge.cdn.e --> api.w\n\n@edge.cdn(x: &api.r)\n"
+	if got := Print(file); got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestStateInheritanceAndSeveralStates(t *testing.T) {
+	source := `app:Server@base@loud
+db:Database@base
+@app(x: 1)
+@base(bg: "#fff", port: 80)
+@big(w: 300)
+@loud(extends: [base, big], bg: "#111")`
+
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	root, err := ParseWithSpans(tokens, spans)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	app := root.Children[0]
+	if !reflect.DeepEqual(app.StateNames(), []string{"base", "loud"}) {
+		t.Fatalf("expected app to apply base and loud, got %q", app.State)
+	}
+	if _, ok := app.States["app"]; !ok || len(app.States) != 3 {
+		t.Fatalf("expected the id state and both named states on app, got %v", app.States)
+	}
+	want := `bg:"#fff",port:80,w:300,bg:"#111"`
+	if got := strings.ReplaceAll(root.Globals["loud"].PropsDef, " ", ""); got != want {
+		t.Fatalf("unexpected props definition\n got: %s\nwant: %s", got, want)
+	}
+
+	file, err := ParseFile(source)
+	if err != nil {
+		t.Fatalf("parse file: %v", err)
+	}
+	if got := file.Statements[0].State; got != "base@loud" {
+		t.Fatalf("expected the declaration to keep both states, got %q", got)
+	}
+
+	for _, tt := range []struct {
+		source, want string
+	}{
+		{source: "@b(extends: a)\n@a(x: 1)", want: `@b extends unknown state "a": define it above @b`},
+		{source: "@b(extends: [])", want: "@b: extends needs a state name"},
+	} {
+		tokens, spans := tokenizer.TokenizeWithSpans(tt.source)
+		_, err := ParseWithSpans(tokens, spans)
+		var parseErr *Error
+		if !errors.As(err, &parseErr) || parseErr.Msg != tt.want || !parseErr.HasSpan {
+			t.Errorf("%q: expected %q, got %v", tt.source, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/props"
+)
+
+// indent is the indentation of container children.
+const indent = "    "
+
+// Print writes f in canonical form: imports first, then declarations, connections and
+// state definitions, each group separated by one blank line. Blank lines the author left
+// inside a group are kept, collapsed to one. Props are written as `key: value` joined
+// by ", ", and strings use double quotes.
+//
+// A definition right after a declaration without states would be read as its state, so
+// when no connection comes between them @layout and @var, which apply to no node, move
+// up after the imports, and a last declaration no remaining definition applies to moves
+// after the definitions.
+func Print(f *File) string {
+	var imports, globals, declarations, connections, states, last []Statement
+	for _, stmt := range f.Statements {
+		switch stmt.Kind {
+		case StatementImport:
+			imports = append(imports, stmt)
+		case StatementDeclaration:
+			declarations = append(declarations, stmt)
+		case StatementConnection:
+			connections = append(connections, stmt)
+		case StatementState:
+			states = append(states, stmt)
+		}
+	}
+	if n := len(declarations); n > 0 && len(connections) == 0 && !declarations[n-1].Container && declarations[n-1].State == "" {
+		rest := states[:0:0]
+		for _, stmt := range states {
+			if stmt.Name == "layout" || stmt.Name == VariablesState {
+				globals = append(globals, stmt)
+			} else {
+				rest = append(rest, stmt)
+			}
+		}
+		states = rest
+
+		if tail := declarations[n-1]; len(states) > 0 && !appliesTo(states, tail) {
+			declarations, last = declarations[:n-1], []Statement{tail}
+		}
+	}
+
+	var b strings.Builder
+	for _, group := range [][]Statement{imports, globals, declarations, connections, states, last} {
+		if len(group) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		printStatements(&b, group, "")
+	}
+	return b.String()
+}
+
+// appliesTo reports whether one of the definitions would apply to the declaration by its
+// id or type.
+func appliesTo(definitions []Statement, decl Statement) bool {
+	for _, def := range definitions {
+		if def.Name == decl.ID || def.Name == decl.Type {
+			return true
+		}
+	}
+	return false
+}
+
+func printStatements(b *strings.Builder, statements []Statement, prefix string) {
+	for i, stmt := range statements {
+		if i > 0 && stmt.BlankBefore {
+			b.WriteString("\n")
+		}
+		b.WriteString(prefix)
+		switch stmt.Kind {
+		case StatementDeclaration:
+			b.WriteString(stmt.ID)
+			if stmt.Type != "" {
+				b.WriteString(":" + stmt.Type)
+			}
+			if stmt.State != "" {
+				b.WriteString("@" + stmt.State)
+			}
+			if stmt.Container {
+				b.WriteString(" {\n")
+				printStatements(b, stmt.Children, prefix+indent)
+				b.WriteString(prefix + "}")
+			}
+		case StatementConnection:
+			b.WriteString(stmt.From + "." + stmt.FromAnchor + " --> " + stmt.To + "." + stmt.ToAnchor)
+		case StatementState:
+			b.WriteString("@" + stmt.Name + "(")
+			for j, prop := range stmt.Props {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				if prop.Key != "" {
+					b.WriteString(prop.Key + ": ")
+				}
+				b.WriteString(prop.Value)
+			}
+			b.WriteString(")")
+		case StatementImport:
+			quote := `"`
+			if strings.Contains(stmt.Import.Path, quote) {
+				quote = "'"
+			}
+			b.WriteString("@" + ImportKeyword + " " + quote + stmt.Import.Path + quote)
+			if stmt.Import.Namespace != "" {
+				b.WriteString(" as " + stmt.Import.Namespace)
+			}
+		}
+		b.WriteString("\n")
+	}
+}
+
+// PrintNode writes the diagram root describes in canonical form, for ASTs that were built
+// rather than parsed, such as imported ones. Nodes and connections keep their order. The
+// state of each node follows in declaration order, after @layout, and the remaining
+// states are sorted by name.
+func PrintNode(root Node) string {
+	f := &File{}
+	for _, imp := range root.Imports {
+		f.Statements = append(f.Statements, Statement{Kind: StatementImport, Import: imp})
+	}
+
+	var declared []string
+	var declarations func(nodes []Node) []Statement
+	declarations = func(nodes []Node) []Statement {
+		var statements []Statement
+		for _, node := range nodes {
+			stmt := Statement{Kind: StatementDeclaration, ID: node.Text, State: node.State}
+			if node.Type != NODE_ELEMENT && node.Type != NODE_CONTAINER {
+				stmt.Type = string(node.Type)
+			}
+			if len(node.Children) > 0 || node.Type == NODE_CONTAINER {
+				stmt.Container = true
+			}
+			declared = append(declared, node.Text)
+			stmt.Children = declarations(node.Children)
+			statements = append(statements, stmt)
+		}
+		return statements
+	}
+	f.Statements = append(f.Statements, declarations(root.Children)...)
+	// A definition right after a declaration without states would be read as its state,
+	// so the last declaration names its id state when no connection comes between.
+	if n := len(f.Statements); n > 0 && len(root.Connections) == 0 {
+		last := &f.Statements[n-1]
+		if _, ok := root.Globals[last.ID]; ok && last.Kind == StatementDeclaration && !last.Container && last.State == "" {
+			last.State = last.ID
+		}
+	}
+
+	for _, conn := range root.Connections {
+		f.Statements = append(f.Statements, Statement{
+			Kind:       StatementConnection,
+			From:       conn.FromID,
+			FromAnchor: conn.FromAnchor.Raw,
+			To:         conn.ToID,
+			ToAnchor:   conn.ToAnchor.Raw,
+		})
+	}
+
+	printed := make(map[string]bool)
+	state := func(name string) {
+		def, ok := root.Globals[name]
+		if !ok || printed[name] {
+			return
+		}
+		printed[name] = true
+		stmt := Statement{Kind: StatementState, Name: name}
+		for _, pair := range props.Pairs(def.PropsDef) {
+			stmt.Props = append(stmt.Props, Prop{Key: pair.Key, Value: pair.Value})
+		}
+		f.Statements = append(f.Statements, stmt)
+	}
+	state("layout")
+	for _, name := range declared {
+		state(name)
+	}
+	rest := make([]string, 0, len(root.Globals))
+	for name := range root.Globals {
+		rest = append(rest, name)
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		state(name)
+	}
+	return Print(f)
+}
@@ -0,0 +1,370 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+// StatementKind identifies the kind of a top-level or container statement.
+type StatementKind int
+
+const (
+	StatementDeclaration StatementKind = iota // id:Type@state@state, optionally with { children }
+	StatementConnection                       // from.anchor --> to.anchor
+	StatementState                            // @name(props)
+	StatementImport                           // @import "path" as ns
+)
+
+// File is the concrete syntax of a diagram: its statements in source order plus the
+// trivia needed to print it back. Unlike Node it keeps states, connections and
+// declarations where they were written.
+type File struct {
+	Statements []Statement
+}
+
+// Statement is one declaration, connection, state definition or import.
+type Statement struct {
+	Kind StatementKind
+	Span tokenizer.Span
+	// BlankBefore records a blank line between this statement and the previous one.
+	BlankBefore bool
+
+	// Declarations
+	ID        string
+	Type      string
+	State     string // Joined by @ when there are several, as in Node.State
+	Container bool
+	Children  []Statement
+
+	// Connections
+	From       string
+	FromAnchor string
+	To         string
+	ToAnchor   string
+	FromSpan   tokenizer.Span // Span of From
+	ToSpan     tokenizer.Span // Span of To
+
+	// State definitions
+	Name  string
+	Props []Prop
+
+	// Imports
+	Import Import
+}
+
+// Prop is one key: value pair of a state definition. Value is the source text of the
+// value with whitespace between tokens collapsed; Key is empty for a bare value.
+type Prop struct {
+	Key       string
+	Value     string
+	Span      tokenizer.Span
+	KeySpan   tokenizer.Span
+	ValueSpan tokenizer.Span
+}
+
+// ParseFile parses source into its concrete syntax. It accepts the same input as Parse
+// and reads it the same way, so printing a File never changes what a diagram means.
+func ParseFile(source string) (*File, error) {
+	tokens, spans := tokenizer.TokenizeWithSpans(source)
+	if _, err := ParseWithSpans(tokens, spans); err != nil {
+		return nil, err
+	}
+	tokens, spans = joinNamespaces(tokens, spans)
+
+	s := &syntaxParser{source: source, tokens: tokens, spans: spans}
+	statements, err := s.statements(0)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Statements: statements}, nil
+}
+
+type syntaxParser struct {
+	source  string
+	tokens  []tokenizer.Token
+	spans   []tokenizer.Span
+	current int
+	lastEnd int
+}
+
+func (s *syntaxParser) is(i int, typ tokenizer.TokenType) bool {
+	return i < len(s.tokens) && s.tokens[i].Type == typ
+}
+
+// begin starts a statement at token i, recording whether a blank line precedes it.
+func (s *syntaxParser) begin(kind StatementKind, i int) Statement {
+	gap := s.source[s.lastEnd:s.spans[i].Start]
+	return Statement{
+		Kind:        kind,
+		Span:        tokenizer.Span{Start: s.spans[i].Start},
+		BlankBefore: s.lastEnd > 0 && strings.Count(gap, "\n") > 1,
+	}
+}
+
+func (s *syntaxParser) end(stmt *Statement, last int) {
+	stmt.Span.End = s.spans[last].End
+	s.lastEnd = stmt.Span.End
+}
+
+// statements mirrors Parser.parse: at depth 0 it reads until the end of input, inside a
+// container until the closing brace.
+func (s *syntaxParser) statements(depth int) ([]Statement, error) {
+	var statements []Statement
+	for s.current < len(s.tokens) {
+		i := s.current
+		switch s.tokens[i].Type {
+		case tokenizer.AT:
+			if isImport(s.tokens, i) {
+				imp, next, _ := readImport(s.tokens, i) // Parse has checked it
+				stmt := s.begin(StatementImport, i)
+				stmt.Import = imp
+				s.end(&stmt, next-1)
+				s.current = next
+				statements = append(statements, stmt)
+				continue
+			}
+			stmt, err := s.state()
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, stmt)
+		case tokenizer.RIGHT_BRACE:
+			if depth > 0 {
+				return statements, nil
+			}
+			s.current++
+		case tokenizer.IDENTIFIER:
+			// Same shape test as tryParseConnection, which also needs a token after it.
+			if i+6 < len(s.tokens) && s.is(i+1, tokenizer.DOT) && s.is(i+2, tokenizer.IDENTIFIER) && s.is(i+3, tokenizer.ARROW) &&
+				s.is(i+4, tokenizer.IDENTIFIER) && s.is(i+5, tokenizer.DOT) && s.is(i+6, tokenizer.IDENTIFIER) {
+				stmt := s.begin(StatementConnection, i)
+				stmt.From = strings.TrimSpace(s.tokens[i].Value)
+				stmt.FromAnchor = strings.TrimSpace(s.tokens[i+2].Value)
+				stmt.To = strings.TrimSpace(s.tokens[i+4].Value)
+				stmt.ToAnchor = strings.TrimSpace(s.tokens[i+6].Value)
+				stmt.FromSpan = s.spans[i]
+				stmt.ToSpan = s.spans[i+4]
+				s.end(&stmt, i+6)
+				s.current = i + 7
+				statements = append(statements, stmt)
+				continue
+			}
+
+			stmt, err := s.declaration(depth)
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, stmt)
+		default:
+			// Stray tokens are skipped by Parse as well.
+			s.current++
+		}
+	}
+	return statements, nil
+}
+
+func (s *syntaxParser) declaration(depth int) (Statement, error) {
+	i := s.current
+	stmt := s.begin(StatementDeclaration, i)
+	stmt.ID = strings.TrimSpace(s.tokens[i].Value)
+	last := i
+	i++
+
+	if s.is(i, tokenizer.COLON) && s.is(i+1, tokenizer.IDENTIFIER) {
+		stmt.Type = s.tokens[i+1].Value
+		last = i + 1
+		i += 2
+	}
+	var states []string
+	for s.is(i, tokenizer.AT) && s.is(i+1, tokenizer.IDENTIFIER) {
+		if isImport(s.tokens, i) {
+			break // Parse reads it as an import
+		}
+		if len(states) > 0 && s.is(i+2, tokenizer.LEFT_PAREN) {
+			break // Parse reads it as a definition
+		}
+		states = append(states, s.tokens[i+1].Value)
+		last = i + 1
+		i += 2
+		// Parse reads a following ( as stray tokens, not as a state definition.
+		if s.is(i, tokenizer.LEFT_PAREN) {
+			s.current = i
+			return Statement{}, s.errorAt(i, "ambiguous state: @%s( directly after a declaration is read as the state of %s, not as a definition", states[len(states)-1], stmt.ID)
+		}
+	}
+	stmt.State = strings.Join(states, stateSeparator)
+	s.end(&stmt, last)
+	s.current = i
+
+	if !s.is(i, tokenizer.LEFT_BRACE) {
+		return stmt, nil
+	}
+	stmt.Container = true
+	s.current++
+	s.lastEnd = s.spans[i].End
+	children, err := s.statements(depth + 1)
+	if err != nil {
+		return Statement{}, err
+	}
+	stmt.Children = children
+	if s.current < len(s.tokens) {
+		s.end(&stmt, s.current) // closing brace
+		s.current++
+	}
+	return stmt, nil
+}
+
+func (s *syntaxParser) state() (Statement, error) {
+	at := s.current
+	stmt := s.begin(StatementState, at)
+	stmt.Name = s.tokens[at+1].Value
+	i := at + 3 // Past @, name and (
+
+	depth, nested := 1, 0 // Parentheses, and the braces and brackets of map and list values
+	inQuotes := false
+	propStart := i
+	for ; i < len(s.tokens); i++ {
+		tok := s.tokens[i]
+		switch {
+		case isQuote(tok):
+			inQuotes = !inQuotes
+		case inQuotes:
+		case tok.Type == tokenizer.LEFT_PAREN:
+			depth++
+		case tok.Type == tokenizer.RIGHT_PAREN:
+			depth--
+		case tok.Type == tokenizer.LEFT_BRACE:
+			nested++
+		case tok.Type == tokenizer.RIGHT_BRACE:
+			nested--
+		case tok.Type == tokenizer.IDENTIFIER:
+			// The tokenizer keeps [ and ] inside words, as in [a or b]
+			nested += strings.Count(tok.Value, "[") - strings.Count(tok.Value, "]")
+		case tok.Type == tokenizer.COMMA && depth == 1 && nested == 0:
+			stmt.Props = s.appendProp(stmt.Props, propStart, i)
+			propStart = i + 1
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	stmt.Props = s.appendProp(stmt.Props, propStart, i)
+	s.end(&stmt, i)
+	s.current = i + 1
+	return stmt, nil
+}
+
+// appendProp adds the prop made of tokens [from, to), if any.
+func (s *syntaxParser) appendProp(props []Prop, from, to int) []Prop {
+	if from >= to {
+		return props
+	}
+
+	colon := -1
+	inQuotes := false
+	for i := from; i < to && colon < 0; i++ {
+		if isQuote(s.tokens[i]) {
+			inQuotes = !inQuotes
+		} else if !inQuotes && s.tokens[i].Type == tokenizer.COLON {
+			colon = i
+		}
+	}
+
+	prop := Prop{Span: tokenizer.Span{Start: s.spans[from].Start, End: s.spans[to-1].End}}
+	if colon < 0 {
+		prop.Value = s.text(from, to)
+		prop.ValueSpan = prop.Span
+	} else {
+		prop.Key = s.text(from, colon)
+		prop.Value = s.text(colon+1, to)
+		prop.KeySpan = tokenizer.Span{Start: s.spans[from].Start, End: s.spans[colon].Start}
+		if colon > from {
+			prop.KeySpan.End = s.spans[colon-1].End
+		}
+		if colon+1 < to {
+			prop.ValueSpan = tokenizer.Span{Start: s.spans[colon+1].Start, End: s.spans[to-1].End}
+		} else {
+			prop.ValueSpan = tokenizer.Span{Start: s.spans[colon].End, End: s.spans[colon].End}
+		}
+	}
+	return append(props, prop)
+}
+
+// text prints tokens [from, to) with one space wherever the source separated them,
+// and quoted strings in double quotes unless they contain one.
+func (s *syntaxParser) text(from, to int) string {
+	var b strings.Builder
+	for i := from; i < to; i++ {
+		tok := s.tokens[i]
+		if i > from && s.spans[i].Start > s.spans[i-1].End {
+			b.WriteByte(' ')
+		}
+		if !isQuote(tok) {
+			b.WriteString(tokenText(tok))
+			continue
+		}
+
+		// A quoted string is the quote, its content (absent when empty) and the
+		// closing quote (absent when unterminated).
+		content, closed := "", false
+		j := i + 1
+		if j < to && !isQuote(s.tokens[j]) {
+			content = s.tokens[j].Value
+			j++
+		}
+		if j < to && s.tokens[j].Value == tok.Value {
+			closed = true
+		} else {
+			j--
+		}
+		quote := `"`
+		if strings.Contains(content, `"`) {
+			quote = tok.Value
+		}
+		b.WriteString(quote + content)
+		if closed {
+			b.WriteString(quote)
+		}
+		i = j
+	}
+	return b.String()
+}
+
+func isQuote(tok tokenizer.Token) bool {
+	return tok.Type == tokenizer.IDENTIFIER && (tok.Value == `"` || tok.Value == `'`)
+}
+
+// tokenText returns the source spelling of a token.
+func tokenText(tok tokenizer.Token) string {
+	switch tok.Type {
+	case tokenizer.LEFT_BRACE:
+		return "{"
+	case tokenizer.RIGHT_BRACE:
+		return "}"
+	case tokenizer.COLON:
+		return ":"
+	case tokenizer.AT:
+		return "@"
+	case tokenizer.LEFT_PAREN:
+		return "("
+	case tokenizer.RIGHT_PAREN:
+		return ")"
+	case tokenizer.COMMA:
+		return ","
+	case tokenizer.EQUALS:
+		return "="
+	case tokenizer.ARROW:
+		return "-->"
+	case tokenizer.DOT:
+		return "."
+	case tokenizer.AMPERSAND:
+		return "&"
+	}
+	return tok.Value
+}
+
+// errorAt reports an error located at token i.
+func (s *syntaxParser) errorAt(i int, format string, args ...interface{}) error {
+	return (&Parser{tokens: s.tokens, spans: s.spans}).errorAt(i, format, args...)
+}
@@ -0,0 +1,168 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/props"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+// VariablesState is the reserved state that defines variables:
+//
+//	@var(primary: "#2563eb", gap: 40)
+//	@api(bg: $primary, x: $gap * 2)
+//
+// Variables are visible to every state in the file, wherever their @var appears, and may
+// use each other. A $name is replaced by its value anywhere in a prop value except inside
+// quoted strings. Values that are expressions, such as 10 + 5, are substituted in
+// parentheses so they keep their meaning. Using an undefined variable, defining one twice
+// or defining one in terms of itself is a parse error.
+const VariablesState = "var"
+
+// collectVariables reads every @var block before parsing, so variables can be used
+// above the block that defines them.
+func (p *Parser) collectVariables() error {
+	raw := make(map[string]string)
+	defined := make(map[string]int) // Token index of the @var defining each name
+	for i := 0; i+2 < len(p.tokens); i++ {
+		if p.tokens[i].Type != tokenizer.AT || p.tokens[i+1].Type != tokenizer.IDENTIFIER ||
+			p.tokens[i+1].Value != VariablesState || p.tokens[i+2].Type != tokenizer.LEFT_PAREN {
+			continue
+		}
+
+		// Without a variable table parseState keeps $name references as written.
+		block := &Parser{tokens: p.tokens, spans: p.spans, current: i}
+		state, err := block.parseState()
+		if err != nil {
+			return err
+		}
+		for _, pair := range props.Pairs(state.PropsDef) {
+			if !isVariableName(pair.Key) {
+				return p.errorAt(i, "invalid variable name %q: use letters, digits and _", pair.Key)
+			}
+			if _, ok := raw[pair.Key]; ok {
+				return p.errorAt(i, "variable $%s is already defined", pair.Key)
+			}
+			raw[pair.Key] = pair.Value
+			defined[pair.Key] = i
+		}
+	}
+
+	p.vars = make(map[string]string, len(raw))
+	resolving := make(map[string]bool)
+	var resolve func(name string) (string, error)
+	resolve = func(name string) (string, error) {
+		if value, ok := p.vars[name]; ok {
+			return value, nil
+		}
+		value, ok := raw[name]
+		if !ok {
+			return "", fmt.Errorf("undefined variable $%s", name)
+		}
+		if resolving[name] {
+			return "", fmt.Errorf("variable $%s is defined in terms of itself", name)
+		}
+		resolving[name] = true
+		value, err := substituteVariables(value, resolve)
+		resolving[name] = false
+		if err != nil {
+			return "", err
+		}
+		p.vars[name] = value
+		return value, nil
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Report the same error every run
+	for _, name := range names {
+		if _, err := resolve(name); err != nil {
+			return p.errorAt(defined[name], "%v", err)
+		}
+	}
+	return nil
+}
+
+// variable returns the value of $name.
+func (p *Parser) variable(name string) (string, error) {
+	value, ok := p.vars[name]
+	if !ok {
+		return "", fmt.Errorf("undefined variable $%s", name)
+	}
+	return value, nil
+}
+
+// substituteVariables replaces every $name outside double quotes in text with its value.
+func substituteVariables(text string, lookup func(name string) (string, error)) (string, error) {
+	if !strings.Contains(text, "$") {
+		return text, nil
+	}
+
+	var b strings.Builder
+	inQuotes := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c == '"' {
+			inQuotes = !inQuotes
+		}
+		if c != '$' || inQuotes {
+			b.WriteByte(c)
+			continue
+		}
+
+		end := i + 1
+		for end < len(text) && isVariableByte(text[end], end == i+1) {
+			end++
+		}
+		if end == i+1 {
+			b.WriteByte(c) // A lone $ is literal
+			continue
+		}
+		value, err := lookup(text[i+1 : end])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(substitution(value))
+		i = end - 1
+	}
+	return b.String(), nil
+}
+
+// substitution returns value as it is inserted into a prop value: in parentheses when it
+// is an expression, so $gap * 2 with gap: 10 + 5 is 30.
+func substitution(value string) string {
+	if value == "" || strings.ContainsAny(value[:1], `"[{(`) {
+		return value
+	}
+	depth := 0
+	for i := 1; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case depth == 0 && strings.IndexByte("+-*/ ", c) >= 0:
+			return "(" + value + ")"
+		}
+	}
+	return value
+}
+
+func isVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isVariableByte(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isVariableByte(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && c >= '0' && c <= '9'
+}
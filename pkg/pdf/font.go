@@ -0,0 +1,192 @@
+package pdf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// fontObjects is the number of objects a font is written as: the font, its CID font,
+// its descriptor, the font file and the map back to Unicode.
+const fontObjects = 5
+
+// Font is a TrueType font embedded in a Document. Text is encoded as glyph ids, so any
+// character the font has a glyph for can be set, and maps back to Unicode so it can be
+// searched and copied.
+type Font struct {
+	name  string // Resource name, such as F1
+	data  []byte
+	sfnt  *sfnt.Font
+	buf   sfnt.Buffer
+	units fixed.Int26_6
+	used  map[sfnt.GlyphIndex]rune
+}
+
+// LoadFont parses the TrueType font ttf for setting text on the pages of d. It is
+// embedded when the document is written, if any text is set in it.
+func (d *Document) LoadFont(ttf []byte) (*Font, error) {
+	parsed, err := sfnt.Parse(ttf)
+	if err != nil {
+		return nil, fmt.Errorf("pdf: parse font: %w", err)
+	}
+	f := &Font{
+		name:  fmt.Sprintf("F%d", len(d.fonts)+1),
+		data:  ttf,
+		sfnt:  parsed,
+		units: fixed.I(int(parsed.UnitsPerEm())),
+		used:  make(map[sfnt.GlyphIndex]rune),
+	}
+	d.fonts = append(d.fonts, f)
+	return f, nil
+}
+
+// toUnits converts a length at the font's em size to thousandths of an em, the unit of
+// PDF glyph metrics.
+func (f *Font) toUnits(v fixed.Int26_6) float64 {
+	return float64(v) / float64(f.units) * 1000
+}
+
+// advance returns the advance width of glyph in thousandths of an em.
+func (f *Font) advance(glyph sfnt.GlyphIndex) float64 {
+	adv, err := f.sfnt.GlyphAdvance(&f.buf, glyph, f.units, font.HintingNone)
+	if err != nil {
+		return 0
+	}
+	return f.toUnits(adv)
+}
+
+func (f *Font) glyph(r rune) sfnt.GlyphIndex {
+	g, err := f.sfnt.GlyphIndex(&f.buf, r)
+	if err != nil {
+		return 0
+	}
+	return g
+}
+
+// Width returns the width of s set in f at size points.
+func (f *Font) Width(s string, size float64) float64 {
+	total := 0.0
+	for _, r := range s {
+		total += f.advance(f.glyph(r))
+	}
+	return total * size / 1000
+}
+
+// Metrics returns how far the glyphs of f at size points rise above the baseline and
+// fall below it.
+func (f *Font) Metrics(size float64) (ascent, descent float64) {
+	m, err := f.sfnt.Metrics(&f.buf, f.units, font.HintingNone)
+	if err != nil {
+		return size, 0
+	}
+	return f.toUnits(m.Ascent) * size / 1000, f.toUnits(m.Descent) * size / 1000
+}
+
+// encode returns s as the hex string of its glyph ids, and remembers the glyphs used.
+func (f *Font) encode(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		g := f.glyph(r)
+		if _, ok := f.used[g]; !ok {
+			f.used[g] = r
+		}
+		fmt.Fprintf(&b, "%04X", uint16(g))
+	}
+	return b.String()
+}
+
+// write writes f as a Type 0 font of glyph ids, the objects numbered from id on.
+func (f *Font) write(out *objectWriter, id int) error {
+	cid, descriptor, file, toUnicode := id+1, id+2, id+3, id+4
+
+	baseName, err := f.sfnt.Name(&f.buf, sfnt.NameIDPostScript)
+	if err != nil || baseName == "" {
+		baseName = f.name
+	}
+	baseName = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || strings.ContainsRune("()<>[]{}/%#", r) {
+			return -1
+		}
+		return r
+	}, baseName)
+
+	glyphs := make([]sfnt.GlyphIndex, 0, len(f.used))
+	for g := range f.used {
+		glyphs = append(glyphs, g)
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+
+	out.object(id, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		baseName, cid, toUnicode))
+
+	var widths strings.Builder
+	for _, g := range glyphs {
+		fmt.Fprintf(&widths, "%d [%s] ", g, number(f.advance(g)))
+	}
+	out.object(cid, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /W [%s] /CIDToGIDMap /Identity >>",
+		baseName, descriptor, strings.TrimSpace(widths.String())))
+
+	m, err := f.sfnt.Metrics(&f.buf, f.units, font.HintingNone)
+	if err != nil {
+		return fmt.Errorf("pdf: font metrics: %w", err)
+	}
+	bounds, err := f.sfnt.Bounds(&f.buf, f.units, font.HintingNone)
+	if err != nil {
+		return fmt.Errorf("pdf: font bounds: %w", err)
+	}
+	flags := 32 // Nonsymbolic
+	italic := 0.0
+	if post := f.sfnt.PostTable(); post != nil {
+		if post.IsFixedPitch {
+			flags |= 1
+		}
+		italic = post.ItalicAngle
+	}
+	capHeight := m.CapHeight
+	if capHeight == 0 {
+		capHeight = m.Ascent
+	}
+	// Bounds has y growing downwards, and the font box upwards.
+	out.object(descriptor, fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags %d /FontBBox [%s %s %s %s] /ItalicAngle %s /Ascent %s /Descent %s /CapHeight %s /StemV 80 /FontFile2 %d 0 R >>",
+		baseName, flags,
+		number(f.toUnits(bounds.Min.X)), number(-f.toUnits(bounds.Max.Y)), number(f.toUnits(bounds.Max.X)), number(-f.toUnits(bounds.Min.Y)),
+		number(italic), number(f.toUnits(m.Ascent)), number(-f.toUnits(m.Descent)), number(f.toUnits(capHeight)), file))
+
+	if err := out.stream(file, fmt.Sprintf("/Length1 %d", len(f.data)), f.data); err != nil {
+		return err
+	}
+	return out.stream(toUnicode, "", f.toUnicode(glyphs))
+}
+
+// toUnicode returns the CMap that maps the glyph ids text is encoded as back to the
+// characters they were set for.
+func (f *Font) toUnicode(glyphs []sfnt.GlyphIndex) []byte {
+	var b strings.Builder
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	b.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	b.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	b.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// A bfchar block holds at most 100 mappings.
+	for start := 0; start < len(glyphs); start += 100 {
+		end := start + 100
+		if end > len(glyphs) {
+			end = len(glyphs)
+		}
+		fmt.Fprintf(&b, "%d beginbfchar\n", end-start)
+		for _, g := range glyphs[start:end] {
+			var utf strings.Builder
+			for _, unit := range utf16.Encode([]rune{f.used[g]}) {
+				fmt.Fprintf(&utf, "%04X", unit)
+			}
+			fmt.Fprintf(&b, "<%04X> <%s>\n", uint16(g), utf.String())
+		}
+		b.WriteString("endbfchar\n")
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return []byte(b.String())
+}
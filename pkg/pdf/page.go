@@ -0,0 +1,174 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+// LineCap is how the ends of open stroked lines are drawn.
+type LineCap int
+
+const (
+	ButtCap LineCap = iota
+	RoundCap
+	SquareCap
+)
+
+// LineJoin is how the corners of stroked lines are drawn.
+type LineJoin int
+
+const (
+	MiterJoin LineJoin = iota
+	RoundJoin
+	BevelJoin
+)
+
+// graphicsState is what the page remembers between Save and Restore, to avoid setting
+// an opacity that is already set.
+type graphicsState struct {
+	fillAlpha, strokeAlpha float64
+}
+
+// Page is a page of a Document. Paths are built with MoveTo, LineTo, CurveTo and
+// ClosePath, then painted with Fill, Stroke or FillStroke in the current colours.
+type Page struct {
+	doc           *Document
+	width, height float64
+	content       bytes.Buffer
+	state         []graphicsState
+}
+
+func (p *Page) op(format string, args ...interface{}) {
+	fmt.Fprintf(&p.content, format, args...)
+	p.content.WriteByte('\n')
+}
+
+func (p *Page) numbers(values ...float64) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = number(v)
+	}
+	return strings.Join(s, " ")
+}
+
+// Save pushes the graphics state: colours, line style and transformation.
+func (p *Page) Save() {
+	p.state = append(p.state, p.state[len(p.state)-1])
+	p.op("q")
+}
+
+// Restore pops the graphics state pushed by the last Save.
+func (p *Page) Restore() {
+	if len(p.state) > 1 {
+		p.state = p.state[:len(p.state)-1]
+	}
+	p.op("Q")
+}
+
+// Transform applies the affine transformation [a b c d e f], as in SVG's matrix(), to
+// what is drawn next.
+func (p *Page) Transform(a, b, c, d, e, f float64) {
+	p.op("%s cm", p.numbers(a, b, c, d, e, f))
+}
+
+// MoveTo starts a new subpath at (x, y).
+func (p *Page) MoveTo(x, y float64) {
+	p.op("%s m", p.numbers(x, y))
+}
+
+// LineTo adds a straight line to (x, y) to the path.
+func (p *Page) LineTo(x, y float64) {
+	p.op("%s l", p.numbers(x, y))
+}
+
+// CurveTo adds a cubic Bézier curve to (x, y), with control points (x1, y1) and (x2,
+// y2), to the path.
+func (p *Page) CurveTo(x1, y1, x2, y2, x, y float64) {
+	p.op("%s c", p.numbers(x1, y1, x2, y2, x, y))
+}
+
+// ClosePath closes the current subpath with a line back to its start.
+func (p *Page) ClosePath() {
+	p.op("h")
+}
+
+// Rectangle adds a closed rectangle to the path.
+func (p *Page) Rectangle(x, y, width, height float64) {
+	p.op("%s re", p.numbers(x, y, width, height))
+}
+
+// Fill fills the path with the fill colour, and ends it.
+func (p *Page) Fill() {
+	p.op("f")
+}
+
+// Stroke strokes the path with the stroke colour and line style, and ends it.
+func (p *Page) Stroke() {
+	p.op("S")
+}
+
+// FillStroke fills then strokes the path, and ends it.
+func (p *Page) FillStroke() {
+	p.op("B")
+}
+
+// SetFillColor sets the colour paths are filled and text is set in, including its
+// opacity.
+func (p *Page) SetFillColor(c color.Color) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	p.op("%s rg", p.numbers(float64(n.R)/255, float64(n.G)/255, float64(n.B)/255))
+	p.setAlpha(float64(n.A)/255, false)
+}
+
+// SetStrokeColor sets the colour paths are stroked in, including its opacity.
+func (p *Page) SetStrokeColor(c color.Color) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	p.op("%s RG", p.numbers(float64(n.R)/255, float64(n.G)/255, float64(n.B)/255))
+	p.setAlpha(float64(n.A)/255, true)
+}
+
+func (p *Page) setAlpha(a float64, stroke bool) {
+	state := &p.state[len(p.state)-1]
+	current := &state.fillAlpha
+	if stroke {
+		current = &state.strokeAlpha
+	}
+	if *current == a {
+		return
+	}
+	*current = a
+	p.op("/%s gs", p.doc.alpha(a, stroke))
+}
+
+// SetLineWidth sets the width of stroked lines.
+func (p *Page) SetLineWidth(width float64) {
+	p.op("%s w", number(width))
+}
+
+// SetLineCap sets how the ends of open stroked lines are drawn.
+func (p *Page) SetLineCap(c LineCap) {
+	p.op("%d J", c)
+}
+
+// SetLineJoin sets how the corners of stroked lines are drawn.
+func (p *Page) SetLineJoin(j LineJoin) {
+	p.op("%d j", j)
+}
+
+// SetDash strokes lines as dashes and gaps of the lengths in pattern, starting phase
+// into it. An empty pattern strokes solid lines.
+func (p *Page) SetDash(pattern []float64, phase float64) {
+	p.op("[%s] %s d", p.numbers(pattern...), number(phase))
+}
+
+// Text sets s in f at size points, in the fill colour, starting at (x, y) on its
+// baseline.
+func (p *Page) Text(f *Font, size, x, y float64, s string) {
+	if s == "" {
+		return
+	}
+	// The text matrix flips y back, or the page's flip would set glyphs upside down.
+	p.op("BT /%s %s Tf %s Tm <%s> Tj ET", f.name, number(size), p.numbers(1, 0, 0, -1, x, y), f.encode(s))
+}
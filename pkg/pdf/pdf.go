@@ -0,0 +1,195 @@
+// Package pdf writes vector PDF documents: pages of filled and stroked paths and of
+// text set in embedded TrueType fonts. It implements the small part of PDF 1.7 that
+// diagrams need, in pure Go, and writes the same bytes for the same drawing.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Document is a PDF document being drawn. Add pages with AddPage and fonts with
+// LoadFont, draw on the pages, then Write the document.
+type Document struct {
+	pages  []*Page
+	fonts  []*Font
+	alphas map[string]float64 // Graphics states setting an opacity, by resource name
+}
+
+// New returns an empty document.
+func New() *Document {
+	return &Document{alphas: make(map[string]float64)}
+}
+
+// AddPage adds a page of width by height points to the end of d. The origin of the page
+// is its top left corner and y grows downwards, as in SVG.
+func (d *Document) AddPage(width, height float64) *Page {
+	p := &Page{doc: d, width: width, height: height, state: []graphicsState{{fillAlpha: 1, strokeAlpha: 1}}}
+	// Flip the y axis of PDF, which grows upwards from the bottom left corner.
+	fmt.Fprintf(&p.content, "1 0 0 -1 0 %s cm\n", number(height))
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Pages returns the number of pages of d.
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+// alpha returns the name of the graphics state that sets the fill opacity, or the
+// stroke opacity if stroke is set, to a.
+func (d *Document) alpha(a float64, stroke bool) string {
+	prefix := "Fa"
+	if stroke {
+		prefix = "Sa"
+	}
+	name := prefix + strconv.Itoa(int(a*1000+0.5))
+	d.alphas[name] = a
+	return name
+}
+
+// Write writes d to w as a PDF file.
+func (d *Document) Write(w io.Writer) error {
+	if len(d.pages) == 0 {
+		return fmt.Errorf("pdf: document has no pages")
+	}
+	out := &objectWriter{w: w}
+	out.printf("%%PDF-1.7\n%%\xe2\xe3\xcf\xd3\n")
+
+	// Number the objects: the catalog, page tree, info and shared resources first, then
+	// each page with its content, then each font used.
+	const catalog, pageTree, info, resources = 1, 2, 3, 4
+	next := resources + 1
+	pageIDs := make([]int, len(d.pages))
+	for i := range d.pages {
+		pageIDs[i] = next
+		next += 2 // The page and its content stream
+	}
+	var fonts []*Font
+	fontIDs := make(map[*Font]int)
+	for _, f := range d.fonts {
+		if len(f.used) == 0 {
+			continue // Fonts nothing was set in are not embedded
+		}
+		fonts = append(fonts, f)
+		fontIDs[f] = next
+		next += fontObjects
+	}
+
+	out.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pageTree))
+	kids := make([]string, len(pageIDs))
+	for i, id := range pageIDs {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	out.object(pageTree, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pageIDs)))
+	out.object(info, "<< /Producer (nagare) >>")
+
+	var res strings.Builder
+	res.WriteString("<< /ProcSet [/PDF /Text]")
+	if len(fonts) > 0 {
+		res.WriteString(" /Font <<")
+		for _, f := range fonts {
+			fmt.Fprintf(&res, " /%s %d 0 R", f.name, fontIDs[f])
+		}
+		res.WriteString(" >>")
+	}
+	if len(d.alphas) > 0 {
+		res.WriteString(" /ExtGState <<")
+		names := make([]string, 0, len(d.alphas))
+		for name := range d.alphas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key := "ca"
+			if strings.HasPrefix(name, "Sa") {
+				key = "CA"
+			}
+			fmt.Fprintf(&res, " /%s << /Type /ExtGState /%s %s >>", name, key, number(d.alphas[name]))
+		}
+		res.WriteString(" >>")
+	}
+	res.WriteString(" >>")
+	out.object(resources, res.String())
+
+	for i, p := range d.pages {
+		id := pageIDs[i]
+		out.object(id, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %d 0 R /Contents %d 0 R >>",
+			pageTree, number(p.width), number(p.height), resources, id+1))
+		if err := out.stream(id+1, "", p.content.Bytes()); err != nil {
+			return err
+		}
+	}
+	for _, f := range fonts {
+		if err := f.write(out, fontIDs[f]); err != nil {
+			return err
+		}
+	}
+
+	xref := out.n
+	out.printf("xref\n0 %d\n0000000000 65535 f \n", next)
+	for id := 1; id < next; id++ {
+		out.printf("%010d 00000 n \n", out.offsets[id])
+	}
+	out.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", next, catalog, info, xref)
+	return out.err
+}
+
+// objectWriter writes numbered objects and remembers where each starts for the
+// cross-reference table. The first error sticks.
+type objectWriter struct {
+	w       io.Writer
+	n       int64
+	offsets map[int]int64
+	err     error
+}
+
+func (o *objectWriter) printf(format string, args ...interface{}) {
+	if o.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(o.w, format, args...)
+	o.n += int64(n)
+	o.err = err
+}
+
+func (o *objectWriter) object(id int, body string) {
+	if o.offsets == nil {
+		o.offsets = make(map[int]int64)
+	}
+	o.offsets[id] = o.n
+	o.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+// stream writes data compressed as a stream object whose dictionary holds the entries
+// of dict as well as its length and filter.
+func (o *objectWriter) stream(id int, dict string, data []byte) error {
+	var compressed bytes.Buffer
+	z := zlib.NewWriter(&compressed)
+	if _, err := z.Write(data); err != nil {
+		return err
+	}
+	if err := z.Close(); err != nil {
+		return err
+	}
+	if dict != "" {
+		dict += " "
+	}
+	o.object(id, fmt.Sprintf("<< %s/Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", dict, compressed.Len(), compressed.Bytes()))
+	return o.err
+}
+
+// number writes v with at most four decimals, as PDF reads no exponents.
+func number(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 4, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// streams returns the decompressed streams of a written document, in order.
+func streams(t *testing.T, data []byte) []string {
+	t.Helper()
+	var out []string
+	for _, m := range regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(data, -1) {
+		r, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		out = append(out, string(b))
+	}
+	return out
+}
+
+func TestWrite(t *testing.T) {
+	d := New()
+	for i := 0; i < 2; i++ {
+		p := d.AddPage(200, 100)
+		p.SetFillColor(color.NRGBA{R: 255, A: 128})
+		p.Rectangle(10, 10, 50, 20)
+		p.Fill()
+	}
+	var b bytes.Buffer
+	if err := d.Write(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	data := b.Bytes()
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.7\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatalf("expected a pdf header and trailer, got %q", data)
+	}
+	if !bytes.Contains(data, []byte("/Count 2")) || !bytes.Contains(data, []byte("/MediaBox [0 0 200 100]")) {
+		t.Fatalf("expected two pages of 200x100, got %s", data)
+	}
+
+	// Every object must start where the cross-reference table says it does.
+	xref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(data)
+	start, _ := strconv.Atoi(string(xref[1]))
+	table := strings.Split(string(data[start:]), "\n")
+	if table[0] != "xref" || table[1] != "0 9" {
+		t.Fatalf("unexpected xref header %q", table[:2])
+	}
+	count, _ := strconv.Atoi(strings.Fields(table[1])[1])
+	for id := 1; id < count; id++ {
+		offset, _ := strconv.Atoi(table[2+id][:10])
+		if want := strconv.Itoa(id) + " 0 obj"; !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Fatalf("object %d: xref points at %q", id, data[offset:offset+10])
+		}
+	}
+
+	content := streams(t, data)[0]
+	for _, want := range []string{"1 0 0 -1 0 100 cm", "1 0 0 rg", "/Fa502 gs", "10 10 50 20 re", "f"} {
+		if !strings.Contains(content, want+"\n") {
+			t.Fatalf("expected %q in content:\n%s", want, content)
+		}
+	}
+	if !bytes.Contains(data, []byte("/Fa502 << /Type /ExtGState /ca 0.502 >>")) {
+		t.Fatalf("expected the opacity as a graphics state, got %s", data)
+	}
+}
+
+func TestWriteWithoutPages(t *testing.T) {
+	if err := New().Write(io.Discard); err == nil {
+		t.Fatal("expected an error for a document without pages")
+	}
+}
+
+func TestFontIsEmbeddedWithUnicode(t *testing.T) {
+	d := New()
+	f, err := d.LoadFont(goregular.TTF)
+	if err != nil {
+		t.Fatalf("load font: %v", err)
+	}
+	unused, err := d.LoadFont(goregular.TTF)
+	if err != nil {
+		t.Fatalf("load font: %v", err)
+	}
+	if w := f.Width("ii", 10); w <= 0 || w != 2*f.Width("i", 10) {
+		t.Fatalf("unexpected width %v", w)
+	}
+	if ascent, descent := f.Metrics(10); ascent <= 0 || descent <= 0 {
+		t.Fatalf("unexpected metrics %v %v", ascent, descent)
+	}
+
+	d.AddPage(100, 100).Text(f, 12, 5, 20, "Hi •")
+	var b bytes.Buffer
+	if err := d.Write(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	data := b.Bytes()
+
+	if !bytes.Contains(data, []byte("/Font << /"+f.name+" ")) || bytes.Contains(data, []byte("/"+unused.name+" ")) {
+		t.Fatalf("expected only the font text was set in, got %s", data)
+	}
+	for _, want := range []string{"/Subtype /Type0", "/Encoding /Identity-H", "/Subtype /CIDFontType2", "/FontFile2", "/Length1 "} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Fatalf("expected %q in %s", want, data)
+		}
+	}
+
+	s := streams(t, data)
+	if !strings.Contains(s[0], "BT /"+f.name+" 12 Tf 1 0 0 -1 5 20 Tm <") {
+		t.Fatalf("unexpected text operators:\n%s", s[0])
+	}
+	if !bytes.Equal([]byte(s[1]), goregular.TTF) {
+		t.Fatal("expected the font file to be embedded as is")
+	}
+	cmap := s[2]
+	for _, r := range "Hi •" {
+		if !strings.Contains(cmap, strings.ToUpper(strconv.FormatInt(int64(r)+0x10000, 16)[1:])+">") {
+			t.Fatalf("expected %q mapped back to Unicode:\n%s", r, cmap)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	for v, want := range map[float64]string{0: "0", 100: "100", 1.5: "1.5", -0.00001: "0", 1.23456: "1.2346", -2.25: "-2.25"} {
+		if got := number(v); got != want {
+			t.Errorf("number(%v) = %q, want %q", v, got, want)
+		}
+	}
+}
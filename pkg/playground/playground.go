@@ -0,0 +1,300 @@
+// Package playground serves the embedded live-preview editor. The browser keeps one
+// Server-Sent Events stream open per tab and posts the source as the user types; every
+// edit is rendered on the server and pushed back over the stream together with its
+// diagnostics. All assets are embedded so the playground works offline.
+package playground
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saasuke-labs/nagare/pkg/diagram"
+	"github.com/saasuke-labs/nagare/pkg/renderer"
+	"github.com/saasuke-labs/nagare/pkg/testdiagram"
+)
+
+//go:embed static examples
+var assets embed.FS
+
+// Prefix is the path the playground is mounted under.
+const Prefix = "/playground/"
+
+// keepAlive is how often an idle stream sends a comment so proxies keep it open.
+const keepAlive = 25 * time.Second
+
+// Config configures a Playground.
+type Config struct {
+	Render       diagram.RenderFunc // Nil uses diagram.Render
+	Options      diagram.Options    // Base options; limits apply to every preview
+	MaxBodyBytes int64              // Largest accepted source update; 0 disables the check
+	MaxSessions  int                // Concurrent preview streams; 0 disables the check
+}
+
+// Example is a diagram offered in the example gallery.
+type Example struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// Preview is the payload of a "render" event.
+type Preview struct {
+	Revision    int                  `json:"revision"`
+	SVG         string               `json:"svg,omitempty"`
+	Width       int                  `json:"width,omitempty"`
+	Height      int                  `json:"height,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Diagnostics []diagram.Diagnostic `json:"diagnostics"`
+	ElapsedMs   float64              `json:"elapsedMs"`
+}
+
+// update is one source revision posted by the editor.
+type update struct {
+	Session  string `json:"session"`
+	Revision int    `json:"revision"`
+	Source   string `json:"source"`
+	Theme    string `json:"theme"`
+}
+
+// session holds the latest unrendered update for one stream. Updates posted while a
+// render is running replace each other, so a fast typist only waits for the newest one.
+type session struct {
+	mu      sync.Mutex
+	pending *update
+	wake    chan struct{}
+}
+
+func (s *session) push(u update) {
+	s.mu.Lock()
+	s.pending = &u
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *session) take() (update, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		return update{}, false
+	}
+	u := *s.pending
+	s.pending = nil
+	return u, true
+}
+
+// Playground is an http.Handler serving the editor, its assets and the preview stream.
+type Playground struct {
+	cfg      Config
+	mux      *http.ServeMux
+	mu       sync.Mutex
+	sessions map[string]*session
+	closing  chan struct{} // Closed by Close to end every stream
+	once     sync.Once
+}
+
+// New returns a playground that renders through cfg.Render.
+func New(cfg Config) *Playground {
+	if cfg.Render == nil {
+		cfg.Render = diagram.Render
+	}
+	p := &Playground{cfg: cfg, sessions: make(map[string]*session), closing: make(chan struct{})}
+
+	static, _ := fs.Sub(assets, "static")
+	p.mux = http.NewServeMux()
+	p.mux.Handle("GET "+Prefix, http.StripPrefix(Prefix, http.FileServerFS(static)))
+	p.mux.HandleFunc("GET "+Prefix+"meta", p.handleMeta)
+	p.mux.HandleFunc("GET "+Prefix+"events", p.handleEvents)
+	p.mux.HandleFunc("POST "+Prefix+"source", p.handleSource)
+	return p
+}
+
+func (p *Playground) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+// Close ends every open preview stream. Streams only end on their own when the browser
+// goes away, so a server shutting down gracefully must call it, for example through
+// http.Server.RegisterOnShutdown.
+func (p *Playground) Close() {
+	p.once.Do(func() { close(p.closing) })
+}
+
+// Examples returns the gallery diagrams sorted by name.
+func Examples() []Example {
+	examples := []Example{{Name: "web-app", Source: testdiagram.Diagram}}
+	entries, _ := fs.ReadDir(assets, "examples")
+	for _, entry := range entries {
+		data, err := fs.ReadFile(assets, path.Join("examples", entry.Name()))
+		if err != nil {
+			continue
+		}
+		examples = append(examples, Example{Name: strings.TrimSuffix(entry.Name(), ".nagare"), Source: string(data)})
+	}
+	sort.Slice(examples, func(i, j int) bool { return examples[i].Name < examples[j].Name })
+	return examples
+}
+
+func (p *Playground) handleMeta(w http.ResponseWriter, r *http.Request) {
+	meta := struct {
+		Formats    []diagram.OutputFormat          `json:"formats"`
+		Extensions map[diagram.OutputFormat]string `json:"extensions"` // File extension of each format, dot included
+		Themes     []string                        `json:"themes"`
+		Examples   []Example                       `json:"examples"`
+	}{diagram.Formats(), make(map[diagram.OutputFormat]string), renderer.Themes(), Examples()}
+	for _, format := range meta.Formats {
+		meta.Extensions[format] = format.Extension()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meta)
+}
+
+// handleEvents opens a preview stream. The first event announces the session ID the
+// editor must send with its updates.
+func (p *Playground) handleEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	id, sess, err := p.open()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer p.close(id)
+
+	// The stream outlives the server's write timeout by design.
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if err := writeEvent(w, rc, "session", map[string]string{"id": id}); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-p.closing:
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-sess.wake:
+			u, ok := sess.take()
+			if !ok {
+				continue
+			}
+			if err := writeEvent(w, rc, "render", p.preview(r.Context(), u)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleSource queues a source revision for the session's stream.
+func (p *Playground) handleSource(w http.ResponseWriter, r *http.Request) {
+	if p.cfg.MaxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, p.cfg.MaxBodyBytes)
+	}
+
+	var u update
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	sess, ok := p.sessions[u.Session]
+	p.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	sess.push(u)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (p *Playground) preview(ctx context.Context, u update) Preview {
+	opts := p.cfg.Options
+	opts.Theme = u.Theme
+
+	start := time.Now()
+	out, err := p.cfg.Render(ctx, u.Source, diagram.FormatSVG, opts)
+	preview := Preview{
+		Revision:    u.Revision,
+		Diagnostics: diagram.Diagnostics(u.Source, err),
+		ElapsedMs:   float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if preview.Diagnostics == nil {
+		preview.Diagnostics = []diagram.Diagnostic{}
+	}
+	if err != nil {
+		preview.Error = err.Error()
+		return preview
+	}
+	preview.Diagnostics = append(preview.Diagnostics, out.Warnings...)
+	preview.SVG = string(out.Data)
+	preview.Width = out.Width
+	preview.Height = out.Height
+	return preview
+}
+
+func (p *Playground) open() (string, *session, error) {
+	var raw [12]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", nil, err
+	}
+	id := hex.EncodeToString(raw[:])
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cfg.MaxSessions > 0 && len(p.sessions) >= p.cfg.MaxSessions {
+		return "", nil, errors.New("too many playground sessions")
+	}
+	sess := &session{wake: make(chan struct{}, 1)}
+	p.sessions[id] = sess
+	return id, sess, nil
+}
+
+func (p *Playground) close(id string) {
+	p.mu.Lock()
+	delete(p.sessions, id)
+	p.mu.Unlock()
+}
+
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
@@ -0,0 +1,113 @@
+package playground
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readEvent reads one Server-Sent Event from the stream.
+func readEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+	var event, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && event != "":
+			return event, data
+		}
+	}
+}
+
+func TestPlaygroundStreamsPreviews(t *testing.T) {
+	srv := httptest.NewServer(New(Config{}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + Prefix + "events")
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	stream := bufio.NewReader(resp.Body)
+
+	event, data := readEvent(t, stream)
+	if event != "session" {
+		t.Fatalf("expected session event, got %s", event)
+	}
+	var hello struct{ ID string }
+	if err := json.Unmarshal([]byte(data), &hello); err != nil {
+		t.Fatalf("decode session: %v", err)
+	}
+
+	post := func(revision int, source string) {
+		body, _ := json.Marshal(update{Session: hello.ID, Revision: revision, Source: source})
+		resp, err := http.Post(srv.URL+Prefix+"source", "application/json", strings.NewReader(string(body)))
+		if err != nil {
+			t.Fatalf("post source: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d", resp.StatusCode)
+		}
+	}
+
+	post(1, "app:Server")
+	var preview Preview
+	_, data = readEvent(t, stream)
+	if err := json.Unmarshal([]byte(data), &preview); err != nil {
+		t.Fatalf("decode preview: %v", err)
+	}
+	if preview.Revision != 1 || !strings.HasPrefix(preview.SVG, "<svg") {
+		t.Fatalf("unexpected preview %+v", preview)
+	}
+
+	post(2, "vm:VM {")
+	preview = Preview{}
+	_, data = readEvent(t, stream)
+	if err := json.Unmarshal([]byte(data), &preview); err != nil {
+		t.Fatalf("decode preview: %v", err)
+	}
+	if preview.Revision != 2 || preview.Error == "" || len(preview.Diagnostics) != 1 || preview.Diagnostics[0].Span == nil {
+		t.Fatalf("expected located diagnostic, got %+v", preview)
+	}
+}
+
+func TestPlaygroundRejectsUnknownSession(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, Prefix+"source", strings.NewReader(`{"session":"nope","source":"a:Server"}`))
+	New(Config{}).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestPlaygroundMetaListsExtensions(t *testing.T) {
+	rec := httptest.NewRecorder()
+	New(Config{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Prefix+"meta", nil))
+	var meta struct {
+		Formats    []string          `json:"formats"`
+		Extensions map[string]string `json:"extensions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &meta); err != nil {
+		t.Fatalf("decode meta: %v", err)
+	}
+	if len(meta.Extensions) != len(meta.Formats) {
+		t.Fatalf("expected an extension for each of %v, got %v", meta.Formats, meta.Extensions)
+	}
+	for format, want := range map[string]string{"svg": ".svg", "mermaid": ".mmd", "plantuml": ".puml"} {
+		if got := meta.Extensions[format]; got != want {
+			t.Errorf("expected %s for %s, got %q", want, format, got)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+"use strict";
+
+// The editor posts every revision to /playground/source; the server renders it and
+// pushes the result over the /playground/events stream opened below.
+const source = document.getElementById("source");
+const gutter = document.getElementById("gutter");
+const canvas = document.getElementById("canvas");
+const diagnosticsList = document.getElementById("diagnostics");
+const status = document.getElementById("status");
+const examples = document.getElementById("examples");
+const theme = document.getElementById("theme");
+const downloads = document.getElementById("downloads");
+
+const storageKey = "nagare.playground.source";
+let session = null;
+let revision = 0;
+let debounce = null;
+
+function setStatus(text, isError) {
+  status.textContent = text;
+  status.classList.toggle("error", Boolean(isError));
+}
+
+function renderGutter(errorLines) {
+  const lines = source.value.split("\n").length;
+  const rows = [];
+  for (let i = 1; i <= lines; i++) {
+    rows.push(`<div${errorLines.has(i) ? ' class="error"' : ""}>${i}</div>`);
+  }
+  gutter.innerHTML = rows.join("");
+  gutter.scrollTop = source.scrollTop;
+}
+
+function showDiagnostics(diagnostics) {
+  diagnosticsList.replaceChildren();
+  const errorLines = new Set();
+  for (const d of diagnostics) {
+    const item = document.createElement("li");
+    if (d.span) {
+      errorLines.add(d.span.start.line);
+      item.textContent = `${d.span.start.line}:${d.span.start.column} ${d.severity}: ${d.message}`;
+      item.addEventListener("click", () => {
+        source.focus();
+        source.setSelectionRange(d.span.start.offset, d.span.end.offset);
+      });
+    } else {
+      item.textContent = `${d.severity}: ${d.message}`;
+    }
+    diagnosticsList.appendChild(item);
+  }
+  renderGutter(errorLines);
+}
+
+function sendSource() {
+  if (!session) {
+    return;
+  }
+  revision++;
+  localStorage.setItem(storageKey, source.value);
+  fetch("source", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ session, revision, source: source.value, theme: theme.value }),
+  }).catch((err) => setStatus(err.message, true));
+}
+
+function scheduleSend() {
+  renderGutter(new Set());
+  clearTimeout(debounce);
+  debounce = setTimeout(sendSource, 120);
+}
+
+function connect() {
+  const events = new EventSource("events");
+  events.addEventListener("session", (e) => {
+    session = JSON.parse(e.data).id;
+    setStatus("live");
+    sendSource();
+  });
+  events.addEventListener("render", (e) => {
+    const preview = JSON.parse(e.data);
+    if (preview.revision !== revision) {
+      return;
+    }
+    showDiagnostics(preview.diagnostics);
+    if (preview.error) {
+      canvas.classList.add("stale");
+      setStatus(preview.error, true);
+      return;
+    }
+    canvas.classList.remove("stale");
+    canvas.innerHTML = preview.svg;
+    setStatus(`${preview.width}×${preview.height} · ${preview.elapsedMs.toFixed(1)} ms`);
+  });
+  events.onerror = () => {
+    session = null;
+    setStatus("reconnecting…", true);
+  };
+}
+
+async function download(format, extension) {
+  const response = await fetch("../v1/render", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ source: source.value, format, theme: theme.value }),
+  });
+  if (!response.ok) {
+    const problem = await response.json();
+    setStatus(problem.detail, true);
+    return;
+  }
+  const link = document.createElement("a");
+  link.href = URL.createObjectURL(await response.blob());
+  link.download = `diagram${extension}`;
+  link.click();
+  URL.revokeObjectURL(link.href);
+}
+
+async function init() {
+  const meta = await (await fetch("meta")).json();
+
+  for (const example of meta.examples) {
+    examples.add(new Option(example.name, example.source));
+  }
+  examples.addEventListener("change", () => {
+    source.value = examples.value;
+    scheduleSend();
+  });
+
+  for (const name of meta.themes) {
+    theme.add(new Option(name, name));
+  }
+  theme.value = meta.themes.includes("light") ? "light" : meta.themes[0];
+  theme.addEventListener("change", sendSource);
+
+  for (const format of meta.formats) {
+    const extension = meta.extensions[format];
+    const button = document.createElement("button");
+    button.textContent = extension;
+    button.title = `Download ${format}`;
+    button.addEventListener("click", () => download(format, extension));
+    downloads.appendChild(button);
+  }
+
+  source.value = localStorage.getItem(storageKey) || (meta.examples[0] && meta.examples[0].source) || "";
+  source.addEventListener("input", scheduleSend);
+  source.addEventListener("scroll", () => {
+    gutter.scrollTop = source.scrollTop;
+  });
+  source.addEventListener("keydown", (e) => {
+    if (e.key === "Tab") {
+      e.preventDefault();
+      source.setRangeText("  ", source.selectionStart, source.selectionEnd, "end");
+      scheduleSend();
+    }
+  });
+
+  renderGutter(new Set());
+  connect();
+}
+
+init().catch((err) => setStatus(err.message, true));
@@ -0,0 +1,111 @@
+package props
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Color is a CSS colour accepted by SVG: #rgb, #rgba, #rrggbb or #rrggbbaa, rgb(r, g, b),
+// rgba(r, g, b, a), or a CSS colour name such as steelblue, transparent or none. Props
+// of this type are validated when parsed and keep the spelling they were written with.
+type Color string
+
+// ParseColor validates value as a Color.
+func ParseColor(value string) (Color, error) {
+	v := strings.TrimSpace(value)
+	lower := strings.ToLower(v)
+	switch {
+	case strings.HasPrefix(v, "#"):
+		if !isHexColor(v[1:]) {
+			return "", fmt.Errorf("%q is not a hex colour: use #rgb, #rgba, #rrggbb or #rrggbbaa", value)
+		}
+	case strings.HasPrefix(lower, "rgb"):
+		if err := checkRGB(lower); err != nil {
+			return "", fmt.Errorf("%q is not an rgb colour: %v", value, err)
+		}
+	default:
+		if !namedColors[lower] {
+			return "", fmt.Errorf("%q is not a colour: use a hex value, rgb(...) or a CSS colour name", value)
+		}
+	}
+	return Color(v), nil
+}
+
+func isHexColor(digits string) bool {
+	switch len(digits) {
+	case 3, 4, 6, 8:
+	default:
+		return false
+	}
+	_, err := strconv.ParseUint(digits, 16, 32)
+	return err == nil
+}
+
+// checkRGB validates rgb(r, g, b) and rgba(r, g, b, a), where each channel is 0-255 or a
+// percentage and alpha is 0-1 or a percentage.
+func checkRGB(v string) error {
+	name, args, ok := strings.Cut(v, "(")
+	name = strings.TrimSpace(name)
+	if !ok || !strings.HasSuffix(args, ")") || (name != "rgb" && name != "rgba") {
+		return fmt.Errorf("expected rgb(r, g, b) or rgba(r, g, b, a)")
+	}
+	parts := strings.Split(strings.TrimSuffix(args, ")"), ",")
+	if len(parts) != 3 && len(parts) != 4 {
+		return fmt.Errorf("expected 3 or 4 components, got %d", len(parts))
+	}
+	for i, part := range parts {
+		limit := 255.0
+		if i == 3 {
+			limit = 1
+		}
+		part = strings.TrimSpace(part)
+		if strings.HasSuffix(part, "%") {
+			part, limit = strings.TrimSuffix(part, "%"), 100
+		}
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 || n > limit {
+			return fmt.Errorf("component %d must be between 0 and %v", i+1, limit)
+		}
+	}
+	return nil
+}
+
+// namedColors holds the CSS colour keywords, lower-cased.
+var namedColors = map[string]bool{
+	"none": true, "transparent": true, "currentcolor": true,
+	"aliceblue": true, "antiquewhite": true, "aqua": true, "aquamarine": true, "azure": true,
+	"beige": true, "bisque": true, "black": true, "blanchedalmond": true, "blue": true,
+	"blueviolet": true, "brown": true, "burlywood": true, "cadetblue": true, "chartreuse": true,
+	"chocolate": true, "coral": true, "cornflowerblue": true, "cornsilk": true, "crimson": true,
+	"cyan": true, "darkblue": true, "darkcyan": true, "darkgoldenrod": true, "darkgray": true,
+	"darkgreen": true, "darkgrey": true, "darkkhaki": true, "darkmagenta": true,
+	"darkolivegreen": true, "darkorange": true, "darkorchid": true, "darkred": true,
+	"darksalmon": true, "darkseagreen": true, "darkslateblue": true, "darkslategray": true,
+	"darkslategrey": true, "darkturquoise": true, "darkviolet": true, "deeppink": true,
+	"deepskyblue": true, "dimgray": true, "dimgrey": true, "dodgerblue": true,
+	"firebrick": true, "floralwhite": true, "forestgreen": true, "fuchsia": true,
+	"gainsboro": true, "ghostwhite": true, "gold": true, "goldenrod": true, "gray": true,
+	"green": true, "greenyellow": true, "grey": true, "honeydew": true, "hotpink": true,
+	"indianred": true, "indigo": true, "ivory": true, "khaki": true, "lavender": true,
+	"lavenderblush": true, "lawngreen": true, "lemonchiffon": true, "lightblue": true,
+	"lightcoral": true, "lightcyan": true, "lightgoldenrodyellow": true, "lightgray": true,
+	"lightgreen": true, "lightgrey": true, "lightpink": true, "lightsalmon": true,
+	"lightseagreen": true, "lightskyblue": true, "lightslategray": true,
+	"lightslategrey": true, "lightsteelblue": true, "lightyellow": true, "lime": true,
+	"limegreen": true, "linen": true, "magenta": true, "maroon": true,
+	"mediumaquamarine": true, "mediumblue": true, "mediumorchid": true, "mediumpurple": true,
+	"mediumseagreen": true, "mediumslateblue": true, "mediumspringgreen": true,
+	"mediumturquoise": true, "mediumvioletred": true, "midnightblue": true, "mintcream": true,
+	"mistyrose": true, "moccasin": true, "navajowhite": true, "navy": true, "oldlace": true,
+	"olive": true, "olivedrab": true, "orange": true, "orangered": true, "orchid": true,
+	"palegoldenrod": true, "palegreen": true, "paleturquoise": true, "palevioletred": true,
+	"papayawhip": true, "peachpuff": true, "peru": true, "pink": true, "plum": true,
+	"powderblue": true, "purple": true, "rebeccapurple": true, "red": true, "rosybrown": true,
+	"royalblue": true, "saddlebrown": true, "salmon": true, "sandybrown": true,
+	"seagreen": true, "seashell": true, "sienna": true, "silver": true, "skyblue": true,
+	"slateblue": true, "slategray": true, "slategrey": true, "snow": true, "springgreen": true,
+	"steelblue": true, "tan": true, "teal": true, "thistle": true, "tomato": true,
+	"turquoise": true, "violet": true, "wheat": true, "white": true, "whitesmoke": true,
+	"yellow": true, "yellowgreen": true,
+}
@@ -1,10 +1,13 @@
 package props
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Props is the interface that all component props must implement
@@ -12,136 +15,500 @@ type Props interface {
 	Parse(input string) error
 }
 
-// ParseProps is a helper function to parse props using struct tags
+// ParseProps is a helper function to parse props using struct tags. Fields are matched
+// by their prop tag and may be strings, integers, floats, booleans, time.Duration, Color,
+// slices written as [a, b], maps written as {key: value}, pointers to any of these, or
+// interface{} (an int, a float or a string, whichever parses first). A field with an
+// enum tag only accepts the listed values.
+//
+// Every pair is applied even if an earlier one fails; the failures are returned joined.
 func ParseProps(input string, target interface{}) error {
-	// Remove parentheses
-	input = strings.Trim(input, "()")
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("props target must be a pointer to a struct, got %T", target)
+	}
+	v = v.Elem()
+	info := typeInfoOf(v.Type())
 
-	// Split by comma but respect quoted strings
-	var pairs []string
-	var current strings.Builder
-	inQuotes := false
+	var errs []error
+	for _, pair := range splitPairs(input) {
+		key, value, ok := splitPair(pair)
+		if !ok {
+			continue // No valid key:value separator found
+		}
 
-	// Always read input into the current buffer
-	current.WriteString(strings.TrimSpace(input))
+		// Debug output
+		fmt.Printf("Parsing prop key=%q value=%q\n", key, value)
 
-	// Split into pairs by commas outside quotes
-	inQuotes = false
-	var result strings.Builder
-	for i := 0; i < current.Len(); i++ {
-		char := current.String()[i]
+		field, ok := info.byKey[key]
+		if !ok {
+			fmt.Printf("Warning: no field found with prop tag %q\n", key)
+			continue
+		}
 
-		if char == '"' {
-			inQuotes = !inQuotes
+		fmt.Printf("Setting field %s with tag %q to %q\n", field.Name, key, value)
+		if err := setValue(v.FieldByIndex(field.index), value, field.Enum); err != nil {
+			errs = append(errs, &PropError{Key: key, Err: err})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// PropError is the failure of one pair in ParseProps, so callers can point at its key.
+type PropError struct {
+	Key string
+	Err error
+}
+
+func (e *PropError) Error() string {
+	return fmt.Sprintf("prop %s: %v", e.Key, e.Err)
+}
+
+func (e *PropError) Unwrap() error {
+	return e.Err
+}
+
+// SetDefaults sets every field of target, a pointer to a struct, that has a default tag
+// to that value. Defaults are part of the struct definition, so one that does not parse
+// is a programming error and SetDefaults panics.
+func SetDefaults(target interface{}) {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("props: SetDefaults needs a pointer to a struct, got %T", target))
+	}
+	v = v.Elem()
+	for _, field := range typeInfoOf(v.Type()).fields {
+		if !field.hasDefault {
+			continue
+		}
+		if err := setValue(v.FieldByIndex(field.index), field.Default, field.Enum); err != nil {
+			panic(fmt.Sprintf("props: default of %s.%s: %v", v.Type().Name(), field.Name, err))
+		}
+	}
+}
+
+// Issue is a pair of a props definition that ParseProps ignores.
+type Issue struct {
+	Key     string // Empty when the pair has no key
+	Message string
+}
+
+// Check reports the pairs of input that no target would apply: pairs without a colon,
+// which ParseProps skips, and keys that none of targets declares.
+func Check(input string, targets ...interface{}) []Issue {
+	known := make(map[string]bool)
+	for _, target := range targets {
+		for _, field := range Fields(target) {
+			known[field.Key] = true
+		}
+	}
+
+	var issues []Issue
+	for _, pair := range splitPairs(input) {
+		key, _, ok := splitPair(pair)
+		switch {
+		case !ok:
+			issues = append(issues, Issue{Message: fmt.Sprintf("%s has no key and is ignored", pair)})
+		case !known[key]:
+			issues = append(issues, Issue{Key: key, Message: fmt.Sprintf("unknown prop %q is ignored", key)})
+		}
+	}
+	return issues
+}
+
+// Pair is one key: value pair of a props definition, with the value as written.
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// Pairs splits a props definition into its key: value pairs, respecting quotes and
+// brackets. Pairs without a key are skipped, as ParseProps skips them.
+func Pairs(input string) []Pair {
+	var pairs []Pair
+	for _, pair := range splitPairs(input) {
+		if key, value, ok := splitPair(pair); ok {
+			pairs = append(pairs, Pair{Key: key, Value: value})
 		}
+	}
+	return pairs
+}
 
-		if char == ',' && !inQuotes {
-			// Found a valid separator - add pair if non-empty
-			if str := strings.TrimSpace(result.String()); str != "" {
-				pairs = append(pairs, str)
+// Without returns input without its pairs for key, keeping the others as written.
+func Without(input, key string) string {
+	var kept []string
+	for _, pair := range splitPairs(input) {
+		if k, _, ok := splitPair(pair); !ok || k != key {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, ",")
+}
+
+// Field describes one prop accepted by a props struct.
+type Field struct {
+	Key     string   // Name used in the DSL, from the prop tag
+	Name    string   // Go field name
+	Type    string   // DSL-facing type, such as int, color or list of string
+	Doc     string   // One-line description, from the doc tag
+	Enum    []string // Accepted values, from the enum tag; empty accepts any
+	Default string   // Value used when the prop is not set, from the default tag
+}
+
+// Fields lists the props declared on target, a struct or pointer to struct, in
+// declaration order.
+func Fields(target interface{}) []Field {
+	t := reflect.TypeOf(target)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	info := typeInfoOf(t)
+	fields := make([]Field, len(info.fields))
+	for i, field := range info.fields {
+		fields[i] = field.Field
+	}
+	return fields
+}
+
+// Value is one prop of a props struct and its current value.
+type Value struct {
+	Field
+	Value interface{}
+}
+
+// Values lists the props of target, a struct or pointer to struct, with their values, in
+// declaration order.
+func Values(target interface{}) []Value {
+	v := reflect.ValueOf(target)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	info := typeInfoOf(v.Type())
+	values := make([]Value, len(info.fields))
+	for i, field := range info.fields {
+		values[i] = Value{Field: field.Field, Value: v.FieldByIndex(field.index).Interface()}
+	}
+	return values
+}
+
+// Lookup returns the value of the prop key of target, a struct or pointer to struct.
+func Lookup(target interface{}, key string) (interface{}, bool) {
+	for _, value := range Values(target) {
+		if value.Key == key {
+			return value.Value, true
+		}
+	}
+	return nil, false
+}
+
+// fieldInfo is the cached metadata of one prop field.
+type fieldInfo struct {
+	Field
+	index      []int
+	hasDefault bool
+}
+
+// typeInfo is the cached metadata of a props struct.
+type typeInfo struct {
+	fields []fieldInfo
+	byKey  map[string]*fieldInfo
+}
+
+// typeCache maps a struct reflect.Type to its *typeInfo, so tags are read once per type.
+var typeCache sync.Map
+
+func typeInfoOf(t reflect.Type) *typeInfo {
+	if cached, ok := typeCache.Load(t); ok {
+		return cached.(*typeInfo)
+	}
+
+	info := &typeInfo{byKey: make(map[string]*fieldInfo)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("prop")
+		if key == "" {
+			continue
+		}
+		def, hasDefault := field.Tag.Lookup("default")
+		var enum []string
+		if values := field.Tag.Get("enum"); values != "" {
+			for _, value := range strings.Split(values, ",") {
+				enum = append(enum, strings.TrimSpace(value))
 			}
-			result.Reset()
-		} else {
-			result.WriteByte(char)
 		}
+		info.fields = append(info.fields, fieldInfo{
+			Field: Field{
+				Key:     key,
+				Name:    field.Name,
+				Type:    typeName(field.Type),
+				Doc:     field.Tag.Get("doc"),
+				Enum:    enum,
+				Default: def,
+			},
+			index:      field.Index,
+			hasDefault: hasDefault,
+		})
+	}
+	for i := range info.fields {
+		info.byKey[info.fields[i].Key] = &info.fields[i]
 	}
 
-	// Don't forget the last pair
-	if str := strings.TrimSpace(result.String()); str != "" {
-		pairs = append(pairs, str)
+	actual, _ := typeCache.LoadOrStore(t, info)
+	return actual.(*typeInfo)
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	colorType    = reflect.TypeOf(Color(""))
+)
+
+// typeName is the DSL-facing name of t.
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case durationType:
+		return "duration"
+	case colorType:
+		return "color"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Slice:
+		return "list of " + typeName(t.Elem())
+	case reflect.Map:
+		return "map of " + typeName(t.Elem())
+	default:
+		return "any"
 	}
+}
+
+// setValue parses raw into v according to v's type. Values of string kind, including
+// list elements and map values, must be one of enum when it is not empty.
+func setValue(v reflect.Value, raw string, enum []string) error {
+	raw = strings.TrimSpace(raw)
 
-	// Now parse each key:value pair
-	for _, pair := range pairs {
-		// Split at first colon only
-		pair = strings.TrimSpace(pair)
-		colonIndex := -1
-		inQuotes = false
-		for i := 0; i < len(pair); i++ {
-			char := pair[i]
-			if char == '"' {
-				inQuotes = !inQuotes
-			} else if char == ':' && !inQuotes && colonIndex == -1 {
-				colonIndex = i
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(unquote(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 1.5s or 200ms", unquote(raw))
+		}
+		v.SetInt(int64(d))
+		return nil
+	case colorType:
+		c, err := ParseColor(unquote(raw))
+		if err != nil {
+			return err
+		}
+		if err := checkEnum(string(c), enum); err != nil {
+			return err
+		}
+		v.SetString(string(c))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), raw, enum); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.String:
+		value := unquote(raw)
+		if err := checkEnum(value, enum); err != nil {
+			return err
+		}
+		v.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(unquote(raw), 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", unquote(raw))
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(unquote(raw), v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a number", unquote(raw))
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(unquote(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", unquote(raw))
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		items, err := enclosed(raw, '[', ']')
+		if err != nil {
+			return err
+		}
+		list := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(list.Index(i), item, enum); err != nil {
+				return fmt.Errorf("item %d: %w", i+1, err)
+			}
+		}
+		v.Set(list)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		entries, err := enclosed(raw, '{', '}')
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(entries))
+		for _, entry := range entries {
+			key, value, ok := splitPair(entry)
+			if !ok {
+				return fmt.Errorf("map entry %s has no key", entry)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(elem, value, enum); err != nil {
+				return fmt.Errorf("key %s: %w", unquote(key), err)
 			}
+			m.SetMapIndex(reflect.ValueOf(unquote(key)).Convert(v.Type().Key()), elem)
+		}
+		v.Set(m)
+	case reflect.Interface:
+		// Untyped props keep the historical reading: an int if it is one, else a string.
+		value := unquote(raw)
+		if n, err := strconv.Atoi(value); err == nil {
+			v.Set(reflect.ValueOf(n))
+		} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+			v.Set(reflect.ValueOf(f))
+		} else {
+			v.Set(reflect.ValueOf(value))
 		}
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
 
-		if colonIndex == -1 {
-			continue // No valid key:value separator found
+func checkEnum(value string, enum []string) error {
+	if len(enum) == 0 {
+		return nil
+	}
+	for _, allowed := range enum {
+		if value == allowed {
+			return nil
 		}
+	}
+	return fmt.Errorf("%q is not one of %s", value, strings.Join(enum, ", "))
+}
+
+// enclosed checks that raw is wrapped in open and close and splits its content at
+// top-level commas.
+func enclosed(raw string, open, close byte) ([]string, error) {
+	if len(raw) < 2 || raw[0] != open || raw[len(raw)-1] != close {
+		return nil, fmt.Errorf("expected %c...%c, got %q", open, close, raw)
+	}
+	return splitTopLevel(raw[1:len(raw)-1], ','), nil
+}
 
-		key := strings.TrimSpace(pair[:colonIndex])
-		value := strings.TrimSpace(pair[colonIndex+1:])
+// unquote strips one pair of matching double or single quotes.
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
 
-		// Debug output
-		fmt.Printf("Parsing prop key=%q value=%q\n", key, value)
+// splitPairs strips the parentheses around input, if any, and splits it into pairs at
+// top-level commas.
+func splitPairs(input string) []string {
+	input = strings.TrimSpace(input)
+	if len(input) >= 2 && input[0] == '(' && closing(input, 0) == len(input)-1 {
+		input = input[1 : len(input)-1]
+	}
+	return splitTopLevel(input, ',')
+}
 
-		// Clean up any unwanted spaces in the value
-		value = strings.TrimPrefix(value, " ")
-		value = strings.TrimSuffix(value, " ")
-
-		// Handle quoted values
-		if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
-			value = strings.Trim(value, `"`)
-		}
-
-		// Debug after cleanup
-		fmt.Printf("After cleanup: key=%q value=%q\n", key, value)
-
-		// Use reflection to find matching field
-		v := reflect.ValueOf(target).Elem()
-		t := v.Type()
-
-		var found bool
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			if prop := field.Tag.Get("prop"); prop == key {
-				fmt.Printf("Setting field %s with tag %q to %q\n", field.Name, prop, value)
-				fieldValue := v.Field(i)
-
-				// Handle different field types
-				switch fieldValue.Kind() {
-				case reflect.String:
-					fieldValue.SetString(value)
-				case reflect.Int:
-					// Parse string as integer
-					if intValue, err := strconv.Atoi(value); err == nil {
-						fieldValue.SetInt(int64(intValue))
-					} else {
-						return fmt.Errorf("failed to parse %q as integer for field %s: %v", value, field.Name, err)
-					}
-				case reflect.Interface:
-					// For interface{} fields, try to parse as int first, then string
-					if intValue, err := strconv.Atoi(value); err == nil {
-						fieldValue.Set(reflect.ValueOf(intValue))
-					} else {
-						fieldValue.Set(reflect.ValueOf(value))
-					}
-				case reflect.Ptr:
-					elemType := fieldValue.Type().Elem()
-					switch elemType.Kind() {
-					case reflect.String:
-						strValue := value
-						fieldValue.Set(reflect.ValueOf(&strValue))
-					case reflect.Int:
-						if intValue, err := strconv.Atoi(value); err == nil {
-							fieldValue.Set(reflect.ValueOf(&intValue))
-						} else {
-							return fmt.Errorf("failed to parse %q as integer for field %s: %v", value, field.Name, err)
-						}
-					default:
-						return fmt.Errorf("unsupported pointer type for field %s", field.Name)
-					}
-				}
-
-				found = true
-				break
+// splitTopLevel splits s at sep where it is outside double quotes and brackets, dropping
+// empty parts. The parser writes every string in double quotes.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	start, depth := 0, 0
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			if part := strings.TrimSpace(s[start:i]); part != "" {
+				parts = append(parts, part)
 			}
+			start = i + 1
 		}
-		if !found {
-			fmt.Printf("Warning: no field found with prop tag %q\n", key)
+	}
+	if part := strings.TrimSpace(s[start:]); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// closing returns the index of the bracket closing the one at open, or -1.
+func closing(s string, open int) int {
+	depth := 0
+	inQuotes := false
+	for i := open; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
 		}
 	}
+	return -1
+}
 
-	return nil
+// splitPair splits a pair at its first colon outside double quotes and brackets.
+func splitPair(pair string) (key, value string, ok bool) {
+	depth := 0
+	inQuotes := false
+	for i := 0; i < len(pair); i++ {
+		switch c := pair[i]; {
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == ':' && depth == 0:
+			return strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:]), true
+		}
+	}
+	return "", "", false
 }
@@ -0,0 +1,163 @@
+package props
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type typedProps struct {
+	Title   string            `prop:"title"`
+	Width   float64           `prop:"w"`
+	Height  *float64          `prop:"h"`
+	Port    int               `prop:"port" default:"80"`
+	Dashed  bool              `prop:"dashed"`
+	Delay   time.Duration     `prop:"delay" default:"250ms"`
+	Fill    Color             `prop:"fill" default:"#fff"`
+	Icon    string            `prop:"icon" enum:"nginx,golang,default" default:"default"`
+	Tags    []string          `prop:"tags"`
+	Weights []float64         `prop:"weights"`
+	Labels  map[string]string `prop:"labels"`
+	Limits  map[string]int    `prop:"limits"`
+	Any     interface{}       `prop:"any"`
+}
+
+func TestParsePropsTypes(t *testing.T) {
+	var p typedProps
+	input := `title: "a, b: c", w: 120.5, h: 40.25, port: 8080, dashed: true, delay: 1.5s, fill: "rgb(0, 119, 194)", icon: nginx, tags: ["a", "b,c"], weights: [1, 2.5], labels: {tier: "web", zone: "eu-1"}, limits: {cpu: 2}, any: 1.5`
+	if err := ParseProps(input, &p); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	h := 40.25
+	want := typedProps{
+		Title:   "a, b: c",
+		Width:   120.5,
+		Height:  &h,
+		Port:    8080,
+		Dashed:  true,
+		Delay:   1500 * time.Millisecond,
+		Fill:    "rgb(0, 119, 194)",
+		Icon:    "nginx",
+		Tags:    []string{"a", "b,c"},
+		Weights: []float64{1, 2.5},
+		Labels:  map[string]string{"tier": "web", "zone": "eu-1"},
+		Limits:  map[string]int{"cpu": 2},
+		Any:     1.5,
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Fatalf("got %+v\nwant %+v", p, want)
+	}
+}
+
+func TestParsePropsReportsEveryInvalidValue(t *testing.T) {
+	var p typedProps
+	err := ParseProps(`port: http, icon: apache, fill: "#12345", tags: a, title: "kept"`, &p)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, key := range []string{"port", "icon", "fill", "tags"} {
+		if !strings.Contains(err.Error(), "prop "+key+":") {
+			t.Errorf("expected an error for %s, got %v", key, err)
+		}
+	}
+	var keys []string
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var propErr *PropError
+		if errors.As(err, &propErr) {
+			keys = append(keys, propErr.Key)
+		}
+	}
+	if want := []string{"port", "icon", "fill", "tags"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected a PropError for each of %v, got %v", want, keys)
+	}
+	if p.Title != "kept" {
+		t.Fatalf("expected valid props to apply despite errors, got title %q", p.Title)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for _, valid := range []string{"#abc", "#abcd", "#a1b2c3", "#a1b2c3d4", "rgb(0, 119, 194)", "rgba(0,0,0,0.5)", "rgb(10%, 20%, 30%)", "SteelBlue", "transparent", "none"} {
+		if _, err := ParseColor(valid); err != nil {
+			t.Errorf("expected %q to be valid: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"", "#ab", "#ggg", "rgb(1, 2)", "rgb(256, 0, 0)", "rgba(0, 0, 0, 2)", "blurple"} {
+		if _, err := ParseColor(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestSetDefaultsAndFields(t *testing.T) {
+	var p typedProps
+	SetDefaults(&p)
+	if p.Port != 80 || p.Delay != 250*time.Millisecond || p.Fill != "#fff" || p.Icon != "default" {
+		t.Fatalf("unexpected defaults %+v", p)
+	}
+
+	fields := Fields(p)
+	types := make(map[string]Field)
+	for _, field := range fields {
+		types[field.Key] = field
+	}
+	for key, typ := range map[string]string{"w": "float", "h": "float", "delay": "duration", "fill": "color", "tags": "list of string", "limits": "map of int", "any": "any"} {
+		if types[key].Type != typ {
+			t.Errorf("expected %s to be %s, got %s", key, typ, types[key].Type)
+		}
+	}
+	if icon := types["icon"]; !reflect.DeepEqual(icon.Enum, []string{"nginx", "golang", "default"}) || icon.Default != "default" {
+		t.Errorf("unexpected icon metadata %+v", icon)
+	}
+}
+
+func TestValues(t *testing.T) {
+	p := typedProps{Title: "api", Port: 8080, Tags: []string{"a"}}
+	values := Values(&p)
+	if len(values) != len(Fields(p)) || values[0].Key != "title" || values[0].Value != "api" {
+		t.Fatalf("unexpected values %+v", values)
+	}
+	if port, ok := Lookup(p, "port"); !ok || port != 8080 {
+		t.Fatalf("expected port 8080, got %v", port)
+	}
+	if _, ok := Lookup(p, "nope"); ok {
+		t.Fatal("expected no value for an unknown key")
+	}
+}
+
+func TestCheckRespectsNesting(t *testing.T) {
+	issues := Check(`tags: ["a", "b"], labels: {k: v, n: 2}, stray`, &typedProps{})
+	if len(issues) != 1 || issues[0].Key != "" {
+		t.Fatalf("expected only the stray pair to be reported, got %+v", issues)
+	}
+}
+
+func TestSchemaOfUsesDefaults(t *testing.T) {
+	var p typedProps
+	SetDefaults(&p)
+	p.Tags = []string{"web"}
+	schema := SchemaOf(&p)
+
+	if schema.AdditionalProperties != false {
+		t.Fatalf("expected unknown props to be rejected, got %v", schema.AdditionalProperties)
+	}
+	checks := map[string]Schema{
+		"port":  {Type: "integer", Default: 80},
+		"w":     {Type: "number"},
+		"delay": {Type: "string", Format: "duration", Pattern: durationPattern, Default: "250ms"},
+		"fill":  {Type: "string", Format: "color", Default: Color("#fff")},
+		"icon":  {Type: "string", Enum: []string{"nginx", "golang", "default"}, Default: "default"},
+		"tags":  {Type: "array", Items: &Schema{Type: "string"}, Default: []string{"web"}},
+		"any":   {Type: []string{"number", "string"}},
+	}
+	for key, want := range checks {
+		if got := schema.Properties[key]; got == nil || !reflect.DeepEqual(*got, want) {
+			t.Errorf("%s: got %+v, want %+v", key, got, want)
+		}
+	}
+	if limits := schema.Properties["limits"]; !reflect.DeepEqual(limits.AdditionalProperties, &Schema{Type: "integer"}) {
+		t.Errorf("expected limits to map to integers, got %+v", limits.AdditionalProperties)
+	}
+}
@@ -0,0 +1,99 @@
+package props
+
+import (
+	"reflect"
+	"time"
+)
+
+// SchemaVersion is the JSON Schema dialect produced by SchemaOf.
+const SchemaVersion = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema used to describe props.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"` // A type name, or a list of them
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"` // A *Schema, or false
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// durationPattern matches the durations time.ParseDuration accepts, such as 1.5s or 1m30s.
+const durationPattern = `^-?([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h)(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))*$`
+
+// SchemaOf describes the props of defaults, a props struct or pointer to one, as a JSON
+// Schema object that rejects unknown props. The non-zero fields of defaults become the
+// schema defaults, so pass the value a component starts from.
+func SchemaOf(defaults interface{}) *Schema {
+	v := reflect.ValueOf(defaults)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return &Schema{Type: "object"}
+	}
+
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+	for _, field := range typeInfoOf(v.Type()).fields {
+		value := v.FieldByIndex(field.index)
+		property := typeSchema(value.Type())
+		property.Description = field.Doc
+		if len(field.Enum) > 0 {
+			property.Enum = field.Enum
+		}
+		if !value.IsZero() {
+			property.Default = jsonValue(value)
+		}
+		schema.Properties[field.Key] = property
+	}
+	return schema
+}
+
+// typeSchema describes the values ParseProps accepts for t.
+func typeSchema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case durationType:
+		return &Schema{Type: "string", Format: "duration", Pattern: durationPattern}
+	case colorType:
+		return &Schema{Type: "string", Format: "color"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: typeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: typeSchema(t.Elem())}
+	case reflect.Interface:
+		// ParseProps reads untyped props as a number if they are one, else a string.
+		return &Schema{Type: []string{"number", "string"}}
+	default:
+		return &Schema{}
+	}
+}
+
+// jsonValue converts a prop value into the form it takes in JSON.
+func jsonValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	return v.Interface()
+}
@@ -2,6 +2,8 @@ package renderer
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 
 	"github.com/saasuke-labs/nagare/pkg/components"
 	"github.com/saasuke-labs/nagare/pkg/layout"
@@ -176,18 +178,83 @@ func drawGrid(canvasWidth, canvasHeight int) string {
 	return lines
 }
 
+// Theme controls the colours the renderer applies on top of component props.
+type Theme struct {
+	Name       string
+	Background string
+	ArrowColor string // Empty keeps each arrow's own stroke colour
+}
+
+var themes = map[string]Theme{
+	"light": {Name: "light", Background: "#ffffff"},
+	"dark":  {Name: "dark", Background: "#0f172a", ArrowColor: "#e2e8f0"},
+}
+
+// DefaultTheme is the theme used by Render.
+var DefaultTheme = themes["light"]
+
+// LookupTheme returns the built-in theme with the given name.
+func LookupTheme(name string) (Theme, bool) {
+	theme, ok := themes[name]
+	return theme, ok
+}
+
+// Themes lists the built-in theme names in a stable order.
+func Themes() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options configures RenderWithOptions.
+type Options struct {
+	Theme Theme
+	Scale float64 // Multiplier for the output size; 0 is treated as 1
+}
+
 // Render generates SVG code from a layout
 func Render(l layout.Layout, canvasWidth, canvasHeight int) string {
+	return RenderWithOptions(l, canvasWidth, canvasHeight, Options{Theme: DefaultTheme})
+}
+
+// RenderWithOptions generates SVG code from a layout using the given theme and scale.
+// The canvas keeps its layout coordinates; scaling only changes the outer size via viewBox.
+func RenderWithOptions(l layout.Layout, canvasWidth, canvasHeight int, opts Options) string {
+	if opts.Theme.Background == "" {
+		opts.Theme.Background = DefaultTheme.Background
+	}
+	if opts.Theme.ArrowColor != "" {
+		for _, child := range l.Children {
+			if arrow, ok := child.(*components.Arrow); ok {
+				arrow.StrokeColor = opts.Theme.ArrowColor
+			}
+		}
+	}
+
+	size := fmt.Sprintf(`width="%d" height="%d"`, canvasWidth, canvasHeight)
+	if opts.Scale > 0 && opts.Scale != 1 {
+		size = fmt.Sprintf(`width="%s" height="%s" viewBox="0 0 %d %d"`,
+			formatScaled(canvasWidth, opts.Scale), formatScaled(canvasHeight, opts.Scale),
+			canvasWidth, canvasHeight)
+	}
+
 	// Create the SVG wrapper with background and the layout
-	return fmt.Sprintf(`<svg width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">
+	return fmt.Sprintf(`<svg %s xmlns="http://www.w3.org/2000/svg">
         <!-- Background -->
-        <rect width="%d" height="%d" fill="#ffffff"/>
+        <rect width="%d" height="%d" fill="%s"/>
         %s
         %s
 </svg>`,
-		canvasWidth, canvasHeight,
-		canvasWidth, canvasHeight,
+		size,
+		canvasWidth, canvasHeight, opts.Theme.Background,
 		drawGrid(canvasWidth, canvasHeight),
 		renderChildren(l.Children),
 	)
 }
+
+func formatScaled(value int, scale float64) string {
+	return strconv.FormatFloat(float64(value)*scale, 'f', -1, 64)
+}
@@ -0,0 +1,356 @@
+// Package textgrid draws laid out Nagare diagrams as text, for code comments, commit
+// messages and terminals. Coordinates are scaled to character cells; components become
+// boxes of box-drawing characters with their titles inside, containers get double-line
+// borders, and arrows follow their routed bend points.
+package textgrid
+
+import (
+	"math"
+	"strings"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+)
+
+// CellWidth and CellHeight are the size of a character cell in diagram units at scale 1.
+// A cell is twice as tall as it is wide, as in most monospaced fonts.
+const CellWidth, CellHeight = 8.0, 16.0
+
+// Options control how a layout is drawn as text.
+type Options struct {
+	Scale float64 // Cells per CellWidth by CellHeight units along each axis; 0 means 1
+}
+
+// Directions a line leaves a cell in, combined as a mask.
+const (
+	north uint8 = 1 << iota
+	east
+	south
+	west
+)
+
+var singleGlyphs = map[uint8]rune{
+	north: '│', south: '│', north | south: '│',
+	east: '─', west: '─', east | west: '─',
+	east | south: '┌', west | south: '┐', east | north: '└', west | north: '┘',
+	east | west | south: '┬', east | west | north: '┴', north | south | east: '├', north | south | west: '┤',
+	north | east | south | west: '┼',
+}
+
+var doubleGlyphs = map[uint8]rune{
+	north: '║', south: '║', north | south: '║',
+	east: '═', west: '═', east | west: '═',
+	east | south: '╔', west | south: '╗', east | north: '╚', west | north: '╝',
+	east | west | south: '╦', east | west | north: '╩', north | south | east: '╠', north | south | west: '╣',
+	north | east | south | west: '╬',
+}
+
+// arrowheads point in each direction.
+var arrowheads = map[uint8]rune{north: '▲', east: '►', south: '▼', west: '◄'}
+
+// cell is a character cell of the grid. Lines are kept as the directions they leave the
+// cell in, so where they meet the right junction is drawn; text and arrowheads are
+// drawn over them.
+type cell struct {
+	single, double uint8
+	dashed         bool
+	text           rune
+}
+
+// grid is a page of character cells, with what is drawn outside it dropped.
+type grid struct {
+	cells         [][]cell
+	width, height int
+}
+
+type point struct{ x, y int }
+
+// rect is a box of cells, its borders included.
+type rect struct{ x0, y0, x1, y1 int }
+
+func (r rect) onBorder(p point) bool {
+	inside := p.x >= r.x0 && p.x <= r.x1 && p.y >= r.y0 && p.y <= r.y1
+	return inside && (p.x == r.x0 || p.x == r.x1 || p.y == r.y0 || p.y == r.y1)
+}
+
+func newGrid(width, height int) *grid {
+	g := &grid{cells: make([][]cell, height), width: width, height: height}
+	for y := range g.cells {
+		g.cells[y] = make([]cell, width)
+	}
+	return g
+}
+
+func (g *grid) at(p point) *cell {
+	if p.x < 0 || p.y < 0 || p.x >= g.width || p.y >= g.height {
+		return nil
+	}
+	return &g.cells[p.y][p.x]
+}
+
+// Render draws l, on a canvas of width by height units, as lines of text.
+func Render(l layout.Layout, width, height int, opts Options) string {
+	scale := opts.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	toCell := func(x, y float64) point {
+		return point{int(math.Round(x * scale / CellWidth)), int(math.Round(y * scale / CellHeight))}
+	}
+	corner := toCell(float64(width), float64(height))
+	g := newGrid(corner.x+1, corner.y+1)
+
+	elements := l.Elements()
+	boxes := make(map[string]rect, len(elements))
+	for _, e := range elements {
+		from := toCell(e.Bounds.X, e.Bounds.Y)
+		to := toCell(e.Bounds.X+e.Bounds.Width, e.Bounds.Y+e.Bounds.Height)
+		// Leave room for a border on each side and a row of title.
+		r := rect{from.x, from.y, max(to.x, from.x+2), max(to.y, from.y+2)}
+		boxes[e.ID] = r
+		g.box(r, layout.IsContainerType(e.Type))
+	}
+
+	for _, a := range l.Connections {
+		points := []point{toCell(a.Start.X, a.Start.Y)}
+		for _, p := range append(append([]layout.Point{}, a.BendPoints...), a.End) {
+			points = append(points, toCell(p.X, p.Y))
+		}
+		from, hasFrom := boxes[a.FromID]
+		to, hasTo := boxes[a.ToID]
+		g.arrow(path(points), a, from, hasFrom, to, hasTo)
+	}
+
+	for _, e := range elements {
+		g.title(boxes[e.ID], e.Title(), layout.IsContainerType(e.Type))
+	}
+	return g.String()
+}
+
+// box draws the border of r, in double lines if double is set.
+func (g *grid) box(r rect, double bool) {
+	line := func(p point, dirs uint8) {
+		if c := g.at(p); c != nil {
+			if double {
+				c.double |= dirs
+			} else {
+				c.single |= dirs
+			}
+		}
+	}
+	for x := r.x0; x <= r.x1; x++ {
+		var dirs uint8
+		if x > r.x0 {
+			dirs |= west
+		}
+		if x < r.x1 {
+			dirs |= east
+		}
+		top, bottom := dirs, dirs
+		if x == r.x0 || x == r.x1 {
+			top, bottom = top|south, bottom|north
+		}
+		line(point{x, r.y0}, top)
+		line(point{x, r.y1}, bottom)
+	}
+	for y := r.y0 + 1; y < r.y1; y++ {
+		line(point{r.x0, y}, north|south)
+		line(point{r.x1, y}, north|south)
+	}
+}
+
+// path returns the cells a line through points passes, in order. Where two points are
+// not on a row or a column, the line turns once between them.
+func path(points []point) []point {
+	cells := []point{points[0]}
+	for _, p := range points[1:] {
+		last := cells[len(cells)-1]
+		for _, target := range []point{{p.x, last.y}, p} {
+			for at := cells[len(cells)-1]; at != target; cells = append(cells, at) {
+				if at.x != target.x {
+					at.x += sign(target.x - at.x)
+				} else {
+					at.y += sign(target.y - at.y)
+				}
+			}
+		}
+	}
+	return cells
+}
+
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	}
+	return 0
+}
+
+// direction returns the direction of the step from a to the next cell b.
+func direction(a, b point) uint8 {
+	switch {
+	case b.y < a.y:
+		return north
+	case b.x > a.x:
+		return east
+	case b.y > a.y:
+		return south
+	}
+	return west
+}
+
+func opposite(d uint8) uint8 {
+	return (d<<2 | d>>2) & (north | east | south | west)
+}
+
+// arrow draws a along the cells of its path. The line leaves the border of the box it
+// starts at and stops short of the one it ends at, so its arrowhead points at the box.
+func (g *grid) arrow(cells []point, a layout.Arrow, from rect, hasFrom bool, to rect, hasTo bool) {
+	first, last := 0, len(cells)-1
+	for hasFrom && first < last && from.onBorder(cells[first+1]) {
+		first++
+	}
+	for hasTo && last > first && to.onBorder(cells[last]) {
+		last--
+	}
+	if last <= first {
+		return // The boxes touch; there is no room for a line
+	}
+
+	dashed := a.Style == "dashed" || a.Style == "dotted"
+	for i := first; i < last; i++ {
+		d := direction(cells[i], cells[i+1])
+		if c := g.at(cells[i]); c != nil {
+			c.single |= d
+			c.dashed = c.dashed || dashed
+		}
+		if c := g.at(cells[i+1]); c != nil {
+			c.single |= opposite(d)
+			c.dashed = c.dashed || dashed
+		}
+	}
+
+	if a.MarkerEnd {
+		d := direction(cells[last-1], cells[last])
+		if last+1 < len(cells) {
+			d = direction(cells[last], cells[last+1])
+		}
+		if c := g.at(cells[last]); c != nil {
+			c.text = arrowheads[d]
+		}
+	}
+	if a.MarkerStart {
+		// The line starts on the border of its box, if it has one, and the arrowhead
+		// just outside it.
+		at, d := first, opposite(direction(cells[first], cells[first+1]))
+		if hasFrom {
+			at, d = first+1, direction(cells[first+1], cells[first])
+		}
+		if c := g.at(cells[at]); c != nil {
+			c.text = arrowheads[d]
+		}
+	}
+}
+
+// title writes s centred in r, or, for containers, into their top border so it stays
+// clear of what they hold. What does not fit is cut short with an ellipsis.
+func (g *grid) title(r rect, s string, container bool) {
+	s = strings.Join(strings.Fields(s), " ")
+	if container {
+		room := r.x1 - r.x0 - 3 // A border cell on each side, one line cell and a space
+		if room < 3 {
+			return
+		}
+		g.write(point{r.x0 + 2, r.y0}, fit(" "+s+" ", room))
+		return
+	}
+	room := r.x1 - r.x0 - 1
+	if room < 1 {
+		return
+	}
+	text := []rune(fit(s, room))
+	g.write(point{r.x0 + 1 + (room-len(text))/2, (r.y0 + r.y1) / 2}, string(text))
+}
+
+func (g *grid) write(p point, s string) {
+	for _, r := range s {
+		if c := g.at(p); c != nil {
+			c.text = r
+		}
+		p.x++
+	}
+}
+
+// fit cuts s to at most n characters, ending it with an ellipsis if it was cut.
+func fit(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// glyph returns the character drawn in c.
+func (c cell) glyph() rune {
+	switch {
+	case c.text != 0:
+		return c.text
+	case c.single == 0 && c.double == 0:
+		return ' '
+	case c.double == 0:
+		if c.dashed && c.single&(north|south) == 0 {
+			return '┄'
+		}
+		if c.dashed && c.single&(east|west) == 0 {
+			return '┆'
+		}
+		return singleGlyphs[c.single]
+	case c.single == 0:
+		return doubleGlyphs[c.double]
+	}
+	// A single line crossing or leaving a double border.
+	switch {
+	case c.double == east|west && c.single&(east|west) == 0:
+		return map[uint8]rune{south: '╤', north: '╧', north | south: '╪'}[c.single]
+	case c.double == north|south && c.single&(north|south) == 0:
+		return map[uint8]rune{east: '╟', west: '╢', east | west: '╫'}[c.single]
+	}
+	return doubleGlyphs[c.single|c.double]
+}
+
+// String returns the grid as lines of text, cropped to what is drawn on it, each line
+// ending in a newline.
+func (g *grid) String() string {
+	lines := make([]string, g.height)
+	margin := -1
+	for y, row := range g.cells {
+		var b strings.Builder
+		for _, c := range row {
+			b.WriteRune(c.glyph())
+		}
+		lines[y] = strings.TrimRight(b.String(), " ")
+		if lines[y] != "" {
+			indent := len(lines[y]) - len(strings.TrimLeft(lines[y], " "))
+			if margin < 0 || indent < margin {
+				margin = indent
+			}
+		}
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		if line != "" {
+			line = line[margin:] // The margin is spaces, one byte each
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,99 @@
+package textgrid
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/saasuke-labs/nagare/pkg/layout"
+	"github.com/saasuke-labs/nagare/pkg/parser"
+	"github.com/saasuke-labs/nagare/pkg/tokenizer"
+)
+
+const shop = `@layout(w: 600, h: 500)
+web:Server@web
+backend:VM@backend {
+    api:Rectangle@api
+    orders:Database@orders
+}
+web.s --> api.n
+api.s --> orders.n
+web.e --> backend.n
+@web(x: 40, y: 20, w: 200, h: 60, title: "Web")
+@backend(x: 40, y: 120, w: 500, h: 360, title: "Backend")
+@api(x: 20, y: 20, w: 160, h: 60, title: "API")
+@orders(x: 20, y: 140, w: 160, h: 100, title: "Orders")
+`
+
+func layoutOf(t *testing.T, source string) layout.Layout {
+	t.Helper()
+	root, err := parser.Parse(tokenizer.Tokenize(source))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return layout.Calculate(root, 800, 400)
+}
+
+func TestRender(t *testing.T) {
+	got := Render(layoutOf(t, shop), 600, 500, Options{Scale: 0.5})
+	want := `┌───────────┐
+│    Web    ├─┐
+└─────┬─────┘ ▼
+╔═ Backend ════════════════════╗
+║     ▼                        ║
+║┌─────────┐                   ║
+║│   API   │                   ║
+║└────┬────┘                   ║
+║     ▼                        ║
+║┌─────────┐                   ║
+║│ Orders  │                   ║
+║│         │                   ║
+║└─────────┘                   ║
+║                              ║
+╚══════════════════════════════╝
+`
+	if got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestRenderCrossesContainerBorders(t *testing.T) {
+	got := Render(layoutOf(t, shop), 600, 500, Options{})
+	if !strings.Contains(got, "═══╪═══") {
+		t.Errorf("expected the arrow into the container to cross its border:\n%s", got)
+	}
+	if lines := strings.Count(got, "\n"); lines != 30 {
+		t.Errorf("expected 30 lines at scale 1, got %d:\n%s", lines, got)
+	}
+}
+
+func TestRenderArrows(t *testing.T) {
+	l := layout.Layout{Connections: []layout.Arrow{
+		{Start: layout.Point{X: 0, Y: 0}, BendPoints: []layout.Point{{X: 48, Y: 0}}, End: layout.Point{X: 48, Y: 48}, MarkerEnd: true},
+		{Start: layout.Point{X: 0, Y: 64}, End: layout.Point{X: 48, Y: 64}, Style: "dashed", MarkerStart: true, MarkerEnd: true},
+	}}
+	want := `──────┐
+      │
+      │
+      ▼
+◄┄┄┄┄┄►
+`
+	if got := Render(l, 64, 64, Options{}); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestFit(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"Orders", 6, "Orders"},
+		{"Orders", 4, "Ord…"},
+		{"Ünïcode", 3, "Ün…"},
+	} {
+		if got := fit(tc.s, tc.n); got != tc.want {
+			t.Errorf("fit(%q, %d) = %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
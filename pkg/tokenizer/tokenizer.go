@@ -1,6 +1,9 @@
 package tokenizer
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+)
 
 // TokenType represents the type of token
 type TokenType int
@@ -26,99 +29,139 @@ type Token struct {
 	Value string
 }
 
+// Span is the half-open byte range [Start, End) a token occupies in the source.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
 // Tokenize converts input text into a sequence of tokens
 func Tokenize(input string) []Token {
+	tokens, _ := TokenizeWithSpans(input)
+	return tokens
+}
+
+// TokenizeWithSpans converts input text into tokens and returns, for every token, the
+// span it was read from. Offsets are relative to the untrimmed input.
+func TokenizeWithSpans(input string) ([]Token, []Span) {
 	// Handle empty input
+	base := len(input) - len(strings.TrimLeftFunc(input, unicode.IsSpace))
 	input = strings.TrimSpace(input)
 	if input == "" {
-		return []Token{}
+		return []Token{}, []Span{}
 	}
 
 	var tokens []Token
+	var spans []Span
 	var currentWord strings.Builder
+	wordStart := 0
+
+	emit := func(token Token, start, end int) {
+		tokens = append(tokens, token)
+		spans = append(spans, Span{Start: base + start, End: base + end})
+	}
 
 	// Helper to add word token if there's any
-	flushWord := func() {
+	flushWord := func(end int) {
 		if currentWord.Len() > 0 {
-			tokens = append(tokens, Token{
+			emit(Token{
 				Type:  IDENTIFIER,
 				Value: strings.TrimSpace(currentWord.String()),
-			})
+			}, wordStart, end)
 			currentWord.Reset()
 		}
 	}
 
+	// writeWord appends to the current word, remembering where it started.
+	writeWord := func(i int) {
+		if currentWord.Len() == 0 {
+			wordStart = i
+		}
+		currentWord.WriteByte(input[i])
+	}
+
 	for i := 0; i < len(input); i++ {
 		char := input[i]
 		switch char {
 		case '{':
-			flushWord()
-			tokens = append(tokens, Token{Type: LEFT_BRACE})
+			flushWord(i)
+			emit(Token{Type: LEFT_BRACE}, i, i+1)
 		case '}':
-			flushWord()
-			tokens = append(tokens, Token{Type: RIGHT_BRACE})
+			flushWord(i)
+			emit(Token{Type: RIGHT_BRACE}, i, i+1)
 		case ':':
-			flushWord()
-			tokens = append(tokens, Token{Type: COLON})
+			flushWord(i)
+			emit(Token{Type: COLON}, i, i+1)
 		case '@':
-			flushWord()
-			tokens = append(tokens, Token{Type: AT})
+			flushWord(i)
+			emit(Token{Type: AT}, i, i+1)
 		case '(':
-			flushWord()
-			tokens = append(tokens, Token{Type: LEFT_PAREN})
+			flushWord(i)
+			emit(Token{Type: LEFT_PAREN}, i, i+1)
 		case ')':
-			flushWord()
-			tokens = append(tokens, Token{Type: RIGHT_PAREN})
+			flushWord(i)
+			emit(Token{Type: RIGHT_PAREN}, i, i+1)
 		case ',':
-			flushWord()
-			tokens = append(tokens, Token{Type: COMMA})
+			flushWord(i)
+			emit(Token{Type: COMMA}, i, i+1)
 		case '=':
-			flushWord()
-			tokens = append(tokens, Token{Type: EQUALS})
+			flushWord(i)
+			emit(Token{Type: EQUALS}, i, i+1)
 		case '.':
-			flushWord()
-			tokens = append(tokens, Token{Type: DOT})
+			flushWord(i)
+			emit(Token{Type: DOT}, i, i+1)
 		case '&':
-			flushWord()
-			tokens = append(tokens, Token{Type: AMPERSAND})
+			flushWord(i)
+			emit(Token{Type: AMPERSAND}, i, i+1)
 		case '-':
 			if i+2 < len(input) && input[i:i+3] == "-->" {
-				flushWord()
-				tokens = append(tokens, Token{Type: ARROW, Value: "-->"})
+				flushWord(i)
+				emit(Token{Type: ARROW, Value: "-->"}, i, i+3)
 				i += 2
 				continue
 			}
-			currentWord.WriteByte(char)
+			writeWord(i)
 		case '\n':
-			flushWord() // Force a word break on newline
+			flushWord(i) // Force a word break on newline
 		case ' ', '\t':
-			flushWord() // Split on significant whitespace
+			flushWord(i) // Split on significant whitespace
 		default:
 			// Handle string literals
 			if char == '"' || char == '\'' {
-				flushWord()
+				flushWord(i)
 				// Add the opening quote
-				tokens = append(tokens, Token{Type: IDENTIFIER, Value: string(char)})
+				emit(Token{Type: IDENTIFIER, Value: string(char)}, i, i+1)
 				// Get the string content
 				i++
 				for i < len(input) && input[i] != char {
-					currentWord.WriteByte(input[i])
+					writeWord(i)
 					i++
 				}
 				if currentWord.Len() > 0 {
-					tokens = append(tokens, Token{Type: IDENTIFIER, Value: currentWord.String()})
+					emit(Token{Type: IDENTIFIER, Value: currentWord.String()}, wordStart, i)
 					currentWord.Reset()
 				}
 				// Add the closing quote if we found it
 				if i < len(input) {
-					tokens = append(tokens, Token{Type: IDENTIFIER, Value: string(char)})
+					emit(Token{Type: IDENTIFIER, Value: string(char)}, i, i+1)
 				}
 				continue
 			}
-			currentWord.WriteByte(char)
+			writeWord(i)
 		}
 	}
 
-	flushWord() // Flush any remaining word
-	return tokens
+	flushWord(len(input)) // Flush any remaining word
+	return tokens, spans
+}
+
+// Position converts a byte offset in source into a 1-based line and column. Columns
+// count bytes, matching the offsets stored in Span.
+func Position(source string, offset int) (line, column int) {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	line = 1 + strings.Count(source[:offset], "\n")
+	column = offset - strings.LastIndex(source[:offset], "\n")
+	return line, column
 }
@@ -76,3 +76,23 @@ func TestTokenize(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenizeWithSpans(t *testing.T) {
+	input := "  app:Server\n@app(title: \"App\")"
+	tokens, spans := TokenizeWithSpans(input)
+	if len(tokens) != len(spans) {
+		t.Fatalf("expected one span per token, got %d tokens and %d spans", len(tokens), len(spans))
+	}
+
+	expected := []string{"app", ":", "Server", "@", "app", "(", "title", ":", "\"", "App", "\"", ")"}
+	for i, want := range expected {
+		if got := input[spans[i].Start:spans[i].End]; got != want {
+			t.Errorf("span %d = %q, want %q", i, got, want)
+		}
+	}
+
+	line, column := Position(input, spans[4].Start)
+	if line != 2 || column != 2 {
+		t.Errorf("Position() = %d:%d, want 2:2", line, column)
+	}
+}